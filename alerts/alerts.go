@@ -46,6 +46,8 @@ const (
 	AlertTagSystemError = "systemError"
 	AlertTagAosCore     = "aosCore"
 	AlertTagResource    = "resourceAlert"
+	AlertTagCrashLoop   = "serviceCrashLoop"
+	AlertTagEgress      = "serviceEgressDenied"
 	AlertDeviceErrors   = "deviceErrors"
 )
 
@@ -87,6 +89,8 @@ type Alerts struct {
 	journal      *sdjournal.Journal
 	ticker       *time.Ticker
 	closeChannel chan bool
+
+	alertCounts map[string]uint64
 }
 
 /*******************************************************************************
@@ -118,7 +122,7 @@ func New(config *config.Config, serviceProvider ServiceProvider,
 
 	instance = &Alerts{
 		config: config.Alerts, cursorStorage: cursorStorage,
-		serviceProvider: serviceProvider,
+		serviceProvider: serviceProvider, alertCounts: make(map[string]uint64),
 	}
 
 	instance.alertsChannel = make(chan *pb.Alert, alertChannelSize)
@@ -249,6 +253,79 @@ func (instance *Alerts) SendRequestResourceAlert(source string, message string)
 	})
 }
 
+// SendServiceProbeAlert sends service readiness/liveness probe alert.
+func (instance *Alerts) SendServiceProbeAlert(source, probe, message string) {
+	log.WithFields(log.Fields{
+		"source":  source,
+		"probe":   probe,
+		"message": message,
+	}).Debug("Service probe alert")
+
+	instance.pushAlert(&pb.Alert{
+		Timestamp: timestamppb.Now(),
+		Tag:       AlertTagAosCore,
+		Source:    source,
+		Payload: &pb.Alert_SystemAlert{
+			SystemAlert: &pb.SystemAlert{
+				Message: probe + " probe " + message,
+			},
+		},
+	})
+}
+
+// SendServiceCrashLoopAlert sends alert about service instance which repeatedly crashes.
+func (instance *Alerts) SendServiceCrashLoopAlert(source string, restartCount uint64, message string) {
+	log.WithFields(log.Fields{
+		"source":       source,
+		"restartCount": restartCount,
+		"message":      message,
+	}).Debug("Service crash loop alert")
+
+	instance.pushAlert(&pb.Alert{
+		Timestamp: timestamppb.Now(),
+		Tag:       AlertTagCrashLoop,
+		Source:    source,
+		Payload: &pb.Alert_SystemAlert{
+			SystemAlert: &pb.SystemAlert{
+				Message: fmt.Sprintf("crash loop, restarts: %d, %s", restartCount, message),
+			},
+		},
+	})
+}
+
+// SendServiceEgressAlert sends alert about denied service outbound connection.
+func (instance *Alerts) SendServiceEgressAlert(source, message string) {
+	log.WithFields(log.Fields{
+		"source":  source,
+		"message": message,
+	}).Debug("Service egress alert")
+
+	instance.pushAlert(&pb.Alert{
+		Timestamp: timestamppb.Now(),
+		Tag:       AlertTagEgress,
+		Source:    source,
+		Payload: &pb.Alert_SystemAlert{
+			SystemAlert: &pb.SystemAlert{
+				Message: "egress denied, " + message,
+			},
+		},
+	})
+}
+
+// GetAlertCounts returns number of alerts sent since start by alert tag.
+func (instance *Alerts) GetAlertCounts() (counts map[string]uint64) {
+	instance.Lock()
+	defer instance.Unlock()
+
+	counts = make(map[string]uint64, len(instance.alertCounts))
+
+	for tag, count := range instance.alertCounts {
+		counts[tag] = count
+	}
+
+	return counts
+}
+
 /*******************************************************************************
  * Private
  ******************************************************************************/
@@ -429,5 +506,9 @@ func (instance *Alerts) pushAlert(alert *pb.Alert) {
 		return
 	}
 
+	instance.Lock()
+	instance.alertCounts[alert.GetTag()]++
+	instance.Unlock()
+
 	instance.alertsChannel <- alert
 }
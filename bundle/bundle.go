@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bundle loads offline install bundles
+package bundle
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+	"github.com/aoscloud/aos_common/image"
+	log "github.com/sirupsen/logrus"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+// ManifestFileName bundle manifest file name, the manifest is located in the bundle root dir.
+const ManifestFileName = "bundle.json"
+
+const manifestVersion = 1
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// SignatureVerifier verifies detached signature of bundle manifest.
+type SignatureVerifier interface {
+	VerifySignature(fileName string) (err error)
+}
+
+// Bundle offline install bundle content.
+type Bundle struct {
+	Services []*pb.InstallServiceRequest
+	Layers   []*pb.InstallLayerRequest
+	// board config content, empty if board config is not included
+	BoardConfig string
+	Users       []string
+}
+
+// Manifest bundle manifest.
+type Manifest struct {
+	Version     int               `json:"version"`
+	Services    []ServiceManifest `json:"services"`
+	Layers      []LayerManifest   `json:"layers"`
+	BoardConfig string            `json:"boardConfig,omitempty"`
+	Users       []string          `json:"users"`
+}
+
+// FileManifest bundle file info, path is relative to the bundle root dir.
+type FileManifest struct {
+	Path   string `json:"path"`
+	Sha256 string `json:"sha256"`
+	Sha512 string `json:"sha512"`
+	Size   uint64 `json:"size"`
+}
+
+// ServiceManifest bundle service info.
+type ServiceManifest struct {
+	ServiceID     string `json:"serviceId"`
+	ProviderID    string `json:"providerId"`
+	AosVersion    uint64 `json:"aosVersion"`
+	VendorVersion string `json:"vendorVersion"`
+	AlertRules    string `json:"alertRules,omitempty"`
+	Description   string `json:"description,omitempty"`
+	FileManifest
+}
+
+// LayerManifest bundle layer info.
+type LayerManifest struct {
+	LayerID       string `json:"layerId"`
+	Digest        string `json:"digest"`
+	AosVersion    uint64 `json:"aosVersion"`
+	VendorVersion string `json:"vendorVersion"`
+	Description   string `json:"description,omitempty"`
+	FileManifest
+}
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// Load loads bundle from the dir: verifies manifest signature and checks bundle files digests.
+func Load(ctx context.Context, bundleDir string, verifier SignatureVerifier) (bundle *Bundle, err error) {
+	log.WithField("dir", bundleDir).Debug("Load bundle")
+
+	if bundleDir, err = filepath.Abs(bundleDir); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if bundleDir, err = filepath.EvalSymlinks(bundleDir); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	manifestFile := filepath.Join(bundleDir, ManifestFileName)
+
+	if verifier == nil {
+		return nil, aoserrors.New("signature verifier is not set")
+	}
+
+	if err = verifier.VerifySignature(manifestFile); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	manifestData, err := ioutil.ReadFile(manifestFile)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	var manifest Manifest
+
+	if err = json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if manifest.Version != manifestVersion {
+		return nil, aoserrors.Errorf("unsupported bundle version: %d", manifest.Version)
+	}
+
+	bundle = &Bundle{Users: manifest.Users}
+
+	for _, service := range manifest.Services {
+		fileURL, fileInfo, err := checkFile(ctx, bundleDir, service.FileManifest)
+		if err != nil {
+			return nil, aoserrors.Errorf("wrong service %s file: %s", service.ServiceID, err)
+		}
+
+		bundle.Services = append(bundle.Services, &pb.InstallServiceRequest{
+			Users:         &pb.Users{Users: manifest.Users},
+			Url:           fileURL,
+			ServiceId:     service.ServiceID,
+			ProviderId:    service.ProviderID,
+			AosVersion:    service.AosVersion,
+			VendorVersion: service.VendorVersion,
+			AlertRules:    service.AlertRules,
+			Description:   service.Description,
+			Sha256:        fileInfo.Sha256,
+			Sha512:        fileInfo.Sha512,
+			Size:          fileInfo.Size,
+		})
+	}
+
+	for _, layer := range manifest.Layers {
+		fileURL, fileInfo, err := checkFile(ctx, bundleDir, layer.FileManifest)
+		if err != nil {
+			return nil, aoserrors.Errorf("wrong layer %s file: %s", layer.Digest, err)
+		}
+
+		bundle.Layers = append(bundle.Layers, &pb.InstallLayerRequest{
+			Url:           fileURL,
+			LayerId:       layer.LayerID,
+			AosVersion:    layer.AosVersion,
+			VendorVersion: layer.VendorVersion,
+			Digest:        layer.Digest,
+			Description:   layer.Description,
+			Sha256:        fileInfo.Sha256,
+			Sha512:        fileInfo.Sha512,
+			Size:          fileInfo.Size,
+		})
+	}
+
+	if manifest.BoardConfig != "" {
+		fileName, err := getBundleFile(bundleDir, manifest.BoardConfig)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		boardConfig, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		bundle.BoardConfig = string(boardConfig)
+	}
+
+	log.WithFields(log.Fields{
+		"services": len(bundle.Services), "layers": len(bundle.Layers),
+	}).Debug("Bundle loaded")
+
+	return bundle, nil
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func checkFile(ctx context.Context, bundleDir string,
+	fileManifest FileManifest) (fileURL string, fileInfo image.FileInfo, err error) {
+	fileName, err := getBundleFile(bundleDir, fileManifest.Path)
+	if err != nil {
+		return "", fileInfo, aoserrors.Wrap(err)
+	}
+
+	fileInfo.Size = fileManifest.Size
+
+	if fileInfo.Sha256, err = hex.DecodeString(fileManifest.Sha256); err != nil {
+		return "", fileInfo, aoserrors.Wrap(err)
+	}
+
+	if fileInfo.Sha512, err = hex.DecodeString(fileManifest.Sha512); err != nil {
+		return "", fileInfo, aoserrors.Wrap(err)
+	}
+
+	if err = image.CheckFileInfo(ctx, fileName, fileInfo); err != nil {
+		return "", fileInfo, aoserrors.Wrap(err)
+	}
+
+	return (&url.URL{Scheme: "file", Path: fileName}).String(), fileInfo, nil
+}
+
+func getBundleFile(bundleDir, relPath string) (fileName string, err error) {
+	if relPath == "" || filepath.IsAbs(relPath) {
+		return "", aoserrors.Errorf("bundle file path should be relative: %s", relPath)
+	}
+
+	fileName = filepath.Join(bundleDir, relPath)
+
+	if !strings.HasPrefix(fileName, bundleDir+string(filepath.Separator)) {
+		return "", aoserrors.Errorf("bundle file is out of bundle dir: %s", relPath)
+	}
+
+	// bundle dir is resolved, so symlinks can't point outside of it
+	if fileName, err = filepath.EvalSymlinks(fileName); err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	if !strings.HasPrefix(fileName, bundleDir+string(filepath.Separator)) {
+		return "", aoserrors.Errorf("bundle file is out of bundle dir: %s", relPath)
+	}
+
+	return fileName, nil
+}
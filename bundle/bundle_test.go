@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/image"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_servicemanager/bundle"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+type testVerifier struct {
+	signed map[string]bool
+}
+
+/*******************************************************************************
+ * Vars
+ ******************************************************************************/
+
+var tmpDir string
+
+/*******************************************************************************
+ * Main
+ ******************************************************************************/
+
+func TestMain(m *testing.M) {
+	var err error
+
+	if tmpDir, err = ioutil.TempDir("", "bundle_"); err != nil {
+		log.Fatalf("Can't create tmp dir: %s", err)
+	}
+
+	ret := m.Run()
+
+	os.RemoveAll(tmpDir)
+
+	os.Exit(ret)
+}
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestLoad(t *testing.T) {
+	verifier := &testVerifier{signed: make(map[string]bool)}
+
+	manifest := bundle.Manifest{
+		Version: 1,
+		Services: []bundle.ServiceManifest{{
+			ServiceID: "service1", ProviderID: "sp1", AosVersion: 1,
+			FileManifest: createBundleFile(t, "services/service1.tar.gz", "service image"),
+		}},
+		Layers: []bundle.LayerManifest{{
+			LayerID: "layer1", Digest: "sha256:1", AosVersion: 2,
+			FileManifest: createBundleFile(t, "layers/layer1.tar.gz", "layer image"),
+		}},
+		BoardConfig: createBundleFile(t, "board_config.json", `{"vendorVersion": "1.0"}`).Path,
+		Users:       []string{"subject1"},
+	}
+
+	writeManifest(t, manifest)
+
+	if _, err := bundle.Load(context.Background(), tmpDir, verifier); err == nil {
+		t.Error("Error expected for not signed bundle")
+	}
+
+	verifier.signed[path.Join(tmpDir, bundle.ManifestFileName)] = true
+
+	installBundle, err := bundle.Load(context.Background(), tmpDir, verifier)
+	if err != nil {
+		t.Fatalf("Can't load bundle: %s", err)
+	}
+
+	if len(installBundle.Services) != 1 || installBundle.Services[0].ServiceId != "service1" ||
+		installBundle.Services[0].Url != "file://"+path.Join(tmpDir, "services/service1.tar.gz") ||
+		len(installBundle.Services[0].Users.Users) != 1 || installBundle.Services[0].Users.Users[0] != "subject1" {
+		t.Errorf("Wrong bundle services: %v", installBundle.Services)
+	}
+
+	if len(installBundle.Layers) != 1 || installBundle.Layers[0].Digest != "sha256:1" ||
+		installBundle.Layers[0].Size != uint64(len("layer image")) {
+		t.Errorf("Wrong bundle layers: %v", installBundle.Layers)
+	}
+
+	if installBundle.BoardConfig != `{"vendorVersion": "1.0"}` {
+		t.Errorf("Wrong board config: %s", installBundle.BoardConfig)
+	}
+
+	// corrupted service image
+	if err = ioutil.WriteFile(path.Join(tmpDir, "services/service1.tar.gz"),
+		[]byte("service imagE"), 0o600); err != nil {
+		t.Fatalf("Can't write file: %s", err)
+	}
+
+	if _, err = bundle.Load(context.Background(), tmpDir, verifier); err == nil {
+		t.Error("Error expected for wrong file digest")
+	}
+
+	manifest.Services = nil
+	manifest.BoardConfig = "../board_config.json"
+
+	writeManifest(t, manifest)
+
+	if _, err = bundle.Load(context.Background(), tmpDir, verifier); err == nil {
+		t.Error("Error expected for file out of bundle dir")
+	}
+
+	// symlink out of bundle dir
+	if err = os.Symlink("/etc/passwd", path.Join(tmpDir, "link.json")); err != nil {
+		t.Fatalf("Can't create symlink: %s", err)
+	}
+
+	manifest.BoardConfig = "link.json"
+
+	writeManifest(t, manifest)
+
+	if _, err = bundle.Load(context.Background(), tmpDir, verifier); err == nil {
+		t.Error("Error expected for symlink out of bundle dir")
+	}
+}
+
+/*******************************************************************************
+ * Interfaces
+ ******************************************************************************/
+
+func (verifier *testVerifier) VerifySignature(fileName string) (err error) {
+	if !verifier.signed[fileName] {
+		return aoserrors.New("signature not found")
+	}
+
+	return nil
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func createBundleFile(t *testing.T, relPath, content string) (fileManifest bundle.FileManifest) {
+	t.Helper()
+
+	fileName := path.Join(tmpDir, relPath)
+
+	if err := os.MkdirAll(path.Dir(fileName), 0o755); err != nil {
+		t.Fatalf("Can't create dir: %s", err)
+	}
+
+	if err := ioutil.WriteFile(fileName, []byte(content), 0o600); err != nil {
+		t.Fatalf("Can't write file: %s", err)
+	}
+
+	fileInfo, err := image.CreateFileInfo(context.Background(), fileName)
+	if err != nil {
+		t.Fatalf("Can't create file info: %s", err)
+	}
+
+	return bundle.FileManifest{
+		Path:   relPath,
+		Sha256: hex.EncodeToString(fileInfo.Sha256),
+		Sha512: hex.EncodeToString(fileInfo.Sha512),
+		Size:   fileInfo.Size,
+	}
+}
+
+func writeManifest(t *testing.T, manifest bundle.Manifest) {
+	t.Helper()
+
+	data, err := json.Marshal(&manifest)
+	if err != nil {
+		t.Fatalf("Can't marshal manifest: %s", err)
+	}
+
+	if err = ioutil.WriteFile(path.Join(tmpDir, bundle.ManifestFileName), data, 0o600); err != nil {
+		t.Fatalf("Can't write manifest: %s", err)
+	}
+}
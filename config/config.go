@@ -55,16 +55,24 @@ type AlertRule struct {
 	MaxThreshold uint64   `json:"maxThreshold"`
 }
 
+// MonitoringHistory configuration for local monitoring history.
+type MonitoringHistory struct {
+	MaxSamples            uint64   `json:"maxSamples"`
+	DownsamplePeriod      Duration `json:"downsamplePeriod"`
+	MaxDownsampledSamples uint64   `json:"maxDownsampledSamples"`
+}
+
 // Monitoring configuration for system monitoring.
 type Monitoring struct {
-	Disabled   bool       `json:"disabled"`
-	SendPeriod Duration   `json:"sendPeriod"`
-	PollPeriod Duration   `json:"pollPeriod"`
-	RAM        *AlertRule `json:"ram"`
-	CPU        *AlertRule `json:"cpu"`
-	UsedDisk   *AlertRule `json:"usedDisk"`
-	InTraffic  *AlertRule `json:"inTraffic"`
-	OutTraffic *AlertRule `json:"outTraffic"`
+	Disabled   bool              `json:"disabled"`
+	SendPeriod Duration          `json:"sendPeriod"`
+	PollPeriod Duration          `json:"pollPeriod"`
+	RAM        *AlertRule        `json:"ram"`
+	CPU        *AlertRule        `json:"cpu"`
+	UsedDisk   *AlertRule        `json:"usedDisk"`
+	InTraffic  *AlertRule        `json:"inTraffic"`
+	OutTraffic *AlertRule        `json:"outTraffic"`
+	History    MonitoringHistory `json:"history"`
 }
 
 // Logging configuration for system and service logging.
@@ -93,26 +101,66 @@ type Migration struct {
 	MergedMigrationPath string `json:"mergedMigrationPath"`
 }
 
+// Downloader download manager configuration.
+type Downloader struct {
+	DownloadDir            string   `json:"downloadDir"`
+	MaxConcurrentDownloads int      `json:"maxConcurrentDownloads"`
+	MaxBandwidth           uint64   `json:"maxBandwidth"`
+	RetryDelay             Duration `json:"retryDelay"`
+	MaxRetries             int      `json:"maxRetries"`
+	PartialFileTTL         Duration `json:"partialFileTTL"`
+}
+
+// StorageEncryption service storage encryption configuration.
+type StorageEncryption struct {
+	Enabled bool   `json:"enabled"`
+	KeyType string `json:"keyType"`
+}
+
+// NetworkPool service network address pool: base network split to subnets of size prefix length.
+type NetworkPool struct {
+	Base string `json:"base"`
+	Size int    `json:"size"`
+}
+
+// Network service network configuration.
+type Network struct {
+	IPv6           bool          `json:"ipv6"`
+	IPv6Prefix     string        `json:"ipv6Prefix"`
+	Pools          []NetworkPool `json:"pools"`
+	ExcludedRanges []string      `json:"excludedRanges"`
+}
+
 // Config instance.
 type Config struct {
-	CACert                    string     `json:"caCert"`
-	SMServerURL               string     `json:"smServerUrl"`
-	CertStorage               string     `json:"certStorage"`
-	IAMServerURL              string     `json:"iamServer"`
-	IAMPublicServerURL        string     `json:"iamPublicServer"`
-	WorkingDir                string     `json:"workingDir"`
-	StorageDir                string     `json:"storageDir"`
-	LayersDir                 string     `json:"layersDir"`
-	BoardConfigFile           string     `json:"boardConfigFile"`
-	DefaultServiceTTLDays     uint64     `json:"defaultServiceTtlDays"`
-	ServiceHealthCheckTimeout Duration   `json:"serviceHealthCheckTimeout"`
-	Monitoring                Monitoring `json:"monitoring"`
-	Logging                   Logging    `json:"logging"`
-	Alerts                    Alerts     `json:"alerts"`
-	HostBinds                 []string   `json:"hostBinds"`
-	Hosts                     []Host     `json:"hosts,omitempty"`
-	Migration                 Migration  `json:"migration"`
-	Runner                    string     `json:"runner"`
+	CACert                    string            `json:"caCert"`
+	SMServerURL               string            `json:"smServerUrl"`
+	MetricsServerURL          string            `json:"metricsServerUrl"`
+	NotificationQueueSize     uint64            `json:"notificationQueueSize"`
+	CertStorage               string            `json:"certStorage"`
+	IAMServerURL              string            `json:"iamServer"`
+	IAMPublicServerURL        string            `json:"iamPublicServer"`
+	WorkingDir                string            `json:"workingDir"`
+	StorageDir                string            `json:"storageDir"`
+	LayersDir                 string            `json:"layersDir"`
+	BoardConfigFile           string            `json:"boardConfigFile"`
+	BackupDir                 string            `json:"backupDir"`
+	BundleDir                 string            `json:"bundleDir"`
+	DefaultServiceTTLDays     uint64            `json:"defaultServiceTtlDays"`
+	ServiceHealthCheckTimeout Duration          `json:"serviceHealthCheckTimeout"`
+	Monitoring                Monitoring        `json:"monitoring"`
+	Logging                   Logging           `json:"logging"`
+	Alerts                    Alerts            `json:"alerts"`
+	HostBinds                 []string          `json:"hostBinds"`
+	Hosts                     []Host            `json:"hosts,omitempty"`
+	Network                   Network           `json:"network"`
+	Migration                 Migration         `json:"migration"`
+	Downloader                Downloader        `json:"downloader"`
+	ImageSignaturePolicy      string            `json:"imageSignaturePolicy"`
+	StorageEncryption         StorageEncryption `json:"storageEncryption"`
+	StateHistorySize          int               `json:"stateHistorySize"`
+	Runner                    string            `json:"runner"`
+	RuntimeBackend            string            `json:"runtimeBackend"`
 }
 
 /*******************************************************************************
@@ -130,9 +178,18 @@ func New(fileName string) (config *Config, err error) {
 		DefaultServiceTTLDays:     30, // nolint:gomnd
 		ServiceHealthCheckTimeout: Duration{35 * time.Second},
 		Runner:                    "runc",
+		ImageSignaturePolicy:      "enforce",
+		StateHistorySize:          3, // nolint:gomnd
+		RuntimeBackend:            "systemd",
+		NotificationQueueSize:     10000, // nolint:gomnd
 		Monitoring: Monitoring{
 			SendPeriod: Duration{1 * time.Minute},
 			PollPeriod: Duration{10 * time.Second},
+			History: MonitoringHistory{
+				MaxSamples:            1440, // nolint:gomnd
+				DownsamplePeriod:      Duration{10 * time.Minute},
+				MaxDownsampledSamples: 4320, // nolint:gomnd
+			},
 		},
 		Logging: Logging{
 			MaxPartSize:  524288, // nolint:gomnd
@@ -142,6 +199,15 @@ func New(fileName string) (config *Config, err error) {
 			SystemAlertPriority:  defaultSystemAlertPriority,
 			ServiceAlertPriority: defaultServiceAlertPriority,
 		},
+		Network: Network{
+			IPv6Prefix: "fd00:a05::/48",
+		},
+		Downloader: Downloader{
+			MaxConcurrentDownloads: 2, // nolint:gomnd
+			RetryDelay:             Duration{10 * time.Second},
+			MaxRetries:             5, // nolint:gomnd
+			PartialFileTTL:         Duration{24 * time.Hour},
+		},
 	}
 
 	if err = json.Unmarshal(raw, &config); err != nil {
@@ -152,6 +218,10 @@ func New(fileName string) (config *Config, err error) {
 		config.CertStorage = "/var/aos/crypt/sm/"
 	}
 
+	if config.StorageEncryption.KeyType == "" {
+		config.StorageEncryption.KeyType = config.CertStorage
+	}
+
 	if config.StorageDir == "" {
 		config.StorageDir = path.Join(config.WorkingDir, "storages")
 	}
@@ -164,6 +234,18 @@ func New(fileName string) (config *Config, err error) {
 		config.BoardConfigFile = path.Join(config.WorkingDir, "aos_board.cfg")
 	}
 
+	if config.BackupDir == "" {
+		config.BackupDir = path.Join(config.WorkingDir, "backup")
+	}
+
+	if config.BundleDir == "" {
+		config.BundleDir = path.Join(config.WorkingDir, "bundle")
+	}
+
+	if config.Downloader.DownloadDir == "" {
+		config.Downloader.DownloadDir = path.Join(config.WorkingDir, "download")
+	}
+
 	if config.Migration.MigrationPath == "" {
 		config.Migration.MigrationPath = "/usr/share/aos/servicemanager/migration"
 	}
@@ -40,6 +40,8 @@ func createConfigFile() (err error) {
 	configContent := `{
 	"CACert" : "CACert",	
 	"smServerUrl": "smserver",
+	"metricsServerUrl": "localhost:9100",
+	"notificationQueueSize": 100,
 	"workingDir" : "workingDir",
 	"certStorage": "sm",
 	"storageDir" : "/var/aos/storage",
@@ -49,6 +51,20 @@ func createConfigFile() (err error) {
 	"iamPublicServer" : "localhost:8090",
 	"defaultServiceTTLDays" : 30,
 	"serviceHealthCheckTimeout": "10s",
+	"runner": "crun",
+	"runtimeBackend": "runner",
+	"imageSignaturePolicy": "enforce",
+	"stateHistorySize": 5,
+	"network": {
+		"ipv6": true,
+		"ipv6Prefix": "fd12:3456:789a::/48",
+		"pools": [{"base": "10.100.0.0/16", "size": 24}],
+		"excludedRanges": ["10.100.10.0/24"]
+	},
+	"storageEncryption": {
+		"enabled": true,
+		"keyType": "storage"
+	},
 	"monitoring": {
 		"sendPeriod": "00:05:00",
 		"pollPeriod": "00:00:01",		
@@ -61,6 +77,10 @@ func createConfigFile() (err error) {
 			"minTimeout": "00:00:20",
 			"minThreshold": 10,
 			"maxThreshold": 150
+		},
+		"history": {
+			"maxSamples": 100,
+			"downsamplePeriod": "00:30:00"
 		}
 	},
 	"logging": {
@@ -85,6 +105,11 @@ func createConfigFile() (err error) {
 	"migration": {
 		"migrationPath" : "/usr/share/aos_servicemnager/migration",
 		"mergedMigrationPath" : "/var/aos/servicemanager/mergedMigration"
+	},
+	"downloader": {
+		"maxConcurrentDownloads": 4,
+		"maxBandwidth": 1048576,
+		"retryDelay": "30s"
 	}
 }`
 
@@ -159,6 +184,28 @@ func TestSMServerURL(t *testing.T) {
 	}
 }
 
+func TestMetricsServerURL(t *testing.T) {
+	config, err := config.New("tmp/aos_servicemanager.cfg")
+	if err != nil {
+		t.Fatalf("Error opening config file: %s", err)
+	}
+
+	if config.MetricsServerURL != "localhost:9100" {
+		t.Errorf("Wrong metricsServerUrl value: %s", config.MetricsServerURL)
+	}
+}
+
+func TestNotificationQueueSize(t *testing.T) {
+	config, err := config.New("tmp/aos_servicemanager.cfg")
+	if err != nil {
+		t.Fatalf("Error opening config file: %s", err)
+	}
+
+	if config.NotificationQueueSize != 100 {
+		t.Errorf("Wrong notificationQueueSize value: %d", config.NotificationQueueSize)
+	}
+}
+
 func TestGetWorkingDir(t *testing.T) {
 	config, err := config.New("tmp/aos_servicemanager.cfg")
 	if err != nil {
@@ -203,6 +250,28 @@ func TestGetLayersDir(t *testing.T) {
 	}
 }
 
+func TestGetBackupDir(t *testing.T) {
+	config, err := config.New("tmp/aos_servicemanager.cfg")
+	if err != nil {
+		t.Fatalf("Error opening config file: %s", err)
+	}
+
+	if config.BackupDir != "workingDir/backup" {
+		t.Errorf("Wrong backupDir value: %s", config.BackupDir)
+	}
+}
+
+func TestGetBundleDir(t *testing.T) {
+	config, err := config.New("tmp/aos_servicemanager.cfg")
+	if err != nil {
+		t.Fatalf("Error opening config file: %s", err)
+	}
+
+	if config.BundleDir != "workingDir/bundle" {
+		t.Errorf("Wrong bundleDir value: %s", config.BundleDir)
+	}
+}
+
 func TestGetIAMServerURL(t *testing.T) {
 	config, err := config.New("tmp/aos_servicemanager.cfg")
 	if err != nil {
@@ -270,6 +339,18 @@ func TestGetMonitoringConfig(t *testing.T) {
 	if config.Monitoring.OutTraffic.MinTimeout.Duration != 20*time.Second {
 		t.Errorf("Wrong value: %s", config.Monitoring.RAM.MinTimeout)
 	}
+
+	if config.Monitoring.History.MaxSamples != 100 {
+		t.Errorf("Wrong history max samples value: %d", config.Monitoring.History.MaxSamples)
+	}
+
+	if config.Monitoring.History.DownsamplePeriod.Duration != 30*time.Minute {
+		t.Errorf("Wrong history downsample period value: %s", config.Monitoring.History.DownsamplePeriod)
+	}
+
+	if config.Monitoring.History.MaxDownsampledSamples != 4320 {
+		t.Errorf("Wrong history max downsampled samples value: %d", config.Monitoring.History.MaxDownsampledSamples)
+	}
 }
 
 func TestGetLoggingConfig(t *testing.T) {
@@ -376,3 +457,110 @@ func TestServiceHealthCheckTimeout(t *testing.T) {
 		t.Errorf("Wrong ServiceHealthCheckTimeout value: %s", config.ServiceHealthCheckTimeout.String())
 	}
 }
+
+func TestRuntimeBackend(t *testing.T) {
+	config, err := config.New("tmp/aos_servicemanager.cfg")
+	if err != nil {
+		t.Fatalf("Error opening config file: %s", err)
+	}
+
+	if config.Runner != "crun" {
+		t.Errorf("Wrong Runner value: %s", config.Runner)
+	}
+
+	if config.RuntimeBackend != "runner" {
+		t.Errorf("Wrong RuntimeBackend value: %s", config.RuntimeBackend)
+	}
+}
+
+func TestDownloaderConfig(t *testing.T) {
+	config, err := config.New("tmp/aos_servicemanager.cfg")
+	if err != nil {
+		t.Fatalf("Error opening config file: %s", err)
+	}
+
+	if config.Downloader.DownloadDir != "workingDir/download" {
+		t.Errorf("Wrong download dir value: %s", config.Downloader.DownloadDir)
+	}
+
+	if config.Downloader.MaxConcurrentDownloads != 4 {
+		t.Errorf("Wrong max concurrent downloads value: %d", config.Downloader.MaxConcurrentDownloads)
+	}
+
+	if config.Downloader.MaxBandwidth != 1048576 {
+		t.Errorf("Wrong max bandwidth value: %d", config.Downloader.MaxBandwidth)
+	}
+
+	if config.Downloader.RetryDelay.Duration != 30*time.Second {
+		t.Errorf("Wrong retry delay value: %s", config.Downloader.RetryDelay.String())
+	}
+
+	if config.Downloader.MaxRetries != 5 {
+		t.Errorf("Wrong max retries value: %d", config.Downloader.MaxRetries)
+	}
+
+	if config.Downloader.PartialFileTTL.Duration != 24*time.Hour {
+		t.Errorf("Wrong partial file TTL value: %s", config.Downloader.PartialFileTTL.String())
+	}
+}
+
+func TestImageSignaturePolicy(t *testing.T) {
+	config, err := config.New("tmp/aos_servicemanager.cfg")
+	if err != nil {
+		t.Fatalf("Error opening config file: %s", err)
+	}
+
+	if config.ImageSignaturePolicy != "enforce" {
+		t.Errorf("Wrong image signature policy value: %s", config.ImageSignaturePolicy)
+	}
+}
+
+func TestStorageEncryption(t *testing.T) {
+	config, err := config.New("tmp/aos_servicemanager.cfg")
+	if err != nil {
+		t.Fatalf("Error opening config file: %s", err)
+	}
+
+	if !config.StorageEncryption.Enabled {
+		t.Error("Storage encryption should be enabled")
+	}
+
+	if config.StorageEncryption.KeyType != "storage" {
+		t.Errorf("Wrong storage encryption key type: %s", config.StorageEncryption.KeyType)
+	}
+}
+
+func TestStateHistorySize(t *testing.T) {
+	config, err := config.New("tmp/aos_servicemanager.cfg")
+	if err != nil {
+		t.Fatalf("Error opening config file: %s", err)
+	}
+
+	if config.StateHistorySize != 5 {
+		t.Errorf("Wrong state history size: %d", config.StateHistorySize)
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	config, err := config.New("tmp/aos_servicemanager.cfg")
+	if err != nil {
+		t.Fatalf("Error opening config file: %s", err)
+	}
+
+	if !config.Network.IPv6 {
+		t.Error("IPv6 should be enabled")
+	}
+
+	if config.Network.IPv6Prefix != "fd12:3456:789a::/48" {
+		t.Errorf("Wrong IPv6 prefix: %s", config.Network.IPv6Prefix)
+	}
+
+	if len(config.Network.Pools) != 1 || config.Network.Pools[0].Base != "10.100.0.0/16" ||
+		config.Network.Pools[0].Size != 24 {
+		t.Errorf("Wrong network pools: %v", config.Network.Pools)
+	}
+
+	if len(config.Network.ExcludedRanges) != 1 || config.Network.ExcludedRanges[0] != "10.100.10.0/24" {
+		t.Errorf("Wrong excluded ranges: %v", config.Network.ExcludedRanges)
+	}
+}
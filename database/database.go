@@ -31,8 +31,12 @@ import (
 	"github.com/aoscloud/aos_common/migration"
 	_ "github.com/mattn/go-sqlite3" //ignore lint
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/aoscloud/aos_servicemanager/launcher"
+	"github.com/aoscloud/aos_servicemanager/monitoring"
+	"github.com/aoscloud/aos_servicemanager/networkmanager"
+	"github.com/aoscloud/aos_servicemanager/smserver"
 )
 
 /*******************************************************************************
@@ -45,7 +49,7 @@ const (
 	syncMode    = "NORMAL"
 )
 
-const dbVersion = 5
+const dbVersion = 13
 
 /*******************************************************************************
  * Vars
@@ -163,7 +167,7 @@ func (db *Database) UpdateService(service launcher.Service) (err error) {
 	return aoserrors.Wrap(err)
 }
 
-// RemoveService removes existing service.
+// RemoveService removes existing service and its layer references.
 func (db *Database) RemoveService(serviceID string) (err error) {
 	stmt, err := db.sql.Prepare("DELETE FROM services WHERE id = ?")
 	if err != nil {
@@ -171,7 +175,11 @@ func (db *Database) RemoveService(serviceID string) (err error) {
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(serviceID)
+	if _, err = stmt.Exec(serviceID); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	_, err = db.sql.Exec("DELETE FROM layerrefs WHERE serviceId = ?", serviceID)
 
 	return aoserrors.Wrap(err)
 }
@@ -247,15 +255,16 @@ func (db *Database) GetServiceProviderServices(serviceProvider string) (services
 	return services, aoserrors.Wrap(rows.Err())
 }
 
-// GetServiceByUnitName returns service by systemd unit name.
+// GetServiceByUnitName returns service by systemd unit name of the service or its instance.
 func (db *Database) GetServiceByUnitName(unitName string) (service launcher.Service, err error) {
-	stmt, err := db.sql.Prepare("SELECT * FROM services WHERE unit = ?")
+	stmt, err := db.sql.Prepare(
+		"SELECT * FROM services WHERE unit = ? OR id IN (SELECT serviceid FROM instances WHERE unit = ?)")
 	if err != nil {
 		return service, aoserrors.Wrap(err)
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRow(unitName).Scan(&service.ID, &service.AosVersion, &service.ServiceProvider, &service.Path,
+	err = stmt.QueryRow(unitName, unitName).Scan(&service.ID, &service.AosVersion, &service.ServiceProvider, &service.Path,
 		&service.UnitName, &service.UID, &service.GID, &service.State,
 		&service.StartAt, &service.AlertRules, &service.VendorVersion, &service.Description, &service.ManifestDigest)
 	if err != nil && errors.Is(err, sql.ErrNoRows) {
@@ -319,51 +328,41 @@ func (db *Database) SetServiceStartTime(serviceID string, time time.Time) (err e
 	return aoserrors.Wrap(err)
 }
 
-// AddServiceToUsers adds service ID to users.
-func (db *Database) AddServiceToUsers(users []string, serviceID string) (err error) {
-	stmt, err := db.sql.Prepare("INSERT INTO users values(?, ?, ?, ?, ?)")
+// AddSubjectService adds service to subject.
+func (db *Database) AddSubjectService(subjectService launcher.SubjectService) (err error) {
+	stmt, err := db.sql.Prepare("INSERT INTO instances values(?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 	defer stmt.Close()
 
-	usersJSON, err := json.Marshal(users)
-	if err != nil {
-		return aoserrors.Wrap(err)
-	}
-
-	_, err = stmt.Exec(usersJSON, serviceID, "", []byte{}, "")
+	_, err = stmt.Exec(subjectService.SubjectID, subjectService.ServiceID, subjectService.UnitName,
+		subjectService.StorageFolder, subjectService.StateChecksum, "")
 
 	return aoserrors.Wrap(err)
 }
 
-// RemoveServiceFromUsers removes service ID from users.
-func (db *Database) RemoveServiceFromUsers(users []string, serviceID string) (err error) {
-	stmt, err := db.sql.Prepare("DELETE FROM users WHERE users = ? AND serviceid = ?")
+// RemoveSubjectService removes service from subject.
+func (db *Database) RemoveSubjectService(subjectID, serviceID string) (err error) {
+	stmt, err := db.sql.Prepare("DELETE FROM instances WHERE subjectid = ? AND serviceid = ?")
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 	defer stmt.Close()
 
-	usersJSON, err := json.Marshal(users)
-	if err != nil {
+	if _, err = stmt.Exec(subjectID, serviceID); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	_, err = stmt.Exec(usersJSON, serviceID)
+	_, err = db.sql.Exec("DELETE FROM restarts WHERE subjectid = ? AND serviceid = ?", subjectID, serviceID)
 
 	return aoserrors.Wrap(err)
 }
 
-// SetUsersStorageFolder sets users storage folder.
-func (db *Database) SetUsersStorageFolder(users []string, serviceID string, storageFolder string) (err error) {
-	usersJSON, err := json.Marshal(users)
-	if err != nil {
-		return aoserrors.Wrap(err)
-	}
-
-	result, err := db.sql.Exec("UPDATE users SET storageFolder = ? WHERE users = ? AND serviceid = ?",
-		storageFolder, usersJSON, serviceID)
+// SetSubjectStorageFolder sets subject service storage folder.
+func (db *Database) SetSubjectStorageFolder(subjectID, serviceID, storageFolder string) (err error) {
+	result, err := db.sql.Exec("UPDATE instances SET storageFolder = ? WHERE subjectid = ? AND serviceid = ?",
+		storageFolder, subjectID, serviceID)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
@@ -380,15 +379,10 @@ func (db *Database) SetUsersStorageFolder(users []string, serviceID string, stor
 	return nil
 }
 
-// SetUsersStateChecksum sets users state checksum.
-func (db *Database) SetUsersStateChecksum(users []string, serviceID string, checksum []byte) (err error) {
-	usersJSON, err := json.Marshal(users)
-	if err != nil {
-		return aoserrors.Wrap(err)
-	}
-
-	result, err := db.sql.Exec("UPDATE users SET stateCheckSum = ? WHERE users = ? AND serviceid = ?",
-		checksum, usersJSON, serviceID)
+// SetSubjectStateChecksum sets subject service state checksum.
+func (db *Database) SetSubjectStateChecksum(subjectID, serviceID string, checksum []byte) (err error) {
+	result, err := db.sql.Exec("UPDATE instances SET stateCheckSum = ? WHERE subjectid = ? AND serviceid = ?",
+		checksum, subjectID, serviceID)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
@@ -405,115 +399,122 @@ func (db *Database) SetUsersStateChecksum(users []string, serviceID string, chec
 	return nil
 }
 
-// GetUsersService returns users service.
-func (db *Database) GetUsersService(users []string, serviceID string) (usersService launcher.UsersService, err error) {
-	usersJSON, err := json.Marshal(users)
-	if err != nil {
-		return usersService, aoserrors.Wrap(err)
-	}
-
-	rows, err := db.sql.Query("SELECT storageFolder, stateCheckSum FROM users WHERE users = ? AND serviceid = ?",
-		usersJSON, serviceID)
+// GetSubjectService returns subject service.
+func (db *Database) GetSubjectService(subjectID, serviceID string) (subjectService launcher.SubjectService,
+	err error) {
+	rows, err := db.sql.Query(
+		"SELECT unit, storageFolder, stateCheckSum FROM instances WHERE subjectid = ? AND serviceid = ?",
+		subjectID, serviceID)
 	if err != nil {
-		return usersService, aoserrors.Wrap(err)
+		return subjectService, aoserrors.Wrap(err)
 	}
 	defer rows.Close()
 
 	if rows.Err() != nil {
-		return usersService, aoserrors.Wrap(rows.Err())
+		return subjectService, aoserrors.Wrap(rows.Err())
 	}
 
 	if !rows.Next() {
-		return usersService, ErrNotExist
+		return subjectService, ErrNotExist
 	}
 
-	if err = rows.Scan(&usersService.StorageFolder, &usersService.StateChecksum); err != nil {
-		return usersService, aoserrors.Wrap(err)
+	if err = rows.Scan(&subjectService.UnitName, &subjectService.StorageFolder,
+		&subjectService.StateChecksum); err != nil {
+		return subjectService, aoserrors.Wrap(err)
 	}
 
-	usersService.Users = users
-	usersService.ServiceID = serviceID
+	subjectService.SubjectID = subjectID
+	subjectService.ServiceID = serviceID
 
-	return usersService, nil
+	return subjectService, nil
 }
 
-// GetUsersServicesByServiceID returns users services by service ID.
-func (db *Database) GetUsersServicesByServiceID(serviceID string) (usersServices []launcher.UsersService, err error) {
-	rows, err := db.sql.Query("SELECT users, storageFolder, stateCheckSum FROM users WHERE serviceid = ?", serviceID)
+// GetSubjectServicesByServiceID returns subject services by service ID.
+func (db *Database) GetSubjectServicesByServiceID(serviceID string) (subjectServices []launcher.SubjectService,
+	err error) {
+	rows, err := db.sql.Query(
+		"SELECT subjectid, unit, storageFolder, stateCheckSum FROM instances WHERE serviceid = ?", serviceID)
 	if err != nil {
-		return usersServices, aoserrors.Wrap(err)
+		return subjectServices, aoserrors.Wrap(err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		usersService := launcher.UsersService{ServiceID: serviceID}
-		usersJSON := []byte{}
-
-		if err = rows.Scan(&usersJSON, &usersService.StorageFolder, &usersService.StateChecksum); err != nil {
-			return usersServices, aoserrors.Wrap(err)
-		}
+		subjectService := launcher.SubjectService{ServiceID: serviceID}
 
-		if err = json.Unmarshal(usersJSON, &usersService.Users); err != nil {
-			return usersServices, aoserrors.Wrap(err)
+		if err = rows.Scan(&subjectService.SubjectID, &subjectService.UnitName, &subjectService.StorageFolder,
+			&subjectService.StateChecksum); err != nil {
+			return subjectServices, aoserrors.Wrap(err)
 		}
 
-		usersServices = append(usersServices, usersService)
+		subjectServices = append(subjectServices, subjectService)
 	}
 
-	return usersServices, aoserrors.Wrap(rows.Err())
+	return subjectServices, aoserrors.Wrap(rows.Err())
 }
 
-// GetUsersServices returns list of users services.
-func (db *Database) GetUsersServices(users []string) (usersServices []launcher.Service, err error) {
-	usersJSON, err := json.Marshal(users)
-	if err != nil {
-		return nil, aoserrors.Wrap(err)
-	}
-
-	rows, err := db.sql.Query("SELECT * FROM services WHERE id IN (SELECT serviceid FROM users WHERE users = ?)",
-		usersJSON)
+// GetSubjectServices returns list of subject services.
+func (db *Database) GetSubjectServices(subjectID string) (subjectServices []launcher.Service, err error) {
+	rows, err := db.sql.Query("SELECT * FROM services WHERE id IN (SELECT serviceid FROM instances WHERE subjectid = ?)",
+		subjectID)
 	if err != nil {
-		return usersServices, aoserrors.Wrap(err)
+		return subjectServices, aoserrors.Wrap(err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var service launcher.Service
 
-		err = rows.Scan(&service.ID, &service.AosVersion, &service.ServiceProvider, &service.Path,
+		if err = rows.Scan(&service.ID, &service.AosVersion, &service.ServiceProvider, &service.Path,
 			&service.UnitName, &service.UID, &service.GID, &service.State,
-			&service.StartAt, &service.AlertRules, &service.VendorVersion, &service.Description, &service.ManifestDigest)
-		if err != nil {
-			return usersServices, aoserrors.Wrap(err)
+			&service.StartAt, &service.AlertRules, &service.VendorVersion, &service.Description,
+			&service.ManifestDigest); err != nil {
+			return subjectServices, aoserrors.Wrap(err)
 		}
 
-		usersServices = append(usersServices, service)
+		subjectServices = append(subjectServices, service)
 	}
 
-	return usersServices, aoserrors.Wrap(rows.Err())
+	return subjectServices, aoserrors.Wrap(rows.Err())
 }
 
-// RemoveServiceFromAllUsers removes service from all users.
-func (db *Database) RemoveServiceFromAllUsers(serviceID string) (err error) {
-	stmt, err := db.sql.Prepare("DELETE FROM users WHERE serviceid = ?")
+// RemoveServiceFromAllSubjects removes service from all subjects.
+func (db *Database) RemoveServiceFromAllSubjects(serviceID string) (err error) {
+	stmt, err := db.sql.Prepare("DELETE FROM instances WHERE serviceid = ?")
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(serviceID)
+	if _, err = stmt.Exec(serviceID); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	_, err = db.sql.Exec("DELETE FROM restarts WHERE serviceid = ?", serviceID)
 
 	return aoserrors.Wrap(err)
 }
 
-// UpdateOverrideEnvVars add/update/remove overrides env vars.
-func (db *Database) UpdateOverrideEnvVars(users []string, serviceID string, vars []*pb.EnvVarInfo) (err error) {
-	// TODO: Currunt version support only one user. Should be re-implemented
-	usersJSON, err := json.Marshal(users)
-	if err != nil {
-		return aoserrors.Wrap(err)
+// SetSubjectRestartCount sets number of subject service restarts.
+func (db *Database) SetSubjectRestartCount(subjectID, serviceID string, restartCount uint64) (err error) {
+	_, err = db.sql.Exec("INSERT OR REPLACE INTO restarts values(?, ?, ?)", subjectID, serviceID, restartCount)
+
+	return aoserrors.Wrap(err)
+}
+
+// GetSubjectRestartCount returns number of subject service restarts.
+func (db *Database) GetSubjectRestartCount(subjectID, serviceID string) (restartCount uint64, err error) {
+	err = db.sql.QueryRow("SELECT count FROM restarts WHERE subjectid = ? AND serviceid = ?",
+		subjectID, serviceID).Scan(&restartCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
 	}
 
+	return restartCount, aoserrors.Wrap(err)
+}
+
+// UpdateOverrideEnvVars add/update/remove overrides env vars.
+func (db *Database) UpdateOverrideEnvVars(subjectID, serviceID string, vars []*pb.EnvVarInfo) (err error) {
 	varsText := ""
 
 	if len(vars) > 0 {
@@ -525,8 +526,8 @@ func (db *Database) UpdateOverrideEnvVars(users []string, serviceID string, vars
 		varsText = string(varsJSON)
 	}
 
-	result, err := db.sql.Exec("UPDATE users SET overrideEnvVars = ? WHERE users = ? AND serviceid = ?",
-		varsText, usersJSON, serviceID)
+	result, err := db.sql.Exec("UPDATE instances SET overrideEnvVars = ? WHERE subjectid = ? AND serviceid = ?",
+		varsText, subjectID, serviceID)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
@@ -545,7 +546,7 @@ func (db *Database) UpdateOverrideEnvVars(users []string, serviceID string, vars
 
 // GetAllOverrideEnvVars returns list of env vars for services.
 func (db *Database) GetAllOverrideEnvVars() (vars []pb.OverrideEnvVar, err error) {
-	rows, err := db.sql.Query("SELECT users, serviceid, overrideEnvVars FROM users")
+	rows, err := db.sql.Query("SELECT subjectid, serviceid, overrideEnvVars FROM instances")
 	if err != nil {
 		return vars, aoserrors.Wrap(err)
 	}
@@ -557,26 +558,14 @@ func (db *Database) GetAllOverrideEnvVars() (vars []pb.OverrideEnvVar, err error
 
 	for rows.Next() {
 		varsText := ""
-		usersText := ""
-		users := []string{}
 
 		var envVar pb.OverrideEnvVar
 
-		err = rows.Scan(&usersText, &envVar.ServiceId, &varsText)
+		err = rows.Scan(&envVar.SubjectId, &envVar.ServiceId, &varsText)
 		if err != nil {
 			return vars, aoserrors.Wrap(err)
 		}
 
-		if err = json.Unmarshal([]byte(usersText), &users); err != nil {
-			return vars, aoserrors.Wrap(err)
-		}
-
-		if len(users) < 1 {
-			return vars, aoserrors.Wrap(ErrNotExist)
-		}
-
-		envVar.SubjectId = users[0] // TODO: currently support only one user
-
 		if varsText != "" {
 			if err = json.Unmarshal([]byte(varsText), &envVar.Vars); err != nil {
 				return vars, aoserrors.Wrap(err)
@@ -644,6 +633,222 @@ func (db *Database) RemoveTrafficMonitorData(chain string) (err error) {
 	return aoserrors.Wrap(err)
 }
 
+// SetNetwork stores service provider network subnets.
+func (db *Database) SetNetwork(network networkmanager.NetworkInfo) (err error) {
+	_, err = db.sql.Exec("INSERT OR REPLACE INTO networks values(?, ?, ?)",
+		network.SpID, network.Subnet, network.IPv6Subnet)
+
+	return aoserrors.Wrap(err)
+}
+
+// RemoveNetwork removes service provider network subnets.
+func (db *Database) RemoveNetwork(spID string) (err error) {
+	_, err = db.sql.Exec("DELETE FROM networks WHERE spid = ?", spID)
+
+	return aoserrors.Wrap(err)
+}
+
+// GetNetworks returns subnets of all service provider networks.
+func (db *Database) GetNetworks() (networks []networkmanager.NetworkInfo, err error) {
+	rows, err := db.sql.Query("SELECT spid, subnet, ipv6subnet FROM networks ORDER BY spid")
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var network networkmanager.NetworkInfo
+
+		if err = rows.Scan(&network.SpID, &network.Subnet, &network.IPv6Subnet); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, aoserrors.Wrap(rows.Err())
+}
+
+// SetServiceIP stores service IP addresses reservation.
+func (db *Database) SetServiceIP(serviceIP networkmanager.ServiceIPInfo) (err error) {
+	_, err = db.sql.Exec("INSERT OR REPLACE INTO serviceips values(?, ?, ?, ?)",
+		serviceIP.ServiceID, serviceIP.SpID, serviceIP.IP, serviceIP.IPv6)
+
+	return aoserrors.Wrap(err)
+}
+
+// RemoveServiceIP removes service IP addresses reservation.
+func (db *Database) RemoveServiceIP(serviceID string) (err error) {
+	_, err = db.sql.Exec("DELETE FROM serviceips WHERE serviceid = ?", serviceID)
+
+	return aoserrors.Wrap(err)
+}
+
+// GetServiceIPs returns IP addresses reservations of all services.
+func (db *Database) GetServiceIPs() (serviceIPs []networkmanager.ServiceIPInfo, err error) {
+	rows, err := db.sql.Query("SELECT serviceid, spid, ip, ipv6 FROM serviceips ORDER BY serviceid")
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var serviceIP networkmanager.ServiceIPInfo
+
+		if err = rows.Scan(&serviceIP.ServiceID, &serviceIP.SpID, &serviceIP.IP, &serviceIP.IPv6); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		serviceIPs = append(serviceIPs, serviceIP)
+	}
+
+	return serviceIPs, aoserrors.Wrap(rows.Err())
+}
+
+// AddMonitoringData adds monitoring data sample to the history of specified level and removes
+// the oldest samples to keep not more than maxSamples.
+func (db *Database) AddMonitoringData(level int, sample monitoring.HistorySample, maxSamples uint64) (err error) {
+	rawData, err := proto.Marshal(sample.Data)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	instancesJSON, err := json.Marshal(sample.InstanceIDs)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec("INSERT OR REPLACE INTO monitoring values(?, ?, ?, ?)",
+		level, sample.Data.GetTimestamp().AsTime().UnixNano(), rawData, instancesJSON); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if _, err = tx.Exec(`DELETE FROM monitoring WHERE level = ? AND timestamp <= (
+		SELECT timestamp FROM monitoring WHERE level = ? ORDER BY timestamp DESC LIMIT 1 OFFSET ?)`,
+		level, level, maxSamples); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return aoserrors.Wrap(tx.Commit())
+}
+
+// GetMonitoringData returns monitoring data samples of specified level within time range.
+func (db *Database) GetMonitoringData(
+	level int, from, till time.Time) (samples []monitoring.HistorySample, err error) {
+	rows, err := db.sql.Query("SELECT data, instances FROM monitoring "+
+		"WHERE level = ? AND timestamp >= ? AND timestamp <= ? ORDER BY timestamp",
+		level, from.UnixNano(), till.UnixNano())
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			rawData       []byte
+			instancesJSON sql.NullString
+		)
+
+		if err = rows.Scan(&rawData, &instancesJSON); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		sample := monitoring.HistorySample{Data: &pb.Monitoring{}}
+
+		if err = proto.Unmarshal(rawData, sample.Data); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		// samples stored before instance IDs were added don't have them
+		if instancesJSON.Valid {
+			if err = json.Unmarshal([]byte(instancesJSON.String), &sample.InstanceIDs); err != nil {
+				return nil, aoserrors.Wrap(err)
+			}
+		}
+
+		samples = append(samples, sample)
+	}
+
+	return samples, aoserrors.Wrap(rows.Err())
+}
+
+// AddNotification adds notification to the outbound queue and returns its sequence number. The oldest
+// notifications are removed to keep not more than maxCount notifications in the queue.
+func (db *Database) AddNotification(data []byte, maxCount uint64) (seq uint64, err error) {
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	result, err := tx.Exec("INSERT INTO notifications (data) values(?)", data)
+	if err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	if _, err = tx.Exec(`DELETE FROM notifications WHERE seq <= (
+		SELECT seq FROM notifications ORDER BY seq DESC LIMIT 1 OFFSET ?)`, maxCount); err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	return uint64(id), nil
+}
+
+// GetNotifications returns up to limit queued notifications with sequence number greater than fromSeq.
+func (db *Database) GetNotifications(
+	fromSeq uint64, limit uint64) (notifications []smserver.DurableNotification, err error) {
+	rows, err := db.sql.Query("SELECT seq, data FROM notifications WHERE seq > ? ORDER BY seq LIMIT ?",
+		fromSeq, limit)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var notification smserver.DurableNotification
+
+		if err = rows.Scan(&notification.Seq, &notification.Data); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, aoserrors.Wrap(rows.Err())
+}
+
+// RemoveNotifications removes notifications with sequence number less or equal to tillSeq.
+func (db *Database) RemoveNotifications(tillSeq uint64) (err error) {
+	_, err = db.sql.Exec("DELETE FROM notifications WHERE seq <= ?", tillSeq)
+
+	return aoserrors.Wrap(err)
+}
+
 // SetJournalCursor stores system logger cursor.
 func (db *Database) SetJournalCursor(cursor string) (err error) {
 	result, err := db.sql.Exec("UPDATE config SET cursor = ?", cursor)
@@ -773,6 +978,53 @@ func (db *Database) GetLayerInfoByDigest(digest string) (layer pb.LayerStatus, e
 	return layer, nil // nolint
 }
 
+// SetServiceLayers replaces layers referenced by the service.
+func (db *Database) SetServiceLayers(serviceID string, digests []string) (err error) {
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec("DELETE FROM layerrefs WHERE serviceId = ?", serviceID); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	for _, digest := range digests {
+		if _, err = tx.Exec("INSERT OR IGNORE INTO layerrefs values(?, ?)", serviceID, digest); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return aoserrors.Wrap(tx.Commit())
+}
+
+// GetLayerServices returns IDs of services which reference the layer.
+func (db *Database) GetLayerServices(digest string) (serviceIDs []string, err error) {
+	rows, err := db.sql.Query("SELECT serviceId FROM layerrefs WHERE digest = ?", digest)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var serviceID string
+
+		if err = rows.Scan(&serviceID); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		serviceIDs = append(serviceIDs, serviceID)
+	}
+
+	return serviceIDs, aoserrors.Wrap(rows.Err())
+}
+
 // Close closes database.
 func (db *Database) Close() {
 	db.sql.Close()
@@ -843,7 +1095,7 @@ func newDatabase(name string, migrationPath string, mergedMigrationPath string,
 		return db, aoserrors.Wrap(err)
 	}
 
-	if err := db.createUsersTable(); err != nil {
+	if err := db.createInstancesTable(); err != nil {
 		return db, aoserrors.Wrap(err)
 	}
 
@@ -855,6 +1107,30 @@ func newDatabase(name string, migrationPath string, mergedMigrationPath string,
 		return db, aoserrors.Wrap(err)
 	}
 
+	if err := db.createMonitoringTable(); err != nil {
+		return db, aoserrors.Wrap(err)
+	}
+
+	if err := db.createNotificationsTable(); err != nil {
+		return db, aoserrors.Wrap(err)
+	}
+
+	if err := db.createLayerRefsTable(); err != nil {
+		return db, aoserrors.Wrap(err)
+	}
+
+	if err := db.createRestartsTable(); err != nil {
+		return db, aoserrors.Wrap(err)
+	}
+
+	if err := db.createNetworksTable(); err != nil {
+		return db, aoserrors.Wrap(err)
+	}
+
+	if err := db.createServiceIPsTable(); err != nil {
+		return db, aoserrors.Wrap(err)
+	}
+
 	return db, nil
 }
 
@@ -919,15 +1195,16 @@ func (db *Database) createServiceTable() (err error) {
 	return aoserrors.Wrap(err)
 }
 
-func (db *Database) createUsersTable() (err error) {
-	log.Info("Create users table")
+func (db *Database) createInstancesTable() (err error) {
+	log.Info("Create instances table")
 
-	_, err = db.sql.Exec(`CREATE TABLE IF NOT EXISTS users (users TEXT NOT NULL,
-															serviceid TEXT NOT NULL,
-															storageFolder TEXT,
-															stateCheckSum BLOB,
-															overrideEnvVars TEXT,
-															PRIMARY KEY(users, serviceid))`)
+	_, err = db.sql.Exec(`CREATE TABLE IF NOT EXISTS instances (subjectid TEXT NOT NULL,
+																serviceid TEXT NOT NULL,
+																unit TEXT,
+																storageFolder TEXT,
+																stateCheckSum BLOB,
+																overrideEnvVars TEXT,
+																PRIMARY KEY(subjectid, serviceid))`)
 
 	return aoserrors.Wrap(err)
 }
@@ -956,14 +1233,77 @@ func (db *Database) createLayersTable() (err error) {
 	return aoserrors.Wrap(err)
 }
 
+func (db *Database) createMonitoringTable() (err error) {
+	log.Info("Create monitoring table")
+
+	_, err = db.sql.Exec(`CREATE TABLE IF NOT EXISTS monitoring (level INTEGER NOT NULL,
+																 timestamp INTEGER NOT NULL,
+																 data BLOB,
+																 instances TEXT,
+																 PRIMARY KEY(level, timestamp))`)
+
+	return aoserrors.Wrap(err)
+}
+
+func (db *Database) createNotificationsTable() (err error) {
+	log.Info("Create notifications table")
+
+	_, err = db.sql.Exec(`CREATE TABLE IF NOT EXISTS notifications (seq INTEGER PRIMARY KEY AUTOINCREMENT,
+																	data BLOB)`)
+
+	return aoserrors.Wrap(err)
+}
+
+func (db *Database) createLayerRefsTable() (err error) {
+	log.Info("Create layer references table")
+
+	_, err = db.sql.Exec(`CREATE TABLE IF NOT EXISTS layerrefs (serviceId TEXT NOT NULL,
+																digest TEXT NOT NULL,
+																PRIMARY KEY(serviceId, digest))`)
+
+	return aoserrors.Wrap(err)
+}
+
+func (db *Database) createRestartsTable() (err error) {
+	log.Info("Create restarts table")
+
+	_, err = db.sql.Exec(`CREATE TABLE IF NOT EXISTS restarts (subjectid TEXT NOT NULL,
+															   serviceid TEXT NOT NULL,
+															   count INTEGER,
+															   PRIMARY KEY(subjectid, serviceid))`)
+
+	return aoserrors.Wrap(err)
+}
+
+func (db *Database) createNetworksTable() (err error) {
+	log.Info("Create networks table")
+
+	_, err = db.sql.Exec(`CREATE TABLE IF NOT EXISTS networks (spid TEXT NOT NULL PRIMARY KEY,
+															   subnet TEXT,
+															   ipv6subnet TEXT)`)
+
+	return aoserrors.Wrap(err)
+}
+
+func (db *Database) createServiceIPsTable() (err error) {
+	log.Info("Create service IPs table")
+
+	_, err = db.sql.Exec(`CREATE TABLE IF NOT EXISTS serviceips (serviceid TEXT NOT NULL PRIMARY KEY,
+																 spid TEXT,
+																 ip TEXT,
+																 ipv6 TEXT)`)
+
+	return aoserrors.Wrap(err)
+}
+
 func (db *Database) removeAllServices() (err error) {
 	_, err = db.sql.Exec("DELETE FROM services")
 
 	return aoserrors.Wrap(err)
 }
 
-func (db *Database) removeAllUsers() (err error) {
-	_, err = db.sql.Exec("DELETE FROM users")
+func (db *Database) removeAllInstances() (err error) {
+	_, err = db.sql.Exec("DELETE FROM instances")
 
 	return aoserrors.Wrap(err)
 }
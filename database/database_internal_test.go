@@ -26,6 +26,7 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"sort"
 	"strconv"
 	"sync"
 	"testing"
@@ -37,6 +38,8 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/aoscloud/aos_servicemanager/launcher"
+	"github.com/aoscloud/aos_servicemanager/monitoring"
+	"github.com/aoscloud/aos_servicemanager/networkmanager"
 )
 
 /*******************************************************************************
@@ -392,7 +395,7 @@ func TestGetServiceProviderServices(t *testing.T) {
 	}
 }
 
-func TestAddUsersService(t *testing.T) {
+func TestAddSubjectService(t *testing.T) {
 	// Add services
 	service1 := launcher.Service{
 		ID: "service1", AosVersion: 1, VendorVersion: "", ServiceProvider: "sp1",
@@ -412,19 +415,23 @@ func TestAddUsersService(t *testing.T) {
 		t.Errorf("Can't add service: %s", err)
 	}
 
-	// Add service to users
-	if err := db.AddServiceToUsers([]string{"user1"}, "service1"); err != nil {
-		t.Errorf("Can't add users service: %s", err)
+	// Add service to subjects
+	if err := db.AddSubjectService(launcher.SubjectService{SubjectID: "user1", ServiceID: "service1"}); err != nil {
+		t.Errorf("Can't add subject service: %s", err)
 	}
 
-	if err := db.AddServiceToUsers([]string{"user2"}, "service2"); err != nil {
-		t.Errorf("Can't add users service: %s", err)
+	if err := db.AddSubjectService(launcher.SubjectService{SubjectID: "user2", ServiceID: "service2"}); err != nil {
+		t.Errorf("Can't add subject service: %s", err)
+	}
+
+	if err := db.AddSubjectService(launcher.SubjectService{SubjectID: "user2", ServiceID: "service1"}); err != nil {
+		t.Errorf("Can't add subject service: %s", err)
 	}
 
 	// Check user1
-	services, err := db.GetUsersServices([]string{"user1"})
+	services, err := db.GetSubjectServices("user1")
 	if err != nil {
-		t.Errorf("Can't get users services: %s", err)
+		t.Errorf("Can't get subject services: %s", err)
 	}
 
 	if len(services) != 1 {
@@ -436,112 +443,109 @@ func TestAddUsersService(t *testing.T) {
 	}
 
 	// Check user2
-	services, err = db.GetUsersServices([]string{"user2"})
+	services, err = db.GetSubjectServices("user2")
 	if err != nil {
-		t.Errorf("Can't get users services: %s", err)
+		t.Errorf("Can't get subject services: %s", err)
 	}
 
-	if len(services) != 1 {
+	if len(services) != 2 {
 		t.Error("Wrong service count")
 	}
 
-	if services[0].ID != "service2" {
-		t.Errorf("Wrong service id: %s", services[0].ID)
-	}
-
 	// Clear DB
 	if err = db.removeAllServices(); err != nil {
 		t.Errorf("Can't remove all services: %s", err)
 	}
 
-	if err = db.removeAllUsers(); err != nil {
-		t.Errorf("Can't remove all users: %s", err)
+	if err = db.removeAllInstances(); err != nil {
+		t.Errorf("Can't remove all instances: %s", err)
 	}
 }
 
-func TestAddSameUsersService(t *testing.T) {
+func TestAddSameSubjectService(t *testing.T) {
 	// Add service
-	err := db.AddServiceToUsers([]string{"user0", "user1"}, "service1")
+	err := db.AddSubjectService(launcher.SubjectService{SubjectID: "user0", ServiceID: "service1"})
 	if err != nil {
-		t.Errorf("Can't add users service: %s", err)
+		t.Errorf("Can't add subject service: %s", err)
 	}
 
 	// Add service
-	err = db.AddServiceToUsers([]string{"user0", "user1"}, "service1")
+	err = db.AddSubjectService(launcher.SubjectService{SubjectID: "user0", ServiceID: "service1"})
 	if err == nil {
-		t.Error("Error adding same users service")
+		t.Error("Error adding same subject service")
 	}
 
 	// Clear DB
-	if err = db.removeAllUsers(); err != nil {
-		t.Errorf("Can't remove all users: %s", err)
+	if err = db.removeAllInstances(); err != nil {
+		t.Errorf("Can't remove all instances: %s", err)
 	}
 }
 
-func TestNotExistUsersServices(t *testing.T) {
+func TestNotExistSubjectServices(t *testing.T) {
 	// GetService
-	_, err := db.GetUsersService([]string{"user2", "user3"}, "service18")
+	_, err := db.GetSubjectService("user2", "service18")
 	if err != nil && !errors.Is(err, ErrNotExist) {
-		t.Fatalf("Can't check if service in users: %s", err)
+		t.Fatalf("Can't check if service in subject: %s", err)
 	}
 
 	if err == nil {
-		t.Errorf("Error users service: %s", err)
+		t.Errorf("Error subject service: %s", err)
 	}
 }
 
-func TestRemoveUsersService(t *testing.T) {
+func TestRemoveSubjectService(t *testing.T) {
 	// Add service
-	err := db.AddServiceToUsers([]string{"user0", "user1"}, "service1")
+	err := db.AddSubjectService(launcher.SubjectService{SubjectID: "user0", ServiceID: "service1"})
 	if err != nil {
-		t.Errorf("Can't add users service: %s", err)
+		t.Errorf("Can't add subject service: %s", err)
 	}
 
 	// Remove service
-	err = db.RemoveServiceFromUsers([]string{"user0", "user1"}, "service1")
+	err = db.RemoveSubjectService("user0", "service1")
 	if err != nil {
-		t.Errorf("Can't remove users service: %s", err)
+		t.Errorf("Can't remove subject service: %s", err)
 	}
 
-	_, err = db.GetUsersService([]string{"user0", "user1"}, "service1")
+	_, err = db.GetSubjectService("user0", "service1")
 	if err != nil && !errors.Is(err, ErrNotExist) {
-		t.Fatalf("Can't check if service in users: %s", err)
+		t.Fatalf("Can't check if service in subject: %s", err)
 	}
 
 	if err == nil {
-		t.Errorf("Error users service: %s", err)
+		t.Errorf("Error subject service: %s", err)
 	}
 }
 
-func TestAddUsersList(t *testing.T) {
-	numUsers := 5
+func TestAddSubjectsList(t *testing.T) {
+	numSubjects := 5
 	numServices := 3
 
-	for i := 0; i < numUsers; i++ {
-		users := []string{fmt.Sprintf("user%d", i)}
+	for i := 0; i < numSubjects; i++ {
 		for j := 0; j < numServices; j++ {
-			err := db.AddServiceToUsers(users, fmt.Sprintf("service%d", j))
+			err := db.AddSubjectService(launcher.SubjectService{
+				SubjectID: fmt.Sprintf("user%d", i), ServiceID: fmt.Sprintf("service%d", j),
+			})
 			if err != nil {
-				t.Errorf("Can't add users service: %s", err)
+				t.Errorf("Can't add subject service: %s", err)
 			}
 		}
 	}
 
-	// Check users list
-	usersList, err := db.getUsersList()
+	// Check subjects list
+	subjectsList, err := db.getSubjectsList()
 	if err != nil {
-		t.Fatalf("Can't get users list: %s", err)
+		t.Fatalf("Can't get subjects list: %s", err)
 	}
 
-	if len(usersList) != numUsers {
-		t.Fatal("Wrong users count")
+	if len(subjectsList) != numSubjects {
+		t.Fatal("Wrong subjects count")
 	}
 
-	for _, users := range usersList {
+	for _, subject := range subjectsList {
 		ok := false
 
-		for i := 0; i < numUsers; i++ {
-			if users[0] == fmt.Sprintf("user%d", i) {
+		for i := 0; i < numSubjects; i++ {
+			if subject == fmt.Sprintf("user%d", i) {
 				ok = true
 
 				break
@@ -549,27 +553,31 @@ func TestAddUsersList(t *testing.T) {
 		}
 
 		if !ok {
-			t.Errorf("Invalid users: %s", users)
+			t.Errorf("Invalid subject: %s", subject)
 		}
 	}
 
 	for j := 0; j < numServices; j++ {
 		serviceID := fmt.Sprintf("service%d", j)
 
-		usersServices, err := db.GetUsersServicesByServiceID(serviceID)
+		subjectServices, err := db.GetSubjectServicesByServiceID(serviceID)
 		if err != nil {
-			t.Errorf("Can't get users services: %s", err)
+			t.Errorf("Can't get subject services: %s", err)
+		}
+
+		if len(subjectServices) != numSubjects {
+			t.Errorf("Wrong subject services count: %d", len(subjectServices))
 		}
 
-		for _, userService := range usersServices {
-			if userService.ServiceID != serviceID {
-				t.Errorf("Invalid serviceID: %s", userService.ServiceID)
+		for _, subjectService := range subjectServices {
+			if subjectService.ServiceID != serviceID {
+				t.Errorf("Invalid serviceID: %s", subjectService.ServiceID)
 			}
 
 			ok := false
 
-			for i := 0; i < numUsers; i++ {
-				if userService.Users[0] == fmt.Sprintf("user%d", i) {
+			for i := 0; i < numSubjects; i++ {
+				if subjectService.SubjectID == fmt.Sprintf("user%d", i) {
 					ok = true
 
 					break
@@ -577,75 +585,211 @@ func TestAddUsersList(t *testing.T) {
 			}
 
 			if !ok {
-				t.Errorf("Invalid users: %s", userService.Users)
+				t.Errorf("Invalid subject: %s", subjectService.SubjectID)
 			}
 		}
 
-		err = db.RemoveServiceFromAllUsers(serviceID)
+		err = db.RemoveServiceFromAllSubjects(serviceID)
 		if err != nil {
-			t.Errorf("Can't delete users: %s", err)
+			t.Errorf("Can't delete subjects: %s", err)
 		}
 	}
 
-	usersList, err = db.getUsersList()
+	subjectsList, err = db.getSubjectsList()
 	if err != nil {
-		t.Fatalf("Can't get users list: %s", err)
+		t.Fatalf("Can't get subjects list: %s", err)
 	}
 
-	if len(usersList) != 0 {
-		t.Fatal("Wrong users count")
+	if len(subjectsList) != 0 {
+		t.Fatal("Wrong subjects count")
 	}
 
 	// Clear DB
-	if err = db.removeAllUsers(); err != nil {
-		t.Errorf("Can't remove all users: %s", err)
+	if err = db.removeAllInstances(); err != nil {
+		t.Errorf("Can't remove all instances: %s", err)
 	}
 }
 
-func TestUsersStorage(t *testing.T) {
-	// Add users service
-	err := db.AddServiceToUsers([]string{"user1"}, "service1")
+func TestSubjectStorage(t *testing.T) {
+	// Add subject service
+	err := db.AddSubjectService(launcher.SubjectService{
+		SubjectID: "user1", ServiceID: "service1", UnitName: "service1_user1.service",
+	})
 	if err != nil {
-		t.Errorf("Can't add users service: %s", err)
+		t.Errorf("Can't add subject service: %s", err)
 	}
 
 	// Check default values
-	usersService, err := db.GetUsersService([]string{"user1"}, "service1")
+	subjectService, err := db.GetSubjectService("user1", "service1")
 	if err != nil {
-		t.Errorf("Can't get users service: %s", err)
+		t.Errorf("Can't get subject service: %s", err)
 	}
 
-	if usersService.StorageFolder != "" || len(usersService.StateChecksum) != 0 {
-		t.Error("Wrong users service value")
+	if subjectService.StorageFolder != "" || len(subjectService.StateChecksum) != 0 ||
+		subjectService.UnitName != "service1_user1.service" {
+		t.Error("Wrong subject service value")
 	}
 
-	if err = db.SetUsersStorageFolder([]string{"user1"}, "service1", "stateFolder1"); err != nil {
-		t.Errorf("Can't set users storage folder: %s", err)
+	if err = db.SetSubjectStorageFolder("user1", "service1", "stateFolder1"); err != nil {
+		t.Errorf("Can't set subject storage folder: %s", err)
 	}
 
-	if err = db.SetUsersStateChecksum([]string{"user1"}, "service1", []byte{0, 1, 2, 3, 4, 5}); err != nil {
-		t.Errorf("Can't set users state checksum: %s", err)
+	if err = db.SetSubjectStateChecksum("user1", "service1", []byte{0, 1, 2, 3, 4, 5}); err != nil {
+		t.Errorf("Can't set subject state checksum: %s", err)
 	}
 
-	usersService, err = db.GetUsersService([]string{"user1"}, "service1")
+	subjectService, err = db.GetSubjectService("user1", "service1")
 	if err != nil {
-		t.Errorf("Can't get users service: %s", err)
+		t.Errorf("Can't get subject service: %s", err)
+	}
+
+	if subjectService.StorageFolder != "stateFolder1" ||
+		!reflect.DeepEqual(subjectService.StateChecksum, []byte{0, 1, 2, 3, 4, 5}) {
+		t.Error("Wrong subject service value")
 	}
 
-	if usersService.StorageFolder != "stateFolder1" ||
-		!reflect.DeepEqual(usersService.StateChecksum, []byte{0, 1, 2, 3, 4, 5}) {
-		t.Error("Wrong users service value")
+	if err = db.SetSubjectStorageFolder("user2", "service1", "stateFolder2"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Should be error: %s", ErrNotExist)
 	}
 
 	// Clear DB
-	if err = db.removeAllUsers(); err != nil {
-		t.Errorf("Can't remove all users: %s", err)
+	if err = db.removeAllInstances(); err != nil {
+		t.Errorf("Can't remove all instances: %s", err)
+	}
+}
+
+func TestSubjectRestartCount(t *testing.T) {
+	if err := db.AddSubjectService(launcher.SubjectService{SubjectID: "user1", ServiceID: "service1"}); err != nil {
+		t.Fatalf("Can't add subject service: %s", err)
+	}
+
+	restartCount, err := db.GetSubjectRestartCount("user1", "service1")
+	if err != nil {
+		t.Fatalf("Can't get restart count: %s", err)
+	}
+
+	if restartCount != 0 {
+		t.Errorf("Wrong restart count: %d", restartCount)
+	}
+
+	for i := uint64(1); i <= 2; i++ {
+		if err = db.SetSubjectRestartCount("user1", "service1", i); err != nil {
+			t.Fatalf("Can't set restart count: %s", err)
+		}
+	}
+
+	if restartCount, err = db.GetSubjectRestartCount("user1", "service1"); err != nil {
+		t.Fatalf("Can't get restart count: %s", err)
+	}
+
+	if restartCount != 2 {
+		t.Errorf("Wrong restart count: %d", restartCount)
+	}
+
+	if err = db.RemoveSubjectService("user1", "service1"); err != nil {
+		t.Fatalf("Can't remove subject service: %s", err)
+	}
+
+	if restartCount, err = db.GetSubjectRestartCount("user1", "service1"); err != nil {
+		t.Fatalf("Can't get restart count: %s", err)
+	}
+
+	if restartCount != 0 {
+		t.Errorf("Restart count should be removed with subject service: %d", restartCount)
+	}
+}
+
+func TestNetworks(t *testing.T) {
+	testNetworks := []networkmanager.NetworkInfo{
+		{SpID: "sp1", Subnet: "172.17.0.0/16"},
+		{SpID: "sp2", Subnet: "172.18.0.0/16", IPv6Subnet: "fd00:a05:0:1::/64"},
+	}
+
+	for _, network := range testNetworks {
+		if err := db.SetNetwork(network); err != nil {
+			t.Fatalf("Can't set network: %s", err)
+		}
+	}
+
+	testNetworks[0].Subnet = "172.19.0.0/16"
+
+	if err := db.SetNetwork(testNetworks[0]); err != nil {
+		t.Fatalf("Can't set network: %s", err)
+	}
+
+	networks, err := db.GetNetworks()
+	if err != nil {
+		t.Fatalf("Can't get networks: %s", err)
+	}
+
+	if !reflect.DeepEqual(networks, testNetworks) {
+		t.Errorf("Wrong networks: %v", networks)
+	}
+
+	for _, network := range testNetworks {
+		if err = db.RemoveNetwork(network.SpID); err != nil {
+			t.Fatalf("Can't remove network: %s", err)
+		}
+	}
+
+	if networks, err = db.GetNetworks(); err != nil {
+		t.Fatalf("Can't get networks: %s", err)
+	}
+
+	if len(networks) != 0 {
+		t.Errorf("Networks should be removed: %v", networks)
+	}
+}
+
+func TestServiceIPs(t *testing.T) {
+	testServiceIPs := []networkmanager.ServiceIPInfo{
+		{ServiceID: "service1", SpID: "sp1", IP: "172.17.0.2"},
+		{ServiceID: "service2", SpID: "sp1", IP: "172.17.0.3", IPv6: "fd00:a05:0:1::3"},
+	}
+
+	for _, serviceIP := range testServiceIPs {
+		if err := db.SetServiceIP(serviceIP); err != nil {
+			t.Fatalf("Can't set service IP: %s", err)
+		}
+	}
+
+	testServiceIPs[0].IP = "172.17.0.10"
+
+	if err := db.SetServiceIP(testServiceIPs[0]); err != nil {
+		t.Fatalf("Can't set service IP: %s", err)
+	}
+
+	serviceIPs, err := db.GetServiceIPs()
+	if err != nil {
+		t.Fatalf("Can't get service IPs: %s", err)
+	}
+
+	if !reflect.DeepEqual(serviceIPs, testServiceIPs) {
+		t.Errorf("Wrong service IPs: %v", serviceIPs)
+	}
+
+	for _, serviceIP := range testServiceIPs {
+		if err = db.RemoveServiceIP(serviceIP.ServiceID); err != nil {
+			t.Fatalf("Can't remove service IP: %s", err)
+		}
+	}
+
+	if serviceIPs, err = db.GetServiceIPs(); err != nil {
+		t.Fatalf("Can't get service IPs: %s", err)
+	}
+
+	if len(serviceIPs) != 0 {
+		t.Errorf("Service IPs should be removed: %v", serviceIPs)
 	}
 }
 
 func TestOverideEnvVars(t *testing.T) {
-	// Add users service
-	if err := db.AddServiceToUsers([]string{"subject1"}, "service1"); err != nil {
+	// Add subject services
+	if err := db.AddSubjectService(launcher.SubjectService{SubjectID: "subject1", ServiceID: "service1"}); err != nil {
+		t.Errorf("Can't add subject service: %s", err)
+	}
+
+	if err := db.AddSubjectService(launcher.SubjectService{SubjectID: "subject2", ServiceID: "service1"}); err != nil {
 		t.Errorf("Can't add subject service: %s", err)
 	}
 
@@ -654,13 +798,13 @@ func TestOverideEnvVars(t *testing.T) {
 	envVars := []*pb.EnvVarInfo{}
 	envVars = append(envVars, &pb.EnvVarInfo{VarId: "some", Variable: "log=10", Ttl: timestamppb.New(ttl)})
 
-	if err := db.UpdateOverrideEnvVars([]string{"subject1"}, "service2", envVars); err != nil {
+	if err := db.UpdateOverrideEnvVars("subject1", "service2", envVars); err != nil {
 		if !errors.Is(err, ErrNotExist) {
 			t.Errorf("Should be error: %s", ErrNotExist)
 		}
 	}
 
-	if err := db.UpdateOverrideEnvVars([]string{"subject1"}, "service1", envVars); err != nil {
+	if err := db.UpdateOverrideEnvVars("subject1", "service1", envVars); err != nil {
 		t.Errorf("Can't update override env vars: %s", err)
 	}
 
@@ -669,12 +813,32 @@ func TestOverideEnvVars(t *testing.T) {
 		t.Errorf("Can't get all env vars: %s", err)
 	}
 
-	if len(allVars) != 1 {
-		t.Error("Count of all env vars should be 1")
+	if len(allVars) != 2 {
+		t.Fatal("Count of all env vars should be 2")
+	}
+
+	for i := range allVars {
+		vars := &allVars[i]
+
+		switch vars.SubjectId {
+		case "subject1":
+			if !reflect.DeepEqual(vars.Vars, envVars) {
+				t.Error("Incorrect env vars in get all override env vars request")
+			}
+
+		case "subject2":
+			if len(vars.Vars) != 0 {
+				t.Error("Env vars of subject2 should be empty")
+			}
+
+		default:
+			t.Errorf("Unexpected subject: %s", vars.SubjectId)
+		}
 	}
 
-	if reflect.DeepEqual(allVars[0].Vars, envVars) == false {
-		t.Error("Incorrect env vars in get all override env vars request")
+	// Clear DB
+	if err = db.removeAllInstances(); err != nil {
+		t.Errorf("Can't remove all instances: %s", err)
 	}
 }
 
@@ -709,6 +873,138 @@ func TestTrafficMonitor(t *testing.T) {
 	}
 }
 
+func TestMonitoringData(t *testing.T) {
+	const maxSamples = 5
+
+	startTime := time.Now()
+
+	for i := 0; i < 10; i++ {
+		if err := db.AddMonitoringData(0, monitoring.HistorySample{
+			Data: &pb.Monitoring{
+				Timestamp:        timestamppb.New(startTime.Add(time.Duration(i) * time.Minute)),
+				SystemMonitoring: &pb.SystemMonitoring{Ram: uint64(i)},
+				ServiceMonitoring: []*pb.ServiceMonitoring{
+					{ServiceId: "service1", Cpu: uint64(i)},
+				},
+			},
+			InstanceIDs: []string{"instance1"},
+		}, maxSamples); err != nil {
+			t.Fatalf("Can't add monitoring data: %s", err)
+		}
+	}
+
+	if err := db.AddMonitoringData(1, monitoring.HistorySample{
+		Data: &pb.Monitoring{Timestamp: timestamppb.New(startTime)},
+	}, maxSamples); err != nil {
+		t.Fatalf("Can't add monitoring data: %s", err)
+	}
+
+	data, err := db.GetMonitoringData(0, startTime, startTime.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Can't get monitoring data: %s", err)
+	}
+
+	if len(data) != maxSamples {
+		t.Fatalf("Wrong monitoring data count: %d", len(data))
+	}
+
+	for i, sample := range data {
+		if sample.Data.GetSystemMonitoring().GetRam() != uint64(i+10-maxSamples) {
+			t.Errorf("Wrong system RAM: %d", sample.Data.GetSystemMonitoring().GetRam())
+		}
+
+		if len(sample.Data.GetServiceMonitoring()) != 1 ||
+			sample.Data.GetServiceMonitoring()[0].GetCpu() != uint64(i+10-maxSamples) {
+			t.Errorf("Wrong service monitoring: %v", sample.Data.GetServiceMonitoring())
+		}
+
+		if !reflect.DeepEqual(sample.InstanceIDs, []string{"instance1"}) {
+			t.Errorf("Wrong instance IDs: %v", sample.InstanceIDs)
+		}
+	}
+
+	if data, err = db.GetMonitoringData(0, startTime.Add(6*time.Minute),
+		startTime.Add(8*time.Minute)); err != nil {
+		t.Fatalf("Can't get monitoring data: %s", err)
+	}
+
+	if len(data) != 3 {
+		t.Errorf("Wrong monitoring data count: %d", len(data))
+	}
+
+	if data, err = db.GetMonitoringData(1, startTime, startTime.Add(time.Hour)); err != nil {
+		t.Fatalf("Can't get monitoring data: %s", err)
+	}
+
+	if len(data) != 1 {
+		t.Errorf("Wrong monitoring data count: %d", len(data))
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	const maxCount = 5
+
+	var lastSeq uint64
+
+	for i := 0; i < 10; i++ {
+		seq, err := db.AddNotification([]byte{byte(i)}, maxCount)
+		if err != nil {
+			t.Fatalf("Can't add notification: %s", err)
+		}
+
+		if seq <= lastSeq {
+			t.Errorf("Wrong notification seq: %d", seq)
+		}
+
+		lastSeq = seq
+	}
+
+	notifications, err := db.GetNotifications(0, 100)
+	if err != nil {
+		t.Fatalf("Can't get notifications: %s", err)
+	}
+
+	if len(notifications) != maxCount {
+		t.Fatalf("Wrong notifications count: %d", len(notifications))
+	}
+
+	for i, notification := range notifications {
+		if notification.Seq != lastSeq-maxCount+1+uint64(i) {
+			t.Errorf("Wrong notification seq: %d", notification.Seq)
+		}
+
+		if len(notification.Data) != 1 || notification.Data[0] != byte(i+10-maxCount) {
+			t.Errorf("Wrong notification data: %v", notification.Data)
+		}
+	}
+
+	if err = db.RemoveNotifications(lastSeq - 1); err != nil {
+		t.Fatalf("Can't remove notifications: %s", err)
+	}
+
+	if notifications, err = db.GetNotifications(0, 100); err != nil {
+		t.Fatalf("Can't get notifications: %s", err)
+	}
+
+	if len(notifications) != 1 || notifications[0].Seq != lastSeq {
+		t.Errorf("Wrong notifications: %v", notifications)
+	}
+
+	if err = db.RemoveNotifications(lastSeq); err != nil {
+		t.Fatalf("Can't remove notifications: %s", err)
+	}
+
+	// Sequence number should not be reused after removing
+	seq, err := db.AddNotification([]byte{0}, maxCount)
+	if err != nil {
+		t.Fatalf("Can't add notification: %s", err)
+	}
+
+	if seq <= lastSeq {
+		t.Errorf("Wrong notification seq: %d", seq)
+	}
+}
+
 func TestOperationVersion(t *testing.T) {
 	var setOperationVersion uint64 = 123
 
@@ -766,10 +1062,29 @@ func TestGetServiceByUnitName(t *testing.T) {
 		t.Error("service1 doesn't match stored one")
 	}
 
+	// Get service by instance unit name
+	if err = db.AddSubjectService(launcher.SubjectService{
+		SubjectID: "user1", ServiceID: "service1", UnitName: "service1_user1.service",
+	}); err != nil {
+		t.Errorf("Can't add subject service: %s", err)
+	}
+
+	if service, err = db.GetServiceByUnitName("service1_user1.service"); err != nil {
+		t.Errorf("Can't get service: %s", err)
+	}
+
+	if !reflect.DeepEqual(service, service1) {
+		t.Error("service1 doesn't match stored one")
+	}
+
 	// Clear DB
 	if err = db.removeAllServices(); err != nil {
 		t.Errorf("Can't remove all services: %s", err)
 	}
+
+	if err = db.removeAllInstances(); err != nil {
+		t.Errorf("Can't remove all instances: %s", err)
+	}
 }
 
 func TestMultiThread(t *testing.T) {
@@ -886,6 +1201,57 @@ func TestLayers(t *testing.T) {
 	}
 }
 
+func TestLayerRefs(t *testing.T) {
+	if err := db.SetServiceLayers("refService1", []string{"sha256:10", "sha256:11"}); err != nil {
+		t.Fatalf("Can't set service layers: %s", err)
+	}
+
+	if err := db.SetServiceLayers("refService2", []string{"sha256:11"}); err != nil {
+		t.Fatalf("Can't set service layers: %s", err)
+	}
+
+	serviceIDs, err := db.GetLayerServices("sha256:11")
+	if err != nil {
+		t.Fatalf("Can't get layer services: %s", err)
+	}
+
+	if len(serviceIDs) != 2 {
+		t.Errorf("Wrong layer services count: %d", len(serviceIDs))
+	}
+
+	if err = db.SetServiceLayers("refService1", []string{"sha256:12"}); err != nil {
+		t.Fatalf("Can't set service layers: %s", err)
+	}
+
+	if serviceIDs, err = db.GetLayerServices("sha256:10"); err != nil {
+		t.Fatalf("Can't get layer services: %s", err)
+	}
+
+	if len(serviceIDs) != 0 {
+		t.Errorf("Layer should not be referenced: %v", serviceIDs)
+	}
+
+	if err = db.RemoveService("refService2"); err != nil {
+		t.Fatalf("Can't remove service: %s", err)
+	}
+
+	if serviceIDs, err = db.GetLayerServices("sha256:11"); err != nil {
+		t.Fatalf("Can't get layer services: %s", err)
+	}
+
+	if len(serviceIDs) != 0 {
+		t.Errorf("Layer should not be referenced: %v", serviceIDs)
+	}
+
+	if serviceIDs, err = db.GetLayerServices("sha256:12"); err != nil {
+		t.Fatalf("Can't get layer services: %s", err)
+	}
+
+	if len(serviceIDs) != 1 || serviceIDs[0] != "refService1" {
+		t.Errorf("Wrong layer services: %v", serviceIDs)
+	}
+}
+
 func TestMigrationToV1(t *testing.T) {
 	migrationDB := path.Join(tmpDir, "test_migration.db")
 	mergedMigrationDir := path.Join(tmpDir, "mergedMigration")
@@ -929,35 +1295,100 @@ func TestMigrationToV1(t *testing.T) {
 	db.Close()
 }
 
+func TestMigrationToV6(t *testing.T) {
+	migrationDB := path.Join(tmpDir, "test_migration_v6.db")
+	mergedMigrationDir := path.Join(tmpDir, "mergedMigrationV6")
+
+	if err := os.MkdirAll(mergedMigrationDir, 0o755); err != nil {
+		t.Fatalf("Error creating merged migration dir: %s", err)
+	}
+
+	defer func() {
+		if err := os.RemoveAll(mergedMigrationDir); err != nil {
+			t.Fatalf("Error removing merged migration dir: %s", err)
+		}
+	}()
+
+	if err := createDatabaseV0(migrationDB); err != nil {
+		t.Fatalf("Can't create initial database %s", err)
+	}
+
+	if err := addUsersServiceV0(migrationDB, []string{"subject1", `sub"ject2`}, "service1", "storage1"); err != nil {
+		t.Fatalf("Can't add users service: %s", err)
+	}
+
+	// Migration upward
+	db, err := newDatabase(migrationDB, "migration", mergedMigrationDir, 6)
+	if err != nil {
+		t.Fatalf("Can't create database: %s", err)
+	}
+
+	subjectService, err := db.GetSubjectService("subject1", "service1")
+	if err != nil {
+		t.Errorf("Can't get subject service: %s", err)
+	}
+
+	if subjectService.StorageFolder != "storage1" {
+		t.Errorf("Wrong storage folder: %s", subjectService.StorageFolder)
+	}
+
+	subjects, err := db.getSubjectsList()
+	if err != nil {
+		t.Errorf("Can't get subjects: %s", err)
+	}
+
+	sort.Strings(subjects)
+
+	if !reflect.DeepEqual(subjects, []string{`sub"ject2`, "subject1"}) {
+		t.Errorf("Wrong subjects: %v", subjects)
+	}
+
+	db.Close()
+
+	// Migration downward
+	db, err = newDatabase(migrationDB, "migration", mergedMigrationDir, 5)
+	if err != nil {
+		t.Fatalf("Can't create database: %s", err)
+	}
+
+	var storageFolder string
+
+	if err = db.sql.QueryRow("SELECT storageFolder FROM users WHERE users = ? AND serviceid = ?",
+		[]byte(`["subject1"]`), "service1").Scan(&storageFolder); err != nil {
+		t.Errorf("Can't get users service: %s", err)
+	}
+
+	if storageFolder != "storage1" {
+		t.Errorf("Wrong storage folder: %s", storageFolder)
+	}
+
+	db.Close()
+}
+
 /*******************************************************************************
  * Private
  ******************************************************************************/
 
-func (db *Database) getUsersList() (usersList [][]string, err error) {
-	rows, err := db.sql.Query("SELECT DISTINCT users FROM users")
+func (db *Database) getSubjectsList() (subjectsList []string, err error) {
+	rows, err := db.sql.Query("SELECT DISTINCT subjectid FROM instances")
 	if err != nil {
-		return usersList, aoserrors.Wrap(err)
+		return subjectsList, aoserrors.Wrap(err)
 	}
 	defer rows.Close()
 
-	usersList = make([][]string, 0)
+	subjectsList = make([]string, 0)
 
 	for rows.Next() {
-		var usersJSON []byte
-		if err := rows.Scan(&usersJSON); err != nil {
-			return usersList, aoserrors.Wrap(err)
-		}
-
-		var users []string
+		var subject string
 
-		if err = json.Unmarshal(usersJSON, &users); err != nil {
-			return usersList, aoserrors.Wrap(err)
+		if err := rows.Scan(&subject); err != nil {
+			return subjectsList, aoserrors.Wrap(err)
 		}
 
-		usersList = append(usersList, users)
+		subjectsList = append(subjectsList, subject)
 	}
 
-	return usersList, aoserrors.Wrap(rows.Err())
+	return subjectsList, aoserrors.Wrap(rows.Err())
 }
 
 func createDatabaseV0(name string) (err error) {
@@ -1037,6 +1468,32 @@ func createDatabaseV0(name string) (err error) {
 	return nil
 }
 
+func addUsersServiceV0(name string, subjects []string, serviceID, storageFolder string) (err error) {
+	sqlite, err := sql.Open("sqlite3", fmt.Sprintf("%s?_busy_timeout=%d&_journal_mode=%s&_sync=%s",
+		name, busyTimeout, journalMode, syncMode))
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer sqlite.Close()
+
+	usersJSON, err := json.Marshal(subjects)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if _, err = sqlite.Exec("INSERT INTO users values(?, ?, ?, ?)",
+		usersJSON, serviceID, storageFolder, []byte{}); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	// Migration 5 expects manifestDigest column which is not created by V0 scheme
+	if _, err = sqlite.Exec("ALTER TABLE services ADD manifestDigest BLOB"); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
 func isDatabaseVer1(sqlite *sql.DB) (err error) {
 	rows, err := sqlite.Query(
 		"SELECT COUNT(*) AS CNTREC FROM pragma_table_info('config') WHERE name='componentsUpdateInfo'")
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS restarts (subjectid TEXT NOT NULL,
+									 serviceid TEXT NOT NULL,
+									 count INTEGER,
+									 PRIMARY KEY(subjectid, serviceid));
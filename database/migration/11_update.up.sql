@@ -0,0 +1,3 @@
+CREATE TABLE IF NOT EXISTS networks (spid TEXT NOT NULL PRIMARY KEY,
+									 subnet TEXT,
+									 ipv6subnet TEXT);
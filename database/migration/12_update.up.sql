@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS serviceips (serviceid TEXT NOT NULL PRIMARY KEY,
+									   spid TEXT,
+									   ip TEXT,
+									   ipv6 TEXT);
@@ -0,0 +1,7 @@
+CREATE TABLE monitoring_backup (level INTEGER NOT NULL,
+								timestamp INTEGER NOT NULL,
+								data BLOB,
+								PRIMARY KEY(level, timestamp));
+INSERT INTO monitoring_backup SELECT level, timestamp, data FROM monitoring;
+DROP TABLE monitoring;
+ALTER TABLE monitoring_backup RENAME TO monitoring;
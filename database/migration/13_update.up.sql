@@ -0,0 +1 @@
+ALTER TABLE monitoring ADD COLUMN instances TEXT;
@@ -0,0 +1,12 @@
+CREATE TABLE users (users TEXT NOT NULL,
+					serviceid TEXT NOT NULL,
+					storageFolder TEXT,
+					stateCheckSum BLOB,
+					overrideEnvVars TEXT,
+					PRIMARY KEY(users, serviceid));
+
+INSERT INTO users (users, serviceid, storageFolder, stateCheckSum, overrideEnvVars)
+SELECT CAST('["' || subjectid || '"]' AS BLOB), serviceid, storageFolder, stateCheckSum, overrideEnvVars
+FROM instances;
+
+DROP TABLE instances;
@@ -0,0 +1,14 @@
+CREATE TABLE instances (subjectid TEXT NOT NULL,
+						serviceid TEXT NOT NULL,
+						unit TEXT,
+						storageFolder TEXT,
+						stateCheckSum BLOB,
+						overrideEnvVars TEXT,
+						PRIMARY KEY(subjectid, serviceid));
+
+INSERT OR IGNORE INTO instances (subjectid, serviceid, unit, storageFolder, stateCheckSum, overrideEnvVars)
+SELECT CAST(subject.value AS TEXT), users.serviceid, '', users.storageFolder, users.stateCheckSum,
+	users.overrideEnvVars
+FROM users, json_each(CAST(users.users AS TEXT)) AS subject;
+
+DROP TABLE users;
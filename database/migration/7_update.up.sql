@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS monitoring (level INTEGER NOT NULL,
+									   timestamp INTEGER NOT NULL,
+									   data BLOB,
+									   PRIMARY KEY(level, timestamp));
@@ -0,0 +1,2 @@
+CREATE TABLE IF NOT EXISTS notifications (seq INTEGER PRIMARY KEY AUTOINCREMENT,
+										  data BLOB);
@@ -0,0 +1,3 @@
+CREATE TABLE IF NOT EXISTS layerrefs (serviceId TEXT NOT NULL,
+									  digest TEXT NOT NULL,
+									  PRIMARY KEY(serviceId, digest));
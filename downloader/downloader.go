@@ -0,0 +1,513 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package downloader provides resumable, rate limited downloads into shared download cache
+package downloader
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/image"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+	"github.com/aoscloud/aos_servicemanager/progress"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+const (
+	partFileSuffix = ".part"
+	bufferSize     = 32 * 1024
+)
+
+const (
+	defaultMaxConcurrentDownloads = 2
+	defaultRetryDelay             = 10 * time.Second
+	defaultPartialFileTTL         = 24 * time.Hour
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// Downloader download manager instance.
+type Downloader struct {
+	sync.Mutex
+
+	downloadDir string
+	maxRetries  int
+	retryDelay  time.Duration
+
+	client    *http.Client
+	limiter   *rateLimiter
+	semaphore chan struct{}
+	downloads map[string]*download
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// download is shared by all requests of the same blob, it is canceled when all requests leave it
+type download struct {
+	key       string
+	fileName  string
+	refs      int
+	finished  bool
+	canceled  bool
+	err       error
+	done      chan struct{}
+	reporters []*progress.Reporter
+	ctx       context.Context
+	cancel    context.CancelFunc
+	// canceled download of the same blob which should finish before this one starts
+	previous *download
+}
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// New creates new downloader object.
+func New(config *config.Config) (downloader *Downloader, err error) {
+	log.WithFields(log.Fields{
+		"downloadDir":  config.Downloader.DownloadDir,
+		"maxBandwidth": config.Downloader.MaxBandwidth,
+	}).Debug("New downloader")
+
+	downloader = &Downloader{
+		downloadDir: config.Downloader.DownloadDir,
+		maxRetries:  config.Downloader.MaxRetries,
+		retryDelay:  config.Downloader.RetryDelay.Duration,
+		client:      &http.Client{},
+		limiter:     &rateLimiter{rate: config.Downloader.MaxBandwidth},
+		downloads:   make(map[string]*download),
+	}
+
+	if downloader.downloadDir == "" {
+		downloader.downloadDir = path.Join(config.WorkingDir, "download")
+	}
+
+	if downloader.retryDelay == 0 {
+		downloader.retryDelay = defaultRetryDelay
+	}
+
+	partialFileTTL := config.Downloader.PartialFileTTL.Duration
+	if partialFileTTL == 0 {
+		partialFileTTL = defaultPartialFileTTL
+	}
+
+	maxConcurrentDownloads := config.Downloader.MaxConcurrentDownloads
+	if maxConcurrentDownloads <= 0 {
+		maxConcurrentDownloads = defaultMaxConcurrentDownloads
+	}
+
+	downloader.semaphore = make(chan struct{}, maxConcurrentDownloads)
+
+	if err = os.MkdirAll(downloader.downloadDir, 0o755); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if err = downloader.removeStaleFiles(partialFileTTL); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	downloader.ctx, downloader.cancel = context.WithCancel(context.Background())
+
+	return downloader, nil
+}
+
+// Close closes downloader. Not finished downloads are interrupted, their partial files are kept to be resumed.
+func (downloader *Downloader) Close() {
+	log.Debug("Close downloader")
+
+	downloader.cancel()
+}
+
+// Download downloads blob into download cache and returns downloaded file name. The same blob requested
+// simultaneously is downloaded once, the download is canceled when all its requesters leave it. The file should be
+// released with Release when it is not needed anymore.
+// Download progress is reported to progress reporter carried by ctx.
+func (downloader *Downloader) Download(ctx context.Context, url string,
+	fileInfo image.FileInfo) (fileName string, err error) {
+	if len(fileInfo.Sha256) == 0 {
+		return "", aoserrors.New("file sha256 is not specified")
+	}
+
+	key := hex.EncodeToString(fileInfo.Sha256)
+
+	downloader.Lock()
+
+	item, ok := downloader.downloads[key]
+
+	// finished download is reused while its file is held by other requesters, canceled or failed one is restarted
+	if !ok || item.canceled || (item.finished && item.err != nil) {
+		newItem := &download{key: key, fileName: path.Join(downloader.downloadDir, key), done: make(chan struct{})}
+		newItem.ctx, newItem.cancel = context.WithCancel(downloader.ctx)
+
+		// canceled download is still writing the partial file
+		if ok && !item.finished {
+			newItem.previous = item
+		}
+
+		item = newItem
+		downloader.downloads[key] = item
+
+		go downloader.process(item, url, fileInfo)
+	} else {
+		log.WithFields(log.Fields{"url": url, "file": item.fileName}).Debug("Join existing download")
+	}
+
+	item.refs++
+
+	if reporter := progress.FromContext(ctx); reporter != nil {
+		item.reporters = append(item.reporters, reporter)
+	}
+
+	downloader.Unlock()
+
+	select {
+	case <-item.done:
+
+	case <-ctx.Done():
+		downloader.release(item)
+
+		return "", aoserrors.Wrap(ctx.Err())
+	}
+
+	if item.err != nil {
+		downloader.release(item)
+
+		return "", item.err
+	}
+
+	return item.fileName, nil
+}
+
+// Release releases downloaded file. The file is removed when it is released by all requesters.
+func (downloader *Downloader) Release(fileName string) {
+	downloader.Lock()
+	item, ok := downloader.downloads[filepath.Base(fileName)]
+	// only successfully finished download returns the file, it is the only such download of the blob
+	ok = ok && item.finished && item.err == nil
+	downloader.Unlock()
+
+	if ok {
+		downloader.release(item)
+	}
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func (downloader *Downloader) release(item *download) {
+	downloader.Lock()
+	defer downloader.Unlock()
+
+	if item.refs > 0 {
+		item.refs--
+	}
+
+	if item.refs != 0 {
+		return
+	}
+
+	if item.finished {
+		downloader.removeDownload(item)
+
+		return
+	}
+
+	log.WithField("file", item.fileName).Debug("Cancel download without requesters")
+
+	// partial file is kept to resume the download on next request
+	item.canceled = true
+	item.cancel()
+}
+
+func (downloader *Downloader) removeDownload(item *download) {
+	if downloader.downloads[item.key] == item {
+		delete(downloader.downloads, item.key)
+	}
+
+	// keep partial file of failed download to resume it on next request
+	if item.err != nil {
+		return
+	}
+
+	if err := os.RemoveAll(item.fileName); err != nil {
+		log.WithField("file", item.fileName).Errorf("Can't remove downloaded file: %s", err)
+	}
+}
+
+func (downloader *Downloader) process(item *download, url string, fileInfo image.FileInfo) {
+	defer item.cancel()
+
+	if item.previous != nil {
+		<-item.previous.done
+	}
+
+	err := downloader.downloadFile(item, url, fileInfo)
+	if err != nil {
+		log.WithField("url", url).Errorf("Can't download file: %s", err)
+	}
+
+	downloader.Lock()
+	defer downloader.Unlock()
+
+	item.err = err
+	item.finished = true
+
+	close(item.done)
+
+	if item.refs == 0 {
+		downloader.removeDownload(item)
+	}
+}
+
+// removeStaleFiles removes partial and not released files which are not modified within ttl
+func (downloader *Downloader) removeStaleFiles(ttl time.Duration) (err error) {
+	items, err := ioutil.ReadDir(downloader.downloadDir)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	for _, item := range items {
+		if item.IsDir() || time.Since(item.ModTime()) < ttl {
+			continue
+		}
+
+		fileName := path.Join(downloader.downloadDir, item.Name())
+
+		log.WithField("file", fileName).Debug("Remove stale download file")
+
+		if err = os.RemoveAll(fileName); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func (downloader *Downloader) downloadFile(item *download, url string, fileInfo image.FileInfo) (err error) {
+	fileName := item.fileName
+
+	if _, err = os.Stat(fileName); err == nil {
+		if err = image.CheckFileInfo(item.ctx, fileName, fileInfo); err == nil {
+			log.WithField("file", fileName).Debug("File is already downloaded")
+
+			downloader.notifyProgress(item, fileInfo.Size, fileInfo.Size)
+
+			return nil
+		}
+
+		if err = os.RemoveAll(fileName); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	select {
+	case downloader.semaphore <- struct{}{}:
+		defer func() { <-downloader.semaphore }()
+
+	case <-item.ctx.Done():
+		return aoserrors.Wrap(item.ctx.Err())
+	}
+
+	log.WithFields(log.Fields{"url": url, "file": fileName}).Debug("Download file")
+
+	partFileName := fileName + partFileSuffix
+
+	for retry := 0; ; retry++ {
+		if err = downloader.fetch(item, url, partFileName, fileInfo.Size); err == nil {
+			break
+		}
+
+		if retry >= downloader.maxRetries || item.ctx.Err() != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		log.WithField("url", url).Warnf("Download failed, retry in %s: %s", downloader.retryDelay, err)
+
+		select {
+		case <-time.After(downloader.retryDelay):
+
+		case <-item.ctx.Done():
+			return aoserrors.Wrap(item.ctx.Err())
+		}
+	}
+
+	downloader.setPhase(item, progress.PhaseVerify)
+
+	if err = image.CheckFileInfo(item.ctx, partFileName, fileInfo); err != nil {
+		if item.ctx.Err() != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		// corrupted partial file can't be resumed
+		if removeErr := os.RemoveAll(partFileName); removeErr != nil {
+			log.WithField("file", partFileName).Errorf("Can't remove partial file: %s", removeErr)
+		}
+
+		return aoserrors.Wrap(err)
+	}
+
+	if err = os.Rename(partFileName, fileName); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// fetch downloads remaining part of the file and appends it to the partial file
+func (downloader *Downloader) fetch(item *download, url, partFileName string, size uint64) (err error) {
+	file, err := os.OpenFile(partFileName, os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if uint64(offset) == size {
+		return nil
+	}
+
+	if uint64(offset) > size {
+		if offset, err = truncateFile(file); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(item.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := downloader.client.Do(req)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return aoserrors.Errorf("wrong content range: %s", resp.Header.Get("Content-Range"))
+		}
+
+		log.WithFields(log.Fields{"url": url, "offset": offset}).Debug("Resume download")
+
+	case http.StatusOK:
+		if offset > 0 {
+			log.WithField("url", url).Warn("Server doesn't support range requests, download from beginning")
+
+			if _, err = truncateFile(file); err != nil {
+				return aoserrors.Wrap(err)
+			}
+		}
+
+	default:
+		return aoserrors.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+
+	return downloader.copyBody(item, file, resp.Body, uint64(offset), size)
+}
+
+func (downloader *Downloader) copyBody(item *download, file io.Writer, body io.Reader,
+	offset, size uint64) (err error) {
+	buffer := make([]byte, downloader.limiter.getChunkSize(bufferSize))
+
+	downloader.notifyProgress(item, offset, size)
+
+	for {
+		n, readErr := body.Read(buffer)
+		if n > 0 {
+			if err = downloader.limiter.wait(item.ctx, n); err != nil {
+				return aoserrors.Wrap(err)
+			}
+
+			if _, err = file.Write(buffer[:n]); err != nil {
+				return aoserrors.Wrap(err)
+			}
+
+			offset += uint64(n)
+
+			downloader.notifyProgress(item, offset, size)
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+
+		if readErr != nil {
+			return aoserrors.Wrap(readErr)
+		}
+	}
+}
+
+func (downloader *Downloader) notifyProgress(item *download, downloaded, total uint64) {
+	downloader.Lock()
+	defer downloader.Unlock()
+
+	for _, reporter := range item.reporters {
+		reporter.SetDownloaded(downloaded, total)
+	}
+}
+
+func (downloader *Downloader) setPhase(item *download, phase string) {
+	downloader.Lock()
+	defer downloader.Unlock()
+
+	for _, reporter := range item.reporters {
+		reporter.SetPhase(phase)
+	}
+}
+
+func truncateFile(file *os.File) (offset int64, err error) {
+	if err = file.Truncate(0); err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	if offset, err = file.Seek(0, io.SeekStart); err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	return offset, nil
+}
@@ -0,0 +1,520 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package downloader //nolint
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aoscloud/aos_common/image"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+type testServer struct {
+	sync.Mutex
+
+	content      []byte
+	modTime      time.Time
+	dropFirst    bool
+	requests     int
+	rangeHeaders []string
+	release      chan struct{}
+}
+
+/*******************************************************************************
+ * Vars
+ ******************************************************************************/
+
+var tmpDir string
+
+/*******************************************************************************
+ * Init
+ ******************************************************************************/
+
+func init() {
+	log.SetFormatter(&log.TextFormatter{
+		DisableTimestamp: false,
+		TimestampFormat:  "2006-01-02 15:04:05.000",
+		FullTimestamp:    true,
+	})
+	log.SetLevel(log.DebugLevel)
+	log.SetOutput(os.Stdout)
+}
+
+/*******************************************************************************
+ * Main
+ ******************************************************************************/
+
+func TestMain(m *testing.M) {
+	var err error
+
+	if tmpDir, err = ioutil.TempDir("", "downloader_"); err != nil {
+		log.Fatalf("Can't create tmp dir: %s", err)
+	}
+
+	ret := m.Run()
+
+	os.RemoveAll(tmpDir)
+
+	os.Exit(ret)
+}
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestResumeDownload(t *testing.T) {
+	server := newTestServer(t, 256*1024)
+	server.dropFirst = true
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	downloader := newTestDownloader(t)
+	defer downloader.Close()
+
+	fileName, err := downloader.Download(context.Background(), httpServer.URL, server.getFileInfo(t))
+	if err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	checkFileContent(t, fileName, server.content)
+
+	if server.requests != 2 {
+		t.Errorf("Wrong requests count: %d", server.requests)
+	}
+
+	if len(server.rangeHeaders) != 2 || server.rangeHeaders[0] != "" || server.rangeHeaders[1] == "" {
+		t.Errorf("Download is not resumed, range headers: %v", server.rangeHeaders)
+	}
+
+	downloader.Release(fileName)
+
+	if _, err = os.Stat(fileName); !os.IsNotExist(err) {
+		t.Errorf("Downloaded file is not removed on release")
+	}
+}
+
+func TestResumePersistedPartialFile(t *testing.T) {
+	server := newTestServer(t, 64*1024)
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	fileInfo := server.getFileInfo(t)
+
+	// partial file left from previous run
+	if err := ioutil.WriteFile(path.Join(tmpDir, hex.EncodeToString(fileInfo.Sha256)+partFileSuffix),
+		server.content[:1000], 0o600); err != nil {
+		t.Fatalf("Can't write partial file: %s", err)
+	}
+
+	downloader := newTestDownloader(t)
+	defer downloader.Close()
+
+	fileName, err := downloader.Download(context.Background(), httpServer.URL, fileInfo)
+	if err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+	defer downloader.Release(fileName)
+
+	checkFileContent(t, fileName, server.content)
+
+	if len(server.rangeHeaders) != 1 || server.rangeHeaders[0] != "bytes=1000-" {
+		t.Errorf("Wrong range headers: %v", server.rangeHeaders)
+	}
+}
+
+func TestSharedDownload(t *testing.T) {
+	server := newTestServer(t, 64*1024)
+	server.release = make(chan struct{})
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	downloader := newTestDownloader(t)
+	defer downloader.Close()
+
+	fileInfo := server.getFileInfo(t)
+	key := hex.EncodeToString(fileInfo.Sha256)
+
+	type result struct {
+		fileName string
+		err      error
+	}
+
+	resultChannel := make(chan result, 2)
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			fileName, err := downloader.Download(context.Background(), httpServer.URL, fileInfo)
+			resultChannel <- result{fileName, err}
+		}()
+	}
+
+	// wait both requests join the download
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		downloader.Lock()
+		item, ok := downloader.downloads[key]
+		refs := 0
+
+		if ok {
+			refs = item.refs
+		}
+		downloader.Unlock()
+
+		if refs == 2 {
+			break
+		}
+
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Requests don't join the download")
+		}
+	}
+
+	close(server.release)
+
+	var fileNames []string
+
+	for i := 0; i < 2; i++ {
+		result := <-resultChannel
+		if result.err != nil {
+			t.Fatalf("Can't download file: %s", result.err)
+		}
+
+		fileNames = append(fileNames, result.fileName)
+	}
+
+	if fileNames[0] != fileNames[1] {
+		t.Errorf("Different file names: %v", fileNames)
+	}
+
+	if server.requests != 1 {
+		t.Errorf("Wrong requests count: %d", server.requests)
+	}
+
+	downloader.Release(fileNames[0])
+
+	if _, err := os.Stat(fileNames[0]); err != nil {
+		t.Errorf("File is removed while it is used: %s", err)
+	}
+
+	downloader.Release(fileNames[1])
+
+	if _, err := os.Stat(fileNames[1]); !os.IsNotExist(err) {
+		t.Errorf("Downloaded file is not removed on release")
+	}
+}
+
+func TestCancelSharedDownload(t *testing.T) {
+	server := newTestServer(t, 64*1024)
+	server.release = make(chan struct{})
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	downloader := newTestDownloader(t)
+	defer downloader.Close()
+
+	fileInfo := server.getFileInfo(t)
+	key := hex.EncodeToString(fileInfo.Sha256)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChannel := make(chan error, 2)
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := downloader.Download(ctx, httpServer.URL, fileInfo)
+			errChannel <- err
+		}()
+	}
+
+	waitDownload(t, downloader, key, func(item *download) bool { return item.refs == 2 })
+
+	downloader.Lock()
+	item := downloader.downloads[key]
+	downloader.Unlock()
+
+	cancel()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errChannel; err == nil {
+			t.Fatal("Error expected")
+		}
+	}
+
+	select {
+	case <-item.done:
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("Download without requesters is not canceled")
+	}
+
+	waitDownload(t, downloader, key, nil)
+
+	close(server.release)
+
+	fileName, err := downloader.Download(context.Background(), httpServer.URL, fileInfo)
+	if err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+	defer downloader.Release(fileName)
+
+	checkFileContent(t, fileName, server.content)
+}
+
+func TestReleaseSharedFile(t *testing.T) {
+	server := newTestServer(t, 64*1024)
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	downloader := newTestDownloader(t)
+	defer downloader.Close()
+
+	fileInfo := server.getFileInfo(t)
+
+	fileNameA, err := downloader.Download(context.Background(), httpServer.URL, fileInfo)
+	if err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	fileNameB, err := downloader.Download(context.Background(), httpServer.URL, fileInfo)
+	if err != nil {
+		t.Fatalf("Can't download file: %s", err)
+	}
+
+	downloader.Release(fileNameA)
+
+	checkFileContent(t, fileNameB, server.content)
+
+	downloader.Release(fileNameB)
+
+	if _, err = os.Stat(fileNameB); !os.IsNotExist(err) {
+		t.Errorf("Released file should be removed: %v", err)
+	}
+}
+
+func TestRemoveStaleFiles(t *testing.T) {
+	staleFile := path.Join(tmpDir, "stale"+partFileSuffix)
+	freshFile := path.Join(tmpDir, "fresh"+partFileSuffix)
+
+	for _, fileName := range []string{staleFile, freshFile} {
+		if err := ioutil.WriteFile(fileName, []byte("data"), 0o600); err != nil {
+			t.Fatalf("Can't write partial file: %s", err)
+		}
+	}
+
+	defer os.Remove(freshFile)
+
+	staleTime := time.Now().Add(-48 * time.Hour)
+
+	if err := os.Chtimes(staleFile, staleTime, staleTime); err != nil {
+		t.Fatalf("Can't change file time: %s", err)
+	}
+
+	downloader := newTestDownloader(t)
+	defer downloader.Close()
+
+	if _, err := os.Stat(staleFile); !os.IsNotExist(err) {
+		t.Error("Stale partial file is not removed")
+	}
+
+	if _, err := os.Stat(freshFile); err != nil {
+		t.Errorf("Partial file is removed: %s", err)
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	server := newTestServer(t, 1024)
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	downloader := newTestDownloader(t)
+	defer downloader.Close()
+
+	fileInfo := server.getFileInfo(t)
+	fileInfo.Sha512 = make([]byte, len(fileInfo.Sha512))
+
+	if _, err := downloader.Download(context.Background(), httpServer.URL, fileInfo); err == nil {
+		t.Fatal("Error expected")
+	}
+
+	partFileName := path.Join(tmpDir, hex.EncodeToString(fileInfo.Sha256)+partFileSuffix)
+
+	if _, err := os.Stat(partFileName); !os.IsNotExist(err) {
+		t.Errorf("Corrupted partial file is not removed")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := &rateLimiter{rate: 1000}
+
+	if size := limiter.getChunkSize(bufferSize); size != 1000 {
+		t.Errorf("Wrong chunk size: %d", size)
+	}
+
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if err := limiter.wait(context.Background(), 500); err != nil {
+			t.Fatalf("Wait error: %s", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 1*time.Second || elapsed > 2*time.Second {
+		t.Errorf("Wrong rate limit delay: %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := limiter.wait(ctx, 10000); err == nil {
+		t.Error("Error expected on canceled context")
+	}
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func newTestServer(t *testing.T, size int) (server *testServer) {
+	t.Helper()
+
+	server = &testServer{content: make([]byte, size), modTime: time.Now()}
+
+	if _, err := rand.Read(server.content); err != nil {
+		t.Fatalf("Can't generate content: %s", err)
+	}
+
+	return server
+}
+
+func (server *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.Lock()
+
+	server.requests++
+	server.rangeHeaders = append(server.rangeHeaders, r.Header.Get("Range"))
+	drop := server.dropFirst && server.requests == 1
+
+	server.Unlock()
+
+	if server.release != nil {
+		<-server.release
+	}
+
+	if drop {
+		w.Header().Set("Content-Length", strconv.Itoa(len(server.content)))
+		w.WriteHeader(http.StatusOK)
+
+		_, _ = w.Write(server.content[:len(server.content)/2])
+
+		w.(http.Flusher).Flush()
+
+		panic(http.ErrAbortHandler)
+	}
+
+	http.ServeContent(w, r, "blob", server.modTime, bytes.NewReader(server.content))
+}
+
+func (server *testServer) getFileInfo(t *testing.T) (fileInfo image.FileInfo) {
+	t.Helper()
+
+	file, err := ioutil.TempFile("", "blob_")
+	if err != nil {
+		t.Fatalf("Can't create file: %s", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err = file.Write(server.content); err != nil {
+		t.Fatalf("Can't write file: %s", err)
+	}
+
+	if fileInfo, err = image.CreateFileInfo(context.Background(), file.Name()); err != nil {
+		t.Fatalf("Can't create file info: %s", err)
+	}
+
+	return fileInfo
+}
+
+func newTestDownloader(t *testing.T) (downloader *Downloader) {
+	t.Helper()
+
+	downloader, err := New(&config.Config{Downloader: config.Downloader{
+		DownloadDir: tmpDir,
+		MaxRetries:  3,
+		RetryDelay:  config.Duration{Duration: 10 * time.Millisecond},
+	}})
+	if err != nil {
+		t.Fatalf("Can't create downloader: %s", err)
+	}
+
+	return downloader
+}
+
+// waitDownload waits until download matches condition, nil condition waits until download is removed
+func waitDownload(t *testing.T, downloader *Downloader, key string, condition func(item *download) bool) {
+	t.Helper()
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		downloader.Lock()
+		item, ok := downloader.downloads[key]
+		result := (condition == nil && !ok) || (condition != nil && ok && condition(item))
+		downloader.Unlock()
+
+		if result {
+			return
+		}
+
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Wait download timeout")
+		}
+	}
+}
+
+func checkFileContent(t *testing.T, fileName string, content []byte) {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("Can't read file: %s", err)
+	}
+
+	if !bytes.Equal(data, content) {
+		t.Error("Wrong file content")
+	}
+}
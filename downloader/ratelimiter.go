@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package downloader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// rateLimiter limits total bandwidth of all downloads
+type rateLimiter struct {
+	sync.Mutex
+
+	rate uint64 // bytes per second, 0 - unlimited
+	next time.Time
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+// getChunkSize returns read chunk size which doesn't exceed one second transfer
+func (limiter *rateLimiter) getChunkSize(maxSize int) (size int) {
+	if limiter.rate != 0 && limiter.rate < uint64(maxSize) {
+		return int(limiter.rate)
+	}
+
+	return maxSize
+}
+
+// wait reserves transfer of size bytes and waits until the transfer is allowed
+func (limiter *rateLimiter) wait(ctx context.Context, size int) (err error) {
+	if limiter.rate == 0 {
+		return nil
+	}
+
+	limiter.Lock()
+
+	now := time.Now()
+
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+
+	delay := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(time.Duration(uint64(size) * uint64(time.Second) / limiter.rate))
+
+	limiter.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+
+	case <-ctx.Done():
+		return aoserrors.Wrap(ctx.Err())
+	}
+}
@@ -19,6 +19,12 @@ package iamclient
 
 import (
 	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
 	"sync"
 	"time"
 
@@ -44,6 +50,9 @@ const (
 
 const usersChangedChannelSize = 1
 
+// storageKeyLabel is signed by IAM storage key to derive subject storage keys
+const storageKeyLabel = "aos storage key:"
+
 /*******************************************************************************
  * Types
  ******************************************************************************/
@@ -54,6 +63,9 @@ type Client struct {
 
 	users []string
 
+	cryptoContext  *cryptutils.CryptoContext
+	storageKeyType string
+
 	publicConnection    *grpc.ClientConn
 	protectedConnection *grpc.ClientConn
 	pbclientPublic      pb.IAMPublicServiceClient
@@ -72,6 +84,8 @@ func New(config *config.Config, cryptcoxontext *cryptutils.CryptoContext, insecu
 	log.Debug("Connecting to IAM...")
 
 	client = &Client{
+		cryptoContext:       cryptcoxontext,
+		storageKeyType:      config.StorageEncryption.KeyType,
 		closeChannel:        make(chan struct{}, 1),
 		usersChangedChannel: make(chan []string, usersChangedChannelSize),
 	}
@@ -215,6 +229,58 @@ func (client *Client) GetCertKeyURL(keyType string) (certURL, keyURL string, err
 	return response.CertUrl, response.KeyUrl, nil
 }
 
+// GetStorageKey returns subject storage encryption key. The key is derived from IAM key of configured storage key
+// type, so the same key is returned for the subject on each call while the IAM key is not changed.
+func (client *Client) GetStorageKey(subjectID string) (key []byte, err error) {
+	log.WithField("subjectID", subjectID).Debug("Get storage key")
+
+	if client.cryptoContext == nil {
+		return nil, aoserrors.New("crypto context is not set")
+	}
+
+	_, keyURL, err := client.GetCertKeyURL(client.storageKeyType)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	privKey, _, err := client.cryptoContext.LoadPrivateKeyByURL(keyURL)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	signer, ok := privKey.(crypto.Signer)
+	if !ok {
+		return nil, aoserrors.New("storage key doesn't support signing")
+	}
+
+	message := []byte(storageKeyLabel + subjectID)
+
+	var opts crypto.SignerOpts
+
+	// only deterministic signatures can be used for key derivation
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(message)
+
+		message, opts = digest[:], crypto.SHA256
+
+	case ed25519.PublicKey:
+		opts = crypto.Hash(0)
+
+	default:
+		return nil, aoserrors.Errorf("storage key type %T is not supported", signer.Public())
+	}
+
+	signature, err := signer.Sign(rand.Reader, message, opts)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	derivedKey := sha512.Sum512(signature)
+
+	return derivedKey[:], nil
+}
+
 // Close closes IAM client.
 func (client *Client) Close() (err error) {
 	if client.publicConnection != nil {
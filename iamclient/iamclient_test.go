@@ -18,18 +18,23 @@
 package iamclient_test
 
 import (
+	"bytes"
 	"context"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net"
 	"os"
+	"path"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/aoscloud/aos_common/aoserrors"
 	pb "github.com/aoscloud/aos_common/api/iamanager/v2"
+	"github.com/aoscloud/aos_common/utils/cryptutils"
 	"github.com/golang/protobuf/ptypes/empty"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
@@ -59,6 +64,7 @@ type testPublicServer struct {
 	users               []string
 	usersChangedChannel chan []string
 	permissionsCache    map[string]servicePermissions
+	keyURLs             map[string]string
 }
 
 type testProtectedServer struct {
@@ -256,6 +262,73 @@ func TestGetPermissions(t *testing.T) {
 	}
 }
 
+func TestGetStorageKey(t *testing.T) {
+	publicServer, protectedServer, err := newTestServers(publicServerURL, protectedServerURL,
+		make(map[string]servicePermissions))
+	if err != nil {
+		t.Fatalf("Can't create test server: %s", err)
+	}
+
+	defer publicServer.close()
+	defer protectedServer.close()
+
+	privKey, err := rsa.GenerateKey(cryptorand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Can't generate key: %s", err)
+	}
+
+	keyFile := path.Join(tmpDir, "storage.key")
+
+	if err = cryptutils.SavePrivateKeyToFile(keyFile, privKey); err != nil {
+		t.Fatalf("Can't save key: %s", err)
+	}
+
+	publicServer.keyURLs["storage"] = "file://" + keyFile
+
+	cryptoContext, err := cryptutils.NewCryptoContext("")
+	if err != nil {
+		t.Fatalf("Can't create crypto context: %s", err)
+	}
+	defer cryptoContext.Close()
+
+	client, err := iamclient.New(&config.Config{
+		IAMServerURL:       protectedServerURL,
+		IAMPublicServerURL: publicServerURL,
+		StorageEncryption:  config.StorageEncryption{Enabled: true, KeyType: "storage"},
+	}, cryptoContext, true)
+	if err != nil {
+		t.Fatalf("Can't create IAM client: %s", err)
+	}
+	defer client.Close()
+
+	key1, err := client.GetStorageKey("subject1")
+	if err != nil {
+		t.Fatalf("Can't get storage key: %s", err)
+	}
+
+	if len(key1) != 64 {
+		t.Errorf("Wrong storage key size: %d", len(key1))
+	}
+
+	key2, err := client.GetStorageKey("subject1")
+	if err != nil {
+		t.Fatalf("Can't get storage key: %s", err)
+	}
+
+	if !bytes.Equal(key1, key2) {
+		t.Error("Storage key should be the same for the same subject")
+	}
+
+	key3, err := client.GetStorageKey("subject2")
+	if err != nil {
+		t.Fatalf("Can't get storage key: %s", err)
+	}
+
+	if bytes.Equal(key1, key3) {
+		t.Error("Storage keys should be different for different subjects")
+	}
+}
+
 /*******************************************************************************
  * Private
  ******************************************************************************/
@@ -265,6 +338,7 @@ func newTestServers(publicServerURL, protectedServerURL string, permissionsCache
 	publicServer = &testPublicServer{
 		usersChangedChannel: make(chan []string, 1),
 		permissionsCache:    permissionsCache,
+		keyURLs:             make(map[string]string),
 	}
 
 	publicListener, err := net.Listen("tcp", publicServerURL)
@@ -390,6 +464,16 @@ func (server *testPublicServer) SubscribeUsersChanged(req *empty.Empty,
 	}
 }
 
+func (server *testPublicServer) GetCert(ctx context.Context, req *pb.GetCertRequest) (rsp *pb.GetCertResponse,
+	err error) {
+	keyURL, ok := server.keyURLs[req.Type]
+	if !ok {
+		return nil, aoserrors.Errorf("certificate %s not found", req.Type)
+	}
+
+	return &pb.GetCertResponse{Type: req.Type, KeyUrl: keyURL}, nil
+}
+
 func (server *testProtectedServer) findServiceID(serviceID string) (secret string) {
 	for key, value := range server.permissionsCache {
 		if value.serviceID == serviceID {
@@ -0,0 +1,830 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+const (
+	backupVersion      = 2
+	backupManifestName = "backup.json"
+	backupDataDir      = "data"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// backupManifest describes backup archive content, it is the first entry of the archive
+type backupManifest struct {
+	Version  int             `json:"version"`
+	Created  time.Time       `json:"created"`
+	Services []backupService `json:"services"`
+}
+
+// backupService service DB record. Service image and layers are not saved: they should be installed before
+// restore, so the record identifies service and layers versions to be installed.
+type backupService struct {
+	ServiceID       string          `json:"serviceId"`
+	AosVersion      uint64          `json:"aosVersion"`
+	VendorVersion   string          `json:"vendorVersion,omitempty"`
+	ServiceProvider string          `json:"serviceProvider,omitempty"`
+	Description     string          `json:"description,omitempty"`
+	AlertRules      string          `json:"alertRules,omitempty"`
+	ManifestDigest  []byte          `json:"manifestDigest,omitempty"`
+	UID             uint32          `json:"uid"`
+	GID             uint32          `json:"gid"`
+	Layers          []backupLayer   `json:"layers,omitempty"`
+	Subjects        []backupSubject `json:"subjects"`
+}
+
+type backupLayer struct {
+	LayerID       string `json:"layerId"`
+	Digest        string `json:"digest"`
+	AosVersion    uint64 `json:"aosVersion"`
+	VendorVersion string `json:"vendorVersion,omitempty"`
+}
+
+type backupSubject struct {
+	SubjectID string `json:"subjectId"`
+	// archive dir with storage folder content, empty if subject has no storage
+	DataDir       string           `json:"dataDir,omitempty"`
+	StateChecksum []byte           `json:"stateChecksum,omitempty"`
+	EnvVars       []*pb.EnvVarInfo `json:"envVars,omitempty"`
+}
+
+// restoreItem subject data restored from backup
+type restoreItem struct {
+	service       Service
+	backupUID     uint32
+	backupGID     uint32
+	subject       backupSubject
+	storageFolder string
+	applied       bool
+}
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// BackupServices saves storages, states and env vars overrides of services to signed archive. All installed
+// services are saved if serviceIDs is empty. Running instances are stopped while their data is saved.
+func (launcher *Launcher) BackupServices(archivePath string, serviceIDs []string) (backedUp []string, err error) {
+	launcher.usersMutex.RLock()
+	defer launcher.usersMutex.RUnlock()
+
+	log.WithFields(log.Fields{"archive": archivePath, "services": serviceIDs}).Debug("Backup services")
+
+	if launcher.backupSigner == nil {
+		return nil, aoserrors.New("backup signer is not set")
+	}
+
+	services, err := launcher.getBackupServices(serviceIDs)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	manifest, folders, err := launcher.createBackupManifest(services)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	instances := launcher.getRunningInstances(func(instance *serviceInstance) bool {
+		return isBackupService(manifest, instance.service.ID)
+	})
+
+	launcher.stopInstances(instances)
+	defer launcher.startInstances(instances)
+
+	defer func() {
+		if err != nil {
+			os.Remove(archivePath)
+		}
+	}()
+
+	if err = writeBackupArchive(archivePath, manifest, folders); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if err = launcher.backupSigner.SignFile(archivePath); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	for _, service := range manifest.Services {
+		backedUp = append(backedUp, service.ServiceID)
+	}
+
+	log.WithFields(log.Fields{"archive": archivePath, "services": backedUp}).Info("Services backed up")
+
+	return backedUp, nil
+}
+
+// RestoreServices restores services data from signed archive. All services of the archive are restored if
+// serviceIDs is empty. Services should be installed on the unit, files owned by service UID/GID of the archive
+// are remapped to UID/GID allocated for the service on this unit.
+func (launcher *Launcher) RestoreServices(archivePath string, serviceIDs []string) (restored []string, err error) {
+	launcher.usersMutex.RLock()
+	defer launcher.usersMutex.RUnlock()
+
+	log.WithFields(log.Fields{"archive": archivePath, "services": serviceIDs}).Debug("Restore services")
+
+	if launcher.backupSigner == nil {
+		return nil, aoserrors.New("backup signer is not set")
+	}
+
+	file, err := os.OpenFile(archivePath, os.O_RDONLY|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	// verify exactly the opened file as archive path may be replaced after verification
+	if err = launcher.backupSigner.Verify(archivePath, file); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+	defer gzReader.Close()
+
+	tarReader := tar.NewReader(gzReader)
+
+	manifest, err := readBackupManifest(tarReader)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	var items []*restoreItem
+
+	defer func() {
+		for _, item := range items {
+			if !item.applied && item.storageFolder != "" {
+				os.RemoveAll(item.storageFolder)
+			}
+		}
+	}()
+
+	if items, err = launcher.prepareRestore(manifest, serviceIDs); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if err = extractBackupData(tarReader, items); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if restored, err = launcher.applyRestore(items); err != nil {
+		return restored, aoserrors.Wrap(err)
+	}
+
+	log.WithFields(log.Fields{"archive": archivePath, "services": restored}).Info("Services restored")
+
+	return restored, nil
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func (launcher *Launcher) getBackupServices(serviceIDs []string) (services []Service, err error) {
+	if len(serviceIDs) == 0 {
+		if services, err = launcher.serviceProvider.GetServices(); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		return services, nil
+	}
+
+	for _, serviceID := range serviceIDs {
+		service, err := launcher.serviceProvider.GetService(serviceID)
+		if err != nil {
+			return nil, aoserrors.Errorf("can't get service %s: %s", serviceID, err)
+		}
+
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+func (launcher *Launcher) createBackupManifest(
+	services []Service) (manifest backupManifest, folders map[string]string, err error) {
+	manifest = backupManifest{Version: backupVersion, Created: time.Now().UTC()}
+	folders = make(map[string]string)
+
+	envVars, err := launcher.serviceProvider.GetAllOverrideEnvVars()
+	if err != nil {
+		return manifest, nil, aoserrors.Wrap(err)
+	}
+
+	for _, service := range services {
+		serviceBackup := backupService{
+			ServiceID: service.ID, AosVersion: service.AosVersion, VendorVersion: service.VendorVersion,
+			ServiceProvider: service.ServiceProvider, Description: service.Description, AlertRules: service.AlertRules,
+			ManifestDigest: service.ManifestDigest, UID: service.UID, GID: service.GID,
+		}
+
+		if serviceBackup.Layers, err = launcher.getBackupLayers(service); err != nil {
+			return manifest, nil, aoserrors.Wrap(err)
+		}
+
+		subjectServices, err := launcher.serviceProvider.GetSubjectServicesByServiceID(service.ID)
+		if err != nil {
+			return manifest, nil, aoserrors.Wrap(err)
+		}
+
+		for _, subjectService := range subjectServices {
+			subject := backupSubject{SubjectID: subjectService.SubjectID}
+
+			for i := range envVars {
+				if envVars[i].SubjectId == subject.SubjectID && envVars[i].ServiceId == service.ID {
+					subject.EnvVars = envVars[i].Vars
+				}
+			}
+
+			if subjectService.StorageFolder != "" {
+				if launcher.storageHandler.isStorageLocked(subject.SubjectID, subjectService.StorageFolder) {
+					log.WithFields(log.Fields{
+						"serviceID": service.ID, "subjectID": subject.SubjectID,
+					}).Warn("Subject storage is locked and not backed up")
+				} else {
+					subject.DataDir = path.Join(backupDataDir, strconv.Itoa(len(folders)))
+					subject.StateChecksum = subjectService.StateChecksum
+					folders[subject.DataDir] = subjectService.StorageFolder
+				}
+			}
+
+			serviceBackup.Subjects = append(serviceBackup.Subjects, subject)
+		}
+
+		manifest.Services = append(manifest.Services, serviceBackup)
+	}
+
+	return manifest, folders, nil
+}
+
+func (launcher *Launcher) getBackupLayers(service Service) (layers []backupLayer, err error) {
+	digests, err := getServiceLayers(service.Path)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	for _, digest := range digests {
+		layer, err := launcher.layerProvider.GetLayerInfoByDigest(digest)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		layers = append(layers, backupLayer{
+			LayerID: layer.LayerId, Digest: digest, AosVersion: layer.AosVersion, VendorVersion: layer.VendorVersion,
+		})
+	}
+
+	return layers, nil
+}
+
+func (launcher *Launcher) prepareRestore(manifest backupManifest,
+	serviceIDs []string) (items []*restoreItem, err error) {
+	for _, serviceID := range serviceIDs {
+		if !isBackupService(manifest, serviceID) {
+			return items, aoserrors.Errorf("service %s is not found in backup", serviceID)
+		}
+	}
+
+	for _, serviceBackup := range manifest.Services {
+		if len(serviceIDs) != 0 && !containsString(serviceIDs, serviceBackup.ServiceID) {
+			continue
+		}
+
+		service, err := launcher.serviceProvider.GetService(serviceBackup.ServiceID)
+		if err != nil {
+			return items, aoserrors.Errorf("service %s is not installed, install %s before restore: %s",
+				serviceBackup.ServiceID, getBackupInstallInfo(serviceBackup), err)
+		}
+
+		if service.AosVersion < serviceBackup.AosVersion {
+			return items, aoserrors.Errorf("service %s version %d is older than backup, install %s before restore",
+				service.ID, service.AosVersion, getBackupInstallInfo(serviceBackup))
+		}
+
+		if !launcher.idsPool.isAllocated(service.UID, service.GID) {
+			return items, aoserrors.Errorf("UID/GID of service %s is not allocated", service.ID)
+		}
+
+		for _, subject := range serviceBackup.Subjects {
+			item := &restoreItem{
+				service: service, backupUID: serviceBackup.UID, backupGID: serviceBackup.GID, subject: subject,
+			}
+
+			if subject.DataDir != "" {
+				if item.storageFolder, err = launcher.storageHandler.newStorageFolder(
+					subject.SubjectID, service.UID, service.GID); err != nil {
+					return items, aoserrors.Wrap(err)
+				}
+			}
+
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+func (launcher *Launcher) applyRestore(items []*restoreItem) (restored []string, err error) {
+	var serviceIDs []string
+
+	for _, item := range items {
+		if !containsString(serviceIDs, item.service.ID) {
+			serviceIDs = append(serviceIDs, item.service.ID)
+		}
+	}
+
+	for _, serviceID := range serviceIDs {
+		instances := launcher.getRunningInstances(func(instance *serviceInstance) bool {
+			return instance.service.ID == serviceID
+		})
+
+		launcher.stopInstances(instances)
+
+		for _, item := range items {
+			if item.service.ID != serviceID {
+				continue
+			}
+
+			if err = launcher.restoreSubjectData(item); err != nil {
+				break
+			}
+		}
+
+		if syncErr := launcher.envVarsProvider.syncEnvVarsWithStorage(); syncErr != nil && err == nil {
+			err = syncErr
+		}
+
+		launcher.startInstances(instances)
+
+		if err != nil {
+			return restored, aoserrors.Wrap(err)
+		}
+
+		restored = append(restored, serviceID)
+	}
+
+	return restored, nil
+}
+
+func (launcher *Launcher) restoreSubjectData(item *restoreItem) (err error) {
+	subjectID, service := item.subject.SubjectID, item.service
+
+	log.WithFields(log.Fields{"serviceID": service.ID, "subjectID": subjectID}).Debug("Restore subject data")
+
+	subjectService, err := launcher.serviceProvider.GetSubjectService(subjectID, service.ID)
+	if err != nil {
+		if !strings.Contains(err.Error(), "not exist") {
+			return aoserrors.Wrap(err)
+		}
+
+		if err = launcher.serviceProvider.AddSubjectService(SubjectService{
+			SubjectID: subjectID,
+			ServiceID: service.ID,
+			UnitName:  launcher.newServiceInstance(service, subjectID).unitName,
+		}); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	if item.storageFolder != "" {
+		if err = launcher.serviceProvider.SetSubjectStorageFolder(
+			subjectID, service.ID, item.storageFolder); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		item.applied = true
+
+		if subjectService.StorageFolder != "" {
+			if err = os.RemoveAll(subjectService.StorageFolder); err != nil {
+				log.WithField("folder", subjectService.StorageFolder).Errorf("Can't remove storage folder: %s", err)
+			}
+		}
+
+		if err = launcher.serviceProvider.SetSubjectStateChecksum(
+			subjectID, service.ID, item.subject.StateChecksum); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	if err = launcher.serviceProvider.UpdateOverrideEnvVars(subjectID, service.ID, item.subject.EnvVars); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// isStorageLocked checks if storage folder is in encrypted dir of inactive subject
+func (handler *storageHandler) isStorageLocked(subjectID, storageFolder string) (locked bool) {
+	if handler.encryptor == nil || !handler.encryptor.isSubjectFolder(subjectID, storageFolder) {
+		return false
+	}
+
+	_, err := handler.encryptor.getSubjectDir(subjectID)
+
+	return err != nil
+}
+
+// newStorageFolder creates empty storage folder in storage dir or in encrypted subject dir
+func (handler *storageHandler) newStorageFolder(subjectID string, uid, gid uint32) (storageFolder string, err error) {
+	storageDir := handler.storageDir
+
+	if handler.encryptor != nil {
+		if storageDir, err = handler.encryptor.getSubjectDir(subjectID); err != nil {
+			return "", aoserrors.Wrap(err)
+		}
+	}
+
+	if storageFolder, err = createStorageFolder(storageDir, uid, gid); err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	return storageFolder, nil
+}
+
+func writeBackupArchive(fileName string, manifest backupManifest, folders map[string]string) (err error) {
+	// existing file or symlink is replaced, new archive is never written through symlink
+	if err = os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+		return aoserrors.Wrap(err)
+	}
+
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY|unix.O_NOFOLLOW, 0o600)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	gzWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzWriter)
+
+	manifestData, err := json.Marshal(&manifest)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = tarWriter.WriteHeader(&tar.Header{
+		Name: backupManifestName, Typeflag: tar.TypeReg, Mode: 0o600,
+		Size: int64(len(manifestData)), ModTime: manifest.Created,
+	}); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if _, err = tarWriter.Write(manifestData); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	for _, service := range manifest.Services {
+		for _, subject := range service.Subjects {
+			if subject.DataDir == "" {
+				continue
+			}
+
+			if err = addFolderToBackup(tarWriter, folders[subject.DataDir], subject.DataDir); err != nil {
+				return aoserrors.Wrap(err)
+			}
+		}
+	}
+
+	if err = tarWriter.Close(); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = gzWriter.Close(); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return aoserrors.Wrap(file.Close())
+}
+
+func addFolderToBackup(tarWriter *tar.Writer, folder, archiveDir string) (err error) {
+	return aoserrors.Wrap(filepath.Walk(folder, func(fileName string, info os.FileInfo, err error) error {
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		relName, err := filepath.Rel(folder, fileName)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if relName == "." {
+			return nil
+		}
+
+		// overlay work dir content is not persistent
+		if relName == workDirName && info.IsDir() {
+			return filepath.SkipDir
+		}
+
+		link := ""
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(fileName); err != nil {
+				return aoserrors.Wrap(err)
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			log.WithField("file", fileName).Warnf("File is not backed up: %s", err)
+
+			return nil
+		}
+
+		header.Name = path.Join(archiveDir, filepath.ToSlash(relName))
+		header.Uname, header.Gname = "", ""
+
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err = tarWriter.WriteHeader(header); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		file, err := os.Open(fileName)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+		defer file.Close()
+
+		if _, err = io.Copy(tarWriter, file); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		return nil
+	}))
+}
+
+func readBackupManifest(tarReader *tar.Reader) (manifest backupManifest, err error) {
+	header, err := tarReader.Next()
+	if err != nil {
+		return manifest, aoserrors.Wrap(err)
+	}
+
+	if header.Name != backupManifestName {
+		return manifest, aoserrors.Errorf("backup manifest not found")
+	}
+
+	data, err := ioutil.ReadAll(tarReader)
+	if err != nil {
+		return manifest, aoserrors.Wrap(err)
+	}
+
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return manifest, aoserrors.Wrap(err)
+	}
+
+	// version 1 archives have no service records, their data is restored in the same way
+	if manifest.Version < 1 || manifest.Version > backupVersion {
+		return manifest, aoserrors.Errorf("unsupported backup version: %d", manifest.Version)
+	}
+
+	return manifest, nil
+}
+
+func extractBackupData(tarReader *tar.Reader, items []*restoreItem) (err error) {
+	dataDirs := make(map[string]*restoreItem)
+
+	for _, item := range items {
+		if item.subject.DataDir != "" {
+			dataDirs[item.subject.DataDir] = item
+		}
+	}
+
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return aoserrors.Wrap(err)
+		}
+
+		parts := strings.SplitN(path.Clean(header.Name), "/", 3) // nolint:gomnd
+
+		if len(parts) < 2 || parts[0] != backupDataDir {
+			return aoserrors.Errorf("unexpected backup entry: %s", header.Name)
+		}
+
+		item, ok := dataDirs[path.Join(parts[0], parts[1])]
+		if !ok || len(parts) < 3 {
+			continue
+		}
+
+		if err = extractBackupEntry(tarReader, header, item, filepath.FromSlash(parts[2])); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+}
+
+func extractBackupEntry(reader io.Reader, header *tar.Header, item *restoreItem, relName string) (err error) {
+	fileName := filepath.Join(item.storageFolder, relName)
+
+	// parent dir should not be redirected out of storage folder by restored symlinks
+	parentDir, err := filepath.EvalSymlinks(filepath.Dir(fileName))
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if parentDir != item.storageFolder && !strings.HasPrefix(parentDir, item.storageFolder+string(os.PathSeparator)) {
+		return aoserrors.Errorf("backup entry %s is out of storage folder", header.Name)
+	}
+
+	// overlay whiteouts are the only device nodes which can be restored
+	if (header.Typeflag == tar.TypeChar && (header.Devmajor != 0 || header.Devminor != 0)) ||
+		header.Typeflag == tar.TypeBlock {
+		return aoserrors.Errorf("backup entry %s is not allowed device", header.Name)
+	}
+
+	if err = removeBackupEntryTarget(fileName, header.Typeflag); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	mode := os.FileMode(header.Mode).Perm()
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err = os.Mkdir(fileName, mode); err != nil && !os.IsExist(err) {
+			return aoserrors.Wrap(err)
+		}
+
+	case tar.TypeReg:
+		file, err := os.OpenFile(fileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY|unix.O_NOFOLLOW, mode)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		_, err = io.Copy(file, reader) // nolint:gosec // archive is signed
+
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+	case tar.TypeSymlink:
+		if err = os.Symlink(header.Linkname, fileName); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+	// overlay whiteouts are stored as char devices
+	case tar.TypeChar:
+		if err = unix.Mknod(fileName, unix.S_IFCHR|uint32(mode), int(unix.Mkdev(0, 0))); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+	default:
+		log.WithField("entry", header.Name).Warn("Unsupported backup entry type")
+
+		return nil
+	}
+
+	if err = os.Lchown(fileName, int(remapPoolID(uint32(header.Uid), item.backupUID, item.service.UID)),
+		int(remapPoolID(uint32(header.Gid), item.backupGID, item.service.GID))); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if header.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+
+	// mode is set after chown as chown clears setuid and setgid bits
+	if err = os.Chmod(fileName, os.FileMode(header.Mode).Perm()|getSpecialMode(header.Mode)); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	// dir modification time is changed by its entries
+	if header.Typeflag == tar.TypeDir {
+		return nil
+	}
+
+	if err = os.Chtimes(fileName, header.ModTime, header.ModTime); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// removeBackupEntryTarget removes existing file which would be replaced by backup entry. Only real dir is kept
+// for dir entry, so entries are never written through symlinks restored by previous entries.
+func removeBackupEntryTarget(fileName string, entryType byte) (err error) {
+	info, err := os.Lstat(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return aoserrors.Wrap(err)
+	}
+
+	if entryType == tar.TypeDir && info.IsDir() {
+		return nil
+	}
+
+	if err = os.RemoveAll(fileName); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func getSpecialMode(mode int64) (fileMode os.FileMode) {
+	if mode&unix.S_ISUID != 0 {
+		fileMode |= os.ModeSetuid
+	}
+
+	if mode&unix.S_ISGID != 0 {
+		fileMode |= os.ModeSetgid
+	}
+
+	if mode&unix.S_ISVTX != 0 {
+		fileMode |= os.ModeSticky
+	}
+
+	return fileMode
+}
+
+// getBackupInstallInfo describes service and layers versions which should be installed to restore service data
+func getBackupInstallInfo(service backupService) (info string) {
+	info = "service version " + strconv.FormatUint(service.AosVersion, 10)
+
+	for _, layer := range service.Layers {
+		info += ", layer " + layer.LayerID + " version " + strconv.FormatUint(layer.AosVersion, 10) +
+			" (" + layer.Digest + ")"
+	}
+
+	return info
+}
+
+func isBackupService(manifest backupManifest, serviceID string) (result bool) {
+	for _, service := range manifest.Services {
+		if service.ServiceID == serviceID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(items []string, value string) (result bool) {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,319 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher //nolint
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+
+	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestBackupArchive(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Root privileges are required to change file owners")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "backup_")
+	if err != nil {
+		t.Fatalf("Can't create tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	const (
+		backupUID, backupGID   = 5001, 5002
+		serviceUID, serviceGID = 5010, 5020
+	)
+
+	storageFolder, err := createStorageFolder(tmpDir, backupUID, backupGID)
+	if err != nil {
+		t.Fatalf("Can't create storage folder: %s", err)
+	}
+
+	writeTestFile(t, path.Join(storageFolder, upperDirName, "data"), "service data", backupUID, backupGID)
+	writeTestFile(t, path.Join(storageFolder, workDirName, "tmp"), "work data", backupUID, backupGID)
+	writeTestFile(t, path.Join(storageFolder, stateFile), "state", backupUID, backupGID)
+
+	if err = os.Mkdir(path.Join(storageFolder, stateHistoryDirName), 0o700); err != nil {
+		t.Fatalf("Can't create state history dir: %s", err)
+	}
+
+	writeTestFile(t, path.Join(storageFolder, stateHistoryDirName, "1"+stateSnapshotSuffix), "state", 0, 0)
+
+	if err = os.Symlink("data", path.Join(storageFolder, upperDirName, "link")); err != nil {
+		t.Fatalf("Can't create symlink: %s", err)
+	}
+
+	manifest := backupManifest{
+		Version: backupVersion,
+		Created: time.Now().UTC(),
+		Services: []backupService{{
+			ServiceID: "service1", UID: backupUID, GID: backupGID,
+			Subjects: []backupSubject{{
+				SubjectID: "subject1", DataDir: path.Join(backupDataDir, "0"), StateChecksum: []byte{1, 2, 3},
+				EnvVars: []*pb.EnvVarInfo{{VarId: "var1", Variable: "NAME=value"}},
+			}},
+		}},
+	}
+
+	archive := path.Join(tmpDir, "backup.tar.gz")
+
+	if err = writeBackupArchive(archive, manifest,
+		map[string]string{path.Join(backupDataDir, "0"): storageFolder}); err != nil {
+		t.Fatalf("Can't write backup archive: %s", err)
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		t.Fatalf("Can't open backup archive: %s", err)
+	}
+	defer file.Close()
+
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Can't create gzip reader: %s", err)
+	}
+
+	tarReader := tar.NewReader(gzReader)
+
+	restoredManifest, err := readBackupManifest(tarReader)
+	if err != nil {
+		t.Fatalf("Can't read backup manifest: %s", err)
+	}
+
+	if len(restoredManifest.Services) != 1 || len(restoredManifest.Services[0].Subjects) != 1 ||
+		restoredManifest.Services[0].Subjects[0].EnvVars[0].Variable != "NAME=value" {
+		t.Fatalf("Wrong backup manifest: %+v", restoredManifest)
+	}
+
+	restoreFolder, err := createStorageFolder(tmpDir, serviceUID, serviceGID)
+	if err != nil {
+		t.Fatalf("Can't create storage folder: %s", err)
+	}
+
+	item := &restoreItem{
+		service:   Service{ID: "service1", UID: serviceUID, GID: serviceGID},
+		backupUID: backupUID, backupGID: backupGID,
+		subject:       restoredManifest.Services[0].Subjects[0],
+		storageFolder: restoreFolder,
+	}
+
+	if err = extractBackupData(tarReader, []*restoreItem{item}); err != nil {
+		t.Fatalf("Can't extract backup data: %s", err)
+	}
+
+	checkTestFile(t, path.Join(restoreFolder, upperDirName, "data"), "service data", serviceUID, serviceGID)
+	checkTestFile(t, path.Join(restoreFolder, stateFile), "state", serviceUID, serviceGID)
+	checkTestFile(t, path.Join(restoreFolder, stateHistoryDirName, "1"+stateSnapshotSuffix), "state", 0, 0)
+
+	if link, err := os.Readlink(path.Join(restoreFolder, upperDirName, "link")); err != nil || link != "data" {
+		t.Errorf("Wrong symlink: %s, %v", link, err)
+	}
+
+	if _, err = os.Stat(path.Join(restoreFolder, workDirName, "tmp")); !os.IsNotExist(err) {
+		t.Error("Work dir content should not be restored")
+	}
+}
+
+func TestBackupSymlinks(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Root privileges are required to change file owners")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "backup_")
+	if err != nil {
+		t.Fatalf("Can't create tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	outsideFile := path.Join(tmpDir, "outside")
+
+	writeTestFile(t, outsideFile, "outside data", 0, 0)
+
+	// archive is not written through symlink
+	archive := path.Join(tmpDir, "backup.tar.gz")
+
+	if err = os.Symlink(outsideFile, archive); err != nil {
+		t.Fatalf("Can't create symlink: %s", err)
+	}
+
+	if err = writeBackupArchive(archive, backupManifest{Version: backupVersion}, nil); err != nil {
+		t.Fatalf("Can't write backup archive: %s", err)
+	}
+
+	checkTestFile(t, outsideFile, "outside data", 0, 0)
+
+	// restored symlink is replaced by next entry with the same name
+	var buffer bytes.Buffer
+
+	tarWriter := tar.NewWriter(&buffer)
+
+	for _, header := range []*tar.Header{
+		{Name: "data/0/link", Typeflag: tar.TypeSymlink, Linkname: outsideFile, Mode: 0o777},
+		{Name: "data/0/link", Typeflag: tar.TypeReg, Mode: 0o600, Size: int64(len("payload"))},
+	} {
+		if err = tarWriter.WriteHeader(header); err != nil {
+			t.Fatalf("Can't write tar header: %s", err)
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			if _, err = tarWriter.Write([]byte("payload")); err != nil {
+				t.Fatalf("Can't write tar entry: %s", err)
+			}
+		}
+	}
+
+	if err = tarWriter.Close(); err != nil {
+		t.Fatalf("Can't close tar writer: %s", err)
+	}
+
+	restoreFolder := path.Join(tmpDir, "restore")
+
+	if err = os.Mkdir(restoreFolder, 0o700); err != nil {
+		t.Fatalf("Can't create restore folder: %s", err)
+	}
+
+	item := &restoreItem{subject: backupSubject{DataDir: "data/0"}, storageFolder: restoreFolder}
+
+	if err = extractBackupData(tar.NewReader(&buffer), []*restoreItem{item}); err != nil {
+		t.Fatalf("Can't extract backup data: %s", err)
+	}
+
+	checkTestFile(t, outsideFile, "outside data", 0, 0)
+	checkTestFile(t, path.Join(restoreFolder, "link"), "payload", 0, 0)
+}
+
+func TestBackupDevices(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Root privileges are required to create device nodes")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "backup_")
+	if err != nil {
+		t.Fatalf("Can't create tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	restoreFolder := path.Join(tmpDir, "restore")
+
+	if err = os.Mkdir(restoreFolder, 0o700); err != nil {
+		t.Fatalf("Can't create restore folder: %s", err)
+	}
+
+	item := &restoreItem{subject: backupSubject{DataDir: "data/0"}, storageFolder: restoreFolder}
+
+	testData := []struct {
+		header  tar.Header
+		allowed bool
+	}{
+		{header: tar.Header{Name: "data/0/whiteout", Typeflag: tar.TypeChar, Mode: 0o600}, allowed: true},
+		{header: tar.Header{Name: "data/0/mem", Typeflag: tar.TypeChar, Mode: 0o600, Devmajor: 1, Devminor: 1}},
+		{header: tar.Header{Name: "data/0/null", Typeflag: tar.TypeChar, Mode: 0o600, Devminor: 3}},
+		{header: tar.Header{Name: "data/0/disk", Typeflag: tar.TypeBlock, Mode: 0o600, Devmajor: 8}},
+	}
+
+	for _, data := range testData {
+		var buffer bytes.Buffer
+
+		tarWriter := tar.NewWriter(&buffer)
+
+		header := data.header
+
+		if err = tarWriter.WriteHeader(&header); err != nil {
+			t.Fatalf("Can't write tar header: %s", err)
+		}
+
+		if err = tarWriter.Close(); err != nil {
+			t.Fatalf("Can't close tar writer: %s", err)
+		}
+
+		err = extractBackupData(tar.NewReader(&buffer), []*restoreItem{item})
+
+		if data.allowed && err != nil {
+			t.Errorf("Can't extract %s: %s", header.Name, err)
+		}
+
+		if !data.allowed && err == nil {
+			t.Errorf("Error expected for %s", header.Name)
+		}
+
+		info, statErr := os.Lstat(path.Join(restoreFolder, path.Base(header.Name)))
+
+		if data.allowed {
+			if statErr != nil || info.Mode()&os.ModeCharDevice == 0 {
+				t.Errorf("Whiteout is not created: %v", statErr)
+			}
+
+			continue
+		}
+
+		if !os.IsNotExist(statErr) {
+			t.Errorf("Device %s should not be created", header.Name)
+		}
+	}
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func writeTestFile(t *testing.T, fileName, content string, uid, gid int) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(fileName, []byte(content), 0o600); err != nil {
+		t.Fatalf("Can't write file: %s", err)
+	}
+
+	if err := os.Chown(fileName, uid, gid); err != nil {
+		t.Fatalf("Can't change file owner: %s", err)
+	}
+}
+
+func checkTestFile(t *testing.T, fileName, content string, uid, gid uint32) {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("Can't read file: %s", err)
+	}
+
+	if string(data) != content {
+		t.Errorf("Wrong file content: %s", data)
+	}
+
+	info, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatalf("Can't stat file: %s", err)
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Uid != uid || stat.Gid != gid {
+		t.Errorf("Wrong file owner: %+v", info.Sys())
+	}
+}
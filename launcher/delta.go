@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_servicemanager/utils/imageutils"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// deltaImageInfo describes delta service image. Rootfs layer of delta image contains only added and
+// changed files relative to the base service rootfs.
+type deltaImageInfo struct {
+	// hex encoded sha256 of the base service manifest
+	BaseDigest string `json:"baseDigest"`
+	// files and directories removed from the base rootfs
+	Removed []string `json:"removed,omitempty"`
+	// full service image used if base service doesn't match
+	FullImage *fullImageInfo `json:"fullImage,omitempty"`
+}
+
+type fullImageInfo struct {
+	URL    string `json:"url"`
+	Sha256 string `json:"sha256"`
+	Sha512 string `json:"sha512"`
+	Size   uint64 `json:"size"`
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+// isDeltaApplicable checks that delta image is created against installed service version
+func isDeltaApplicable(delta *deltaImageInfo, serviceExists bool, service Service) (result bool) {
+	return serviceExists && delta.BaseDigest == hex.EncodeToString(service.ManifestDigest)
+}
+
+// applyDelta creates rootfs from base rootfs and delta layer. Unchanged files are hard linked to the base
+// rootfs, so base rootfs stays intact and may be used for rollback.
+func applyDelta(baseRootfsDir, deltaLayerPath, rootfsDir string, removed []string, uid, gid uint32) (err error) {
+	log.WithFields(log.Fields{"base": baseRootfsDir, "rootfs": rootfsDir}).Debug("Apply delta layer")
+
+	if err = linkTree(baseRootfsDir, rootfsDir); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	for _, name := range removed {
+		fullName, err := securePath(rootfsDir, name)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if err = checkPathParents(rootfsDir, fullName); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if err = os.RemoveAll(fullName); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	// Unpack delta next to rootfs to be able to move files instead of copying
+	deltaDir, err := ioutil.TempDir(path.Dir(rootfsDir), "delta")
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer os.RemoveAll(deltaDir)
+
+	if err = imageutils.UnpackTarImage(deltaLayerPath, deltaDir); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = chownTree(deltaDir, uid, gid); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = mergeTree(deltaDir, rootfsDir); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// linkTree recreates directories of source tree and hard links all other entries
+func linkTree(sourceDir, destDir string) (err error) {
+	return aoserrors.Wrap(filepath.Walk(sourceDir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		relName, err := filepath.Rel(sourceDir, name)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		destName := filepath.Join(destDir, relName)
+
+		if !info.IsDir() {
+			return aoserrors.Wrap(os.Link(name, destName))
+		}
+
+		if err = os.MkdirAll(destName, info.Mode().Perm()); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		// MkdirAll permissions are affected by umask
+		if err = os.Chmod(destName, info.Mode()); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		return aoserrors.Wrap(copyOwner(info, destName))
+	}))
+}
+
+// mergeTree moves entries of source tree into destination tree replacing existing entries
+func mergeTree(sourceDir, destDir string) (err error) {
+	return aoserrors.Wrap(filepath.Walk(sourceDir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		relName, err := filepath.Rel(sourceDir, name)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		// Delta root is temporary dir, keep rootfs dir attributes
+		if relName == "." {
+			return nil
+		}
+
+		destName := filepath.Join(destDir, relName)
+
+		if err = checkPathParents(destDir, destName); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if info.IsDir() {
+			if destInfo, err := os.Lstat(destName); err == nil && !destInfo.IsDir() {
+				if err = os.Remove(destName); err != nil {
+					return aoserrors.Wrap(err)
+				}
+			}
+
+			if err = os.MkdirAll(destName, info.Mode().Perm()); err != nil {
+				return aoserrors.Wrap(err)
+			}
+
+			if err = os.Chmod(destName, info.Mode()); err != nil {
+				return aoserrors.Wrap(err)
+			}
+
+			return aoserrors.Wrap(copyOwner(info, destName))
+		}
+
+		if err = os.RemoveAll(destName); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		return aoserrors.Wrap(os.Rename(name, destName))
+	}))
+}
+
+func chownTree(dir string, uid, gid uint32) (err error) {
+	return aoserrors.Wrap(filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		return aoserrors.Wrap(os.Lchown(name, int(uid), int(gid)))
+	}))
+}
+
+func copyOwner(info os.FileInfo, name string) (err error) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	return aoserrors.Wrap(os.Lchown(name, int(stat.Uid), int(stat.Gid)))
+}
+
+// securePath returns full path of name inside root dir and checks that it doesn't point outside root dir
+func securePath(rootDir, name string) (fullName string, err error) {
+	fullName = filepath.Join(rootDir, filepath.Clean("/"+name))
+
+	if fullName == filepath.Clean(rootDir) || !strings.HasPrefix(fullName, filepath.Clean(rootDir)+"/") {
+		return "", aoserrors.Errorf("invalid path: %s", name)
+	}
+
+	return fullName, nil
+}
+
+// checkPathParents checks that parent dirs of full name inside root dir are not symlinks. Rootfs hard linked from
+// the base rootfs keeps its symlinks as is, so following them may lead outside of rootfs.
+func checkPathParents(rootDir, fullName string) (err error) {
+	relName, err := filepath.Rel(rootDir, filepath.Dir(fullName))
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if relName == "." {
+		return nil
+	}
+
+	curName := rootDir
+
+	for _, element := range strings.Split(relName, string(filepath.Separator)) {
+		curName = filepath.Join(curName, element)
+
+		info, err := os.Lstat(curName)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return aoserrors.Wrap(err)
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return aoserrors.Errorf("path contains symlink: %s", curName)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher //nolint
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestApplyDelta(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "delta_")
+	if err != nil {
+		t.Fatalf("Can't create test dir: %s", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	baseDir := path.Join(testDir, "base")
+
+	writeTestFiles(t, baseDir, map[string]string{
+		"bin/app":       "app v1",
+		"etc/app.conf":  "config v1",
+		"etc/obsolete":  "obsolete",
+		"share/data":    "data",
+		"share/old/old": "old",
+	})
+
+	deltaDir := path.Join(testDir, "delta")
+
+	writeTestFiles(t, deltaDir, map[string]string{
+		"bin/app":     "app v2",
+		"etc/new.cfg": "new",
+	})
+
+	deltaLayer := path.Join(testDir, "delta.tar.gz")
+
+	if err = packImage(deltaDir, deltaLayer); err != nil {
+		t.Fatalf("Can't pack delta layer: %s", err)
+	}
+
+	installDir := path.Join(testDir, "install")
+
+	if err = os.MkdirAll(installDir, 0o755); err != nil {
+		t.Fatalf("Can't create install dir: %s", err)
+	}
+
+	rootfsDir := path.Join(installDir, serviceRootfsDir)
+
+	if err = applyDelta(baseDir, deltaLayer, rootfsDir, []string{"etc/obsolete", "/share/old"},
+		uint32(os.Getuid()), uint32(os.Getgid())); err != nil {
+		t.Fatalf("Can't apply delta: %s", err)
+	}
+
+	checkTestFiles(t, rootfsDir, map[string]string{
+		"bin/app":      "app v2",
+		"etc/app.conf": "config v1",
+		"etc/new.cfg":  "new",
+		"share/data":   "data",
+	}, []string{"etc/obsolete", "share/old"})
+
+	// Base rootfs should stay unchanged
+	checkTestFiles(t, baseDir, map[string]string{
+		"bin/app":       "app v1",
+		"etc/obsolete":  "obsolete",
+		"share/old/old": "old",
+	}, []string{"etc/new.cfg"})
+
+	// Temporary delta dir should be removed
+	items, err := ioutil.ReadDir(installDir)
+	if err != nil {
+		t.Fatalf("Can't read install dir: %s", err)
+	}
+
+	if len(items) != 1 {
+		t.Errorf("Unexpected install dir content: %d items", len(items))
+	}
+
+	if err = applyDelta(baseDir, deltaLayer, path.Join(testDir, "invalid"), []string{".."},
+		uint32(os.Getuid()), uint32(os.Getgid())); err == nil {
+		t.Error("Error expected")
+	}
+
+	if _, err = os.Stat(path.Join(baseDir, "bin/app")); err != nil {
+		t.Errorf("Base file should not be removed: %s", err)
+	}
+}
+
+func TestApplyDeltaSymlinks(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "delta_")
+	if err != nil {
+		t.Fatalf("Can't create test dir: %s", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	hostDir := path.Join(testDir, "host")
+
+	writeTestFiles(t, hostDir, map[string]string{"x": "host file"})
+
+	baseDir := path.Join(testDir, "base")
+
+	writeTestFiles(t, baseDir, map[string]string{"bin/app": "app v1"})
+
+	// absolute symlink in the base rootfs points to host dir
+	if err = os.Symlink(hostDir, path.Join(baseDir, "lib")); err != nil {
+		t.Fatalf("Can't create symlink: %s", err)
+	}
+
+	deltaDir := path.Join(testDir, "delta")
+
+	writeTestFiles(t, deltaDir, map[string]string{"bin/app": "app v2"})
+
+	deltaLayer := path.Join(testDir, "delta.tar.gz")
+
+	if err = packImage(deltaDir, deltaLayer); err != nil {
+		t.Fatalf("Can't pack delta layer: %s", err)
+	}
+
+	if err = applyDelta(baseDir, deltaLayer, path.Join(testDir, "rootfs"), []string{"lib/x"},
+		uint32(os.Getuid()), uint32(os.Getgid())); err == nil {
+		t.Error("Error expected for removed file under symlink")
+	}
+
+	if err = checkPathParents(path.Join(testDir, "rootfs"), path.Join(testDir, "rootfs", "lib", "y", "z")); err == nil {
+		t.Error("Error expected for path under symlink")
+	}
+
+	checkTestFiles(t, hostDir, map[string]string{"x": "host file"}, nil)
+}
+
+func TestDeltaApplicable(t *testing.T) {
+	service := Service{ManifestDigest: []byte{0x01, 0x02, 0x03}}
+
+	delta := &deltaImageInfo{BaseDigest: hex.EncodeToString(service.ManifestDigest)}
+
+	if !isDeltaApplicable(delta, true, service) {
+		t.Error("Delta should be applicable")
+	}
+
+	if isDeltaApplicable(delta, false, Service{}) {
+		t.Error("Delta should not be applicable to not installed service")
+	}
+
+	if isDeltaApplicable(&deltaImageInfo{BaseDigest: "040506"}, true, service) {
+		t.Error("Delta should not be applicable to other base")
+	}
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		if err := os.MkdirAll(path.Dir(path.Join(dir, name)), 0o755); err != nil {
+			t.Fatalf("Can't create dir: %s", err)
+		}
+
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Can't write file: %s", err)
+		}
+	}
+}
+
+func checkTestFiles(t *testing.T, dir string, files map[string]string, absent []string) {
+	t.Helper()
+
+	for name, content := range files {
+		data, err := ioutil.ReadFile(path.Join(dir, name))
+		if err != nil {
+			t.Errorf("Can't read file: %s", err)
+
+			continue
+		}
+
+		if string(data) != content {
+			t.Errorf("Wrong file %s content: %s", name, string(data))
+		}
+	}
+
+	for _, name := range absent {
+		if _, err := os.Stat(path.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("File %s should not exist", name)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	log "github.com/sirupsen/logrus"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+// Dependency conditions
+const (
+	// dependency instance is started
+	dependencyConditionStarted = "started"
+	// dependency instance readiness probe succeeded
+	dependencyConditionReady = "ready"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// serviceDependency describes service which should be started before the dependent service
+type serviceDependency struct {
+	ServiceID string `json:"serviceId"`
+	Condition string `json:"condition,omitempty"`
+}
+
+// BlockedService describes service instance which is not started because its dependencies are not satisfied.
+type BlockedService struct {
+	ServiceID string   `json:"serviceId"`
+	SubjectID string   `json:"subjectId"`
+	BlockedBy []string `json:"blockedBy"`
+}
+
+type blockedInstance struct {
+	instance *serviceInstance
+	status   BlockedService
+}
+
+// subjectServiceKey identifies instance of service for subject
+type subjectServiceKey struct {
+	subjectID string
+	serviceID string
+}
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// GetBlockedServices returns service instances which are not started due to unsatisfied dependencies.
+func (launcher *Launcher) GetBlockedServices() (blockedServices []BlockedService) {
+	launcher.instancesMutex.Lock()
+	defer launcher.instancesMutex.Unlock()
+
+	blockedServices = make([]BlockedService, 0, len(launcher.blocked))
+
+	for _, blocked := range launcher.blocked {
+		blockedServices = append(blockedServices, blocked.status)
+	}
+
+	sort.Slice(blockedServices, func(i, j int) bool {
+		if blockedServices[i].ServiceID != blockedServices[j].ServiceID {
+			return blockedServices[i].ServiceID < blockedServices[j].ServiceID
+		}
+
+		return blockedServices[i].SubjectID < blockedServices[j].SubjectID
+	})
+
+	return blockedServices
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func getServiceDependencies(service Service) (dependencies []serviceDependency, err error) {
+	aosConfig, err := getAosServiceConfig(path.Join(service.Path, aosServiceConfigFile))
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return aosConfig.Dependencies, nil
+}
+
+func validateDependencies(dependencies []serviceDependency) (err error) {
+	for _, dependency := range dependencies {
+		if dependency.ServiceID == "" {
+			return aoserrors.New("dependency service ID is not specified")
+		}
+
+		switch dependency.Condition {
+		case "", dependencyConditionStarted, dependencyConditionReady:
+
+		default:
+			return aoserrors.Errorf("unsupported dependency condition: %s", dependency.Condition)
+		}
+	}
+
+	return nil
+}
+
+// checkDependencyCycles checks that new or updated service doesn't create dependency cycle with installed services
+func (launcher *Launcher) checkDependencyCycles(service Service) (err error) {
+	dependencies, err := getServiceDependencies(service)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = validateDependencies(dependencies); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	services, err := launcher.serviceProvider.GetServices()
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	graph := make(map[string][]string)
+
+	for _, installedService := range services {
+		if installedService.ID == service.ID {
+			continue
+		}
+
+		installedDependencies, err := getServiceDependencies(installedService)
+		if err != nil {
+			log.WithField("id", installedService.ID).Warnf("Can't get service dependencies: %s", err)
+
+			continue
+		}
+
+		for _, dependency := range installedDependencies {
+			graph[installedService.ID] = append(graph[installedService.ID], dependency.ServiceID)
+		}
+	}
+
+	for _, dependency := range dependencies {
+		graph[service.ID] = append(graph[service.ID], dependency.ServiceID)
+	}
+
+	if cycle := findDependencyCycle(graph, service.ID); cycle != nil {
+		return aoserrors.Errorf("service dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	return nil
+}
+
+// findDependencyCycle returns dependency cycle which includes specified service
+func findDependencyCycle(graph map[string][]string, serviceID string) (cycle []string) {
+	visited := make(map[string]bool)
+
+	var visit func(id string, chain []string) (cycle []string)
+
+	visit = func(id string, chain []string) (cycle []string) {
+		for _, dependencyID := range graph[id] {
+			dependencyChain := append(chain[:len(chain):len(chain)], dependencyID)
+
+			if dependencyID == serviceID {
+				return dependencyChain
+			}
+
+			if visited[dependencyID] {
+				continue
+			}
+
+			visited[dependencyID] = true
+
+			if cycle = visit(dependencyID, dependencyChain); cycle != nil {
+				return cycle
+			}
+		}
+
+		return nil
+	}
+
+	return visit(serviceID, []string{serviceID})
+}
+
+// getDependencyLevels splits instances into levels in topological order: instances of each level depend only on
+// instances of previous levels.
+func getDependencyLevels(instances []*serviceInstance) (levels [][]*serviceInstance) {
+	instanceKeys := make(map[subjectServiceKey]bool)
+
+	for _, instance := range instances {
+		instanceKeys[subjectServiceKey{instance.subjectID, instance.service.ID}] = true
+	}
+
+	dependencies := make(map[*serviceInstance][]subjectServiceKey)
+
+	for _, instance := range instances {
+		serviceDependencies, err := getServiceDependencies(instance.service)
+		if err != nil {
+			log.WithField("id", instance.id).Warnf("Can't get service dependencies: %s", err)
+
+			continue
+		}
+
+		for _, dependency := range serviceDependencies {
+			key := subjectServiceKey{instance.subjectID, dependency.ServiceID}
+
+			if instanceKeys[key] && dependency.ServiceID != instance.service.ID {
+				dependencies[instance] = append(dependencies[instance], key)
+			}
+		}
+	}
+
+	processed := make(map[subjectServiceKey]bool)
+
+	for len(instances) != 0 {
+		var level, rest []*serviceInstance
+
+		for _, instance := range instances {
+			if isDependenciesProcessed(dependencies[instance], processed) {
+				level = append(level, instance)
+			} else {
+				rest = append(rest, instance)
+			}
+		}
+
+		// should not happen as cycles are checked on install
+		if len(level) == 0 {
+			log.Error("Service dependency cycle detected")
+
+			level, rest = rest, nil
+		}
+
+		for _, instance := range level {
+			processed[subjectServiceKey{instance.subjectID, instance.service.ID}] = true
+		}
+
+		levels = append(levels, level)
+		instances = rest
+	}
+
+	return levels
+}
+
+func isDependenciesProcessed(dependencies []subjectServiceKey, processed map[subjectServiceKey]bool) (result bool) {
+	for _, dependency := range dependencies {
+		if !processed[dependency] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkInstanceDependencies returns IDs of dependency services which conditions are not satisfied
+func (launcher *Launcher) checkInstanceDependencies(instance *serviceInstance,
+	dependencies []serviceDependency) (blockedBy []string) {
+	for _, dependency := range dependencies {
+		dependencyInstances := launcher.getRunningInstances(func(item *serviceInstance) bool {
+			return item.subjectID == instance.subjectID && item.service.ID == dependency.ServiceID
+		})
+
+		if len(dependencyInstances) == 0 {
+			blockedBy = append(blockedBy, dependency.ServiceID)
+
+			continue
+		}
+
+		if dependency.Condition != dependencyConditionReady {
+			continue
+		}
+
+		if err := launcher.waitInstanceReady(dependencyInstances[0]); err != nil {
+			log.WithField("id", dependencyInstances[0].id).Errorf("Dependency instance is not ready: %s", err)
+
+			blockedBy = append(blockedBy, dependency.ServiceID)
+		}
+	}
+
+	return blockedBy
+}
+
+func (launcher *Launcher) waitInstanceReady(instance *serviceInstance) (err error) {
+	aosConfig, err := getAosServiceConfig(path.Join(instance.service.Path, aosServiceConfigFile))
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return launcher.checkInstanceReadiness(instance, aosConfig.ReadinessProbe)
+}
+
+func (launcher *Launcher) blockInstance(instance *serviceInstance, blockedBy []string) {
+	log.WithFields(log.Fields{"id": instance.id, "blockedBy": blockedBy}).Warn("Instance is blocked by dependencies")
+
+	launcher.instancesMutex.Lock()
+	defer launcher.instancesMutex.Unlock()
+
+	launcher.blocked[instance.id] = &blockedInstance{
+		instance: instance,
+		status: BlockedService{
+			ServiceID: instance.service.ID,
+			SubjectID: instance.subjectID,
+			BlockedBy: blockedBy,
+		},
+	}
+}
+
+func (launcher *Launcher) unblockInstance(instanceID string) {
+	launcher.instancesMutex.Lock()
+	defer launcher.instancesMutex.Unlock()
+
+	delete(launcher.blocked, instanceID)
+}
+
+func (launcher *Launcher) isInstanceBlocked(instanceID string) (blocked bool) {
+	launcher.instancesMutex.Lock()
+	defer launcher.instancesMutex.Unlock()
+
+	_, blocked = launcher.blocked[instanceID]
+
+	return blocked
+}
+
+func (launcher *Launcher) unblockSubjectsInstances(subjects []string) {
+	launcher.instancesMutex.Lock()
+	defer launcher.instancesMutex.Unlock()
+
+	for id, blocked := range launcher.blocked {
+		for _, subjectID := range subjects {
+			if blocked.instance.subjectID == subjectID {
+				delete(launcher.blocked, id)
+
+				break
+			}
+		}
+	}
+}
+
+// startBlockedDependents starts blocked instances which depend on started instance
+func (launcher *Launcher) startBlockedDependents(instance *serviceInstance) {
+	var dependents []*serviceInstance
+
+	launcher.instancesMutex.Lock()
+
+	for _, blocked := range launcher.blocked {
+		if blocked.instance.subjectID != instance.subjectID {
+			continue
+		}
+
+		for _, serviceID := range blocked.status.BlockedBy {
+			if serviceID == instance.service.ID {
+				dependents = append(dependents, blocked.instance)
+
+				break
+			}
+		}
+	}
+
+	launcher.instancesMutex.Unlock()
+
+	for _, dependent := range dependents {
+		launcher.actionHandler.PutInQueue(dependent.id, dependent, func(id string, data interface{}) {
+			dependent, ok := data.(*serviceInstance)
+			if !ok || !launcher.isInstanceBlocked(dependent.id) {
+				return
+			}
+
+			if err := launcher.startInstance(dependent); err != nil {
+				log.WithField("id", dependent.id).Errorf("Can't start instance: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher //nolint
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestFindDependencyCycle(t *testing.T) {
+	graph := map[string][]string{
+		"app1":   {"broker", "db"},
+		"app2":   {"app1"},
+		"broker": {"db"},
+	}
+
+	if cycle := findDependencyCycle(graph, "app2"); cycle != nil {
+		t.Errorf("Unexpected cycle: %v", cycle)
+	}
+
+	graph["db"] = []string{"app2"}
+
+	cycle := findDependencyCycle(graph, "db")
+	if strings.Join(cycle, " -> ") != "db -> app2 -> app1 -> broker -> db" {
+		t.Errorf("Wrong cycle: %v", cycle)
+	}
+
+	if cycle = findDependencyCycle(map[string][]string{"app": {"app"}}, "app"); len(cycle) != 2 {
+		t.Errorf("Wrong self dependency cycle: %v", cycle)
+	}
+}
+
+func TestDependencyLevels(t *testing.T) {
+	servicesDir, err := ioutil.TempDir("", "dependencies_")
+	if err != nil {
+		t.Fatalf("Can't create services dir: %s", err)
+	}
+	defer os.RemoveAll(servicesDir)
+
+	writeTestFiles(t, servicesDir, map[string]string{
+		"app/" + aosServiceConfigFile:    `{"dependencies": [{"serviceId": "broker", "condition": "ready"}]}`,
+		"broker/" + aosServiceConfigFile: `{"dependencies": [{"serviceId": "db"}]}`,
+		"db/" + aosServiceConfigFile:     `{}`,
+		"other/" + aosServiceConfigFile:  `{"dependencies": [{"serviceId": "absent"}]}`,
+	})
+
+	var instances []*serviceInstance
+
+	for _, serviceID := range []string{"app", "other", "broker", "db"} {
+		instances = append(instances, &serviceInstance{
+			id: serviceID + "_subject1", subjectID: "subject1",
+			service: Service{ID: serviceID, Path: path.Join(servicesDir, serviceID)},
+		})
+	}
+
+	// instance of other subject doesn't satisfy dependency
+	instances = append(instances, &serviceInstance{
+		id: "app_subject2", subjectID: "subject2",
+		service: Service{ID: "app", Path: path.Join(servicesDir, "app")},
+	})
+
+	levels := getDependencyLevels(instances)
+
+	var result []string
+
+	for _, level := range levels {
+		var ids []string
+
+		for _, instance := range level {
+			ids = append(ids, instance.id)
+		}
+
+		result = append(result, strings.Join(ids, ","))
+	}
+
+	if strings.Join(result, ";") != "other_subject1,db_subject1,app_subject2;broker_subject1;app_subject1" {
+		t.Errorf("Wrong dependency levels: %v", result)
+	}
+}
+
+func TestBlockedInstanceResources(t *testing.T) {
+	servicesDir, err := ioutil.TempDir("", "dependencies_")
+	if err != nil {
+		t.Fatalf("Can't create services dir: %s", err)
+	}
+	defer os.RemoveAll(servicesDir)
+
+	writeTestFiles(t, servicesDir, map[string]string{
+		"app/" + aosServiceConfigFile: `{"dependencies": [{"serviceId": "broker"}]}`,
+	})
+
+	launcher := &Launcher{
+		instances: make(map[string]*serviceInstance),
+		blocked:   make(map[string]*blockedInstance),
+	}
+
+	instance := &serviceInstance{
+		id: "app_subject1", subjectID: "subject1", path: path.Join(servicesDir, "instance"),
+		service: Service{ID: "app", Path: path.Join(servicesDir, "app")},
+	}
+
+	if err = launcher.startInstance(instance); err != nil {
+		t.Fatalf("Can't start instance: %s", err)
+	}
+
+	if !launcher.isInstanceBlocked(instance.id) {
+		t.Error("Instance should be blocked")
+	}
+
+	// blocked instance is not prepared to start
+	if _, err = os.Stat(instance.path); !os.IsNotExist(err) {
+		t.Errorf("Blocked instance dir should not be created: %v", err)
+	}
+}
@@ -0,0 +1,670 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_servicemanager/progress"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+const desiredStateFile = "desiredstate.json"
+
+// Service change states
+const (
+	changePrepared = iota
+	changeApplied
+	changeFailed
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// serviceChange describes service install, update or subjects change of desired state
+type serviceChange struct {
+	installInfo     *pb.InstallServiceRequest
+	Service         Service  `json:"service"` // currently installed service
+	ServiceExists   bool     `json:"serviceExists"`
+	NewService      Service  `json:"newService"`      // prepared service, empty if service version is not changed
+	NewSubjects     []string `json:"newSubjects"`     // subjects which are not yet connected to installed service
+	DroppedSubjects []string `json:"droppedSubjects"` // subjects which are not in desired state anymore
+	State           int      `json:"state"`
+	reporter        *progress.Reporter
+}
+
+// desiredStateTransaction keeps changes which should be rolled back on failure
+type desiredStateTransaction struct {
+	Replace         bool             `json:"replace"`
+	Layers          []string         `json:"layers"`
+	InstalledLayers []string         `json:"installedLayers"`
+	Changes         []*serviceChange `json:"changes"`
+	StoppedServices []Service        `json:"stoppedServices"`
+	Committed       bool             `json:"committed"`
+}
+
+// desiredStateJournal is saved in working dir on each change of desired state transaction, so the transaction is
+// committed or rolled back on start if SM is terminated in the middle of it
+type desiredStateJournal struct {
+	OwnedLayers []string                 `json:"ownedLayers"` // layers installed by desired state
+	Transaction *desiredStateTransaction `json:"transaction,omitempty"`
+}
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// ApplyDesiredState installs, updates and removes services and layers to match desired state. All new services and
+// layers are downloaded and verified before running services are touched. On any failure, all changes are rolled back.
+func (launcher *Launcher) ApplyDesiredState(services []*pb.InstallServiceRequest,
+	layers []*pb.InstallLayerRequest) (status []*pb.ServiceStatus, err error) {
+	log.WithFields(log.Fields{"services": len(services), "layers": len(layers)}).Info("Apply desired state")
+
+	return launcher.applyDesiredState(services, layers, true)
+}
+
+// InstallServices installs or updates services and layers in one transaction the same way as ApplyDesiredState,
+// but keeps services, subjects and layers which are not in the list.
+func (launcher *Launcher) InstallServices(services []*pb.InstallServiceRequest,
+	layers []*pb.InstallLayerRequest) (status []*pb.ServiceStatus, err error) {
+	log.WithFields(log.Fields{"services": len(services), "layers": len(layers)}).Info("Install services")
+
+	return launcher.applyDesiredState(services, layers, false)
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func (launcher *Launcher) applyDesiredState(services []*pb.InstallServiceRequest,
+	layers []*pb.InstallLayerRequest, replace bool) (status []*pb.ServiceStatus, err error) {
+	// exclusive lock serializes desired state with users change and service install and remove
+	launcher.usersMutex.Lock()
+	defer launcher.usersMutex.Unlock()
+
+	if err = launcher.validateDesiredServices(services); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	transaction := &desiredStateTransaction{Replace: replace}
+
+	for _, layer := range layers {
+		transaction.Layers = append(transaction.Layers, layer.GetDigest())
+	}
+
+	if err = launcher.setDesiredStateTransaction(transaction); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			log.Errorf("Can't apply desired state: %s", err)
+
+			launcher.rollbackDesiredState(transaction)
+			launcher.finishDesiredStateTransaction()
+		}
+
+		for _, change := range transaction.Changes {
+			change.reporter.Finish(err)
+		}
+	}()
+
+	if err = launcher.installDesiredLayers(layers, transaction); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	removedServices, err := launcher.prepareDesiredServices(services, transaction)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if err = launcher.switchDesiredServices(removedServices, transaction); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	transaction.Committed = true
+
+	if err = launcher.saveDesiredState(); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	launcher.commitDesiredState(transaction)
+	launcher.finishDesiredStateTransaction()
+
+	log.Info("Desired state successfully applied")
+
+	return launcher.getDesiredServicesStatus(services), nil
+}
+
+func (launcher *Launcher) validateDesiredServices(services []*pb.InstallServiceRequest) (err error) {
+	serviceIDs := make(map[string]bool)
+
+	for _, installInfo := range services {
+		if serviceIDs[installInfo.GetServiceId()] {
+			return aoserrors.Errorf("duplicated service %s", installInfo.GetServiceId())
+		}
+
+		serviceIDs[installInfo.GetServiceId()] = true
+
+		subjects := installInfo.GetUsers().GetUsers()
+
+		if len(subjects) == 0 {
+			return aoserrors.Errorf("no subjects specified for service %s", installInfo.GetServiceId())
+		}
+
+		for _, subjectID := range subjects {
+			if !launcher.isSubjectActive(subjectID) {
+				return aoserrors.Errorf("subject %s is not active", subjectID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// installDesiredLayers installs missing layers. New layers are not used until services are switched.
+func (launcher *Launcher) installDesiredLayers(layers []*pb.InstallLayerRequest,
+	transaction *desiredStateTransaction) (err error) {
+	layersInfo, err := launcher.layerProvider.GetLayersInfo()
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	installedLayers := make(map[string]bool)
+
+	for _, layer := range layersInfo {
+		installedLayers[layer.GetDigest()] = true
+	}
+
+	for _, layer := range layers {
+		if installedLayers[layer.GetDigest()] {
+			continue
+		}
+
+		if err = launcher.layerProvider.InstallLayer(layer); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		installedLayers[layer.GetDigest()] = true
+		transaction.InstalledLayers = append(transaction.InstalledLayers, layer.GetDigest())
+
+		if err = launcher.saveDesiredState(); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// prepareDesiredServices downloads and prepares new service versions and, if desired state replaces the current one,
+// returns installed services which are not in desired state.
+func (launcher *Launcher) prepareDesiredServices(services []*pb.InstallServiceRequest,
+	transaction *desiredStateTransaction) (removedServices []Service, err error) {
+	installedServices, err := launcher.serviceProvider.GetServices()
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	installed := make(map[string]Service)
+
+	for _, service := range installedServices {
+		installed[service.ID] = service
+	}
+
+	desired := make(map[string]bool)
+
+	for _, installInfo := range services {
+		desired[installInfo.GetServiceId()] = true
+
+		change := &serviceChange{installInfo: installInfo}
+
+		change.Service, change.ServiceExists = installed[installInfo.GetServiceId()]
+
+		if change.ServiceExists {
+			if installInfo.GetAosVersion() < change.Service.AosVersion {
+				return nil, aoserrors.Errorf("service %s version mismatch", installInfo.GetServiceId())
+			}
+
+			if change.NewSubjects, change.DroppedSubjects, err = launcher.getSubjectsChanges(change.Service.ID,
+				installInfo.GetUsers().GetUsers()); err != nil {
+				return nil, aoserrors.Wrap(err)
+			}
+
+			if !transaction.Replace {
+				change.DroppedSubjects = nil
+			}
+
+			if installInfo.GetAosVersion() == change.Service.AosVersion {
+				if len(change.NewSubjects) != 0 || len(change.DroppedSubjects) != 0 {
+					if err = launcher.addDesiredServiceChange(change, transaction); err != nil {
+						return nil, aoserrors.Wrap(err)
+					}
+				}
+
+				continue
+			}
+		}
+
+		change.reporter = launcher.startInstallProgress(installInfo)
+
+		if change.NewService, err = launcher.prepareServiceInstall(
+			progress.NewContext(context.Background(), change.reporter), installInfo, change.Service,
+			change.ServiceExists); err != nil {
+			change.reporter.Finish(err)
+
+			return nil, aoserrors.Wrap(err)
+		}
+
+		if err = launcher.addDesiredServiceChange(change, transaction); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+	}
+
+	if !transaction.Replace {
+		return nil, nil
+	}
+
+	for _, service := range installedServices {
+		if !desired[service.ID] {
+			removedServices = append(removedServices, service)
+		}
+	}
+
+	return removedServices, nil
+}
+
+func (launcher *Launcher) addDesiredServiceChange(change *serviceChange,
+	transaction *desiredStateTransaction) (err error) {
+	transaction.Changes = append(transaction.Changes, change)
+
+	return aoserrors.Wrap(launcher.saveDesiredState())
+}
+
+// getSubjectsChanges returns desired subjects which are not connected to the service and connected subjects which
+// are not desired
+func (launcher *Launcher) getSubjectsChanges(serviceID string,
+	subjects []string) (newSubjects, droppedSubjects []string, err error) {
+	subjectServices, err := launcher.serviceProvider.GetSubjectServicesByServiceID(serviceID)
+	if err != nil {
+		return nil, nil, aoserrors.Wrap(err)
+	}
+
+	existingSubjects := make([]string, 0, len(subjectServices))
+
+	for _, subjectService := range subjectServices {
+		existingSubjects = append(existingSubjects, subjectService.SubjectID)
+	}
+
+	return subtractSubjects(subjects, existingSubjects), subtractSubjects(existingSubjects, subjects), nil
+}
+
+// switchDesiredServices stops removed services and applies prepared changes
+func (launcher *Launcher) switchDesiredServices(removedServices []Service,
+	transaction *desiredStateTransaction) (err error) {
+	for _, service := range removedServices {
+		serviceID := service.ID
+
+		transaction.StoppedServices = append(transaction.StoppedServices, service)
+
+		if err = launcher.saveDesiredState(); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		launcher.stopInstances(launcher.getRunningInstances(func(instance *serviceInstance) bool {
+			return instance.service.ID == serviceID
+		}))
+	}
+
+	for _, change := range transaction.Changes {
+		// change is marked as applied before it is applied, so it is reverted if SM is terminated in the middle
+		change.State = changeApplied
+
+		if err = launcher.saveDesiredState(); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if err = launcher.applyDesiredServiceChange(change); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		serviceID, droppedSubjects := change.Service.ID, change.DroppedSubjects
+
+		// dropped subjects are uninstalled on commit, as their storages can't be restored on rollback
+		launcher.stopInstances(launcher.getRunningInstances(func(instance *serviceInstance) bool {
+			return instance.service.ID == serviceID && containsString(droppedSubjects, instance.subjectID)
+		}))
+	}
+
+	return nil
+}
+
+func (launcher *Launcher) applyDesiredServiceChange(change *serviceChange) (err error) {
+	if change.NewService.ID == "" {
+		if err = launcher.addServiceToSubjects(change.Service, change.NewSubjects); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		for _, subjectID := range change.NewSubjects {
+			if err = launcher.runInstanceAction(launcher.newServiceInstance(change.Service, subjectID),
+				launcher.startInstance); err != nil {
+				return aoserrors.Wrap(err)
+			}
+		}
+
+		return nil
+	}
+
+	change.reporter.SetPhase(progress.PhaseStart)
+
+	// on failure, service install or update is rolled back by itself
+	if err = launcher.applyServiceInstall(change.Service, change.NewService, change.ServiceExists,
+		change.installInfo.GetUsers().GetUsers()); err != nil {
+		change.State = changeFailed
+
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// commitDesiredState removes old service versions, removed services, dropped subjects and, if desired state replaces
+// the current one, layers installed by previous desired state which are not in desired state. Changes can't be rolled
+// back at this point, so errors are only logged.
+func (launcher *Launcher) commitDesiredState(transaction *desiredStateTransaction) {
+	for _, change := range transaction.Changes {
+		service := change.Service
+
+		if change.ServiceExists && change.NewService.ID != "" {
+			service = change.NewService
+
+			if err := os.RemoveAll(change.Service.Path); err != nil {
+				log.WithField("id", change.Service.ID).Errorf("Can't remove old service dir: %s", err)
+			}
+		}
+
+		for _, subjectID := range change.DroppedSubjects {
+			if err := launcher.uninstallService(service, subjectID); err != nil {
+				log.WithFields(log.Fields{"id": service.ID, "subject": subjectID}).Errorf(
+					"Can't uninstall service: %s", err)
+			}
+		}
+	}
+
+	for _, service := range transaction.StoppedServices {
+		if err := launcher.removeService(service); err != nil {
+			log.WithField("id", service.ID).Errorf("Can't remove service: %s", err)
+		}
+	}
+
+	if !transaction.Replace {
+		return
+	}
+
+	desiredLayers := make(map[string]bool)
+
+	for _, digest := range transaction.Layers {
+		desiredLayers[digest] = true
+	}
+
+	var ownedLayers []string
+
+	// layers installed with InstallLayer or before desired state are not owned by desired state and are kept
+	for _, digest := range append(launcher.desiredState.OwnedLayers, transaction.InstalledLayers...) {
+		if desiredLayers[digest] {
+			if !containsString(ownedLayers, digest) {
+				ownedLayers = append(ownedLayers, digest)
+			}
+
+			continue
+		}
+
+		if err := launcher.layerProvider.UninstallLayer(digest); err != nil {
+			log.WithField("digest", digest).Warnf("Can't uninstall layer: %s", err)
+		}
+	}
+
+	launcher.desiredState.OwnedLayers = ownedLayers
+}
+
+func (launcher *Launcher) rollbackDesiredState(transaction *desiredStateTransaction) {
+	log.Warn("Rollback desired state")
+
+	for i := len(transaction.Changes) - 1; i >= 0; i-- {
+		change := transaction.Changes[i]
+
+		switch change.State {
+		case changePrepared:
+			launcher.discardServiceChange(change)
+
+		case changeApplied:
+			launcher.revertServiceChange(change)
+		}
+	}
+
+	for _, service := range transaction.StoppedServices {
+		instances, err := launcher.getSubjectsInstances(service)
+		if err != nil {
+			log.WithField("id", service.ID).Errorf("Can't get service instances: %s", err)
+
+			continue
+		}
+
+		launcher.startInstances(instances)
+	}
+
+	for _, digest := range transaction.InstalledLayers {
+		if err := launcher.layerProvider.UninstallLayer(digest); err != nil {
+			log.WithField("digest", digest).Errorf("Can't uninstall layer: %s", err)
+		}
+	}
+}
+
+// discardServiceChange removes prepared but not applied service
+func (launcher *Launcher) discardServiceChange(change *serviceChange) {
+	if change.NewService.ID == "" {
+		return
+	}
+
+	if err := os.RemoveAll(change.NewService.Path); err != nil {
+		log.WithField("id", change.NewService.ID).Errorf("Can't remove service dir: %s", err)
+	}
+
+	if !change.ServiceExists {
+		if err := launcher.idsPool.remove(change.NewService.UID, change.NewService.GID); err != nil {
+			log.WithField("id", change.NewService.ID).Errorf("Can't release UID/GID: %s", err)
+		}
+	}
+}
+
+// revertServiceChange restores service state before applied change
+func (launcher *Launcher) revertServiceChange(change *serviceChange) {
+	if !change.ServiceExists {
+		if err := launcher.removeService(change.NewService); err != nil {
+			log.WithField("id", change.NewService.ID).Errorf("Can't remove service: %s", err)
+		}
+
+		return
+	}
+
+	service := change.Service
+
+	if change.NewService.ID != "" {
+		service = change.NewService
+	}
+
+	for _, subjectID := range change.NewSubjects {
+		if err := launcher.uninstallService(service, subjectID); err != nil {
+			log.WithFields(log.Fields{"id": service.ID, "subject": subjectID}).Errorf(
+				"Can't uninstall service: %s", err)
+		}
+	}
+
+	if change.NewService.ID == "" {
+		var instances []*serviceInstance
+
+		for _, subjectID := range change.DroppedSubjects {
+			if launcher.isSubjectActive(subjectID) {
+				instances = append(instances, launcher.newServiceInstance(change.Service, subjectID))
+			}
+		}
+
+		launcher.startInstances(instances)
+
+		return
+	}
+
+	instances, err := launcher.getSubjectsInstances(change.NewService)
+	if err != nil {
+		log.WithField("id", change.NewService.ID).Errorf("Can't get service instances: %s", err)
+	}
+
+	launcher.stopInstances(instances)
+
+	if err := os.RemoveAll(change.NewService.Path); err != nil {
+		log.WithField("id", change.NewService.ID).Errorf("Can't remove new service dir: %s", err)
+	}
+
+	// instances of dropped subjects are started here as well
+	if err := launcher.restoreService(change.Service); err != nil {
+		log.WithField("id", change.Service.ID).Errorf("Can't restore service: %s", err)
+	}
+}
+
+func (launcher *Launcher) getDesiredServicesStatus(services []*pb.InstallServiceRequest) (status []*pb.ServiceStatus) {
+	for _, installInfo := range services {
+		serviceStatus := &pb.ServiceStatus{
+			ServiceId:     installInfo.GetServiceId(),
+			AosVersion:    installInfo.GetAosVersion(),
+			VendorVersion: installInfo.GetVendorVersion(),
+		}
+
+		subjects := installInfo.GetUsers().GetUsers()
+
+		if subjectService, err := launcher.serviceProvider.GetSubjectService(subjects[0],
+			installInfo.GetServiceId()); err == nil {
+			serviceStatus.StateChecksum = hex.EncodeToString(subjectService.StateChecksum)
+		}
+
+		status = append(status, serviceStatus)
+	}
+
+	return status
+}
+
+// loadDesiredState loads desired state journal and completes transaction interrupted by SM termination: committed
+// transaction is finished, not committed one is rolled back
+func (launcher *Launcher) loadDesiredState() (err error) {
+	data, err := ioutil.ReadFile(path.Join(launcher.config.WorkingDir, desiredStateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return aoserrors.Wrap(err)
+	}
+
+	if err = json.Unmarshal(data, &launcher.desiredState); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	transaction := launcher.desiredState.Transaction
+	if transaction == nil {
+		return nil
+	}
+
+	if transaction.Committed {
+		log.Warn("Commit interrupted desired state")
+
+		launcher.commitDesiredState(transaction)
+	} else {
+		log.Warn("Rollback interrupted desired state")
+
+		launcher.rollbackDesiredState(transaction)
+	}
+
+	launcher.desiredState.Transaction = nil
+
+	return aoserrors.Wrap(launcher.saveDesiredState())
+}
+
+func (launcher *Launcher) setDesiredStateTransaction(transaction *desiredStateTransaction) (err error) {
+	launcher.desiredState.Transaction = transaction
+
+	if err = launcher.saveDesiredState(); err != nil {
+		launcher.desiredState.Transaction = nil
+
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func (launcher *Launcher) finishDesiredStateTransaction() {
+	launcher.desiredState.Transaction = nil
+
+	if err := launcher.saveDesiredState(); err != nil {
+		log.Errorf("Can't save desired state: %s", err)
+	}
+}
+
+// saveDesiredState writes desired state journal to temporary file and renames it, so the journal is not corrupted
+// if SM is terminated while writing
+func (launcher *Launcher) saveDesiredState() (err error) {
+	data, err := json.Marshal(&launcher.desiredState)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	fileName := path.Join(launcher.config.WorkingDir, desiredStateFile)
+
+	file, err := os.OpenFile(fileName+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+
+		return aoserrors.Wrap(err)
+	}
+
+	if err = file.Sync(); err != nil {
+		file.Close()
+
+		return aoserrors.Wrap(err)
+	}
+
+	if err = file.Close(); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return aoserrors.Wrap(os.Rename(fileName+".tmp", fileName))
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher //nolint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+type journalLayerProvider struct {
+	testLayerProvider
+	uninstalled []string
+}
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestDesiredStateJournal(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "launcher_")
+	if err != nil {
+		t.Fatalf("Can't create working dir: %s", err)
+	}
+	defer os.RemoveAll(workingDir)
+
+	type testData struct {
+		journal           desiredStateJournal
+		uninstalledLayers []string
+		ownedLayers       []string
+	}
+
+	data := []testData{
+		// committed transaction: layers owned by previous desired state are removed
+		{
+			journal: desiredStateJournal{
+				OwnedLayers: []string{"layer1", "layer2"},
+				Transaction: &desiredStateTransaction{
+					Replace: true, Layers: []string{"layer1", "layer3", "layer4"},
+					InstalledLayers: []string{"layer3"}, Committed: true,
+				},
+			},
+			uninstalledLayers: []string{"layer2"},
+			ownedLayers:       []string{"layer1", "layer3"},
+		},
+		// committed transaction without replace: layers are not owned and not removed
+		{
+			journal: desiredStateJournal{
+				OwnedLayers: []string{"layer1"},
+				Transaction: &desiredStateTransaction{
+					Layers: []string{"layer2"}, InstalledLayers: []string{"layer2"}, Committed: true,
+				},
+			},
+			ownedLayers: []string{"layer1"},
+		},
+		// not committed transaction: installed layers are removed
+		{
+			journal: desiredStateJournal{
+				OwnedLayers: []string{"layer1"},
+				Transaction: &desiredStateTransaction{
+					Replace: true, Layers: []string{"layer2"}, InstalledLayers: []string{"layer2"},
+				},
+			},
+			uninstalledLayers: []string{"layer2"},
+			ownedLayers:       []string{"layer1"},
+		},
+	}
+
+	for i, item := range data {
+		journalData, err := json.Marshal(&item.journal)
+		if err != nil {
+			t.Fatalf("Can't marshal journal: %s", err)
+		}
+
+		if err = ioutil.WriteFile(path.Join(workingDir, desiredStateFile), journalData, 0o600); err != nil {
+			t.Fatalf("Can't write journal: %s", err)
+		}
+
+		layerProvider := &journalLayerProvider{}
+
+		launcher := &Launcher{config: &config.Config{WorkingDir: workingDir}, layerProvider: layerProvider}
+
+		if err = launcher.loadDesiredState(); err != nil {
+			t.Fatalf("Can't load desired state: %s", err)
+		}
+
+		if !reflect.DeepEqual(layerProvider.uninstalled, item.uninstalledLayers) {
+			t.Errorf("Test %d: wrong uninstalled layers: %v", i, layerProvider.uninstalled)
+		}
+
+		// journal is saved without transaction
+		launcher = &Launcher{config: &config.Config{WorkingDir: workingDir}, layerProvider: &journalLayerProvider{}}
+
+		if err = launcher.loadDesiredState(); err != nil {
+			t.Fatalf("Can't load desired state: %s", err)
+		}
+
+		if launcher.desiredState.Transaction != nil ||
+			!reflect.DeepEqual(launcher.desiredState.OwnedLayers, item.ownedLayers) {
+			t.Errorf("Test %d: wrong desired state: %+v", i, launcher.desiredState)
+		}
+	}
+}
+
+/*******************************************************************************
+ * Interfaces
+ ******************************************************************************/
+
+func (layerProvider *journalLayerProvider) UninstallLayer(digest string) (err error) {
+	layerProvider.uninstalled = append(layerProvider.uninstalled, digest)
+
+	return nil
+}
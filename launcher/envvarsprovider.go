@@ -33,7 +33,7 @@ import (
 
 type EnvVarsStorage interface {
 	GetAllOverrideEnvVars() (vars []pb.OverrideEnvVar, err error)
-	UpdateOverrideEnvVars(subjects []string, serviceID string, vars []*pb.EnvVarInfo) (err error)
+	UpdateOverrideEnvVars(subjectID, serviceID string, vars []*pb.EnvVarInfo) (err error)
 }
 
 type envVarsProvider struct {
@@ -98,7 +98,7 @@ func (provider *envVarsProvider) processOverrideEnvVars(vars []*pb.OverrideEnvVa
 				if !provider.isEnvVarsEqual(desValue.Vars, currentVar.Vars) {
 					provider.currentEnvVars[currentIndex].Vars = desValue.Vars
 
-					err = provider.storage.UpdateOverrideEnvVars([]string{desValue.SubjectId}, desValue.ServiceId,
+					err = provider.storage.UpdateOverrideEnvVars(desValue.SubjectId, desValue.ServiceId,
 						desValue.Vars)
 					if err != nil {
 						log.Error("Can't update env vars in storage: ", err)
@@ -133,7 +133,7 @@ func (provider *envVarsProvider) processOverrideEnvVars(vars []*pb.OverrideEnvVa
 		if !presentInDesired {
 			provider.currentEnvVars[currentIndex].Vars = []*pb.EnvVarInfo{}
 
-			if err = provider.storage.UpdateOverrideEnvVars([]string{currentVar.SubjectId}, currentVar.ServiceId,
+			if err = provider.storage.UpdateOverrideEnvVars(currentVar.SubjectId, currentVar.ServiceId,
 				[]*pb.EnvVarInfo{}); err != nil {
 				if resultError == nil {
 					resultError = aoserrors.Wrap(err)
@@ -208,7 +208,7 @@ func (provider *envVarsProvider) validateEnvVarsTTL() (servicesToRestart []subje
 
 		if wasChanged {
 			provider.currentEnvVars[i].Vars = actualEnv
-			if err = provider.storage.UpdateOverrideEnvVars([]string{provider.currentEnvVars[i].SubjectId},
+			if err = provider.storage.UpdateOverrideEnvVars(provider.currentEnvVars[i].SubjectId,
 				provider.currentEnvVars[i].ServiceId, actualEnv); err != nil {
 				return servicesToRestart, aoserrors.Wrap(err)
 			}
@@ -235,10 +235,10 @@ func (storage *testEnvVarsStorage) GetAllOverrideEnvVars() (vars []pb.OverrideEn
 	return storage.envVarsData, nil
 }
 
-func (storage *testEnvVarsStorage) UpdateOverrideEnvVars(subjects []string, serviceVarID string,
+func (storage *testEnvVarsStorage) UpdateOverrideEnvVars(subjectID, serviceVarID string,
 	vars []*pb.EnvVarInfo) (err error) {
 	for i := range storage.envVarsData {
-		if storage.envVarsData[i].SubjectId == subjects[0] && storage.envVarsData[i].ServiceId == serviceVarID {
+		if storage.envVarsData[i].SubjectId == subjectID && storage.envVarsData[i].ServiceId == serviceVarID {
 			storage.envVarsData[i].Vars = vars
 			return nil
 		}
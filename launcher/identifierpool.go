@@ -117,6 +117,23 @@ func (pool *identifierPool) remove(uid, gid uint32) (err error) {
 	return nil
 }
 
+func (pool *identifierPool) isAllocated(uid, gid uint32) (allocated bool) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	return isInPool(pool.lockedUIDs, uid) && isInPool(pool.lockedGIDs, gid)
+}
+
+// remapPoolID maps ID allocated from the pool on another unit to ID allocated on this unit. IDs out of the pool
+// range (e.g. root) are not remapped.
+func remapPoolID(id, fromID, toID uint32) (remappedID uint32) {
+	if id == fromID || (id >= idsRangeBegin && id <= idsRangeEnd) {
+		return toID
+	}
+
+	return id
+}
+
 func isInPool(pool []uint32, id uint32) (exist bool) {
 	for _, value := range pool {
 		if id == value {
@@ -52,13 +52,20 @@ type imageParts struct {
 	aosSrvConfigPath   string
 	serviceFSLayerPath string
 	layersDigest       []string
+	delta              *deltaImageInfo
 }
 
 /*******************************************************************************
  * Private
  ******************************************************************************/
 
-func validateUnpackedImage(installDir string) (err error) {
+func validateUnpackedImage(installDir string, signatureVerifier SignatureVerifier) (err error) {
+	if signatureVerifier != nil {
+		if err = signatureVerifier.VerifySignature(path.Join(installDir, manifestFileName)); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
 	manifest, err := getImageManifest(installDir)
 	if err != nil {
 		return aoserrors.Wrap(err)
@@ -217,6 +224,7 @@ func getImageParts(installDir string) (parts imageParts, err error) {
 	parts.serviceFSLayerPath = path.Join(installDir, "blobs", string(rootFSDigest.Algorithm()), rootFSDigest.Hex())
 
 	parts.layersDigest = getLayersFromManifest(manifest)
+	parts.delta = manifest.AosDelta
 
 	return parts, nil
 }
@@ -20,9 +20,10 @@ package launcher
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
@@ -39,16 +40,17 @@ import (
 	"github.com/aoscloud/aos_common/aoserrors"
 	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
 	"github.com/aoscloud/aos_common/image"
-	"github.com/coreos/go-systemd/v22/dbus"
 	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
 	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 
 	"github.com/aoscloud/aos_servicemanager/config"
+	"github.com/aoscloud/aos_servicemanager/layermanager"
 	"github.com/aoscloud/aos_servicemanager/monitoring"
 	"github.com/aoscloud/aos_servicemanager/networkmanager"
 	"github.com/aoscloud/aos_servicemanager/platform"
+	"github.com/aoscloud/aos_servicemanager/progress"
 	"github.com/aoscloud/aos_servicemanager/resourcemanager"
 	"github.com/aoscloud/aos_servicemanager/utils/action"
 	"github.com/aoscloud/aos_servicemanager/utils/imageutils"
@@ -62,7 +64,7 @@ import (
 // IMPORTANT: if new functionality doesn't allow existing services to work
 // properly, this value should be increased. It will force to remove all
 // services and their storages before first start.
-const OperationVersion = 7
+const OperationVersion = 8
 
 // Service state
 const (
@@ -72,7 +74,8 @@ const (
 )
 
 const (
-	serviceDir = "services" // services directory
+	serviceDir   = "services"  // services directory
+	instancesDir = "instances" // service instances directory
 
 	aosSecretEnv = "SERVICE_SECRET"
 
@@ -85,43 +88,11 @@ const (
 	stateChannelSize = 32
 )
 
-const serviceTemplate = `# This is template file used to launch AOS services
-# Known variables:
-# * ${ID}            - service id
-# * ${SERVICEPATH}   - path to service dir
-# * ${RUNNER}        - path to runner
-[Unit]
-Description=AOS Service
-After=network.target
-StartLimitIntervalSec=30
-StartLimitBurst=3
-
-
-[Service]
-Type=forking
-Restart=always
-RestartSec=1
-ExecStartPre=${RUNNER} delete -f ${ID}
-ExecStart=${RUNNER} run -d --pid-file ${SERVICEPATH}/.pid -b ${SERVICEPATH} ${ID}
-
-ExecStop=${RUNNER} kill ${ID} SIGKILL
-ExecStopPost=${RUNNER} delete -f ${ID}
-PIDFile=${SERVICEPATH}/.pid
-SuccessExitStatus=SIGKILL
-
-[Install]
-WantedBy=multi-user.target
-`
-
-const serviceTemplateFile = "template.service"
-
 const (
-	unitStatusFailed = "failed"
-	unitStatusActive = "active"
+	runtimeBackendSystemd = "systemd"
+	runtimeBackendRunner  = "runner"
 )
 
-const downloadDirName = "download"
-
 const (
 	hostfsWiteoutsDir = "hostfs/whiteouts"
 )
@@ -134,7 +105,14 @@ const (
 
 const defaultServiceProvider = "default"
 
-const errNotLoaded = "not loaded"
+// number of subject hash bytes used in instance ID
+const instanceIDHashLen = 8
+
+// parent cgroup of service instances started by runner backend
+const instancesCgroupParent = "/aos"
+
+// parent cgroup of systemd service units, instances started by systemd backend stay in unit cgroup
+const systemdServicesSlice = "/system.slice"
 
 const (
 	ttlValidatePeriod = 1 * time.Minute
@@ -161,7 +139,8 @@ type Launcher struct {
 	network          NetworkProvider
 	serviceRegistrar ServiceRegistrar
 	devicemanager    DeviceManagement
-	systemd          *dbus.Conn
+	alertSender      AlertSender
+	runtime          runtimeBackend
 	config           *config.Config
 	layerProvider    layerProvider
 
@@ -170,19 +149,31 @@ type Launcher struct {
 
 	actionHandler  *action.Handler
 	storageHandler *storageHandler
+	encryptor      *storageEncryptor
 	idsPool        *identifierPool
 
 	ttlTicker         *time.Ticker
 	ttlRemoveServices *time.Ticker
 
-	downloadDir string
+	downloader        Downloader
+	progressTracker   ProgressTracker
+	signatureVerifier SignatureVerifier
+	backupSigner      BackupSigner
 
 	users []string
 
-	services map[string]string
+	instances      map[string]*serviceInstance
+	registrations  map[string]*serviceRegistration
+	probeMonitors  map[string]*probeMonitor
+	restarts       map[string]*instanceRestarts
+	blocked        map[string]*blockedInstance
+	instancesMutex sync.Mutex
+
+	supervisorStopChannel chan struct{}
 
-	serviceTemplate string
-	runnerPath      string
+	operationStats operationStatistics
+
+	desiredState desiredStateJournal
 
 	usersMutex sync.RWMutex
 
@@ -206,12 +197,13 @@ type Service struct {
 	ManifestDigest  []byte       // sha256 of service manifest
 }
 
-// UsersService describes users service structure
-type UsersService struct {
-	Users         []string // user claims
-	ServiceID     string   // service id
-	StorageFolder string   // service storage folder
-	StateChecksum []byte   // service state checksum
+// SubjectService describes subject service structure
+type SubjectService struct {
+	SubjectID     string // subject id
+	ServiceID     string // service id
+	UnitName      string // instance unit name
+	StorageFolder string // instance storage folder
+	StateChecksum []byte // instance state checksum
 }
 
 // ServiceProvider provides API to create, remove or access services DB
@@ -225,16 +217,19 @@ type ServiceProvider interface {
 	GetServiceByUnitName(unitName string) (service Service, err error)
 	SetServiceState(serviceID string, state ServiceState) (err error)
 	SetServiceStartTime(serviceID string, time time.Time) (err error)
-	AddServiceToUsers(users []string, serviceID string) (err error)
-	RemoveServiceFromUsers(users []string, serviceID string) (err error)
-	GetUsersServices(users []string) (services []Service, err error)
-	RemoveServiceFromAllUsers(serviceID string) (err error)
-	GetUsersService(users []string, serviceID string) (userService UsersService, err error)
-	GetUsersServicesByServiceID(serviceID string) (userServices []UsersService, err error)
-	SetUsersStorageFolder(users []string, serviceID string, storageFolder string) (err error)
-	SetUsersStateChecksum(users []string, serviceID string, checksum []byte) (err error)
+	AddSubjectService(subjectService SubjectService) (err error)
+	RemoveSubjectService(subjectID, serviceID string) (err error)
+	GetSubjectServices(subjectID string) (services []Service, err error)
+	RemoveServiceFromAllSubjects(serviceID string) (err error)
+	GetSubjectService(subjectID, serviceID string) (subjectService SubjectService, err error)
+	GetSubjectServicesByServiceID(serviceID string) (subjectServices []SubjectService, err error)
+	SetSubjectStorageFolder(subjectID, serviceID string, storageFolder string) (err error)
+	SetSubjectStateChecksum(subjectID, serviceID string, checksum []byte) (err error)
 	GetAllOverrideEnvVars() (vars []pb.OverrideEnvVar, err error)
-	UpdateOverrideEnvVars(subjects []string, serviceID string, vars []*pb.EnvVarInfo) (err error)
+	UpdateOverrideEnvVars(subjectID, serviceID string, vars []*pb.EnvVarInfo) (err error)
+	SetServiceLayers(serviceID string, digests []string) (err error)
+	SetSubjectRestartCount(subjectID, serviceID string, restartCount uint64) (err error)
+	GetSubjectRestartCount(subjectID, serviceID string) (restartCount uint64, err error)
 }
 
 // ServiceRegistrar provides API to register/unregister service
@@ -245,8 +240,8 @@ type ServiceRegistrar interface {
 
 // ServiceMonitor provides API to start/stop service monitoring
 type ServiceMonitor interface {
-	StartMonitorService(serviceID string, monitoringConfig monitoring.ServiceMonitoringConfig) (err error)
-	StopMonitorService(serviceID string) (err error)
+	StartMonitorService(instanceID string, monitoringConfig monitoring.ServiceMonitoringConfig) (err error)
+	StopMonitorService(instanceID string) (err error)
 }
 
 // NetworkProvider provides network interface
@@ -254,8 +249,11 @@ type NetworkProvider interface {
 	AddServiceToNetwork(serviceID, spID string, params networkmanager.NetworkParams) (err error)
 	RemoveServiceFromNetwork(serviceID, spID string) (err error)
 	IsServiceInNetwork(serviceID, spID string) (err error)
-	GetServiceIP(serviceID, spID string) (ip string, err error)
+	GetServiceIP(serviceID, spID string) (ip, ipv6 string, err error)
 	DeleteNetwork(spID string) (err error)
+	GetNetworkMigrationChannel() (channel <-chan string)
+	GetEgressAlertChannel() (channel <-chan networkmanager.EgressAlert)
+	ReleaseServiceIP(serviceID string) (err error)
 }
 
 // DeviceManagement provides API to validate, request and release devices
@@ -264,16 +262,83 @@ type DeviceManagement interface {
 	RequestDevice(device string, serviceID string) (err error)
 	ReleaseDevice(device string, serviceID string) (err error)
 	RequestBoardResourceByName(name string) (boardResource resourcemanager.BoardResource, err error)
+	CheckPublishedPort(port uint16, protocol string) (err error)
+}
+
+// AlertSender provides API to send service alerts
+type AlertSender interface {
+	SendServiceProbeAlert(source, probe, message string)
+	SendServiceCrashLoopAlert(source string, restartCount uint64, message string)
+	SendServiceEgressAlert(source, message string)
+}
+
+// Downloader downloads service images
+type Downloader interface {
+	Download(ctx context.Context, url string, fileInfo image.FileInfo) (fileName string, err error)
+	Release(fileName string)
+}
+
+// ProgressTracker tracks service install progress
+type ProgressTracker interface {
+	StartOperation(operationType, id string, aosVersion uint64) (reporter *progress.Reporter)
+}
+
+// StorageKeyProvider provides subject storage encryption keys
+type StorageKeyProvider interface {
+	GetStorageKey(subjectID string) (key []byte, err error)
+}
+
+// SignatureVerifier verifies detached signature of service image manifest
+type SignatureVerifier interface {
+	VerifySignature(fileName string) (err error)
+}
+
+// BackupSigner signs service data backups and verifies backups signed by this or other unit
+type BackupSigner interface {
+	SignFile(fileName string) (err error)
+	Verify(fileName string, reader io.Reader) (err error)
 }
 
 // ServiceState service state
 type ServiceState int
 
+// runtimeBackend provides API to run and supervise service instances
+type runtimeBackend interface {
+	startInstance(instance *serviceInstance) (err error)
+	stopInstance(instance *serviceInstance) (err error)
+	checkInstanceHealth(instance *serviceInstance, timeout time.Duration) (err error)
+	getInstanceStateChannel() (channel <-chan instanceStateEvent)
+	getInstanceCgroupPath(instance *serviceInstance) (cgroupPath string)
+	close()
+}
+
+// serviceInstance describes service running on behalf of subject
+type serviceInstance struct {
+	id         string  // instance id
+	subjectID  string  // subject id
+	service    Service // instance service
+	path       string  // path to instance bundle
+	unitName   string  // instance unit name
+	cgroupPath string  // instance cgroup path
+
+	restartPolicy restartPolicy // instance restart policy
+}
+
+// serviceRegistration keeps service secret shared by all its instances
+type serviceRegistration struct {
+	secret    string
+	instances map[string]bool
+}
+
 type layerProvider interface {
 	GetLayerPathByDigest(layerDigest string) (layerPath string, err error)
-	UninstallLayer(digest string) (err error)
+	CollectGarbage(dryRun bool) (report layermanager.GarbageReport, err error)
 	GetLayersInfo() (info []*pb.LayerStatus, err error)
 	GetLayerInfoByDigest(digest string) (layer pb.LayerStatus, err error)
+	InstallLayer(installInfo *pb.InstallLayerRequest) (err error)
+	UninstallLayer(digest string) (err error)
+	LockLayers()
+	UnlockLayers()
 }
 
 /*******************************************************************************
@@ -283,20 +348,32 @@ type layerProvider interface {
 // New creates new launcher object
 func New(config *config.Config, serviceProvider ServiceProvider,
 	layerProvider layerProvider, monitor ServiceMonitor, network NetworkProvider, devicemanager DeviceManagement,
-	serviceRegistrar ServiceRegistrar) (launcher *Launcher, err error) {
-	log.WithField("runner", config.Runner).Debug("New launcher")
+	serviceRegistrar ServiceRegistrar, alertSender AlertSender, downloader Downloader,
+	progressTracker ProgressTracker, signatureVerifier SignatureVerifier,
+	storageKeyProvider StorageKeyProvider, backupSigner BackupSigner) (launcher *Launcher, err error) {
+	log.WithFields(log.Fields{
+		"runner": config.Runner, "runtimeBackend": config.RuntimeBackend,
+	}).Debug("New launcher")
 
 	launcher = &Launcher{
-		config:           config,
-		serviceProvider:  serviceProvider,
-		layerProvider:    layerProvider,
-		monitor:          monitor,
-		network:          network,
-		devicemanager:    devicemanager,
-		services:         make(map[string]string),
-		serviceRegistrar: serviceRegistrar,
-		idsPool:          &identifierPool{},
-		downloadDir:      path.Join(config.WorkingDir, downloadDirName),
+		config:            config,
+		serviceProvider:   serviceProvider,
+		layerProvider:     layerProvider,
+		monitor:           monitor,
+		network:           network,
+		devicemanager:     devicemanager,
+		alertSender:       alertSender,
+		instances:         make(map[string]*serviceInstance),
+		registrations:     make(map[string]*serviceRegistration),
+		probeMonitors:     make(map[string]*probeMonitor),
+		restarts:          make(map[string]*instanceRestarts),
+		blocked:           make(map[string]*blockedInstance),
+		serviceRegistrar:  serviceRegistrar,
+		idsPool:           &identifierPool{},
+		downloader:        downloader,
+		progressTracker:   progressTracker,
+		signatureVerifier: signatureVerifier,
+		backupSigner:      backupSigner,
 	}
 
 	launcher.ServiceStateChannel = make(chan *pb.SMNotifications, stateChannelSize)
@@ -307,37 +384,34 @@ func New(config *config.Config, serviceProvider ServiceProvider,
 		return nil, aoserrors.Wrap(err)
 	}
 
-	if launcher.storageHandler, err = newStorageHandler(config.StorageDir, serviceProvider,
-		launcher.ServiceStateChannel); err != nil {
-		return nil, aoserrors.Wrap(err)
-	}
-
-	// Check and create service dir
-	dir := path.Join(config.WorkingDir, serviceDir)
-	if _, err = os.Stat(dir); err != nil {
-		if !os.IsNotExist(err) {
-			return nil, aoserrors.Wrap(err)
+	if config.StorageEncryption.Enabled {
+		if storageKeyProvider == nil {
+			return nil, aoserrors.New("storage key provider is not set")
 		}
-		if err = os.MkdirAll(dir, 0755); err != nil {
+
+		if launcher.encryptor, err = newStorageEncryptor(config.StorageDir, storageKeyProvider); err != nil {
 			return nil, aoserrors.Wrap(err)
 		}
 	}
 
-	// Create systemd connection
-	launcher.systemd, err = dbus.NewSystemConnectionContext(context.Background())
-	if err != nil {
+	if launcher.storageHandler, err = newStorageHandler(config.StorageDir, serviceProvider, launcher.encryptor,
+		config.StateHistorySize, launcher.ServiceStateChannel); err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
 
-	// Get systemd service template
-	launcher.serviceTemplate, err = getSystemdServiceTemplate(config.WorkingDir)
-	if err != nil {
-		return nil, aoserrors.Wrap(err)
+	// Check and create service and instances dirs
+	for _, dir := range []string{path.Join(config.WorkingDir, serviceDir), path.Join(config.WorkingDir, instancesDir)} {
+		if _, err = os.Stat(dir); err != nil {
+			if !os.IsNotExist(err) {
+				return nil, aoserrors.Wrap(err)
+			}
+			if err = os.MkdirAll(dir, 0755); err != nil {
+				return nil, aoserrors.Wrap(err)
+			}
+		}
 	}
 
-	// Retrieve runner abs path
-	launcher.runnerPath, err = exec.LookPath(config.Runner)
-	if err != nil {
+	if launcher.runtime, err = newRuntimeBackend(config); err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
 
@@ -365,11 +439,18 @@ func New(config *config.Config, serviceProvider ServiceProvider,
 		}
 	}
 
-	if err = launcher.addServicesToSystemd(); err != nil {
+	if err = launcher.loadDesiredState(); err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
 
-	os.RemoveAll(launcher.downloadDir)
+	launcher.supervisorStopChannel = make(chan struct{})
+
+	go launcher.superviseInstances()
+
+	if launcher.network != nil {
+		go launcher.handleNetworkMigrations(launcher.network.GetNetworkMigrationChannel())
+		go launcher.handleEgressAlerts(launcher.network.GetEgressAlertChannel())
+	}
 
 	return launcher, nil
 }
@@ -378,12 +459,18 @@ func New(config *config.Config, serviceProvider ServiceProvider,
 func (launcher *Launcher) Close() {
 	log.Debug("Close launcher")
 
-	launcher.stopCurrentUserServices()
+	close(launcher.supervisorStopChannel)
+
+	launcher.stopInstances(launcher.getRunningInstances(nil))
 
-	launcher.systemd.Close()
+	launcher.runtime.close()
 
 	launcher.storageHandler.Close()
 
+	if launcher.encryptor != nil {
+		launcher.encryptor.close()
+	}
+
 	close(launcher.ttlStopChannel)
 }
 
@@ -414,7 +501,20 @@ func (launcher *Launcher) InstallService(serviceInfo *pb.InstallServiceRequest)
 		VendorVersion: serviceInfo.GetVendorVersion(),
 	}
 
+	startTime := time.Now()
+	operation := OperationInstall
+
+	if _, serviceErr := launcher.serviceProvider.GetService(serviceInfo.GetServiceId()); serviceErr == nil {
+		operation = OperationUpdate
+	}
+
+	reporter := launcher.startInstallProgress(serviceInfo)
+
 	defer func() {
+		reporter.Finish(err)
+
+		launcher.operationStats.add(operation, startTime, err)
+
 		if err != nil {
 			log.WithFields(log.Fields{
 				"id":         serviceInfo.GetServiceId(),
@@ -426,20 +526,29 @@ func (launcher *Launcher) InstallService(serviceInfo *pb.InstallServiceRequest)
 	launcher.usersMutex.RLock()
 	defer launcher.usersMutex.RUnlock()
 
-	if !isUsersEqual(launcher.users, serviceInfo.Users.Users) {
-		return status, aoserrors.New("users missmatch")
+	subjects := serviceInfo.GetUsers().GetUsers()
+
+	if len(subjects) == 0 {
+		return status, aoserrors.New("no subjects specified")
+	}
+
+	for _, subjectID := range subjects {
+		if !launcher.isSubjectActive(subjectID) {
+			return status, aoserrors.Errorf("subject %s is not active", subjectID)
+		}
 	}
 
-	if err = launcher.installService(serviceInfo); err != nil {
+	if err = launcher.installService(progress.NewContext(context.Background(), reporter),
+		serviceInfo, subjects); err != nil {
 		return status, aoserrors.Wrap(err)
 	}
 
-	userService, err := launcher.serviceProvider.GetUsersService(launcher.users, serviceInfo.GetServiceId())
+	subjectService, err := launcher.serviceProvider.GetSubjectService(subjects[0], serviceInfo.GetServiceId())
 	if err != nil {
 		return status, aoserrors.Wrap(err)
 	}
 
-	status.StateChecksum = hex.EncodeToString(userService.StateChecksum)
+	status.StateChecksum = hex.EncodeToString(subjectService.StateChecksum)
 
 	log.WithFields(log.Fields{
 		"id":         serviceInfo.GetServiceId(),
@@ -455,16 +564,16 @@ func (launcher *Launcher) UninstallService(removeReq *pb.RemoveServiceRequest) (
 
 	log.WithFields(log.Fields{"id": id}).Debug("Uninstall service")
 
+	startTime := time.Now()
+
 	defer func() {
+		launcher.operationStats.add(OperationRemove, startTime, err)
+
 		if err != nil {
 			log.WithFields(log.Fields{"id": id}).Errorf("Can't uninstall service: %s", err)
 		}
 	}()
 
-	if !isUsersEqual(launcher.users, removeReq.Users.Users) {
-		return aoserrors.New("users missmatch")
-	}
-
 	service, err := launcher.serviceProvider.GetService(id)
 	if err != nil {
 		return aoserrors.Wrap(err)
@@ -473,8 +582,16 @@ func (launcher *Launcher) UninstallService(removeReq *pb.RemoveServiceRequest) (
 	launcher.usersMutex.RLock()
 	defer launcher.usersMutex.RUnlock()
 
-	if err = launcher.uninstallService(service, removeReq.GetUsers().Users); err != nil {
-		return aoserrors.Wrap(err)
+	subjects := removeReq.GetUsers().GetUsers()
+
+	if len(subjects) == 0 {
+		return aoserrors.New("no subjects specified")
+	}
+
+	for _, subjectID := range subjects {
+		if err = launcher.uninstallService(service, subjectID); err != nil {
+			return aoserrors.Wrap(err)
+		}
 	}
 
 	log.WithFields(log.Fields{"id": id}).Info("Service successfully uninstalled")
@@ -503,6 +620,13 @@ func (launcher *Launcher) CheckServicesConsistency() (err error) {
 			if err := launcher.removeService(service); err != nil {
 				return aoserrors.Wrap(err)
 			}
+
+			continue
+		}
+
+		// Layer references may be absent for services installed before references were tracked
+		if err := launcher.setServiceLayers(service); err != nil {
+			return aoserrors.Wrap(err)
 		}
 	}
 
@@ -531,51 +655,13 @@ func (launcher *Launcher) GetServicesLayersInfoByUsers(users []string) (services
 	layersInfo []*pb.LayerStatus, err error) {
 	log.Debug("Get services and layers info by users")
 
-	services, err := launcher.serviceProvider.GetUsersServices(users)
-	if err != nil {
-		return servicesInfo, layersInfo, aoserrors.Wrap(err)
-	}
+	servicesInfo = make([]*pb.ServiceStatus, 0)
 
-	servicesInfo = make([]*pb.ServiceStatus, len(services))
-
-	for i, service := range services {
-		servicesInfo[i] = &pb.ServiceStatus{ServiceId: service.ID, AosVersion: service.AosVersion}
-
-		userService, err := launcher.serviceProvider.GetUsersService(users, service.ID)
-		if err != nil {
+	for _, subjectID := range users {
+		if servicesInfo, layersInfo, err = launcher.appendSubjectServicesLayersInfo(
+			subjectID, servicesInfo, layersInfo); err != nil {
 			return servicesInfo, layersInfo, aoserrors.Wrap(err)
 		}
-
-		aosConfig, err := getAosServiceConfig(path.Join(service.Path, aosServiceConfigFile))
-		if err != nil {
-			return servicesInfo, layersInfo, aoserrors.Wrap(err)
-		}
-
-		if aosConfig.GetStateLimit() != 0 {
-			servicesInfo[i].StateChecksum = hex.EncodeToString(userService.StateChecksum)
-		}
-
-		layersDigest, err := getServiceLayers(service.Path)
-		if err != nil {
-			return servicesInfo, layersInfo, aoserrors.Wrap(err)
-		}
-
-	layersLoop:
-		for _, layerDigest := range layersDigest {
-			for _, layer := range layersInfo {
-				if layer.Digest == layerDigest {
-					continue layersLoop
-				}
-			}
-
-			layerInfo, err := launcher.layerProvider.GetLayerInfoByDigest(layerDigest)
-			if err != nil {
-				log.Warnf("Can't get layer info by digest %s", layerDigest)
-				continue
-			}
-
-			layersInfo = append(layersInfo, &layerInfo)
-		}
 	}
 
 	return servicesInfo, layersInfo, nil
@@ -583,20 +669,28 @@ func (launcher *Launcher) GetServicesLayersInfoByUsers(users []string) (services
 
 // SetUsers sets users for services
 func (launcher *Launcher) SetUsers(users []string) (err error) {
+	launcher.usersMutex.Lock()
+	defer launcher.usersMutex.Unlock()
+
 	log.WithFields(log.Fields{"new": users, "old": launcher.users}).Debug("Set users")
 
 	if isUsersEqual(launcher.users, users) {
 		return nil
 	}
 
-	launcher.usersMutex.Lock()
-	defer launcher.usersMutex.Unlock()
+	removedSubjects := subtractSubjects(launcher.users, users)
+	addedSubjects := subtractSubjects(users, launcher.users)
 
-	launcher.stopCurrentUserServices()
+	launcher.stopSubjectsInstances(removedSubjects)
 
 	launcher.users = users
 
-	launcher.startCurrentUserServices()
+	if launcher.encryptor != nil {
+		launcher.encryptor.lockSubjects(removedSubjects)
+		launcher.encryptor.unlockSubjects(addedSubjects)
+	}
+
+	launcher.startSubjectsInstances(addedSubjects)
 
 	if err = launcher.cleanCache(); err != nil {
 		log.Errorf("Error cleaning cache: %s", err)
@@ -607,6 +701,14 @@ func (launcher *Launcher) SetUsers(users []string) (err error) {
 	return nil
 }
 
+// GetUsers returns current users
+func (launcher *Launcher) GetUsers() (users []string) {
+	launcher.usersMutex.RLock()
+	defer launcher.usersMutex.RUnlock()
+
+	return append(users, launcher.users...)
+}
+
 // RemoveAllServices removing all services
 func (launcher *Launcher) RemoveAllServices() (err error) {
 	services, err := launcher.serviceProvider.GetServices()
@@ -638,11 +740,6 @@ func (launcher *Launcher) RemoveAllServices() (err error) {
 		<-statusChannel
 	}
 
-	err = launcher.systemd.ReloadContext(context.Background())
-	if err != nil {
-		return aoserrors.Wrap(err)
-	}
-
 	services, err = launcher.serviceProvider.GetServices()
 	if err != nil {
 		return aoserrors.Wrap(err)
@@ -682,84 +779,95 @@ func (launcher *Launcher) SetServiceState(state *pb.ServiceState) (err error) {
 		return aoserrors.Wrap(err)
 	}
 
-	if isUsersEqual(state.Users.Users, launcher.users) {
-		if err = launcher.stopService(service); err != nil {
-			log.Errorf("Can't stop service: %s", err)
-			return aoserrors.Wrap(err)
-		}
-	}
+	for _, subjectID := range state.GetUsers().GetUsers() {
+		instance := launcher.newServiceInstance(service, subjectID)
+		subjectActive := launcher.isSubjectActive(subjectID)
 
-	if err = launcher.storageHandler.UpdateState(launcher.users, service, state.State, state.StateChecksum,
-		aosConfig.GetStateLimit()); err != nil {
-		log.Errorf("Can't update state: %s", err)
-		return aoserrors.Wrap(err)
-	}
+		if subjectActive {
+			if err = launcher.stopInstance(instance); err != nil {
+				log.Errorf("Can't stop instance: %s", err)
+				return aoserrors.Wrap(err)
+			}
+		}
 
-	if isUsersEqual(state.Users.Users, launcher.users) {
-		if err = launcher.startService(service); err != nil {
-			log.Errorf("Can't start service: %s", err)
+		if err = launcher.storageHandler.UpdateState(subjectID, service, state.State, state.StateChecksum,
+			aosConfig.GetStateLimit()); err != nil {
+			log.Errorf("Can't update state: %s", err)
 			return aoserrors.Wrap(err)
 		}
+
+		if subjectActive {
+			if err = launcher.startInstance(instance); err != nil {
+				log.Errorf("Can't start instance: %s", err)
+				return aoserrors.Wrap(err)
+			}
+		}
 	}
 
 	return nil
 }
 
-// Cleanup deletes all AOS services, their storages and states
-func Cleanup(cfg *config.Config) (err error) {
-	systemd, err := dbus.NewSystemConnectionContext(context.Background())
-	if err != nil {
-		log.Errorf("Can't connect to systemd: %s", err)
+// GetServiceStateHistory returns accepted state snapshots of service subject, the newest goes first
+func (launcher *Launcher) GetServiceStateHistory(serviceID, subjectID string) (snapshots []StateSnapshot, err error) {
+	if snapshots, err = launcher.storageHandler.GetStateHistory(subjectID, serviceID); err != nil {
+		return nil, aoserrors.Wrap(err)
 	}
 
-	if systemd != nil {
-		unitFiles, err := systemd.ListUnitFilesContext(context.Background())
-		if err != nil {
-			log.Errorf("Can't list systemd units: %s", err)
-		} else {
-			for _, unitFile := range unitFiles {
-				serviceName := filepath.Base(unitFile.Path)
-
-				if !strings.HasPrefix(serviceName, "aos_") {
-					continue
-				}
+	return snapshots, nil
+}
 
-				desc, err := systemd.GetUnitPropertyContext(context.Background(), serviceName, "Description")
-				if err != nil {
-					log.WithField("name", serviceName).Errorf("Can't get unit property: %s", err)
-					continue
-				}
+// RestoreServiceState restores service subject state from state snapshot and sends restored state to the cloud
+func (launcher *Launcher) RestoreServiceState(serviceID, subjectID, snapshotID string) (err error) {
+	launcher.usersMutex.RLock()
+	defer launcher.usersMutex.RUnlock()
 
-				value, ok := desc.Value.Value().(string)
-				if !ok {
-					log.WithField("name", serviceName).Error("Can't convert description")
-					continue
-				}
+	log.WithFields(log.Fields{
+		"serviceID": serviceID, "subjectID": subjectID, "snapshotID": snapshotID,
+	}).Debug("Restore service state")
 
-				if value == "AOS Service" {
-					log.WithField("name", serviceName).Debug("Deleting systemd service")
+	service, err := launcher.serviceProvider.GetService(serviceID)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
 
-					channel := make(chan string)
-					if _, err := systemd.StopUnitContext(context.Background(),
-						serviceName, "replace", channel); err != nil {
-						log.WithField("name", serviceName).Errorf("Can't stop unit: %s", err)
-					} else {
-						<-channel
-					}
+	instance := launcher.newServiceInstance(service, subjectID)
+	subjectActive := launcher.isSubjectActive(subjectID)
 
-					if _, err := systemd.DisableUnitFilesContext(context.Background(),
-						[]string{serviceName}, true); err != nil {
-						log.WithField("name", serviceName).Error("Can't disable unit: ", err)
-					}
-				}
-			}
+	if subjectActive {
+		if err = launcher.stopInstance(instance); err != nil {
+			return aoserrors.Wrap(err)
 		}
+	}
+
+	restoreErr := launcher.storageHandler.RestoreState(subjectID, service, snapshotID)
 
-		if err := systemd.ReloadContext(context.Background()); err != nil {
-			log.Errorf("Can't reload systemd: %s", err)
+	if subjectActive {
+		if err = launcher.startInstance(instance); err != nil {
+			return aoserrors.Wrap(err)
 		}
 	}
 
+	if restoreErr != nil {
+		return aoserrors.Wrap(restoreErr)
+	}
+
+	if err = launcher.storageHandler.SendState(subjectID, service); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// Cleanup deletes all AOS services, their storages and states
+func Cleanup(cfg *config.Config) (err error) {
+	switch cfg.RuntimeBackend {
+	case runtimeBackendRunner:
+		cleanupRunnerServices(cfg)
+
+	default:
+		cleanupSystemdServices()
+	}
+
 	serviceDir := path.Join(cfg.WorkingDir, serviceDir)
 
 	log.WithField("dir", serviceDir).Debug("Remove service dir")
@@ -768,6 +876,14 @@ func Cleanup(cfg *config.Config) (err error) {
 		log.Fatalf("Can't remove service folder: %s", err)
 	}
 
+	instancesDir := path.Join(cfg.WorkingDir, instancesDir)
+
+	log.WithField("dir", instancesDir).Debug("Remove instances dir")
+
+	if err := os.RemoveAll(instancesDir); err != nil {
+		log.Fatalf("Can't remove instances folder: %s", err)
+	}
+
 	log.WithField("dir", cfg.StorageDir).Debug("Remove storage dir")
 
 	if err := os.RemoveAll(cfg.StorageDir); err != nil {
@@ -811,8 +927,8 @@ func (launcher *Launcher) RestartServices() {
 	launcher.usersMutex.Lock()
 	defer launcher.usersMutex.Unlock()
 
-	launcher.stopCurrentUserServices()
-	launcher.startCurrentUserServices()
+	launcher.stopInstances(launcher.getRunningInstances(nil))
+	launcher.startSubjectsInstances(launcher.users)
 }
 
 // ProcessDesiredEnvVarsList override env vars fore services
@@ -840,99 +956,201 @@ func (state ServiceState) String() string {
  * Private
  ******************************************************************************/
 
-func (launcher *Launcher) startCurrentUserServices() {
-	log.WithField("users", launcher.users).Debug("Start user services")
+func (launcher *Launcher) startSubjectsInstances(subjects []string) {
+	log.WithField("subjects", subjects).Debug("Start subjects instances")
 
-	services, err := launcher.serviceProvider.GetUsersServices(launcher.users)
-	if err != nil {
-		log.Errorf("Can't start services: %s", err)
-		return
+	var instances []*serviceInstance
+
+	for _, subjectID := range subjects {
+		services, err := launcher.serviceProvider.GetSubjectServices(subjectID)
+		if err != nil {
+			log.WithField("subject", subjectID).Errorf("Can't get subject services: %s", err)
+			continue
+		}
+
+		for _, service := range services {
+			instances = append(instances, launcher.newServiceInstance(service, subjectID))
+		}
 	}
 
-	launcher.startServices(services)
+	launcher.startInstances(instances)
 }
 
-func (launcher *Launcher) stopCurrentUserServices() {
-	log.WithField("users", launcher.users).Debug("Stop user services")
+func (launcher *Launcher) stopSubjectsInstances(subjects []string) {
+	log.WithField("subjects", subjects).Debug("Stop subjects instances")
 
-	var services []Service
-	var err error
+	launcher.unblockSubjectsInstances(subjects)
 
-	if launcher.users == nil {
-		services, err = launcher.serviceProvider.GetServices()
-		if err != nil {
-			log.Errorf("Can't stop services: %s", err)
-			return
-		}
-	} else {
-		services, err = launcher.serviceProvider.GetUsersServices(launcher.users)
-		if err != nil {
-			log.Errorf("Can't stop services: %s", err)
-			return
+	launcher.stopInstances(launcher.getRunningInstances(func(instance *serviceInstance) bool {
+		for _, subjectID := range subjects {
+			if instance.subjectID == subjectID {
+				return true
+			}
 		}
+
+		return false
+	}))
+}
+
+// startInstances starts instances in dependency order
+func (launcher *Launcher) startInstances(instances []*serviceInstance) {
+	for _, level := range getDependencyLevels(instances) {
+		launcher.startInstancesInParallel(level)
 	}
+}
+
+// stopInstances stops instances in reverse dependency order
+func (launcher *Launcher) stopInstances(instances []*serviceInstance) {
+	levels := getDependencyLevels(instances)
 
-	launcher.stopServices(services)
+	for i := len(levels) - 1; i >= 0; i-- {
+		launcher.stopInstancesInParallel(levels[i])
+	}
 }
 
-func (launcher *Launcher) startServices(services []Service) {
-	var err error
-	statusChannel := make(chan error, len(services))
+// runInstanceAction performs instance action in action handler, so it is serialized with other actions of the
+// instance, e.g. restarts by supervisor
+func (launcher *Launcher) runInstanceAction(instance *serviceInstance,
+	doAction func(instance *serviceInstance) (err error)) (err error) {
+	statusChannel := make(chan error, 1)
 
-	// Start all services in parallel
-	for _, service := range services {
-		launcher.actionHandler.PutInQueue(service.ID, service,
+	launcher.actionHandler.PutInQueue(instance.id, instance, func(id string, data interface{}) {
+		statusChannel <- doAction(instance)
+	})
+
+	return <-statusChannel
+}
+
+func (launcher *Launcher) startInstancesInParallel(instances []*serviceInstance) {
+	statusChannel := make(chan error, len(instances))
+
+	// Start all instances in parallel
+	for _, instance := range instances {
+		launcher.actionHandler.PutInQueue(instance.id, instance,
 			func(id string, data interface{}) {
-				service, ok := data.(Service)
+				instance, ok := data.(*serviceInstance)
 				if !ok {
 					statusChannel <- aoserrors.New("wrong data type")
 					return
 				}
 
-				if err = launcher.startService(service); err != nil {
-					log.Errorf("Can't start service %s: %s", service.ID, err)
+				err := launcher.startInstance(instance)
+				if err != nil {
+					log.Errorf("Can't start instance %s: %s", instance.id, err)
 				}
 
 				statusChannel <- err
 			})
 	}
 
-	// Wait all services are started
-	for i := 0; i < len(services); i++ {
+	// Wait all instances are started
+	for i := 0; i < len(instances); i++ {
 		<-statusChannel
 	}
 }
 
-func (launcher *Launcher) stopServices(services []Service) {
-	var err error
-	statusChannel := make(chan error, len(services))
+func (launcher *Launcher) stopInstancesInParallel(instances []*serviceInstance) {
+	statusChannel := make(chan error, len(instances))
 
-	// Stop all services in parallel
-	for _, service := range services {
-		launcher.actionHandler.PutInQueue(service.ID, service,
+	// Stop all instances in parallel
+	for _, instance := range instances {
+		launcher.actionHandler.PutInQueue(instance.id, instance,
 			func(id string, data interface{}) {
-				service, ok := data.(Service)
+				instance, ok := data.(*serviceInstance)
 				if !ok {
 					statusChannel <- aoserrors.New("wrong data type")
 					return
 				}
 
-				if err = launcher.stopService(service); err != nil {
-					log.Errorf("Can't stop service %s: %s", service.ID, err)
+				err := launcher.stopInstance(instance)
+				if err != nil {
+					log.Errorf("Can't stop instance %s: %s", instance.id, err)
 				}
 
 				statusChannel <- err
 			})
 	}
 
-	// Wait all services are stopped
-	for i := 0; i < len(services); i++ {
+	// Wait all instances are stopped
+	for i := 0; i < len(instances); i++ {
 		<-statusChannel
 	}
 }
 
+// handleNetworkMigrations migrates service provider networks one by one. Migration stops and starts instances,
+// so it is handled separately from instances supervisor.
+func (launcher *Launcher) handleNetworkMigrations(migrationChannel <-chan string) {
+	for {
+		select {
+		case spID := <-migrationChannel:
+			launcher.migrateNetwork(spID)
+
+		case <-launcher.supervisorStopChannel:
+			return
+		}
+	}
+}
+
+// handleEgressAlerts forwards egress filter alerts of service instances
+func (launcher *Launcher) handleEgressAlerts(egressChannel <-chan networkmanager.EgressAlert) {
+	for {
+		select {
+		case alert := <-egressChannel:
+			launcher.sendEgressAlert(alert)
+
+		case <-launcher.supervisorStopChannel:
+			return
+		}
+	}
+}
+
+func (launcher *Launcher) sendEgressAlert(alert networkmanager.EgressAlert) {
+	if launcher.alertSender == nil || reflect.ValueOf(launcher.alertSender).IsNil() {
+		return
+	}
+
+	launcher.instancesMutex.Lock()
+	instance, ok := launcher.instances[alert.ServiceID]
+	launcher.instancesMutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	launcher.alertSender.SendServiceEgressAlert(instance.service.ID,
+		"subject: "+instance.subjectID+", "+alert.Message)
+}
+
+// migrateNetwork restarts running instances of service provider in new network subnet
+func (launcher *Launcher) migrateNetwork(spID string) {
+	launcher.usersMutex.Lock()
+	defer launcher.usersMutex.Unlock()
+
+	log.WithField("spID", spID).Warn("Migrate service provider network")
+
+	var instances []*serviceInstance
+
+	for _, instance := range launcher.getRunningInstances(func(instance *serviceInstance) bool {
+		return instance.service.ServiceProvider == spID
+	}) {
+		instances = append(instances, launcher.newServiceInstance(instance.service, instance.subjectID))
+	}
+
+	launcher.stopInstances(instances)
+
+	// new subnet is allocated when instances are added to the network
+	if err := launcher.network.DeleteNetwork(spID); err != nil {
+		log.WithField("spID", spID).Errorf("Can't delete network: %s", err)
+	}
+
+	launcher.startInstances(instances)
+}
+
 func (launcher *Launcher) restartServicesBySubjectServiceID(subjectServiceToRestart []subjectServicePair) {
-	servicesToRestart := []Service{}
+	launcher.usersMutex.RLock()
+	defer launcher.usersMutex.RUnlock()
+
+	instancesToRestart := []*serviceInstance{}
 
 	for _, value := range subjectServiceToRestart {
 		if launcher.isSubjectActive(value.subjectID) {
@@ -942,43 +1160,126 @@ func (launcher *Launcher) restartServicesBySubjectServiceID(subjectServiceToRest
 				continue
 			}
 
-			servicesToRestart = append(servicesToRestart, service)
+			instancesToRestart = append(instancesToRestart, launcher.newServiceInstance(service, value.subjectID))
 		}
 	}
 
-	if len(servicesToRestart) == 0 {
+	if len(instancesToRestart) == 0 {
 		return
 	}
 
-	launcher.stopServices(servicesToRestart)
-	launcher.startServices(servicesToRestart)
+	launcher.stopInstances(instancesToRestart)
+	launcher.startInstances(instancesToRestart)
 }
 
-func (launcher *Launcher) addServicesToSystemd() (err error) {
-	services, err := launcher.serviceProvider.GetServices()
+func (launcher *Launcher) appendSubjectServicesLayersInfo(subjectID string, servicesInfo []*pb.ServiceStatus,
+	layersInfo []*pb.LayerStatus) (resultServicesInfo []*pb.ServiceStatus, resultLayersInfo []*pb.LayerStatus,
+	err error) {
+	services, err := launcher.serviceProvider.GetSubjectServices(subjectID)
 	if err != nil {
-		return aoserrors.Wrap(err)
+		return servicesInfo, layersInfo, aoserrors.Wrap(err)
 	}
 
+servicesLoop:
 	for _, service := range services {
-		fileName, err := filepath.Abs(path.Join(service.Path, service.UnitName))
+		for _, serviceInfo := range servicesInfo {
+			if serviceInfo.ServiceId == service.ID {
+				continue servicesLoop
+			}
+		}
+
+		serviceInfo := &pb.ServiceStatus{ServiceId: service.ID, AosVersion: service.AosVersion}
+
+		servicesInfo = append(servicesInfo, serviceInfo)
+
+		subjectService, err := launcher.serviceProvider.GetSubjectService(subjectID, service.ID)
 		if err != nil {
-			log.Error("Can't create service file path: ", err)
-			continue
+			return servicesInfo, layersInfo, aoserrors.Wrap(err)
 		}
 
-		if _, err = launcher.systemd.LinkUnitFilesContext(context.Background(),
-			[]string{fileName}, true, true); err != nil {
-			log.Error("Can't link service file: ", err)
-			continue
+		aosConfig, err := getAosServiceConfig(path.Join(service.Path, aosServiceConfigFile))
+		if err != nil {
+			return servicesInfo, layersInfo, aoserrors.Wrap(err)
+		}
+
+		if aosConfig.GetStateLimit() != 0 {
+			serviceInfo.StateChecksum = hex.EncodeToString(subjectService.StateChecksum)
+		}
+
+		layersDigest, err := getServiceLayers(service.Path)
+		if err != nil {
+			return servicesInfo, layersInfo, aoserrors.Wrap(err)
+		}
+
+	layersLoop:
+		for _, layerDigest := range layersDigest {
+			for _, layer := range layersInfo {
+				if layer.Digest == layerDigest {
+					continue layersLoop
+				}
+			}
+
+			layerInfo, err := launcher.layerProvider.GetLayerInfoByDigest(layerDigest)
+			if err != nil {
+				log.Warnf("Can't get layer info by digest %s", layerDigest)
+				continue
+			}
+
+			layersInfo = append(layersInfo, &layerInfo)
 		}
 	}
 
-	if err = launcher.systemd.ReloadContext(context.Background()); err != nil {
-		return aoserrors.Wrap(err)
+	return servicesInfo, layersInfo, nil
+}
+
+func (launcher *Launcher) newServiceInstance(service Service, subjectID string) (instance *serviceInstance) {
+	subjectHash := sha256.Sum256([]byte(subjectID))
+	instanceID := service.ID + "_" + hex.EncodeToString(subjectHash[:instanceIDHashLen])
+
+	instance = &serviceInstance{
+		id:        instanceID,
+		subjectID: subjectID,
+		service:   service,
+		path:      path.Join(launcher.config.WorkingDir, instancesDir, instanceID),
+		unitName:  "aos_" + instanceID + ".service",
 	}
 
-	return nil
+	if launcher.runtime != nil {
+		instance.cgroupPath = launcher.runtime.getInstanceCgroupPath(instance)
+	}
+
+	return instance
+}
+
+// getRunningInstances returns running instances which match filter, all running instances if filter is nil
+func (launcher *Launcher) getRunningInstances(
+	filter func(instance *serviceInstance) bool) (instances []*serviceInstance) {
+	launcher.instancesMutex.Lock()
+	defer launcher.instancesMutex.Unlock()
+
+	for _, instance := range launcher.instances {
+		if filter == nil || filter(instance) {
+			instances = append(instances, instance)
+		}
+	}
+
+	return instances
+}
+
+// getSubjectsInstances returns instances of service for all active subjects
+func (launcher *Launcher) getSubjectsInstances(service Service) (instances []*serviceInstance, err error) {
+	subjectServices, err := launcher.serviceProvider.GetSubjectServicesByServiceID(service.ID)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	for _, subjectService := range subjectServices {
+		if launcher.isSubjectActive(subjectService.SubjectID) {
+			instances = append(instances, launcher.newServiceInstance(service, subjectService.SubjectID))
+		}
+	}
+
+	return instances, nil
 }
 
 func (launcher *Launcher) prepareHostfsDir() (err error) {
@@ -1056,11 +1357,35 @@ func isUsersEqual(users1, users2 []string) (result bool) {
 	return true
 }
 
-func (launcher *Launcher) installService(installInfo *pb.InstallServiceRequest) (err error) {
-	if launcher.users == nil {
-		return aoserrors.New("users are not set")
+// subtractSubjects returns subjects from subjects1 which are not present in subjects2
+func subtractSubjects(subjects1, subjects2 []string) (result []string) {
+subjectsLoop:
+	for _, subject1 := range subjects1 {
+		for _, subject2 := range subjects2 {
+			if subject1 == subject2 {
+				continue subjectsLoop
+			}
+		}
+
+		result = append(result, subject1)
+	}
+
+	return result
+}
+
+// startInstallProgress starts tracking of service install progress, returns nil if progress is not tracked
+func (launcher *Launcher) startInstallProgress(installInfo *pb.InstallServiceRequest) (reporter *progress.Reporter) {
+	if launcher.progressTracker == nil {
+		return nil
 	}
 
+	return launcher.progressTracker.StartOperation(progress.OperationTypeService, installInfo.GetServiceId(),
+		installInfo.GetAosVersion())
+}
+
+func (launcher *Launcher) installService(ctx context.Context, installInfo *pb.InstallServiceRequest,
+	subjects []string) (err error) {
+
 	service, err := launcher.serviceProvider.GetService(installInfo.GetServiceId())
 	if err != nil && !strings.Contains(err.Error(), "not exist") {
 		return aoserrors.Wrap(err)
@@ -1072,59 +1397,84 @@ func (launcher *Launcher) installService(installInfo *pb.InstallServiceRequest)
 		return aoserrors.New("version mistmatch")
 	}
 
-	// If same service version exists, just start the service
+	// If same service version exists, just start the service instances
 	if serviceExists && installInfo.GetAosVersion() == service.AosVersion {
-		if err = launcher.addServiceToUsers(installInfo.GetServiceId(), installInfo.GetUsers().Users); err != nil {
+		progress.FromContext(ctx).SetPhase(progress.PhaseStart)
+
+		if err = launcher.addServiceToSubjects(service, subjects); err != nil {
 			return aoserrors.Wrap(err)
 		}
 
-		if err = launcher.startService(service); err != nil {
-			return aoserrors.Wrap(err)
+		for _, subjectID := range subjects {
+			if err = launcher.runInstanceAction(launcher.newServiceInstance(service, subjectID),
+				launcher.startInstance); err != nil {
+				return aoserrors.Wrap(err)
+			}
 		}
 
 		return nil
 	}
 
-	unpackDir, err := ioutil.TempDir("", "aos_")
-	defer os.RemoveAll(unpackDir)
+	// service layers are not referenced until service is added, they should not be collected meanwhile
+	launcher.layerProvider.LockLayers()
+	defer launcher.layerProvider.UnlockLayers()
 
-	// download and unpack
-	urlVal, err := url.Parse(installInfo.Url)
+	newService, err := launcher.prepareServiceInstall(ctx, installInfo, service, serviceExists)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	var serviceImage string
+	progress.FromContext(ctx).SetPhase(progress.PhaseStart)
 
-	if urlVal.Scheme != "file" {
-		if serviceImage, err = image.Download(context.Background(), launcher.downloadDir, installInfo.Url); err != nil {
+	if err = launcher.applyServiceInstall(service, newService, serviceExists, subjects); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if serviceExists {
+		if err = os.RemoveAll(service.Path); err != nil {
 			return aoserrors.Wrap(err)
 		}
+	}
 
-		defer os.RemoveAll(serviceImage)
-	} else {
-		serviceImage = urlVal.Path
+	return nil
+}
+
+// prepareServiceInstall downloads, verifies and unpacks service image into new service dir. Running services are not
+// affected.
+func (launcher *Launcher) prepareServiceInstall(ctx context.Context, installInfo *pb.InstallServiceRequest,
+	service Service, serviceExists bool) (newService Service, err error) {
+	unpackDir, err := ioutil.TempDir("", "aos_")
+	if err != nil {
+		return newService, aoserrors.Wrap(err)
 	}
+	defer os.RemoveAll(unpackDir)
 
-	if err = image.CheckFileInfo(context.Background(), serviceImage, image.FileInfo{
+	if err = launcher.downloadServiceImage(ctx, installInfo.Url, image.FileInfo{
 		Sha256: installInfo.Sha256,
 		Sha512: installInfo.Sha512, Size: installInfo.Size,
-	}); err != nil {
-		return aoserrors.Wrap(err)
+	}, unpackDir); err != nil {
+		return newService, aoserrors.Wrap(err)
 	}
 
-	if err = imageutils.UnpackTarImage(serviceImage, unpackDir); err != nil {
-		return aoserrors.Wrap(err)
+	manifest, err := getImageManifest(unpackDir)
+	if err != nil {
+		return newService, aoserrors.Wrap(err)
 	}
 
-	if err = validateUnpackedImage(unpackDir); err != nil {
-		return aoserrors.Wrap(err)
+	// Delta image can be applied only on top of the base service version, otherwise use full image
+	if manifest.AosDelta != nil && !isDeltaApplicable(manifest.AosDelta, serviceExists, service) {
+		log.WithField("serviceID", installInfo.GetServiceId()).Warn("Delta image base mismatch, install full image")
+
+		if unpackDir, err = launcher.downloadFullServiceImage(ctx, manifest.AosDelta.FullImage); err != nil {
+			return newService, aoserrors.Wrap(err)
+		}
+		defer os.RemoveAll(unpackDir)
 	}
 
 	servicePath := path.Join(launcher.config.WorkingDir, serviceDir)
 	// Create services dir if needed
 	if err = os.MkdirAll(servicePath, 0755); err != nil {
-		return aoserrors.Wrap(err)
+		return newService, aoserrors.Wrap(err)
 	}
 
 	// We need to install or update the service
@@ -1132,7 +1482,7 @@ func (launcher *Launcher) installService(installInfo *pb.InstallServiceRequest)
 	// create install dir
 	installDir, err := ioutil.TempDir(servicePath, "")
 	if err != nil {
-		return aoserrors.Wrap(err)
+		return newService, aoserrors.Wrap(err)
 	}
 
 	defer func() {
@@ -1143,55 +1493,169 @@ func (launcher *Launcher) installService(installInfo *pb.InstallServiceRequest)
 					log.WithField("serviceID", installInfo.GetServiceId()).Errorf("Can't remove service dir: %s", err)
 				}
 			}
+
+			// Release UID/GID allocated for new service
+			if !serviceExists && newService.ID != "" {
+				if err := launcher.idsPool.remove(newService.UID, newService.GID); err != nil {
+					log.WithField("serviceID", installInfo.GetServiceId()).Errorf("Can't release UID/GID: %s", err)
+				}
+			}
 		}
 	}()
 
 	log.WithFields(log.Fields{"dir": installDir, "serviceID": installInfo.GetServiceId()}).Debug("Create install dir")
 
-	newService, err := launcher.prepareService(unpackDir, installDir, installInfo, serviceExists, service)
+	if newService, err = launcher.prepareService(ctx, unpackDir, installDir, installInfo, serviceExists,
+		service); err != nil {
+		return newService, aoserrors.Wrap(err)
+	}
+
+	if err = launcher.checkDependencyCycles(newService); err != nil {
+		return newService, aoserrors.Wrap(err)
+	}
+
+	if err = launcher.checkPublishedPorts(newService); err != nil {
+		return newService, aoserrors.Wrap(err)
+	}
+
+	return newService, nil
+}
+
+// applyServiceInstall adds new service or updates existing one with prepared service
+func (launcher *Launcher) applyServiceInstall(service, newService Service, serviceExists bool,
+	subjects []string) (err error) {
+	defer func() {
+		if err != nil {
+			// Remove new service dir if exists
+			if _, err := os.Stat(newService.Path); err == nil {
+				if err := os.RemoveAll(newService.Path); err != nil {
+					log.WithField("serviceID", newService.ID).Errorf("Can't remove service dir: %s", err)
+				}
+			}
+		}
+	}()
+
+	if !serviceExists {
+		return aoserrors.Wrap(launcher.addService(newService, subjects))
+	}
+
+	return aoserrors.Wrap(launcher.updateService(service, newService, subjects))
+}
+
+func (launcher *Launcher) downloadServiceImage(ctx context.Context, imageURL string, fileInfo image.FileInfo,
+	unpackDir string) (err error) {
+	reporter := progress.FromContext(ctx)
+
+	urlVal, err := url.Parse(imageURL)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if !serviceExists {
-		if err = launcher.addService(newService, installInfo.GetUsers().Users); err != nil {
+	var serviceImage string
+
+	if urlVal.Scheme != "file" {
+		reporter.SetPhase(progress.PhaseDownload)
+
+		// downloader checks file info of downloaded file
+		if serviceImage, err = launcher.downloader.Download(ctx, imageURL, fileInfo); err != nil {
 			return aoserrors.Wrap(err)
 		}
+
+		defer launcher.downloader.Release(serviceImage)
 	} else {
-		if err = launcher.updateService(service, newService, installInfo.GetUsers().Users); err != nil {
+		serviceImage = urlVal.Path
+
+		reporter.SetPhase(progress.PhaseVerify)
+
+		if err = image.CheckFileInfo(ctx, serviceImage, fileInfo); err != nil {
 			return aoserrors.Wrap(err)
 		}
 	}
 
+	reporter.SetPhase(progress.PhaseUnpack)
+
+	if err = imageutils.UnpackTarImage(serviceImage, unpackDir); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = validateUnpackedImage(unpackDir, launcher.signatureVerifier); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
 	return nil
 }
 
-func (launcher *Launcher) uninstallService(service Service, users []string) (err error) {
-	if launcher.users == nil {
-		return aoserrors.New("users are not set")
+func (launcher *Launcher) downloadFullServiceImage(ctx context.Context,
+	fullImage *fullImageInfo) (unpackDir string, err error) {
+	if fullImage == nil || fullImage.URL == "" {
+		return "", aoserrors.New("full service image is not specified")
 	}
 
-	if err := launcher.stopService(service); err != nil {
+	fileInfo := image.FileInfo{Size: fullImage.Size}
+
+	if fileInfo.Sha256, err = hex.DecodeString(fullImage.Sha256); err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	if fileInfo.Sha512, err = hex.DecodeString(fullImage.Sha512); err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	if unpackDir, err = ioutil.TempDir("", "aos_"); err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	if err = launcher.downloadServiceImage(ctx, fullImage.URL, fileInfo, unpackDir); err != nil {
+		os.RemoveAll(unpackDir)
+
+		return "", aoserrors.Wrap(err)
+	}
+
+	manifest, err := getImageManifest(unpackDir)
+	if err != nil {
+		os.RemoveAll(unpackDir)
+
+		return "", aoserrors.Wrap(err)
+	}
+
+	if manifest.AosDelta != nil {
+		os.RemoveAll(unpackDir)
+
+		return "", aoserrors.New("full service image is delta image")
+	}
+
+	return unpackDir, nil
+}
+
+func (launcher *Launcher) uninstallService(service Service, subjectID string) (err error) {
+	instance := launcher.newServiceInstance(service, subjectID)
+
+	if err := launcher.stopInstance(instance); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	userService, err := launcher.serviceProvider.GetUsersService(users, service.ID)
+	subjectService, err := launcher.serviceProvider.GetSubjectService(subjectID, service.ID)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if userService.StorageFolder != "" {
+	if subjectService.StorageFolder != "" {
 		log.WithFields(log.Fields{
-			"folder":    userService.StorageFolder,
+			"folder":    subjectService.StorageFolder,
 			"serviceID": service.ID,
+			"subjectID": subjectID,
 		}).Debug("Remove storage folder")
 
-		if err = os.RemoveAll(userService.StorageFolder); err != nil {
+		if err = os.RemoveAll(subjectService.StorageFolder); err != nil {
 			return aoserrors.Wrap(err)
 		}
 	}
 
-	if err = launcher.serviceProvider.RemoveServiceFromUsers(users, service.ID); err != nil {
+	if err = os.RemoveAll(instance.path); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = launcher.serviceProvider.RemoveSubjectService(subjectID, service.ID); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
@@ -1215,8 +1679,8 @@ func (launcher *Launcher) updateServiceState(id string, state ServiceState) (err
 	return nil
 }
 
-func (launcher *Launcher) mountRootfs(service Service, storageFolder string, layers []string) (err error) {
-	mergedDir := path.Join(service.Path, serviceMergedDir)
+func (launcher *Launcher) mountRootfs(instance *serviceInstance, storageFolder string, layers []string) (err error) {
+	mergedDir := path.Join(instance.path, serviceMergedDir)
 
 	// create merged dir
 	if err = os.MkdirAll(mergedDir, 0755); err != nil {
@@ -1230,9 +1694,11 @@ func (launcher *Launcher) mountRootfs(service Service, storageFolder string, lay
 		workDir = path.Join(storageFolder, workDirName)
 	}
 
-	log.WithFields(log.Fields{"path": mergedDir, "id": service.ID}).Debug("Mount service rootfs")
+	log.WithFields(log.Fields{"path": mergedDir, "id": instance.id}).Debug("Mount instance rootfs")
 
-	layerDirs := []string{path.Join(service.Path, serviceMountPointsDir), path.Join(service.Path, serviceRootfsDir)}
+	layerDirs := []string{
+		path.Join(instance.path, serviceMountPointsDir), path.Join(instance.service.Path, serviceRootfsDir),
+	}
 	layerDirs = append(layerDirs, layers...)
 	layerDirs = append(layerDirs, path.Join(launcher.config.WorkingDir, hostfsWiteoutsDir))
 	layerDirs = append(layerDirs, string("/"))
@@ -1244,10 +1710,10 @@ func (launcher *Launcher) mountRootfs(service Service, storageFolder string, lay
 	return nil
 }
 
-func (launcher *Launcher) umountRootfs(service Service) (err error) {
-	mergedDir := path.Join(service.Path, serviceMergedDir)
+func (launcher *Launcher) umountRootfs(instance *serviceInstance) (err error) {
+	mergedDir := path.Join(instance.path, serviceMergedDir)
 
-	log.WithFields(log.Fields{"path": mergedDir, "id": service.ID}).Debug("Unmount service rootfs")
+	log.WithFields(log.Fields{"path": mergedDir, "id": instance.id}).Debug("Unmount instance rootfs")
 
 	if err = umountWithRetry(mergedDir); err != nil {
 		return aoserrors.Wrap(err)
@@ -1270,7 +1736,7 @@ func (launcher *Launcher) applyDevicesAndResources(spec *serviceSpec, aosSrvConf
 	return nil
 }
 
-func (launcher *Launcher) prepareServiceRootfs(spec *serviceSpec, service Service,
+func (launcher *Launcher) prepareInstanceRootfs(spec *serviceSpec, instance *serviceInstance,
 	aosSrvConf *aosServiceConfig) (err error) {
 	if err = spec.bindHostDirs(launcher.config.WorkingDir); err != nil {
 		return aoserrors.Wrap(err)
@@ -1280,11 +1746,11 @@ func (launcher *Launcher) prepareServiceRootfs(spec *serviceSpec, service Servic
 		return aoserrors.Wrap(err)
 	}
 
-	if err = launcher.createMountPoints(service.Path, spec); err != nil {
+	if err = launcher.createMountPoints(instance.path, spec); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	storageFolder, err := launcher.storageHandler.PrepareStorageFolder(launcher.users, service,
+	storageFolder, err := launcher.storageHandler.PrepareStorageFolder(instance.subjectID, instance.service,
 		aosSrvConf.GetStorageLimit(), aosSrvConf.GetStateLimit())
 	if err != nil {
 		return aoserrors.Wrap(err)
@@ -1296,7 +1762,7 @@ func (launcher *Launcher) prepareServiceRootfs(spec *serviceSpec, service Servic
 		}
 	}
 
-	imageParts, err := getImageParts(service.Path)
+	imageParts, err := getImageParts(instance.service.Path)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
@@ -1312,18 +1778,18 @@ func (launcher *Launcher) prepareServiceRootfs(spec *serviceSpec, service Servic
 		layers = append(layers, layerPath)
 	}
 
-	if err = launcher.mountRootfs(service, storageFolder, layers); err != nil {
+	if err = launcher.mountRootfs(instance, storageFolder, layers); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
 	return nil
 }
 
-func (launcher *Launcher) applyNetworkSettings(spec *serviceSpec, service Service,
+func (launcher *Launcher) applyNetworkSettings(spec *serviceSpec, instance *serviceInstance,
 	aosSrvConf *aosServiceConfig, imageSpec *imagespec.Image) (err error) {
 	networkFiles := []string{"/etc/hosts", "/etc/resolv.conf"}
 
-	if netNsPath := networkmanager.GetNetNsPathByName(service.ID); netNsPath != "" {
+	if netNsPath := networkmanager.GetNetNsPathByName(instance.id); netNsPath != "" {
 		for i, ns := range spec.ocSpec.Linux.Namespaces {
 			switch ns.Type {
 			case runtimespec.NetworkNamespace:
@@ -1333,8 +1799,8 @@ func (launcher *Launcher) applyNetworkSettings(spec *serviceSpec, service Servic
 	}
 
 	params := networkmanager.NetworkParams{
-		HostsFilePath:      path.Join(service.Path, serviceMountPointsDir, networkFiles[0]),
-		ResolvConfFilePath: path.Join(service.Path, serviceMountPointsDir, networkFiles[1]),
+		HostsFilePath:      path.Join(instance.path, serviceMountPointsDir, networkFiles[0]),
+		ResolvConfFilePath: path.Join(instance.path, serviceMountPointsDir, networkFiles[1]),
 	}
 
 	if aosSrvConf.Quotas.DownloadSpeed != nil {
@@ -1371,51 +1837,98 @@ func (launcher *Launcher) applyNetworkSettings(spec *serviceSpec, service Servic
 		params.Hostname = *aosSrvConf.Hostname
 	}
 
-	if params.Hosts, err = launcher.getHostsFromResources(aosSrvConf.Resources); err != nil {
-		return aoserrors.Wrap(err)
+	if aosSrvConf.IPAddress != nil {
+		params.IP = *aosSrvConf.IPAddress
+	}
+
+	if aosSrvConf.IPv6Address != nil {
+		params.IPv6 = *aosSrvConf.IPv6Address
+	}
+
+	if params.PublishedPorts, err = launcher.getPublishedPorts(aosSrvConf); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if aosSrvConf.EgressPolicy != nil {
+		params.EgressPolicy = &networkmanager.EgressPolicy{
+			Hosts:    aosSrvConf.EgressPolicy.Hosts,
+			Networks: aosSrvConf.EgressPolicy.Networks,
+		}
+	}
+
+	if params.Hosts, err = launcher.getHostsFromResources(aosSrvConf.Resources); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = launcher.network.AddServiceToNetwork(instance.id, instance.service.ServiceProvider,
+		params); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// registerInstance registers service on first instance start, other instances share the same secret
+func (launcher *Launcher) registerInstance(spec *serviceSpec, instance *serviceInstance,
+	aosSrvConf *aosServiceConfig) (err error) {
+	if aosSrvConf.Permissions == nil {
+		return nil
+	}
+
+	launcher.instancesMutex.Lock()
+	defer launcher.instancesMutex.Unlock()
+
+	registration, ok := launcher.registrations[instance.service.ID]
+	if !ok {
+		secret, err := launcher.serviceRegistrar.RegisterService(instance.service.ID, aosSrvConf.Permissions)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		registration = &serviceRegistration{secret: secret, instances: make(map[string]bool)}
+		launcher.registrations[instance.service.ID] = registration
 	}
 
-	if err = launcher.network.AddServiceToNetwork(service.ID, service.ServiceProvider, params); err != nil {
-		return aoserrors.Wrap(err)
-	}
+	registration.instances[instance.id] = true
+
+	spec.mergeEnv([]string{aosSecretEnv + "=" + registration.secret})
 
 	return nil
 }
 
-func (launcher *Launcher) registerService(spec *serviceSpec, service Service,
-	aosSrvConf *aosServiceConfig) (err error) {
+// unregisterInstance unregisters service when its last instance is stopped
+func (launcher *Launcher) unregisterInstance(instance *serviceInstance, aosSrvConf *aosServiceConfig) (err error) {
 	if aosSrvConf.Permissions == nil {
 		return nil
 	}
 
-	secret, err := launcher.serviceRegistrar.RegisterService(service.ID, aosSrvConf.Permissions)
-	if err != nil {
-		return aoserrors.Wrap(err)
-	}
+	launcher.instancesMutex.Lock()
+	defer launcher.instancesMutex.Unlock()
 
-	spec.mergeEnv([]string{aosSecretEnv + "=" + secret})
+	registration, ok := launcher.registrations[instance.service.ID]
+	if !ok || !registration.instances[instance.id] {
+		return nil
+	}
 
-	return nil
-}
+	delete(registration.instances, instance.id)
 
-func (launcher *Launcher) unregisterService(service Service, aosSrvConf *aosServiceConfig) (err error) {
-	if aosSrvConf.Permissions == nil {
+	if len(registration.instances) > 0 {
 		return nil
 	}
 
-	if err := launcher.serviceRegistrar.UnregisterService(service.ID); err != nil {
+	delete(launcher.registrations, instance.service.ID)
+
+	if err := launcher.serviceRegistrar.UnregisterService(instance.service.ID); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
 	return nil
 }
 
-func (launcher *Launcher) overrideEnvVars(spec *serviceSpec, service Service) (err error) {
-	currentSubject := launcher.users[0] // TODO: currently supported only one user
-
+func (launcher *Launcher) overrideEnvVars(spec *serviceSpec, instance *serviceInstance) (err error) {
 	vars, err := launcher.envVarsProvider.getEnvVars(subjectServicePair{
-		subjectID: currentSubject,
-		serviseID: service.ID,
+		subjectID: instance.subjectID,
+		serviseID: instance.service.ID,
 	})
 	if err != nil {
 		return aoserrors.Wrap(err)
@@ -1435,7 +1948,9 @@ func (launcher *Launcher) overrideEnvVars(spec *serviceSpec, service Service) (e
 	return nil
 }
 
-func (launcher *Launcher) prestartService(service Service, aosConfig *aosServiceConfig) (err error) {
+func (launcher *Launcher) prestartInstance(instance *serviceInstance, aosConfig *aosServiceConfig) (err error) {
+	service := instance.service
+
 	err = validateImageManifest(service)
 	if err != nil {
 		return aoserrors.Wrap(err)
@@ -1446,8 +1961,12 @@ func (launcher *Launcher) prestartService(service Service, aosConfig *aosService
 		return aoserrors.Wrap(err)
 	}
 
+	if err = os.MkdirAll(instance.path, 0755); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
 	// generate config.json
-	spec, err := generateRuntimeSpec(imageSpec, path.Join(service.Path, ociRuntimeConfigFile))
+	spec, err := generateRuntimeSpec(imageSpec, path.Join(instance.path, ociRuntimeConfigFile))
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
@@ -1461,6 +1980,7 @@ func (launcher *Launcher) prestartService(service Service, aosConfig *aosService
 	}()
 
 	spec.setUserUIDGID(service.UID, service.GID)
+	spec.setCgroupsPath(instance.cgroupPath)
 
 	if err = spec.applyAosServiceConfig(aosConfig); err != nil {
 		return aoserrors.Wrap(err)
@@ -1470,89 +1990,105 @@ func (launcher *Launcher) prestartService(service Service, aosConfig *aosService
 		return aoserrors.Wrap(err)
 	}
 
-	if err := launcher.registerService(spec, service, aosConfig); err != nil {
+	if err := launcher.registerInstance(spec, instance, aosConfig); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if err := launcher.overrideEnvVars(spec, service); err != nil {
+	if err := launcher.overrideEnvVars(spec, instance); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if err := launcher.prepareServiceRootfs(spec, service, aosConfig); err != nil {
+	if err := launcher.prepareInstanceRootfs(spec, instance, aosConfig); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
 	if launcher.network != nil {
-		if err = launcher.applyNetworkSettings(spec, service, aosConfig, &imageSpec); err != nil {
+		if err = launcher.applyNetworkSettings(spec, instance, aosConfig, &imageSpec); err != nil {
 			return aoserrors.Wrap(err)
 		}
 	}
 
-	if err = launcher.requestDeviceResources(service, aosConfig.Devices); err != nil {
+	if err = launcher.requestDeviceResources(instance, aosConfig.Devices); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
 	return nil
 }
 
-func (launcher *Launcher) addServiceToSystemd(service Service) (err error) {
-	fileName, err := filepath.Abs(path.Join(service.Path, service.UnitName))
-	if err != nil {
-		return aoserrors.Wrap(err)
-	}
-
-	if _, err = launcher.systemd.LinkUnitFilesContext(context.Background(),
-		[]string{fileName}, true, true); err != nil {
-		return aoserrors.Wrap(err)
-	}
+func (launcher *Launcher) requestDeviceResources(instance *serviceInstance, devices []Device) (err error) {
+	for _, device := range devices {
+		log.Debugf("Request device %s, for %s instance", device.Name, instance.id)
 
-	if err = launcher.systemd.ReloadContext(context.Background()); err != nil {
-		return aoserrors.Wrap(err)
+		if err = launcher.devicemanager.RequestDevice(device.Name, instance.id); err != nil {
+			return aoserrors.Wrap(err)
+		}
 	}
 
 	return nil
 }
 
-func (launcher *Launcher) requestDeviceResources(service Service, devices []Device) (err error) {
-	for _, device := range devices {
-		log.Debugf("Request device %s, for %s service", device.Name, service.ID)
+func (launcher *Launcher) isInstanceRunning(instanceID string) (running bool) {
+	launcher.instancesMutex.Lock()
+	defer launcher.instancesMutex.Unlock()
 
-		if err = launcher.devicemanager.RequestDevice(device.Name, service.ID); err != nil {
-			return aoserrors.Wrap(err)
-		}
-	}
+	_, running = launcher.instances[instanceID]
 
-	return nil
+	return running
+}
+
+func (launcher *Launcher) isServiceRunning(serviceID string) (running bool) {
+	return len(launcher.getRunningInstances(func(instance *serviceInstance) bool {
+		return instance.service.ID == serviceID
+	})) > 0
 }
 
-func (launcher *Launcher) startService(service Service) (err error) {
-	if _, ok := launcher.services[service.ID]; ok {
-		log.WithFields(log.Fields{"name": service.UnitName}).Warn("Service already started")
+func (launcher *Launcher) startInstance(instance *serviceInstance) (err error) {
+	if launcher.isInstanceRunning(instance.id) {
+		log.WithFields(log.Fields{"name": instance.unitName}).Warn("Instance already started")
 
 		return nil
 	}
 
+	service := instance.service
+
 	aosConfig, err := getAosServiceConfig(path.Join(service.Path, aosServiceConfigFile))
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if err = launcher.prestartService(service, &aosConfig); err != nil {
+	// blocked instance doesn't hold any resources until it is started
+	if blockedBy := launcher.checkInstanceDependencies(instance, aosConfig.Dependencies); len(blockedBy) != 0 {
+		launcher.blockInstance(instance, blockedBy)
+
+		return nil
+	}
+
+	launcher.unblockInstance(instance.id)
+
+	defer func() {
+		if err != nil {
+			// release resources acquired by prestart
+			if poststopErr := launcher.poststopInstance(instance, &aosConfig); poststopErr != nil {
+				log.WithField("id", instance.id).Warnf("Can't release instance resources: %s", poststopErr)
+			}
+		}
+	}()
+
+	if err = launcher.prestartInstance(instance, &aosConfig); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	channel := make(chan string)
-	if _, err = launcher.systemd.StartUnitContext(context.Background(),
-		service.UnitName, "replace", channel); err != nil {
+	instance.restartPolicy = aosConfig.getRestartPolicy()
+
+	if err = launcher.runtime.startInstance(instance); err != nil {
 		return aoserrors.Wrap(err)
 	}
-	status := <-channel
 
-	log.WithFields(log.Fields{"name": service.UnitName, "status": status}).Debug("Start service")
+	launcher.startProbeMonitor(instance, &aosConfig)
 
 	if launcher.monitor != nil && !reflect.ValueOf(launcher.monitor).IsNil() {
-		if err = launcher.updateMonitoring(service, stateRunning, &aosConfig); err != nil {
-			log.WithField("id", service.ID).Error("Can't update monitoring: ", err)
+		if err = launcher.updateMonitoring(instance, stateRunning, &aosConfig); err != nil {
+			log.WithField("id", instance.id).Error("Can't update monitoring: ", err)
 		}
 	}
 
@@ -1564,16 +2100,20 @@ func (launcher *Launcher) startService(service Service) (err error) {
 		log.WithField("id", service.ID).Warnf("Can't set service start time: %s", err)
 	}
 
-	launcher.services[service.ID] = service.UnitName
+	launcher.instancesMutex.Lock()
+	launcher.instances[instance.id] = instance
+	launcher.instancesMutex.Unlock()
+
+	launcher.startBlockedDependents(instance)
 
 	return nil
 }
 
-func (launcher *Launcher) releaseDeviceResources(service Service, devices []Device) (err error) {
+func (launcher *Launcher) releaseDeviceResources(instance *serviceInstance, devices []Device) (err error) {
 	for _, device := range devices {
-		log.Debugf("Release device %s, for %s service", device.Name, service.ID)
+		log.Debugf("Release device %s, for %s instance", device.Name, instance.id)
 
-		if err = launcher.devicemanager.ReleaseDevice(device.Name, service.ID); err != nil {
+		if err = launcher.devicemanager.ReleaseDevice(device.Name, instance.id); err != nil {
 			return aoserrors.Wrap(err)
 		}
 	}
@@ -1581,31 +2121,32 @@ func (launcher *Launcher) releaseDeviceResources(service Service, devices []Devi
 	return nil
 }
 
-func (launcher *Launcher) poststopService(service Service, aosConfig *aosServiceConfig) (retErr error) {
-	if err := launcher.umountRootfs(service); err != nil {
+func (launcher *Launcher) poststopInstance(instance *serviceInstance, aosConfig *aosServiceConfig) (retErr error) {
+	if err := launcher.umountRootfs(instance); err != nil {
 		if retErr == nil {
-			log.WithField("id", service.ID).Errorf("Can't umount rootfs: %s", err)
+			log.WithField("id", instance.id).Errorf("Can't umount rootfs: %s", err)
 			retErr = err
 		}
 	}
 
-	if err := launcher.storageHandler.StopStateWatching(launcher.users, service, aosConfig.GetStateLimit()); err != nil {
+	if err := launcher.storageHandler.StopStateWatching(instance.subjectID, instance.service,
+		aosConfig.GetStateLimit()); err != nil {
 		if retErr == nil {
-			log.WithField("id", service.ID).Errorf("Can't stop state watching: %s", err)
+			log.WithField("id", instance.id).Errorf("Can't stop state watching: %s", err)
 			retErr = err
 		}
 	}
 
-	if err := launcher.releaseDeviceResources(service, aosConfig.Devices); err != nil {
+	if err := launcher.releaseDeviceResources(instance, aosConfig.Devices); err != nil {
 		if retErr == nil {
-			log.WithField("id", service.ID).Errorf("Can't release devices: %s", err)
+			log.WithField("id", instance.id).Errorf("Can't release devices: %s", err)
 			retErr = err
 		}
 	}
 
-	if err := launcher.unregisterService(service, aosConfig); err != nil {
+	if err := launcher.unregisterInstance(instance, aosConfig); err != nil {
 		if retErr == nil {
-			log.WithField("id", service.ID).Errorf("Can't unregister service: %s", err)
+			log.WithField("id", instance.id).Errorf("Can't unregister service: %s", err)
 			retErr = err
 		}
 	}
@@ -1614,11 +2155,11 @@ func (launcher *Launcher) poststopService(service Service, aosConfig *aosService
 		return aoserrors.Wrap(retErr)
 	}
 
-	if err := launcher.network.IsServiceInNetwork(service.ID, service.ServiceProvider); err == nil {
+	if err := launcher.network.IsServiceInNetwork(instance.id, instance.service.ServiceProvider); err == nil {
 		if err := launcher.network.RemoveServiceFromNetwork(
-			service.ID, service.ServiceProvider); err != nil && !strings.Contains(err.Error(), "not found") {
+			instance.id, instance.service.ServiceProvider); err != nil && !strings.Contains(err.Error(), "not found") {
 			if retErr == nil {
-				log.WithField("id", service.ID).Errorf("Can't remove service from network: %s", err)
+				log.WithField("id", instance.id).Errorf("Can't remove instance from network: %s", err)
 				retErr = err
 			}
 		}
@@ -1627,51 +2168,51 @@ func (launcher *Launcher) poststopService(service Service, aosConfig *aosService
 	return aoserrors.Wrap(retErr)
 }
 
-func (launcher *Launcher) stopService(service Service) (retErr error) {
-	aosConfig, err := getAosServiceConfig(path.Join(service.Path, aosServiceConfigFile))
+func (launcher *Launcher) stopInstance(instance *serviceInstance) (retErr error) {
+	launcher.unblockInstance(instance.id)
+	launcher.stopProbeMonitor(instance.id)
+
+	aosConfig, err := getAosServiceConfig(path.Join(instance.service.Path, aosServiceConfigFile))
 	if err != nil {
 		if retErr == nil {
-			log.WithField("id", service.ID).Errorf("Can't get service config: %s", err)
+			log.WithField("id", instance.id).Errorf("Can't get service config: %s", err)
 			retErr = err
 		}
 	}
 
-	channel := make(chan string)
-	if _, err := launcher.systemd.StopUnitContext(context.Background(),
-		service.UnitName, "replace", channel); err != nil {
-		if strings.Contains(err.Error(), errNotLoaded) {
-			log.WithField("id", service.ID).Warn("Service not loaded")
-		} else {
-			log.WithField("id", service.ID).Errorf("Can't stop systemd unit: %s", err)
+	if err := launcher.runtime.stopInstance(instance); err != nil {
+		if retErr == nil {
+			log.WithField("id", instance.id).Errorf("Can't stop instance: %s", err)
 			retErr = err
 		}
-	} else {
-		status := <-channel
-		log.WithFields(log.Fields{"id": service.ID, "status": status}).Debug("Stop service")
 	}
 
-	if err := launcher.poststopService(service, &aosConfig); err != nil {
+	if err := launcher.poststopInstance(instance, &aosConfig); err != nil {
 		if retErr == nil {
-			log.WithField("id", service.ID).Errorf("Can't perform post stop: %s", err)
+			log.WithField("id", instance.id).Errorf("Can't perform post stop: %s", err)
 			retErr = err
 		}
 	}
 
 	if launcher.monitor != nil && !reflect.ValueOf(launcher.monitor).IsNil() {
-		if err = launcher.updateMonitoring(service, stateStopped, &aosConfig); err != nil {
-			log.WithField("id", service.ID).Error("Can't update monitoring: ", err)
+		if err = launcher.updateMonitoring(instance, stateStopped, &aosConfig); err != nil {
+			log.WithField("id", instance.id).Error("Can't update monitoring: ", err)
 		}
 	}
 
-	if err := launcher.updateServiceState(service.ID, stateStopped); err != nil {
-		if retErr == nil {
-			log.WithField("id", service.ID).Errorf("Can't update service state: %s", err)
-			retErr = err
+	launcher.instancesMutex.Lock()
+	delete(launcher.instances, instance.id)
+	launcher.instancesMutex.Unlock()
+
+	if !launcher.isServiceRunning(instance.service.ID) {
+		if err := launcher.updateServiceState(instance.service.ID, stateStopped); err != nil {
+			if retErr == nil {
+				log.WithField("id", instance.service.ID).Errorf("Can't update service state: %s", err)
+				retErr = err
+			}
 		}
 	}
 
-	delete(launcher.services, service.ID)
-
 	return aoserrors.Wrap(retErr)
 }
 
@@ -1685,6 +2226,13 @@ func (launcher *Launcher) restoreService(service Service) (retErr error) {
 		}
 	}
 
+	if err := launcher.setServiceLayers(service); err != nil {
+		if retErr == nil {
+			log.WithField("id", service.ID).Errorf("Can't set service layers: %s", err)
+			retErr = err
+		}
+	}
+
 	aosConfig, err := getAosServiceConfig(path.Join(service.Path, aosServiceConfigFile))
 	if err != nil {
 		return aoserrors.Wrap(err)
@@ -1698,17 +2246,17 @@ func (launcher *Launcher) restoreService(service Service) (retErr error) {
 		}
 	}
 
-	if err := launcher.addServiceToSystemd(service); err != nil {
-		if retErr == nil {
-			log.WithField("id", service.ID).Errorf("Can't add service to systemd: %s", err)
-			retErr = err
-		}
+	instances, err := launcher.getSubjectsInstances(service)
+	if err != nil {
+		return aoserrors.Wrap(err)
 	}
 
-	if err := launcher.startService(service); err != nil {
-		if retErr == nil {
-			log.WithField("id", service.ID).Errorf("Can't install service: %s", err)
-			retErr = err
+	for _, instance := range instances {
+		if err := launcher.startInstance(instance); err != nil {
+			if retErr == nil {
+				log.WithField("id", instance.id).Errorf("Can't start instance: %s", err)
+				retErr = err
+			}
 		}
 	}
 
@@ -1852,7 +2400,7 @@ func (launcher *Launcher) getHostsFromResources(resources []string) (hosts []con
 	return hosts, nil
 }
 
-func (launcher *Launcher) prepareService(unpackDir, installDir string,
+func (launcher *Launcher) prepareService(ctx context.Context, unpackDir, installDir string,
 	serviceInfo *pb.InstallServiceRequest, update bool, oldService Service) (service Service, err error) {
 	var uid, gid uint32
 
@@ -1890,29 +2438,27 @@ func (launcher *Launcher) prepareService(unpackDir, installDir string,
 
 	rootfsDir := path.Join(installDir, serviceRootfsDir)
 
-	// unpack rootfs layer
-	if err = imageutils.UnpackTarImage(imageParts.serviceFSLayerPath, rootfsDir); err != nil {
-		return service, aoserrors.Wrap(err)
-	}
-
-	if err = filepath.Walk(rootfsDir, func(name string, info os.FileInfo, err error) error {
-		if err != nil {
-			return aoserrors.Wrap(err)
+	if imageParts.delta != nil {
+		// delta is checked by installService, but check it again to not apply delta on wrong base
+		if !isDeltaApplicable(imageParts.delta, update, oldService) {
+			return service, aoserrors.New("delta image base mismatch")
 		}
 
-		if err = os.Chown(name, int(uid), int(gid)); err != nil {
-			return aoserrors.Wrap(err)
+		if err = applyDelta(path.Join(oldService.Path, serviceRootfsDir), imageParts.serviceFSLayerPath, rootfsDir,
+			imageParts.delta.Removed, uid, gid); err != nil {
+			return service, aoserrors.Wrap(err)
+		}
+	} else {
+		// unpack rootfs layer
+		if err = imageutils.UnpackTarImage(imageParts.serviceFSLayerPath, rootfsDir); err != nil {
+			return service, aoserrors.Wrap(err)
 		}
 
-		return nil
-	}); err != nil {
-		return service, aoserrors.Wrap(err)
-	}
-
-	serviceName := "aos_" + serviceInfo.GetServiceId() + ".service"
+		progress.FromContext(ctx).SetPhase(progress.PhaseChown)
 
-	if err = launcher.createSystemdService(installDir, serviceName, serviceInfo.GetServiceId()); err != nil {
-		return service, aoserrors.Wrap(err)
+		if err = chownTree(rootfsDir, uid, gid); err != nil {
+			return service, aoserrors.Wrap(err)
+		}
 	}
 
 	service = Service{
@@ -1922,7 +2468,7 @@ func (launcher *Launcher) prepareService(unpackDir, installDir string,
 		Description:     serviceInfo.GetDescription(),
 		ServiceProvider: serviceInfo.GetProviderId(),
 		Path:            installDir,
-		UnitName:        serviceName,
+		UnitName:        "aos_" + serviceInfo.GetServiceId() + ".service",
 		UID:             uid,
 		GID:             gid,
 		State:           stateInit,
@@ -1943,7 +2489,7 @@ func (launcher *Launcher) prepareService(unpackDir, installDir string,
 
 // We can't remove service if it is not in serviceProvider. Just return error and rollback will be
 // handled by parent function
-func (launcher *Launcher) addService(service Service, users []string) (err error) {
+func (launcher *Launcher) addService(service Service, subjects []string) (err error) {
 	aosConfig, err := getAosServiceConfig(path.Join(service.Path, aosServiceConfigFile))
 	if err != nil {
 		return aoserrors.Wrap(err)
@@ -1968,22 +2514,29 @@ func (launcher *Launcher) addService(service Service, users []string) (err error
 		}
 	}()
 
-	if err = launcher.addServiceToUsers(service.ID, users); err != nil {
+	if err = launcher.setServiceLayers(service); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if err = launcher.addServiceToSystemd(service); err != nil {
+	if err = launcher.addServiceToSubjects(service, subjects); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if err = launcher.startService(service); err != nil {
+	instances, err := launcher.getSubjectsInstances(service)
+	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	return aoserrors.Wrap(err)
+	for _, instance := range instances {
+		if err = launcher.runInstanceAction(instance, launcher.startInstance); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return nil
 }
 
-func (launcher *Launcher) updateService(oldService, newService Service, users []string) (err error) {
+func (launcher *Launcher) updateService(oldService, newService Service, subjects []string) (err error) {
 	defer func() {
 		if err == nil {
 			return
@@ -1991,8 +2544,15 @@ func (launcher *Launcher) updateService(oldService, newService Service, users []
 
 		log.WithField("id", newService.ID).Errorf("Update service error: %s", err)
 
-		if err := launcher.stopService(newService); err != nil {
-			log.WithField("id", newService.ID).Errorf("Can't stop service: %s", err)
+		newInstances, err := launcher.getSubjectsInstances(newService)
+		if err != nil {
+			log.WithField("id", newService.ID).Errorf("Can't get service instances: %s", err)
+		}
+
+		for _, instance := range newInstances {
+			if err := launcher.runInstanceAction(instance, launcher.stopInstance); err != nil {
+				log.WithField("id", instance.id).Errorf("Can't stop instance: %s", err)
+			}
 		}
 
 		if err := os.RemoveAll(newService.Path); err != nil {
@@ -2015,7 +2575,7 @@ func (launcher *Launcher) updateService(oldService, newService Service, users []
 		return aoserrors.Wrap(err)
 	}
 
-	if err = launcher.addServiceToUsers(newService.ID, users); err != nil {
+	if err = launcher.addServiceToSubjects(newService, subjects); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
@@ -2024,27 +2584,54 @@ func (launcher *Launcher) updateService(oldService, newService Service, users []
 		return aoserrors.Wrap(err)
 	}
 
-	if err = launcher.stopService(oldService); err != nil {
-		return aoserrors.Wrap(err)
+	oldInstances := launcher.getRunningInstances(func(instance *serviceInstance) bool {
+		return instance.service.ID == oldService.ID
+	})
+
+	for _, instance := range oldInstances {
+		if err = launcher.runInstanceAction(instance, launcher.stopInstance); err != nil {
+			return aoserrors.Wrap(err)
+		}
 	}
 
-	if err = launcher.addServiceToSystemd(newService); err != nil {
+	newInstances, err := launcher.getSubjectsInstances(newService)
+	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if err = launcher.startService(newService); err != nil {
-		return aoserrors.Wrap(err)
+	for _, instance := range newInstances {
+		if err = launcher.runInstanceAction(instance, launcher.startInstance); err != nil {
+			return aoserrors.Wrap(err)
+		}
 	}
 
-	if err = launcher.checkServiceHealth(newService.UnitName); err != nil {
-		return aoserrors.Wrap(err)
+	for _, instance := range newInstances {
+		// blocked instances are started when dependencies are satisfied
+		if launcher.isInstanceBlocked(instance.id) {
+			continue
+		}
+
+		if err = launcher.runtime.checkInstanceHealth(instance,
+			launcher.config.ServiceHealthCheckTimeout.Duration); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	for _, instance := range newInstances {
+		if launcher.isInstanceBlocked(instance.id) {
+			continue
+		}
+
+		if err = launcher.checkInstanceReadiness(instance, newAosConfig.ReadinessProbe); err != nil {
+			return aoserrors.Wrap(err)
+		}
 	}
 
 	if err = launcher.serviceProvider.UpdateService(newService); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if err = os.RemoveAll(oldService.Path); err != nil {
+	if err = launcher.setServiceLayers(newService); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
@@ -2054,40 +2641,45 @@ func (launcher *Launcher) updateService(oldService, newService Service, users []
 func (launcher *Launcher) removeService(service Service) (retErr error) {
 	log.WithFields(log.Fields{"id": service.ID, "aosVersion": service.AosVersion}).Debug("Remove service")
 
-	if err := launcher.stopService(service); err != nil {
+	subjectServices, err := launcher.serviceProvider.GetSubjectServicesByServiceID(service.ID)
+	if err != nil {
 		if retErr == nil {
+			log.WithField("name", service.ID).Errorf("Can't get subject services: %s", err)
 			retErr = err
 		}
 	}
 
-	if _, err := launcher.systemd.DisableUnitFilesContext(context.Background(),
-		[]string{service.UnitName}, true); err != nil {
-		if retErr == nil {
-			log.WithField("name", service.ID).Errorf("Can't disable systemd unit: %s", err)
-			retErr = err
-		}
-	}
+	for _, subjectService := range subjectServices {
+		instance := launcher.newServiceInstance(service, subjectService.SubjectID)
 
-	if err := launcher.systemd.ReloadContext(context.Background()); err != nil {
-		log.Errorf("Can't reload systemd: %s", err)
-	}
+		if err := launcher.stopInstance(instance); err != nil {
+			if retErr == nil {
+				retErr = err
+			}
+		} else if err := os.RemoveAll(instance.path); err != nil {
+			if retErr == nil {
+				log.WithField("name", instance.id).Errorf("Can't remove instance folder: %s", err)
+				retErr = err
+			}
+		}
 
-	usersServices, err := launcher.serviceProvider.GetUsersServicesByServiceID(service.ID)
-	if err != nil {
-		if retErr == nil {
-			log.WithField("name", service.ID).Errorf("Can't get users services: %s", err)
-			retErr = err
+		if launcher.network != nil {
+			if err := launcher.network.ReleaseServiceIP(instance.id); err != nil {
+				if retErr == nil {
+					log.WithField("name", instance.id).Errorf("Can't release instance IP: %s", err)
+					retErr = err
+				}
+			}
 		}
-	}
 
-	for _, userService := range usersServices {
-		if userService.StorageFolder != "" {
+		if subjectService.StorageFolder != "" {
 			log.WithFields(log.Fields{
-				"folder":    userService.StorageFolder,
+				"folder":    subjectService.StorageFolder,
 				"serviceID": service.ID,
+				"subjectID": subjectService.SubjectID,
 			}).Debug("Remove storage folder")
 
-			if err := os.RemoveAll(userService.StorageFolder); err != nil {
+			if err := os.RemoveAll(subjectService.StorageFolder); err != nil {
 				if retErr == nil {
 					log.WithField("name", service.ID).Errorf("Can't remove storage folder: %s", err)
 					retErr = err
@@ -2096,9 +2688,9 @@ func (launcher *Launcher) removeService(service Service) (retErr error) {
 		}
 	}
 
-	if err := launcher.serviceProvider.RemoveServiceFromAllUsers(service.ID); err != nil {
+	if err := launcher.serviceProvider.RemoveServiceFromAllSubjects(service.ID); err != nil {
 		if retErr == nil {
-			log.WithField("name", service.ID).Errorf("Can't delete users from DB: %s", err)
+			log.WithField("name", service.ID).Errorf("Can't delete subjects from DB: %s", err)
 			retErr = err
 		}
 	}
@@ -2146,141 +2738,64 @@ func (launcher *Launcher) removeService(service Service) (retErr error) {
 	return aoserrors.Wrap(retErr)
 }
 
-func (launcher *Launcher) cleanupLayers() (retErr error) {
-	layersToRemove, retErr := launcher.layerProvider.GetLayersInfo()
-	if retErr != nil {
-		return aoserrors.Wrap(retErr)
-	}
-
-	if len(layersToRemove) == 0 {
-		return nil
-	}
-
-	allServices, retErr := launcher.serviceProvider.GetServices()
-	if retErr != nil {
-		return aoserrors.Wrap(retErr)
-	}
-
-	for _, serviceToCheck := range allServices {
-		if len(layersToRemove) == 0 {
-			return nil
-		}
-
-		layersDigest, err := getServiceLayers(serviceToCheck.Path)
-		if err != nil {
-			if retErr == nil {
-				log.WithField("name", serviceToCheck.ID).Errorf("Can't get layers from installed service: %s", err)
-				retErr = err
-			}
-
-			continue
-		}
-
-		for _, digest := range layersDigest {
-			for i, layerToRemove := range layersToRemove {
-				if layerToRemove.Digest == digest {
-					layersToRemove = append(layersToRemove[:i], layersToRemove[i+1:]...)
-
-					break
-				}
-			}
-		}
-	}
-
-	for _, layerToRemove := range layersToRemove {
-		if err := launcher.layerProvider.UninstallLayer(layerToRemove.Digest); err != nil {
-			if retErr == nil {
-				log.Errorf("Can't delete layer: %s", err)
-				retErr = err
-			}
-		}
-	}
-
-	return aoserrors.Wrap(retErr)
-}
-
-func getSystemdServiceTemplate(workingDir string) (template string, err error) {
-	fileName := path.Join(workingDir, serviceTemplateFile)
-
-	fileContent, err := ioutil.ReadFile(fileName)
+func (launcher *Launcher) cleanupLayers() (err error) {
+	report, err := launcher.layerProvider.CollectGarbage(false)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return template, aoserrors.Wrap(err)
-		}
-
-		log.Warnf("Service template file does not exist. Creating %s", fileName)
-
-		if err = ioutil.WriteFile(fileName, []byte(serviceTemplate), 0644); err != nil {
-			return template, aoserrors.Wrap(err)
-		}
-
-		return serviceTemplate, nil
+		return aoserrors.Wrap(err)
 	}
 
-	return string(fileContent), nil
-}
+	log.WithFields(log.Fields{
+		"layers": len(report.Layers), "size": report.TotalSize,
+	}).Debug("Unused layers removed")
 
-func (launcher *Launcher) createSystemdService(installDir, serviceName, id string) (err error) {
-	f, err := os.Create(path.Join(installDir, serviceName))
-	if err != nil {
-		return aoserrors.Wrap(err)
-	}
-	defer f.Close()
+	return nil
+}
 
-	absServicePath, err := filepath.Abs(installDir)
+func (launcher *Launcher) setServiceLayers(service Service) (err error) {
+	layersDigest, err := getServiceLayers(service.Path)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	lines := strings.SplitAfter(launcher.serviceTemplate, "\n")
-	for _, line := range lines {
-		// skip comments
-		if strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		// replaces variables with values
-		line = strings.ReplaceAll(line, "${RUNNER}", launcher.runnerPath)
-		line = strings.ReplaceAll(line, "${ID}", id)
-		line = strings.ReplaceAll(line, "${SERVICEPATH}", absServicePath)
-
-		fmt.Fprint(f, line)
-	}
-
-	return aoserrors.Wrap(err)
+	return aoserrors.Wrap(launcher.serviceProvider.SetServiceLayers(service.ID, layersDigest))
 }
 
-func (launcher *Launcher) updateMonitoring(service Service, state ServiceState, aosConfig *aosServiceConfig) (err error) {
+func (launcher *Launcher) updateMonitoring(instance *serviceInstance, state ServiceState,
+	aosConfig *aosServiceConfig) (err error) {
 	switch state {
 	case stateRunning:
 		var rules monitoring.ServiceAlertRules
 
-		if err := json.Unmarshal([]byte(service.AlertRules), &rules); err != nil {
+		if err := json.Unmarshal([]byte(instance.service.AlertRules), &rules); err != nil {
 			return aoserrors.Wrap(err)
 		}
 
 		var ipAddress string
 
 		if launcher.network != nil {
-			if ipAddress, err = launcher.network.GetServiceIP(service.ID, service.ServiceProvider); err != nil {
+			if ipAddress, _, err = launcher.network.GetServiceIP(instance.id,
+				instance.service.ServiceProvider); err != nil {
 				return aoserrors.Wrap(err)
 			}
 		}
 
 		monitoringConfig := monitoring.ServiceMonitoringConfig{
-			ServiceDir:   service.Path,
+			ServiceID:    instance.service.ID,
+			SubjectID:    instance.subjectID,
+			ServiceDir:   instance.path,
+			CgroupPath:   instance.cgroupPath,
 			IPAddress:    ipAddress,
-			UID:          service.UID,
-			GID:          service.GID,
+			UID:          instance.service.UID,
+			GID:          instance.service.GID,
 			ServiceRules: &rules,
 		}
 
-		if err = launcher.monitor.StartMonitorService(service.ID, monitoringConfig); err != nil {
+		if err = launcher.monitor.StartMonitorService(instance.id, monitoringConfig); err != nil {
 			return aoserrors.Wrap(err)
 		}
 
 	case stateStopped:
-		if err = launcher.monitor.StopMonitorService(service.ID); err != nil {
+		if err = launcher.monitor.StopMonitorService(instance.id); err != nil {
 			return aoserrors.Wrap(err)
 		}
 	}
@@ -2288,18 +2803,32 @@ func (launcher *Launcher) updateMonitoring(service Service, state ServiceState,
 	return nil
 }
 
-func (launcher *Launcher) addServiceToUsers(serviceID string, users []string) (err error) {
-	_, err = launcher.serviceProvider.GetUsersService(users, serviceID)
-	if err == nil {
-		return nil
-	}
+func (launcher *Launcher) addServiceToSubjects(service Service, subjects []string) (err error) {
+	subjectsAdded := false
 
-	if !strings.Contains(err.Error(), "not exist") {
-		return aoserrors.Wrap(err)
+	for _, subjectID := range subjects {
+		_, err = launcher.serviceProvider.GetSubjectService(subjectID, service.ID)
+		if err == nil {
+			continue
+		}
+
+		if !strings.Contains(err.Error(), "not exist") {
+			return aoserrors.Wrap(err)
+		}
+
+		if err = launcher.serviceProvider.AddSubjectService(SubjectService{
+			SubjectID: subjectID,
+			ServiceID: service.ID,
+			UnitName:  launcher.newServiceInstance(service, subjectID).unitName,
+		}); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		subjectsAdded = true
 	}
 
-	if err = launcher.serviceProvider.AddServiceToUsers(users, serviceID); err != nil {
-		return aoserrors.Wrap(err)
+	if !subjectsAdded {
+		return nil
 	}
 
 	if err = launcher.envVarsProvider.syncEnvVarsWithStorage(); err != nil {
@@ -2312,11 +2841,6 @@ func (launcher *Launcher) addServiceToUsers(serviceID string, users []string) (e
 func (launcher *Launcher) cleanCache() (err error) {
 	log.Debug("Clean cached services and layers")
 
-	startedServices, err := launcher.serviceProvider.GetUsersServices(launcher.users)
-	if err != nil {
-		return aoserrors.Wrap(err)
-	}
-
 	allServices, err := launcher.serviceProvider.GetServices()
 	if err != nil {
 		return aoserrors.Wrap(err)
@@ -2328,18 +2852,8 @@ func (launcher *Launcher) cleanCache() (err error) {
 	statusChannel := make(chan error, len(allServices))
 
 	for _, service := range allServices {
-		// check if service just started
-		justStarted := false
-
-		for _, startedService := range startedServices {
-			if service.ID == startedService.ID {
-				justStarted = true
-
-				break
-			}
-		}
-
-		if justStarted {
+		// skip services with running instances
+		if launcher.isServiceRunning(service.ID) {
 			continue
 		}
 
@@ -2393,14 +2907,10 @@ func (launcher *Launcher) isServiceValid(service Service) (err error) {
 		return aoserrors.Errorf("image specification file %s doesn't exist", path.Join(service.Path, ociImageConfigFile))
 	}
 
-	// check service file
-	if _, err = os.Stat(path.Join(service.Path, service.UnitName)); os.IsNotExist(err) {
-		return aoserrors.Errorf("service file %s doesn't exist", path.Join(service.Path, service.UnitName))
-	}
-
 	return nil
 }
 
+// no mutex as it is called from usersMutex locked context
 func (launcher *Launcher) isSubjectActive(subjectID string) bool {
 	for _, curSubject := range launcher.users {
 		if subjectID == curSubject {
@@ -2449,46 +2959,21 @@ func (launcher *Launcher) validateTTLs() {
 	}
 }
 
-func (launcher *Launcher) checkServiceHealth(serviceName string) (err error) {
-	subSet := launcher.systemd.NewSubscriptionSet()
-
-	subSet.Add(serviceName)
-
-	evChan, errChan := subSet.Subscribe()
-
-	var curretActiveStatus string
-
-	timeoutChannel := time.After(launcher.config.ServiceHealthCheckTimeout.Duration)
-
-	for {
-		select {
-		case changes := <-evChan:
-			unitStatus, ok := changes[serviceName]
-			if !ok {
-				break
-			}
-
-			if unitStatus == nil {
-				return aoserrors.Errorf("service %s disabled", serviceName)
-			}
-
-			if unitStatus.Name == serviceName {
-				if unitStatus.ActiveState == unitStatusFailed {
-					return aoserrors.Errorf("service %s failed", serviceName)
-				}
-
-				curretActiveStatus = unitStatus.ActiveState
-			}
+func newRuntimeBackend(config *config.Config) (backend runtimeBackend, err error) {
+	// Retrieve runner abs path
+	runnerPath, err := exec.LookPath(config.Runner)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
 
-		case err = <-errChan:
-			return aoserrors.Wrap(err)
+	switch config.RuntimeBackend {
+	case runtimeBackendSystemd, "":
+		return newSystemdBackend(config.WorkingDir, runnerPath)
 
-		case <-timeoutChannel:
-			if curretActiveStatus != unitStatusActive {
-				return aoserrors.Errorf("waiting for activating service %s timeout", serviceName)
-			}
+	case runtimeBackendRunner:
+		return newRunnerBackend(runnerPath)
 
-			return nil
-		}
+	default:
+		return nil, aoserrors.Errorf("unsupported runtime backend: %s", config.RuntimeBackend)
 	}
 }
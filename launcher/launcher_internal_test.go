@@ -49,6 +49,7 @@ import (
 	"golang.org/x/crypto/sha3"
 
 	"github.com/aoscloud/aos_servicemanager/config"
+	"github.com/aoscloud/aos_servicemanager/layermanager"
 	"github.com/aoscloud/aos_servicemanager/monitoring"
 	"github.com/aoscloud/aos_servicemanager/networkmanager"
 	"github.com/aoscloud/aos_servicemanager/platform"
@@ -96,8 +97,8 @@ type testMonitor struct {
 
 type testServiceProvider struct {
 	sync.Mutex
-	services      map[string]*Service
-	usersServices []*UsersService
+	services        map[string]*Service
+	subjectServices []*SubjectService
 }
 
 type testLayerProvider struct{}
@@ -847,9 +848,9 @@ func TestUsersServices(t *testing.T) {
 			t.Fatalf("Can't set users: %s", err)
 		}
 
-		services, err := launcher.serviceProvider.GetUsersServices(users)
+		services, err := launcher.serviceProvider.GetSubjectServices(users[0])
 		if err != nil {
-			t.Fatalf("Can't get users services: %s", err)
+			t.Fatalf("Can't get subject services: %s", err)
 		}
 		if len(services) != 0 {
 			t.Fatalf("Wrong service quantity")
@@ -881,7 +882,7 @@ func TestUsersServices(t *testing.T) {
 
 		for _, service := range services {
 			if service.State == stateRunning {
-				_, err = launcher.serviceProvider.GetUsersService(users, service.ID)
+				_, err = launcher.serviceProvider.GetSubjectService(users[0], service.ID)
 				if err != nil && !strings.Contains(err.Error(), "not exist") {
 					t.Errorf("Can't check users service: %s", err)
 				}
@@ -915,7 +916,7 @@ func TestUsersServices(t *testing.T) {
 
 		for _, service := range services {
 			if service.State == stateRunning {
-				_, err = launcher.serviceProvider.GetUsersService(users, service.ID)
+				_, err = launcher.serviceProvider.GetSubjectService(users[0], service.ID)
 				if err != nil && !strings.Contains(err.Error(), "not exist") {
 					t.Errorf("Can't check users service: %s", err)
 				}
@@ -995,8 +996,8 @@ func TestServiceTTL(t *testing.T) {
 		t.Fatal("Wrong service quantity")
 	}
 
-	if len(serviceProvider.usersServices) != 0 {
-		t.Fatalf("Wrong users quantity: %d", len(serviceProvider.usersServices))
+	if len(serviceProvider.subjectServices) != 0 {
+		t.Fatalf("Wrong subjects quantity: %d", len(serviceProvider.subjectServices))
 	}
 }
 
@@ -1059,8 +1060,16 @@ func TestServiceMonitoring(t *testing.T) {
 
 	select {
 	case info := <-monitor.startChannel:
-		if info.serviceID != "Service1" {
-			t.Fatalf("Wrong service ID: %s", info.serviceID)
+		if info.config.ServiceID != "Service1" {
+			t.Fatalf("Wrong service ID: %s", info.config.ServiceID)
+		}
+
+		if info.config.SubjectID != users[0] {
+			t.Fatalf("Wrong subject ID: %s", info.config.SubjectID)
+		}
+
+		if !strings.HasPrefix(info.config.CgroupPath, instancesCgroupParent+"/Service1_") {
+			t.Fatalf("Wrong cgroup path: %s", info.config.CgroupPath)
 		}
 
 		if !reflect.DeepEqual(info.config.ServiceRules, &serviceAlerts) {
@@ -1079,9 +1088,9 @@ func TestServiceMonitoring(t *testing.T) {
 	}
 
 	select {
-	case serviceID := <-monitor.stopChannel:
-		if serviceID != "Service1" {
-			t.Fatalf("Wrong service ID: %s", serviceID)
+	case instanceID := <-monitor.stopChannel:
+		if !strings.HasPrefix(instanceID, "Service1_") {
+			t.Fatalf("Wrong instance ID: %s", instanceID)
 		}
 
 	case <-time.After(2000 * time.Millisecond):
@@ -1661,7 +1670,7 @@ func TestValidateUnpackedImage(t *testing.T) {
 		log.Fatalf("Can't generate fakeImage %s", err)
 	}
 
-	if err := validateUnpackedImage(fakeImageFolder); err != nil {
+	if err := validateUnpackedImage(fakeImageFolder, nil); err != nil {
 		t.Errorf("Error validateUnpackedImage %s", err)
 	}
 }
@@ -1909,20 +1918,22 @@ func TestManifestValidation(t *testing.T) {
 		t.Fatalf("Can't get service: %s", err)
 	}
 
-	err = launcher.stopService(service)
+	instance := launcher.newServiceInstance(service, users[0])
+
+	err = launcher.stopInstance(instance)
 	if err != nil {
-		t.Fatal("Failed to stop service")
+		t.Fatal("Failed to stop instance")
 	}
 
-	err = launcher.startService(service)
+	err = launcher.startInstance(instance)
 	if err != nil {
-		t.Fatal("Failed to start service")
+		t.Fatal("Failed to start instance")
 	}
 
 	// stop and start service with invalid checksum should failed
-	err = launcher.stopService(service)
+	err = launcher.stopInstance(instance)
 	if err != nil {
-		t.Fatal("Failed to stop service")
+		t.Fatal("Failed to stop instance")
 	}
 
 	// change service manifest digest
@@ -1930,7 +1941,7 @@ func TestManifestValidation(t *testing.T) {
 	h.Write(service.ManifestDigest)
 	service.ManifestDigest = h.Sum(nil)
 
-	err = launcher.startService(service)
+	err = launcher.startInstance(launcher.newServiceInstance(service, users[0]))
 	if err == nil {
 		t.Error("Start service with invalid manifest digest should failed")
 	} else if !strings.Contains(err.Error(), "digest does not match") {
@@ -2160,6 +2171,86 @@ func TestChangeUsers(t *testing.T) {
 	launcher.Close()
 }
 
+func TestSubjectsInstances(t *testing.T) {
+	testImage := pythonImage{}
+
+	launcher, err := newTestLauncher(nil, 1*time.Second)
+	if err != nil {
+		t.Fatalf("Can't create launcher: %s", err)
+	}
+
+	t.Cleanup(func() {
+		_ = launcher.RemoveAllServices()
+		launcher.Close()
+	})
+
+	subjects := []string{"subject0", "subject1"}
+	if err = launcher.SetUsers(subjects); err != nil {
+		t.Fatalf("Can't set users: %s", err)
+	}
+
+	serviceURL, fileInfo, err := testImage.PrepareService()
+	if err != nil {
+		t.Fatal("Can't prepare test service: ", err)
+	}
+
+	if _, err = launcher.InstallService(&pb.InstallServiceRequest{
+		ServiceId:  "service0",
+		ProviderId: "sp1", Url: serviceURL, Sha256: fileInfo.Sha256, Sha512: fileInfo.Sha512, Size: fileInfo.Size,
+		Users: &pb.Users{Users: subjects},
+	}); err != nil {
+		t.Fatalf("Can't install service: %s", err)
+	}
+
+	instances := launcher.getRunningInstances(nil)
+	if len(instances) != len(subjects) {
+		t.Fatalf("Wrong running instances count: %d", len(instances))
+	}
+
+	if instances[0].id == instances[1].id || instances[0].path == instances[1].path {
+		t.Error("Instances should have different identity")
+	}
+
+	for _, subjectID := range subjects {
+		subjectService, err := launcher.serviceProvider.GetSubjectService(subjectID, "service0")
+		if err != nil {
+			t.Errorf("Can't get subject service: %s", err)
+		}
+
+		if subjectService.UnitName != launcher.newServiceInstance(Service{ID: "service0"}, subjectID).unitName {
+			t.Errorf("Wrong instance unit name: %s", subjectService.UnitName)
+		}
+	}
+
+	if err = launcher.SetUsers(subjects[1:]); err != nil {
+		t.Fatalf("Can't set users: %s", err)
+	}
+
+	instances = launcher.getRunningInstances(nil)
+	if len(instances) != 1 {
+		t.Fatalf("Wrong running instances count: %d", len(instances))
+	}
+
+	if instances[0].subjectID != subjects[1] {
+		t.Errorf("Wrong instance subject: %s", instances[0].subjectID)
+	}
+
+	if err = launcher.UninstallService(&pb.RemoveServiceRequest{
+		ServiceId: "service0",
+		Users:     &pb.Users{Users: subjects[1:]},
+	}); err != nil {
+		t.Errorf("Can't uninstall service: %s", err)
+	}
+
+	if instances = launcher.getRunningInstances(nil); len(instances) != 0 {
+		t.Errorf("Wrong running instances count: %d", len(instances))
+	}
+
+	if _, err = launcher.serviceProvider.GetSubjectService(subjects[0], "service0"); err != nil {
+		t.Errorf("Service should remain installed for other subject: %s", err)
+	}
+}
+
 /*******************************************************************************
  * Interfaces
  ******************************************************************************/
@@ -2170,7 +2261,8 @@ func newTestLauncher(monitor ServiceMonitor, serviceHealthCheck time.Duration) (
 		DefaultServiceTTLDays: 30, Runner: getRuntime(),
 		ServiceHealthCheckTimeout: config.Duration{Duration: serviceHealthCheck},
 	},
-		&serviceProvider, &layerProviderForTest, monitor, networkProvider, &deviceManager, &permProvider)
+		&serviceProvider, &layerProviderForTest, monitor, networkProvider, &deviceManager, &permProvider,
+		nil, nil, nil, nil, nil, nil)
 	if err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
@@ -2611,50 +2703,49 @@ func (serviceProvider *testServiceProvider) SetServiceStartTime(serviceID string
 	return nil
 }
 
-func (serviceProvider *testServiceProvider) AddServiceToUsers(users []string, serviceID string) (err error) {
+func (serviceProvider *testServiceProvider) AddSubjectService(subjectService SubjectService) (err error) {
 	serviceProvider.Lock()
 	defer serviceProvider.Unlock()
 
-	for _, usersServicePtr := range serviceProvider.usersServices {
-		if reflect.DeepEqual(usersServicePtr.Users, users) && usersServicePtr.ServiceID == serviceID {
-			return aoserrors.New(fmt.Sprintf("service %s already in users", serviceID))
+	for _, subjectServicePtr := range serviceProvider.subjectServices {
+		if subjectServicePtr.SubjectID == subjectService.SubjectID &&
+			subjectServicePtr.ServiceID == subjectService.ServiceID {
+			return aoserrors.New(fmt.Sprintf("service %s already in subject", subjectService.ServiceID))
 		}
 	}
 
-	serviceProvider.usersServices = append(serviceProvider.usersServices, &UsersService{
-		Users: users, ServiceID: serviceID,
-	})
+	serviceProvider.subjectServices = append(serviceProvider.subjectServices, &subjectService)
 
 	return nil
 }
 
-func (serviceProvider *testServiceProvider) RemoveServiceFromUsers(users []string, serviceID string) (err error) {
+func (serviceProvider *testServiceProvider) RemoveSubjectService(subjectID, serviceID string) (err error) {
 	serviceProvider.Lock()
 	defer serviceProvider.Unlock()
 
 	i := 0
 
-	for _, usersServicePtr := range serviceProvider.usersServices {
-		if !reflect.DeepEqual(usersServicePtr.Users, users) || usersServicePtr.ServiceID != serviceID {
-			serviceProvider.usersServices[i] = usersServicePtr
+	for _, subjectServicePtr := range serviceProvider.subjectServices {
+		if subjectServicePtr.SubjectID != subjectID || subjectServicePtr.ServiceID != serviceID {
+			serviceProvider.subjectServices[i] = subjectServicePtr
 			i++
 		}
 	}
 
-	serviceProvider.usersServices = serviceProvider.usersServices[:i]
+	serviceProvider.subjectServices = serviceProvider.subjectServices[:i]
 
 	return nil
 }
 
-func (serviceProvider *testServiceProvider) GetUsersServices(users []string) (services []Service, err error) {
+func (serviceProvider *testServiceProvider) GetSubjectServices(subjectID string) (services []Service, err error) {
 	serviceProvider.Lock()
 	defer serviceProvider.Unlock()
 
-	for _, usersService := range serviceProvider.usersServices {
-		if reflect.DeepEqual(usersService.Users, users) {
-			service, ok := serviceProvider.services[usersService.ServiceID]
+	for _, subjectService := range serviceProvider.subjectServices {
+		if subjectService.SubjectID == subjectID {
+			service, ok := serviceProvider.services[subjectService.ServiceID]
 			if !ok {
-				return nil, aoserrors.New(fmt.Sprintf("service %s does not exist", usersService.ServiceID))
+				return nil, aoserrors.New(fmt.Sprintf("service %s does not exist", subjectService.ServiceID))
 			}
 
 			services = append(services, *service)
@@ -2664,99 +2755,123 @@ func (serviceProvider *testServiceProvider) GetUsersServices(users []string) (se
 	return services, nil
 }
 
-func (serviceProvider *testServiceProvider) RemoveServiceFromAllUsers(serviceID string) (err error) {
+func (serviceProvider *testServiceProvider) RemoveServiceFromAllSubjects(serviceID string) (err error) {
 	serviceProvider.Lock()
 	defer serviceProvider.Unlock()
 
 	i := 0
 
-	for _, usersService := range serviceProvider.usersServices {
-		if usersService.ServiceID != serviceID {
-			serviceProvider.usersServices[i] = usersService
+	for _, subjectService := range serviceProvider.subjectServices {
+		if subjectService.ServiceID != serviceID {
+			serviceProvider.subjectServices[i] = subjectService
 			i++
 		}
 	}
 
-	serviceProvider.usersServices = serviceProvider.usersServices[:i]
+	serviceProvider.subjectServices = serviceProvider.subjectServices[:i]
 
 	return nil
 }
 
-func (serviceProvider *testServiceProvider) GetUsersService(users []string, serviceID string) (userService UsersService,
-	err error) {
+func (serviceProvider *testServiceProvider) GetSubjectService(subjectID, serviceID string) (
+	subjectService SubjectService, err error) {
 	serviceProvider.Lock()
 	defer serviceProvider.Unlock()
 
-	for _, usersServicePtr := range serviceProvider.usersServices {
-		if reflect.DeepEqual(usersServicePtr.Users, users) && usersServicePtr.ServiceID == serviceID {
-			return *usersServicePtr, nil
+	for _, subjectServicePtr := range serviceProvider.subjectServices {
+		if subjectServicePtr.SubjectID == subjectID && subjectServicePtr.ServiceID == serviceID {
+			return *subjectServicePtr, nil
 		}
 	}
 
-	return userService, aoserrors.New(fmt.Sprintf("service %s does not exist in users", serviceID))
+	return subjectService, aoserrors.New(fmt.Sprintf("service %s does not exist in subject", serviceID))
 }
 
-func (serviceProvider *testServiceProvider) GetUsersServicesByServiceID(serviceID string) (userServices []UsersService,
-	err error) {
+func (serviceProvider *testServiceProvider) GetSubjectServicesByServiceID(serviceID string) (
+	subjectServices []SubjectService, err error) {
 	serviceProvider.Lock()
 	defer serviceProvider.Unlock()
 
-	for _, usersServicePtr := range serviceProvider.usersServices {
-		userServices = append(userServices, *usersServicePtr)
+	for _, subjectServicePtr := range serviceProvider.subjectServices {
+		if subjectServicePtr.ServiceID == serviceID {
+			subjectServices = append(subjectServices, *subjectServicePtr)
+		}
 	}
 
-	return userServices, nil
+	return subjectServices, nil
 }
 
-func (serviceProvider *testServiceProvider) SetUsersStorageFolder(users []string, serviceID string,
+func (serviceProvider *testServiceProvider) SetSubjectStorageFolder(subjectID, serviceID string,
 	storageFolder string) (err error) {
 	serviceProvider.Lock()
 	defer serviceProvider.Unlock()
 
-	for _, usersServicePtr := range serviceProvider.usersServices {
-		if reflect.DeepEqual(usersServicePtr.Users, users) && usersServicePtr.ServiceID == serviceID {
-			usersServicePtr.StorageFolder = storageFolder
+	for _, subjectServicePtr := range serviceProvider.subjectServices {
+		if subjectServicePtr.SubjectID == subjectID && subjectServicePtr.ServiceID == serviceID {
+			subjectServicePtr.StorageFolder = storageFolder
 
 			return nil
 		}
 	}
 
-	return aoserrors.New(fmt.Sprintf("service %s does not exist in users", serviceID))
+	return aoserrors.New(fmt.Sprintf("service %s does not exist in subject", serviceID))
 }
 
-func (serviceProvider *testServiceProvider) SetUsersStateChecksum(users []string, serviceID string,
+func (serviceProvider *testServiceProvider) SetSubjectStateChecksum(subjectID, serviceID string,
 	checksum []byte) (err error) {
 	serviceProvider.Lock()
 	defer serviceProvider.Unlock()
 
-	for _, usersServicePtr := range serviceProvider.usersServices {
-		if reflect.DeepEqual(usersServicePtr.Users, users) && usersServicePtr.ServiceID == serviceID {
-			usersServicePtr.StateChecksum = checksum
+	for _, subjectServicePtr := range serviceProvider.subjectServices {
+		if subjectServicePtr.SubjectID == subjectID && subjectServicePtr.ServiceID == serviceID {
+			subjectServicePtr.StateChecksum = checksum
 
 			return nil
 		}
 	}
 
-	return aoserrors.New(fmt.Sprintf("service %s does not exist in users", serviceID))
+	return aoserrors.New(fmt.Sprintf("service %s does not exist in subject", serviceID))
 }
 
 func (serviceProvider *testServiceProvider) GetAllOverrideEnvVars() (vars []pb.OverrideEnvVar, err error) {
-	for _, value := range serviceProvider.usersServices {
-		vars = append(vars, pb.OverrideEnvVar{SubjectId: value.Users[0], ServiceId: value.ServiceID})
+	for _, value := range serviceProvider.subjectServices {
+		vars = append(vars, pb.OverrideEnvVar{SubjectId: value.SubjectID, ServiceId: value.ServiceID})
 	}
 
 	return vars, nil
 }
 
-func (serviceProvider *testServiceProvider) UpdateOverrideEnvVars(subjects []string, serviceID string,
+func (serviceProvider *testServiceProvider) UpdateOverrideEnvVars(subjectID, serviceID string,
 	vars []*pb.EnvVarInfo) (err error) {
 	return nil
 }
 
+func (serviceProvider *testServiceProvider) SetServiceLayers(serviceID string, digests []string) (err error) {
+	return nil
+}
+
+func (serviceProvider *testServiceProvider) SetSubjectRestartCount(subjectID, serviceID string,
+	restartCount uint64) (err error) {
+	return nil
+}
+
+func (serviceProvider *testServiceProvider) GetSubjectRestartCount(subjectID,
+	serviceID string) (restartCount uint64, err error) {
+	return 0, nil
+}
+
 func (layerProvider *testLayerProvider) GetLayerPathByDigest(layerDigest string) (layerPath string, err error) {
 	return path.Join(testDir, "layerStorage"), nil
 }
 
+func (layerProvider *testLayerProvider) CollectGarbage(dryRun bool) (report layermanager.GarbageReport, err error) {
+	return report, nil
+}
+
+func (layerProvider *testLayerProvider) InstallLayer(installInfo *pb.InstallLayerRequest) (err error) {
+	return nil
+}
+
 func (layerProvider *testLayerProvider) UninstallLayer(digest string) (err error) {
 	return nil
 }
@@ -2769,6 +2884,12 @@ func (layerProvider *testLayerProvider) GetLayerInfoByDigest(digest string) (lay
 	return layer, nil //nolint
 }
 
+func (layerProvider *testLayerProvider) LockLayers() {
+}
+
+func (layerProvider *testLayerProvider) UnlockLayers() {
+}
+
 func (deviceManager *testDeviceManager) GetBoardConfigError() (err error) {
 	deviceManager.Lock()
 	defer deviceManager.Unlock()
@@ -2813,6 +2934,10 @@ func (deviceManager *testDeviceManager) ReleaseDevice(device string, serviceID s
 	return nil
 }
 
+func (deviceManager *testDeviceManager) CheckPublishedPort(port uint16, protocol string) (err error) {
+	return nil
+}
+
 func (deviceManager *testDeviceManager) RequestBoardResourceByName(name string) (
 	boardResource resourcemanager.BoardResource, err error) {
 	switch name {
@@ -2874,7 +2999,7 @@ func setup() (err error) {
 		return aoserrors.Wrap(err)
 	}
 
-	if networkProvider, err = networkmanager.New(&config.Config{WorkingDir: testDir}, nil); err != nil {
+	if networkProvider, err = networkmanager.New(&config.Config{WorkingDir: testDir}, nil, nil); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
@@ -3166,12 +3291,15 @@ func genarateImageManfest(folderPath string, imgConfig, aosSrvConfig, rootfsLaye
 }
 
 func (launcher *Launcher) connectToFtp(serviceID string) (ftpConnection *ftp.ServerConn, err error) {
-	service, err := launcher.serviceProvider.GetService(serviceID)
-	if err != nil {
-		return nil, aoserrors.Wrap(err)
+	instances := launcher.getRunningInstances(func(instance *serviceInstance) bool {
+		return instance.service.ID == serviceID
+	})
+
+	if len(instances) == 0 {
+		return nil, aoserrors.Errorf("service %s is not running", serviceID)
 	}
 
-	ip, err := networkProvider.GetServiceIP(service.ID, service.ServiceProvider)
+	ip, _, err := networkProvider.GetServiceIP(instances[0].id, instances[0].service.ServiceProvider)
 	if err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
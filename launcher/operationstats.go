@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher
+
+import (
+	"sync"
+	"time"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+// Service operations
+const (
+	OperationInstall = "install"
+	OperationUpdate  = "update"
+	OperationRemove  = "remove"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// OperationStats contains statistics of service operation
+type OperationStats struct {
+	Count         uint64        // number of finished operations
+	Failures      uint64        // number of failed operations
+	TotalDuration time.Duration // total duration of finished operations
+}
+
+type operationStatistics struct {
+	sync.Mutex
+	stats map[string]OperationStats
+}
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// GetOperationStats returns statistics of service operations since start
+func (launcher *Launcher) GetOperationStats() (stats map[string]OperationStats) {
+	return launcher.operationStats.get()
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func (statistics *operationStatistics) add(operation string, startTime time.Time, err error) {
+	statistics.Lock()
+	defer statistics.Unlock()
+
+	if statistics.stats == nil {
+		statistics.stats = make(map[string]OperationStats)
+	}
+
+	stats := statistics.stats[operation]
+
+	stats.Count++
+	stats.TotalDuration += time.Since(startTime)
+
+	if err != nil {
+		stats.Failures++
+	}
+
+	statistics.stats[operation] = stats
+}
+
+func (statistics *operationStatistics) get() (stats map[string]OperationStats) {
+	statistics.Lock()
+	defer statistics.Unlock()
+
+	stats = make(map[string]OperationStats, len(statistics.stats))
+
+	for operation, operationStats := range statistics.stats {
+		stats[operation] = operationStats
+	}
+
+	return stats
+}
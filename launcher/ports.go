@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher
+
+import (
+	"net"
+	"path"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_servicemanager/networkmanager"
+)
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+// getPublishedPorts parses service published ports and checks that board config allows them
+func (launcher *Launcher) getPublishedPorts(aosConfig *aosServiceConfig) (
+	publishedPorts []networkmanager.PortMapping, err error) {
+	for _, port := range aosConfig.PublishedPorts {
+		mapping, err := networkmanager.ParsePortMapping(port)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		if err = launcher.devicemanager.CheckPublishedPort(mapping.HostPort, mapping.Protocol); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		publishedPorts = append(publishedPorts, mapping)
+	}
+
+	return publishedPorts, nil
+}
+
+// checkPublishedPorts checks that new or updated service doesn't publish host ports used by other services
+func (launcher *Launcher) checkPublishedPorts(service Service) (err error) {
+	aosConfig, err := getAosServiceConfig(path.Join(service.Path, aosServiceConfigFile))
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	publishedPorts, err := launcher.getPublishedPorts(&aosConfig)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if len(publishedPorts) == 0 {
+		return nil
+	}
+
+	for i, port := range publishedPorts {
+		for _, otherPort := range publishedPorts[i+1:] {
+			if isPortConflict(port, otherPort) {
+				return aoserrors.Errorf("host port %d/%s is published twice", port.HostPort, port.Protocol)
+			}
+		}
+	}
+
+	services, err := launcher.serviceProvider.GetServices()
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	for _, installedService := range services {
+		if installedService.ID == service.ID {
+			continue
+		}
+
+		installedConfig, err := getAosServiceConfig(path.Join(installedService.Path, aosServiceConfigFile))
+		if err != nil {
+			log.WithField("serviceID", installedService.ID).Errorf("Can't get aos service config: %s", err)
+
+			continue
+		}
+
+		for _, installedPort := range installedConfig.PublishedPorts {
+			installedMapping, err := networkmanager.ParsePortMapping(installedPort)
+			if err != nil {
+				continue
+			}
+
+			for _, port := range publishedPorts {
+				if isPortConflict(port, installedMapping) {
+					return aoserrors.Errorf("host port %d/%s is already published by service %s",
+						port.HostPort, port.Protocol, installedService.ID)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// isPortConflict returns true if mappings use the same host port, unspecified host IP conflicts with any IP
+func isPortConflict(port1, port2 networkmanager.PortMapping) (result bool) {
+	if port1.HostPort != port2.HostPort || port1.Protocol != port2.Protocol {
+		return false
+	}
+
+	hostIP1, hostIP2 := net.ParseIP(port1.HostIP), net.ParseIP(port2.HostIP)
+
+	if hostIP1 == nil || hostIP2 == nil || hostIP1.IsUnspecified() || hostIP2.IsUnspecified() {
+		return true
+	}
+
+	return hostIP1.Equal(hostIP2)
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher //nolint
+
+import (
+	"testing"
+
+	"github.com/aoscloud/aos_servicemanager/networkmanager"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestIsPortConflict(t *testing.T) {
+	testData := []struct {
+		port1, port2 networkmanager.PortMapping
+		conflict     bool
+	}{
+		{
+			port1:    networkmanager.PortMapping{HostPort: 8080, Protocol: "tcp"},
+			port2:    networkmanager.PortMapping{HostPort: 8080, Protocol: "tcp", HostIP: "192.168.0.1"},
+			conflict: true,
+		},
+		{
+			port1:    networkmanager.PortMapping{HostPort: 8080, Protocol: "tcp", HostIP: "0.0.0.0"},
+			port2:    networkmanager.PortMapping{HostPort: 8080, Protocol: "tcp", HostIP: "192.168.0.1"},
+			conflict: true,
+		},
+		{
+			port1: networkmanager.PortMapping{HostPort: 8080, Protocol: "tcp", HostIP: "192.168.0.2"},
+			port2: networkmanager.PortMapping{HostPort: 8080, Protocol: "tcp", HostIP: "192.168.0.1"},
+		},
+		{
+			port1: networkmanager.PortMapping{HostPort: 8080, Protocol: "tcp"},
+			port2: networkmanager.PortMapping{HostPort: 8080, Protocol: "udp"},
+		},
+		{
+			port1: networkmanager.PortMapping{HostPort: 8080, Protocol: "tcp"},
+			port2: networkmanager.PortMapping{HostPort: 8081, Protocol: "tcp"},
+		},
+	}
+
+	for _, item := range testData {
+		if isPortConflict(item.port1, item.port2) != item.conflict {
+			t.Errorf("Wrong conflict result for %+v and %+v", item.port1, item.port2)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+// Probe types
+const (
+	probeReadiness = "readiness"
+	probeLiveness  = "liveness"
+)
+
+const (
+	defaultProbePeriod           = 10 * time.Second
+	defaultProbeTimeout          = 1 * time.Second
+	defaultProbeFailureThreshold = 3
+)
+
+// used if instance IP address is not available
+const probeDefaultHost = "127.0.0.1"
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// serviceProbe describes service readiness or liveness check. Only one check type should be set.
+type serviceProbe struct {
+	// command executed inside service container
+	Exec []string `json:"exec,omitempty"`
+	// TCP port which should accept connections
+	TCPPort uint16 `json:"tcpPort,omitempty"`
+	// HTTP GET request which should return 2xx or 3xx status
+	HTTPGet *httpGetProbe `json:"httpGet,omitempty"`
+	// file which should exist in service rootfs
+	File string `json:"file,omitempty"`
+
+	InitialDelay     config.Duration `json:"initialDelay"`
+	Period           config.Duration `json:"period"`
+	Timeout          config.Duration `json:"timeout"`
+	FailureThreshold uint            `json:"failureThreshold,omitempty"`
+}
+
+type httpGetProbe struct {
+	Port uint16 `json:"port"`
+	Path string `json:"path,omitempty"`
+}
+
+type probeCheck func(ctx context.Context) (err error)
+
+// probeMonitor periodically runs probes of running instance
+type probeMonitor struct {
+	stopChannel chan struct{}
+	wg          sync.WaitGroup
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func (probe *serviceProbe) getPeriod() (period time.Duration) {
+	if probe.Period.Duration == 0 {
+		return defaultProbePeriod
+	}
+
+	return probe.Period.Duration
+}
+
+func (probe *serviceProbe) getTimeout() (timeout time.Duration) {
+	if probe.Timeout.Duration == 0 {
+		return defaultProbeTimeout
+	}
+
+	return probe.Timeout.Duration
+}
+
+func (probe *serviceProbe) getFailureThreshold() (threshold uint) {
+	if probe.FailureThreshold == 0 {
+		return defaultProbeFailureThreshold
+	}
+
+	return probe.FailureThreshold
+}
+
+func (probe *serviceProbe) run(check probeCheck) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probe.getTimeout())
+	defer cancel()
+
+	return check(ctx)
+}
+
+// waitProbe runs probe until it succeeds or fails failure threshold times in a row. Waiting is canceled when
+// stop channel is closed.
+func waitProbe(probe *serviceProbe, check probeCheck, stopChannel <-chan struct{}) (err error) {
+	if err = waitProbeDelay(probe.InitialDelay.Duration, stopChannel); err != nil {
+		return err
+	}
+
+	for failures := uint(1); ; failures++ {
+		if err = probe.run(check); err == nil {
+			return nil
+		}
+
+		if failures >= probe.getFailureThreshold() {
+			return aoserrors.Wrap(err)
+		}
+
+		if err = waitProbeDelay(probe.getPeriod(), stopChannel); err != nil {
+			return err
+		}
+	}
+}
+
+func waitProbeDelay(delay time.Duration, stopChannel <-chan struct{}) (err error) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+
+	case <-stopChannel:
+		return aoserrors.New("probe is canceled")
+	}
+}
+
+func execProbeCheck(runner, containerID string, command []string) (check probeCheck) {
+	return func(ctx context.Context) (err error) {
+		output, err := exec.CommandContext(ctx, runner,
+			append([]string{"exec", containerID}, command...)...).CombinedOutput()
+		if err != nil {
+			return aoserrors.Errorf("%s: %s", err, strings.TrimSpace(string(output)))
+		}
+
+		return nil
+	}
+}
+
+func tcpProbeCheck(address string) (check probeCheck) {
+	return func(ctx context.Context) (err error) {
+		var dialer net.Dialer
+
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		conn.Close()
+
+		return nil
+	}
+}
+
+func httpProbeCheck(url string) (check probeCheck) {
+	return func(ctx context.Context) (err error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+			return aoserrors.Errorf("unexpected HTTP status: %s", resp.Status)
+		}
+
+		return nil
+	}
+}
+
+func fileProbeCheck(rootfsDir, name string) (check probeCheck) {
+	return func(ctx context.Context) (err error) {
+		fullName, err := securePath(rootfsDir, name)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if _, err = os.Stat(fullName); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		return nil
+	}
+}
+
+func (launcher *Launcher) getProbeCheck(instance *serviceInstance, probe *serviceProbe) (check probeCheck, err error) {
+	switch {
+	case len(probe.Exec) != 0:
+		return execProbeCheck(launcher.config.Runner, instance.id, probe.Exec), nil
+
+	case probe.File != "":
+		return fileProbeCheck(path.Join(instance.path, serviceMergedDir), probe.File), nil
+
+	case probe.HTTPGet != nil:
+		host, err := launcher.getProbeHost(instance)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		return httpProbeCheck("http://" + net.JoinHostPort(host, strconv.Itoa(int(probe.HTTPGet.Port))) +
+			"/" + strings.TrimPrefix(probe.HTTPGet.Path, "/")), nil
+
+	case probe.TCPPort != 0:
+		host, err := launcher.getProbeHost(instance)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		return tcpProbeCheck(net.JoinHostPort(host, strconv.Itoa(int(probe.TCPPort)))), nil
+
+	default:
+		return nil, aoserrors.New("probe check is not specified")
+	}
+}
+
+func (launcher *Launcher) getProbeHost(instance *serviceInstance) (host string, err error) {
+	if launcher.network == nil {
+		return probeDefaultHost, nil
+	}
+
+	if host, _, err = launcher.network.GetServiceIP(instance.id, instance.service.ServiceProvider); err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	if host == "" {
+		return probeDefaultHost, nil
+	}
+
+	return host, nil
+}
+
+// checkInstanceReadiness waits until instance readiness probe succeeds
+func (launcher *Launcher) checkInstanceReadiness(instance *serviceInstance, probe *serviceProbe) (err error) {
+	if probe == nil {
+		return nil
+	}
+
+	log.WithField("id", instance.id).Debug("Check instance readiness")
+
+	check, err := launcher.getProbeCheck(instance, probe)
+	if err == nil {
+		err = waitProbe(probe, check, launcher.getProbeStopChannel(instance.id))
+	}
+
+	if err != nil {
+		launcher.sendProbeAlert(instance, probeReadiness, "failed: "+err.Error())
+
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func (launcher *Launcher) startProbeMonitor(instance *serviceInstance, aosConfig *aosServiceConfig) {
+	if aosConfig.ReadinessProbe == nil && aosConfig.LivenessProbe == nil {
+		return
+	}
+
+	monitor := &probeMonitor{stopChannel: make(chan struct{})}
+
+	for probeType, probe := range map[string]*serviceProbe{
+		probeReadiness: aosConfig.ReadinessProbe,
+		probeLiveness:  aosConfig.LivenessProbe,
+	} {
+		if probe == nil {
+			continue
+		}
+
+		check, err := launcher.getProbeCheck(instance, probe)
+		if err != nil {
+			log.WithFields(log.Fields{"id": instance.id, "probe": probeType}).Errorf("Can't create probe: %s", err)
+
+			continue
+		}
+
+		monitor.wg.Add(1)
+
+		go launcher.monitorProbe(instance, probeType, probe, check, monitor)
+	}
+
+	launcher.instancesMutex.Lock()
+	defer launcher.instancesMutex.Unlock()
+
+	if prevMonitor, ok := launcher.probeMonitors[instance.id]; ok {
+		close(prevMonitor.stopChannel)
+	}
+
+	launcher.probeMonitors[instance.id] = monitor
+}
+
+// getProbeStopChannel returns channel which is closed when instance is stopped or restarted
+func (launcher *Launcher) getProbeStopChannel(instanceID string) (stopChannel <-chan struct{}) {
+	launcher.instancesMutex.Lock()
+	defer launcher.instancesMutex.Unlock()
+
+	if monitor, ok := launcher.probeMonitors[instanceID]; ok {
+		return monitor.stopChannel
+	}
+
+	return launcher.supervisorStopChannel
+}
+
+func (launcher *Launcher) stopProbeMonitor(instanceID string) {
+	launcher.instancesMutex.Lock()
+
+	monitor, ok := launcher.probeMonitors[instanceID]
+	if ok {
+		delete(launcher.probeMonitors, instanceID)
+	}
+
+	launcher.instancesMutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	close(monitor.stopChannel)
+	monitor.wg.Wait()
+}
+
+// monitorProbe periodically runs probe and reports probe state changes. Readiness failures are reported only
+// after instance became ready, initial readiness is checked by service update.
+func (launcher *Launcher) monitorProbe(instance *serviceInstance, probeType string, probe *serviceProbe,
+	check probeCheck, monitor *probeMonitor) {
+	defer monitor.wg.Done()
+
+	select {
+	case <-time.After(probe.InitialDelay.Duration):
+
+	case <-monitor.stopChannel:
+		return
+	}
+
+	ticker := time.NewTicker(probe.getPeriod())
+	defer ticker.Stop()
+
+	var failures uint
+
+	active, failed := probeType == probeLiveness, false
+
+	for {
+		if err := probe.run(check); err != nil {
+			failures++
+
+			if active && !failed && failures >= probe.getFailureThreshold() {
+				failed = true
+
+				log.WithFields(log.Fields{"id": instance.id, "probe": probeType}).Warnf("Probe failed: %s", err)
+
+				launcher.sendProbeAlert(instance, probeType, "failed: "+err.Error())
+			}
+		} else {
+			if failed {
+				log.WithFields(log.Fields{"id": instance.id, "probe": probeType}).Info("Probe recovered")
+
+				launcher.sendProbeAlert(instance, probeType, "recovered")
+			}
+
+			failures, active, failed = 0, true, false
+		}
+
+		select {
+		case <-ticker.C:
+
+		case <-monitor.stopChannel:
+			return
+		}
+	}
+}
+
+func (launcher *Launcher) sendProbeAlert(instance *serviceInstance, probeType, message string) {
+	if launcher.alertSender == nil || reflect.ValueOf(launcher.alertSender).IsNil() {
+		return
+	}
+
+	launcher.alertSender.SendServiceProbeAlert(instance.service.ID, probeType, message)
+}
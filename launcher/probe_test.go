@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher //nolint
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestProbeChecks(t *testing.T) {
+	ctx := context.Background()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Can't listen: %s", err)
+	}
+
+	address := listener.Addr().String()
+
+	if err = tcpProbeCheck(address)(ctx); err != nil {
+		t.Errorf("TCP probe failed: %s", err)
+	}
+
+	listener.Close()
+
+	if err = tcpProbeCheck(address)(ctx); err == nil {
+		t.Error("TCP probe should fail")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	if err = httpProbeCheck(server.URL + "/ready")(ctx); err != nil {
+		t.Errorf("HTTP probe failed: %s", err)
+	}
+
+	if err = httpProbeCheck(server.URL + "/notready")(ctx); err == nil {
+		t.Error("HTTP probe should fail")
+	}
+
+	rootfsDir, err := ioutil.TempDir("", "probe_")
+	if err != nil {
+		t.Fatalf("Can't create rootfs dir: %s", err)
+	}
+	defer os.RemoveAll(rootfsDir)
+
+	writeTestFiles(t, rootfsDir, map[string]string{"run/ready": ""})
+
+	if err = fileProbeCheck(rootfsDir, "/run/ready")(ctx); err != nil {
+		t.Errorf("File probe failed: %s", err)
+	}
+
+	if err = fileProbeCheck(rootfsDir, "/run/absent")(ctx); err == nil {
+		t.Error("File probe should fail")
+	}
+}
+
+func TestWaitProbe(t *testing.T) {
+	probe := &serviceProbe{Period: config.Duration{Duration: 10 * time.Millisecond}, FailureThreshold: 3}
+
+	calls := 0
+
+	if err := waitProbe(probe, func(ctx context.Context) error {
+		if calls++; calls < 3 {
+			return aoserrors.New("not ready")
+		}
+
+		return nil
+	}, nil); err != nil {
+		t.Errorf("Probe should succeed: %s", err)
+	}
+
+	calls = 0
+
+	if err := waitProbe(probe, func(ctx context.Context) error {
+		calls++
+
+		return aoserrors.New("not ready")
+	}, nil); err == nil {
+		t.Error("Probe should fail")
+	}
+
+	if calls != 3 {
+		t.Errorf("Wrong probe calls count: %d", calls)
+	}
+
+	stopChannel := make(chan struct{})
+	probe = &serviceProbe{InitialDelay: config.Duration{Duration: time.Hour}}
+
+	time.AfterFunc(10*time.Millisecond, func() { close(stopChannel) })
+
+	startTime := time.Now()
+
+	if err := waitProbe(probe, func(ctx context.Context) error { return nil }, stopChannel); err == nil {
+		t.Error("Canceled probe should fail")
+	}
+
+	if time.Since(startTime) > 5*time.Second {
+		t.Error("Probe is not canceled")
+	}
+}
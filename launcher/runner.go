@@ -0,0 +1,519 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+// Restart policy, the same as defined in systemd service template
+const (
+	runnerRestartDelay       = 1 * time.Second
+	runnerStartLimitInterval = 30 * time.Second
+	runnerStartLimitBurst    = 3
+)
+
+const (
+	runnerStartTimeout       = 10 * time.Second
+	runnerStopTimeout        = 10 * time.Second
+	runnerPidPollPeriod      = 100 * time.Millisecond
+	runnerHealthCheckPeriod  = 500 * time.Millisecond
+	runnerPidFileName        = ".pid"
+	runnerKillSignal         = "SIGKILL"
+	runnerListFormatArgument = "json"
+)
+
+const (
+	instanceStateInactive   = "inactive"
+	instanceStateActivating = "activating"
+	instanceStateActive     = "active"
+	instanceStateFailed     = "failed"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+type runnerBackend struct {
+	sync.Mutex
+
+	runnerPath   string
+	instances    map[string]*runnerInstance
+	stateChannel chan instanceStateEvent
+}
+
+type runnerInstance struct {
+	sync.Mutex
+
+	id            string
+	bundlePath    string
+	runnerPath    string
+	restartPolicy string
+	state         string
+	pid           int
+	startTimes    []time.Time
+	cmd           *exec.Cmd
+	stateChannel  chan<- instanceStateEvent
+	stopChannel   chan struct{}
+	doneChannel   chan struct{}
+}
+
+type runnerContainerState struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Bundle string `json:"bundle"`
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func newRunnerBackend(runnerPath string) (backend *runnerBackend, err error) {
+	return &runnerBackend{
+		runnerPath:   runnerPath,
+		instances:    make(map[string]*runnerInstance),
+		stateChannel: make(chan instanceStateEvent, instanceStateChannelSize),
+	}, nil
+}
+
+func (backend *runnerBackend) close() {
+	backend.Lock()
+	defer backend.Unlock()
+
+	for id, instance := range backend.instances {
+		instance.stop()
+
+		delete(backend.instances, id)
+	}
+}
+
+func (backend *runnerBackend) startInstance(instance *serviceInstance) (err error) {
+	backend.Lock()
+	defer backend.Unlock()
+
+	if runner, ok := backend.instances[instance.id]; ok {
+		runner.stop()
+
+		delete(backend.instances, instance.id)
+	}
+
+	absInstancePath, err := filepath.Abs(instance.path)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	runner := &runnerInstance{
+		id:            instance.id,
+		bundlePath:    absInstancePath,
+		runnerPath:    backend.runnerPath,
+		restartPolicy: instance.restartPolicy.Policy,
+		state:         instanceStateInactive,
+		stateChannel:  backend.stateChannel,
+		stopChannel:   make(chan struct{}),
+		doneChannel:   make(chan struct{}),
+	}
+
+	if err = runner.start(); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	backend.instances[instance.id] = runner
+
+	return nil
+}
+
+func (backend *runnerBackend) stopInstance(instance *serviceInstance) (err error) {
+	backend.Lock()
+	defer backend.Unlock()
+
+	runner, ok := backend.instances[instance.id]
+	if !ok {
+		log.WithField("id", instance.id).Warn("Instance not loaded")
+
+		return nil
+	}
+
+	runner.stop()
+
+	delete(backend.instances, instance.id)
+
+	log.WithFields(log.Fields{"id": instance.id, "status": runner.getState()}).Debug("Stop instance")
+
+	return nil
+}
+
+func (backend *runnerBackend) checkInstanceHealth(instance *serviceInstance, timeout time.Duration) (err error) {
+	backend.Lock()
+	runner, ok := backend.instances[instance.id]
+	backend.Unlock()
+
+	if !ok {
+		return aoserrors.Errorf("instance %s not loaded", instance.id)
+	}
+
+	ticker := time.NewTicker(runnerHealthCheckPeriod)
+	defer ticker.Stop()
+
+	timeoutChannel := time.After(timeout)
+
+	for {
+		select {
+		case <-ticker.C:
+			if runner.getState() == instanceStateFailed {
+				return aoserrors.Errorf("instance %s failed", instance.id)
+			}
+
+		case <-timeoutChannel:
+			if runner.getState() != instanceStateActive {
+				return aoserrors.Errorf("waiting for activating instance %s timeout", instance.id)
+			}
+
+			return nil
+		}
+	}
+}
+
+func (backend *runnerBackend) getInstanceStateChannel() (channel <-chan instanceStateEvent) {
+	return backend.stateChannel
+}
+
+func (backend *runnerBackend) getInstanceCgroupPath(instance *serviceInstance) (cgroupPath string) {
+	return path.Join(instancesCgroupParent, instance.id)
+}
+
+func (instance *runnerInstance) start() (err error) {
+	startResult := make(chan error, 1)
+
+	go instance.supervise(startResult)
+
+	return <-startResult
+}
+
+func (instance *runnerInstance) stop() {
+	close(instance.stopChannel)
+
+	<-instance.doneChannel
+}
+
+func (instance *runnerInstance) getState() (state string) {
+	instance.Lock()
+	defer instance.Unlock()
+
+	return instance.state
+}
+
+func (instance *runnerInstance) setState(state string) {
+	instance.Lock()
+	defer instance.Unlock()
+
+	if instance.state != state {
+		log.WithFields(log.Fields{"id": instance.id, "state": state, "pid": instance.pid}).Debug("Service state changed")
+	}
+
+	instance.state = state
+}
+
+// notifyState notifies supervisor that instance is not restarted by runner anymore
+func (instance *runnerInstance) notifyState(state string) {
+	select {
+	case instance.stateChannel <- instanceStateEvent{instanceID: instance.id, state: state}:
+
+	case <-instance.stopChannel:
+	}
+}
+
+func (instance *runnerInstance) supervise(startResult chan<- error) {
+	defer close(instance.doneChannel)
+
+	notifyStarted := func(err error) {
+		if startResult != nil {
+			startResult <- err
+			startResult = nil
+		}
+	}
+
+	for {
+		if !instance.checkStartLimit() {
+			log.WithField("id", instance.id).Error("Service start request repeated too quickly")
+
+			instance.setState(instanceStateFailed)
+			notifyStarted(nil)
+			instance.notifyState(instanceStateFailed)
+
+			return
+		}
+
+		instance.setState(instanceStateActivating)
+
+		exitChannel, err := instance.runContainer()
+		if err != nil {
+			instance.setState(instanceStateFailed)
+
+			// initial start error is returned to the caller
+			if startResult == nil {
+				instance.notifyState(instanceStateFailed)
+			}
+
+			notifyStarted(err)
+
+			return
+		}
+
+		exited, exitErr := instance.waitContainerStarted(exitChannel)
+
+		notifyStarted(nil)
+
+		if !exited {
+			select {
+			case <-instance.stopChannel:
+				instance.killContainer(exitChannel)
+				instance.setState(instanceStateInactive)
+
+				return
+
+			case exitErr = <-exitChannel:
+			}
+		}
+
+		log.WithField("id", instance.id).Warnf("Service exited: %v", exitErr)
+
+		if !isRestartAllowed(instance.restartPolicy, exitErr != nil) {
+			state := instanceStateInactive
+
+			if exitErr != nil {
+				state = instanceStateFailed
+			}
+
+			instance.deleteContainer()
+			instance.setState(state)
+			instance.notifyState(state)
+
+			return
+		}
+
+		instance.setState(instanceStateActivating)
+
+		select {
+		case <-instance.stopChannel:
+			instance.deleteContainer()
+			instance.setState(instanceStateInactive)
+
+			return
+
+		case <-time.After(runnerRestartDelay):
+		}
+	}
+}
+
+func (instance *runnerInstance) checkStartLimit() (result bool) {
+	now := time.Now()
+
+	startTimes := make([]time.Time, 0, len(instance.startTimes)+1)
+
+	for _, startTime := range instance.startTimes {
+		if now.Sub(startTime) < runnerStartLimitInterval {
+			startTimes = append(startTimes, startTime)
+		}
+	}
+
+	instance.startTimes = startTimes
+
+	if len(instance.startTimes) >= runnerStartLimitBurst {
+		return false
+	}
+
+	instance.startTimes = append(instance.startTimes, now)
+
+	return true
+}
+
+func (instance *runnerInstance) runContainer() (exitChannel <-chan error, err error) {
+	instance.deleteContainer()
+
+	cmd := exec.Command(instance.runnerPath, "run", "--pid-file", path.Join(instance.bundlePath, runnerPidFileName),
+		"-b", instance.bundlePath, instance.id)
+
+	output := log.WithField("id", instance.id).WriterLevel(log.InfoLevel)
+
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	if err = cmd.Start(); err != nil {
+		output.Close()
+
+		return nil, aoserrors.Wrap(err)
+	}
+
+	instance.Lock()
+	instance.cmd = cmd
+	instance.pid = 0
+	instance.Unlock()
+
+	channel := make(chan error, 1)
+
+	go func() {
+		err := cmd.Wait()
+
+		output.Close()
+
+		channel <- err
+	}()
+
+	return channel, nil
+}
+
+func (instance *runnerInstance) waitContainerStarted(exitChannel <-chan error) (exited bool, exitErr error) {
+	ticker := time.NewTicker(runnerPidPollPeriod)
+	defer ticker.Stop()
+
+	timeoutChannel := time.After(runnerStartTimeout)
+
+	for {
+		select {
+		case exitErr = <-exitChannel:
+			return true, exitErr
+
+		case <-ticker.C:
+			pid, err := instance.readPid()
+			if err != nil {
+				continue
+			}
+
+			instance.Lock()
+			instance.pid = pid
+			instance.Unlock()
+
+			instance.setState(instanceStateActive)
+
+			return false, nil
+
+		case <-timeoutChannel:
+			log.WithField("id", instance.id).Warn("Waiting for service pid timeout")
+
+			return false, nil
+		}
+	}
+}
+
+func (instance *runnerInstance) killContainer(exitChannel <-chan error) {
+	if output, err := exec.Command(instance.runnerPath, "kill", instance.id,
+		runnerKillSignal).CombinedOutput(); err != nil {
+		log.WithField("id", instance.id).Warnf("Can't kill service: %s, %s", err, strings.TrimSpace(string(output)))
+	}
+
+	select {
+	case <-exitChannel:
+
+	case <-time.After(runnerStopTimeout):
+		log.WithField("id", instance.id).Warn("Waiting for service exit timeout")
+
+		instance.Lock()
+		cmd := instance.cmd
+		instance.Unlock()
+
+		if err := cmd.Process.Kill(); err != nil {
+			log.WithField("id", instance.id).Errorf("Can't kill runner process: %s", err)
+		}
+
+		<-exitChannel
+	}
+
+	instance.deleteContainer()
+}
+
+func (instance *runnerInstance) deleteContainer() {
+	if output, err := exec.Command(instance.runnerPath, "delete", "-f",
+		instance.id).CombinedOutput(); err != nil {
+		log.WithField("id", instance.id).Debugf("Can't delete container: %s, %s", err,
+			strings.TrimSpace(string(output)))
+	}
+}
+
+func (instance *runnerInstance) readPid() (pid int, err error) {
+	data, err := ioutil.ReadFile(path.Join(instance.bundlePath, runnerPidFileName))
+	if err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	if pid, err = strconv.Atoi(strings.TrimSpace(string(data))); err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	return pid, nil
+}
+
+func cleanupRunnerServices(cfg *config.Config) {
+	runnerPath, err := exec.LookPath(cfg.Runner)
+	if err != nil {
+		log.Errorf("Can't find runner: %s", err)
+
+		return
+	}
+
+	output, err := exec.Command(runnerPath, "list", "--format", runnerListFormatArgument).Output()
+	if err != nil {
+		log.Errorf("Can't list containers: %s", err)
+
+		return
+	}
+
+	var containers []runnerContainerState
+
+	if err = json.Unmarshal(output, &containers); err != nil {
+		log.Errorf("Can't parse containers list: %s", err)
+
+		return
+	}
+
+	instancesDir, err := filepath.Abs(path.Join(cfg.WorkingDir, instancesDir))
+	if err != nil {
+		log.Errorf("Can't get instances dir: %s", err)
+
+		return
+	}
+
+	for _, container := range containers {
+		if !strings.HasPrefix(container.Bundle, instancesDir+"/") {
+			continue
+		}
+
+		log.WithField("id", container.ID).Debug("Deleting instance container")
+
+		if output, err := exec.Command(runnerPath, "delete", "-f", container.ID).CombinedOutput(); err != nil {
+			log.WithField("id", container.ID).Errorf("Can't delete container: %s, %s", err,
+				strings.TrimSpace(string(output)))
+		}
+	}
+}
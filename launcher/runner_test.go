@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher //nolint
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+// Fake runner: "run" writes pid file and sleeps or exits depending on bundle content
+const fakeRunnerScript = `#!/bin/sh
+case "$1" in
+run)
+	echo $$ > "$3"
+	echo $$ > "$(dirname "$0")/$6.pid"
+	if [ -f "$5/crash" ]; then
+		exit 1
+	fi
+	exec sleep 60
+	;;
+kill)
+	kill -9 "$(cat "$(dirname "$0")/$2.pid")"
+	;;
+esac
+exit 0
+`
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestRunnerBackendStartStop(t *testing.T) {
+	backend, instance := prepareRunnerBackend(t)
+
+	if err := backend.startInstance(instance); err != nil {
+		t.Fatalf("Can't start instance: %s", err)
+	}
+
+	if err := backend.checkInstanceHealth(instance, 1*time.Second); err != nil {
+		t.Errorf("Instance should be healthy: %s", err)
+	}
+
+	if err := backend.stopInstance(instance); err != nil {
+		t.Errorf("Can't stop instance: %s", err)
+	}
+
+	if len(backend.instances) != 0 {
+		t.Error("Instance should be removed")
+	}
+}
+
+func TestRunnerBackendStartLimit(t *testing.T) {
+	backend, instance := prepareRunnerBackend(t)
+
+	if err := ioutil.WriteFile(path.Join(instance.path, "crash"), nil, 0o600); err != nil {
+		t.Fatalf("Can't create crash file: %s", err)
+	}
+
+	if err := backend.startInstance(instance); err != nil {
+		t.Fatalf("Can't start instance: %s", err)
+	}
+
+	if err := backend.checkInstanceHealth(instance,
+		runnerStartLimitBurst*runnerRestartDelay+2*time.Second); err == nil {
+		t.Error("Instance should fail")
+	}
+
+	runner := backend.instances[instance.id]
+
+	if runner.getState() != instanceStateFailed {
+		t.Errorf("Wrong instance state: %s", runner.getState())
+	}
+
+	if len(runner.startTimes) != runnerStartLimitBurst {
+		t.Errorf("Wrong start count: %d", len(runner.startTimes))
+	}
+
+	backend.close()
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func prepareRunnerBackend(t *testing.T) (backend *runnerBackend, instance *serviceInstance) {
+	t.Helper()
+
+	tmpDir, err := ioutil.TempDir("", "runner_")
+	if err != nil {
+		t.Fatalf("Can't create tmp dir: %s", err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	runnerPath := path.Join(tmpDir, "runner")
+
+	if err = ioutil.WriteFile(runnerPath, []byte(fakeRunnerScript), 0o700); err != nil {
+		t.Fatalf("Can't create fake runner: %s", err)
+	}
+
+	instance = &serviceInstance{
+		id: "service0_subject0", subjectID: "subject0", service: Service{ID: "service0"},
+		path: path.Join(tmpDir, "service0_subject0"),
+	}
+
+	if err = os.MkdirAll(instance.path, 0o755); err != nil {
+		t.Fatalf("Can't create instance dir: %s", err)
+	}
+
+	if backend, err = newRunnerBackend(runnerPath); err != nil {
+		t.Fatalf("Can't create runner backend: %s", err)
+	}
+
+	return backend, instance
+}
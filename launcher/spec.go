@@ -52,6 +52,7 @@ const defaultCPUPeriod uint64 = 100000
 type serviceManifest struct {
 	imagespec.Manifest
 	AosService *imagespec.Descriptor `json:"aosService,omitempty"`
+	AosDelta   *deltaImageInfo       `json:"aosDelta,omitempty"`
 }
 
 // Device configuration for system and service logging.
@@ -89,6 +90,20 @@ type aosServiceConfig struct {
 	Devices            []Device                     `json:"devices,omitempty"`
 	Resources          []string                     `json:"resources,omitempty"`
 	Permissions        map[string]map[string]string `json:"permissions,omitempty"`
+	ReadinessProbe     *serviceProbe                `json:"readinessProbe,omitempty"`
+	LivenessProbe      *serviceProbe                `json:"livenessProbe,omitempty"`
+	RestartPolicy      *restartPolicy               `json:"restartPolicy,omitempty"`
+	Dependencies       []serviceDependency          `json:"dependencies,omitempty"`
+	IPAddress          *string                      `json:"ipAddress,omitempty"`
+	IPv6Address        *string                      `json:"ipv6Address,omitempty"`
+	PublishedPorts     []string                     `json:"publishedPorts,omitempty"`
+	EgressPolicy       *egressPolicy                `json:"egressPolicy,omitempty"`
+}
+
+// egressPolicy service outbound connections allowlist, hosts may start with "*." to allow subdomains.
+type egressPolicy struct {
+	Hosts    []string `json:"hosts,omitempty"`
+	Networks []string `json:"networks,omitempty"`
 }
 
 type serviceSpec struct {
@@ -379,6 +394,10 @@ func (spec *serviceSpec) setUserUIDGID(uid, gid uint32) {
 	spec.ocSpec.Process.User.GID = gid
 }
 
+func (spec *serviceSpec) setCgroupsPath(cgroupsPath string) {
+	spec.ocSpec.Linux.CgroupsPath = cgroupsPath
+}
+
 func (spec *serviceSpec) bindHostDirs(workingDir string) (err error) {
 	// TODO: all services should have their own certificates
 	// this mound for demo only and should be removed
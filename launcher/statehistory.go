@@ -0,0 +1,317 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/sha3"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+const (
+	stateHistoryDirName = "statehistory"
+	stateSnapshotSuffix = ".dat"
+	// state updated within restart reset period is rolled back after this number of restarts in a row
+	stateRollbackRetries = 3
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// StateSnapshot accepted service state snapshot
+type StateSnapshot struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Checksum  string    `json:"checksum"`
+	Size      uint64    `json:"size"`
+}
+
+// stateUpdate keeps snapshot of the state which was accepted before the last state update
+type stateUpdate struct {
+	time             time.Time
+	previousSnapshot string
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+// GetStateHistory returns accepted state snapshots, the newest goes first
+func (handler *storageHandler) GetStateHistory(subjectID, serviceID string) (snapshots []StateSnapshot, err error) {
+	handler.Lock()
+	defer handler.Unlock()
+
+	subjectService, err := handler.serviceProvider.GetSubjectService(subjectID, serviceID)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if subjectService.StorageFolder == "" {
+		return nil, nil
+	}
+
+	if snapshots, err = getStateSnapshots(path.Join(subjectService.StorageFolder, stateHistoryDirName)); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return snapshots, nil
+}
+
+// RestoreState restores state from snapshot
+func (handler *storageHandler) RestoreState(subjectID string, service Service, snapshotID string) (err error) {
+	handler.Lock()
+	defer handler.Unlock()
+
+	log.WithFields(log.Fields{
+		"serviceID": service.ID, "subjectID": subjectID, "snapshotID": snapshotID,
+	}).Debug("Restore state")
+
+	return handler.restoreState(subjectID, service.ID, snapshotID)
+}
+
+// RollbackStateUpdate restores state which was accepted before the last state update if the update is done
+// within period. Returns ID of restored snapshot or empty string if there is nothing to rollback.
+func (handler *storageHandler) RollbackStateUpdate(subjectID string, service Service,
+	period time.Duration) (snapshotID string, err error) {
+	handler.Lock()
+	defer handler.Unlock()
+
+	key := getStateUpdateKey(subjectID, service.ID)
+
+	update, ok := handler.stateUpdates[key]
+	if !ok || time.Since(update.time) > period {
+		return "", nil
+	}
+
+	delete(handler.stateUpdates, key)
+
+	if update.previousSnapshot == "" {
+		return "", nil
+	}
+
+	log.WithFields(log.Fields{
+		"serviceID": service.ID, "subjectID": subjectID, "snapshotID": update.previousSnapshot,
+	}).Warn("Rollback state update")
+
+	if err = handler.restoreState(subjectID, service.ID, update.previousSnapshot); err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	return update.previousSnapshot, nil
+}
+
+// SendState sends current state to the cloud if the state is watched
+func (handler *storageHandler) SendState(subjectID string, service Service) (err error) {
+	handler.Lock()
+
+	subjectService, err := handler.serviceProvider.GetSubjectService(subjectID, service.ID)
+	if err != nil {
+		handler.Unlock()
+
+		return aoserrors.Wrap(err)
+	}
+
+	fileName := path.Join(subjectService.StorageFolder, stateFile)
+	state, ok := handler.statesMap[fileName]
+
+	handler.Unlock()
+
+	if ok {
+		handler.stateChanged(fileName, state)
+	}
+
+	return nil
+}
+
+// no mutex as it is called from locked context
+func (handler *storageHandler) restoreState(subjectID, serviceID, snapshotID string) (err error) {
+	if snapshotID == "" || filepath.Base(snapshotID) != snapshotID {
+		return aoserrors.Errorf("invalid state snapshot ID: %s", snapshotID)
+	}
+
+	subjectService, err := handler.serviceProvider.GetSubjectService(subjectID, serviceID)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if subjectService.StorageFolder == "" {
+		return aoserrors.New("service has no storage")
+	}
+
+	state, err := ioutil.ReadFile(
+		path.Join(subjectService.StorageFolder, stateHistoryDirName, snapshotID+stateSnapshotSuffix))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return aoserrors.Errorf("state snapshot %s not found", snapshotID)
+		}
+
+		return aoserrors.Wrap(err)
+	}
+
+	if err = ioutil.WriteFile(path.Join(subjectService.StorageFolder, stateFile), state, 0644); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	checksum := sha3.Sum224(state)
+
+	if err = handler.serviceProvider.SetSubjectStateChecksum(subjectID, serviceID, checksum[:]); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// no mutex as it is called from locked context
+func (handler *storageHandler) prepareStateUpdate(subjectService SubjectService) (previousSnapshot string) {
+	if handler.historySize <= 0 {
+		return ""
+	}
+
+	historyDir := path.Join(subjectService.StorageFolder, stateHistoryDirName)
+
+	snapshots, err := getStateSnapshots(historyDir)
+	if err != nil {
+		log.WithField("serviceID", subjectService.ServiceID).Errorf("Can't get state snapshots: %s", err)
+
+		return ""
+	}
+
+	if len(snapshots) > 0 {
+		return snapshots[0].ID
+	}
+
+	// current state could be accepted before history is enabled
+	state, checksum, err := getFileAndChecksum(path.Join(subjectService.StorageFolder, stateFile))
+	if err != nil || len(state) == 0 || !bytes.Equal(checksum, subjectService.StateChecksum) {
+		return ""
+	}
+
+	if previousSnapshot, err = handler.saveStateSnapshot(subjectService.StorageFolder, state); err != nil {
+		log.WithField("serviceID", subjectService.ServiceID).Errorf("Can't save state snapshot: %s", err)
+	}
+
+	return previousSnapshot
+}
+
+// no mutex as it is called from locked context
+func (handler *storageHandler) saveStateSnapshot(storageFolder string, state []byte) (snapshotID string, err error) {
+	if handler.historySize <= 0 {
+		return "", nil
+	}
+
+	historyDir := path.Join(storageFolder, stateHistoryDirName)
+
+	if err = os.MkdirAll(historyDir, 0700); err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	snapshots, err := getStateSnapshots(historyDir)
+	if err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	checksum := sha3.Sum224(state)
+
+	if len(snapshots) > 0 && snapshots[0].Checksum == hex.EncodeToString(checksum[:]) {
+		return snapshots[0].ID, nil
+	}
+
+	// zero padded timestamp keeps snapshots sorted by name
+	snapshotID = fmt.Sprintf("%020d", time.Now().UnixNano())
+
+	if err = ioutil.WriteFile(path.Join(historyDir, snapshotID+stateSnapshotSuffix), state, 0600); err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	if len(snapshots) >= handler.historySize {
+		for _, snapshot := range snapshots[handler.historySize-1:] {
+			if err = os.Remove(path.Join(historyDir, snapshot.ID+stateSnapshotSuffix)); err != nil {
+				log.WithField("snapshotID", snapshot.ID).Errorf("Can't remove state snapshot: %s", err)
+			}
+		}
+	}
+
+	log.WithFields(log.Fields{"folder": storageFolder, "snapshotID": snapshotID}).Debug("State snapshot saved")
+
+	return snapshotID, nil
+}
+
+func getStateSnapshots(historyDir string) (snapshots []StateSnapshot, err error) {
+	items, err := ioutil.ReadDir(historyDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, aoserrors.Wrap(err)
+	}
+
+	for _, item := range items {
+		if item.IsDir() || !strings.HasSuffix(item.Name(), stateSnapshotSuffix) {
+			continue
+		}
+
+		snapshotID := strings.TrimSuffix(item.Name(), stateSnapshotSuffix)
+
+		timestamp, err := strconv.ParseInt(snapshotID, 10, 64)
+		if err != nil {
+			log.WithField("file", item.Name()).Warn("Unexpected file in state history")
+
+			continue
+		}
+
+		state, err := ioutil.ReadFile(path.Join(historyDir, item.Name()))
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		checksum := sha3.Sum224(state)
+
+		snapshots = append(snapshots, StateSnapshot{
+			ID:        snapshotID,
+			Timestamp: time.Unix(0, timestamp),
+			Checksum:  hex.EncodeToString(checksum[:]),
+			Size:      uint64(len(state)),
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID > snapshots[j].ID })
+
+	return snapshots, nil
+}
+
+func getStateUpdateKey(subjectID, serviceID string) (key string) {
+	return subjectID + "/" + serviceID
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher //nolint
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestStateSnapshots(t *testing.T) {
+	storageFolder, err := ioutil.TempDir("", "storage_")
+	if err != nil {
+		t.Fatalf("Can't create storage folder: %s", err)
+	}
+	defer os.RemoveAll(storageFolder)
+
+	handler := &storageHandler{historySize: 3}
+
+	var snapshotIDs []string
+
+	for i := 0; i < 5; i++ {
+		snapshotID, err := handler.saveStateSnapshot(storageFolder, []byte(fmt.Sprintf("state%d", i)))
+		if err != nil {
+			t.Fatalf("Can't save state snapshot: %s", err)
+		}
+
+		snapshotIDs = append(snapshotIDs, snapshotID)
+	}
+
+	// same state should not create new snapshot
+	snapshotID, err := handler.saveStateSnapshot(storageFolder, []byte("state4"))
+	if err != nil {
+		t.Fatalf("Can't save state snapshot: %s", err)
+	}
+
+	if snapshotID != snapshotIDs[4] {
+		t.Errorf("Wrong snapshot ID: %s", snapshotID)
+	}
+
+	snapshots, err := getStateSnapshots(path.Join(storageFolder, stateHistoryDirName))
+	if err != nil {
+		t.Fatalf("Can't get state snapshots: %s", err)
+	}
+
+	if len(snapshots) != handler.historySize {
+		t.Fatalf("Wrong snapshots count: %d", len(snapshots))
+	}
+
+	for i, snapshot := range snapshots {
+		if snapshot.ID != snapshotIDs[4-i] || snapshot.Size != uint64(len("state0")) {
+			t.Errorf("Wrong snapshot: %+v", snapshot)
+		}
+	}
+
+	disabled := &storageHandler{}
+
+	if snapshotID, err = disabled.saveStateSnapshot(storageFolder, []byte("state5")); err != nil || snapshotID != "" {
+		t.Errorf("Snapshot should not be saved when history is disabled: %s, %v", snapshotID, err)
+	}
+}
@@ -57,14 +57,17 @@ const (
 type storageHandler struct {
 	serviceProvider ServiceProvider
 	storageDir      string
+	encryptor       *storageEncryptor
+	historySize     int
 	sync.Mutex
 	watcher      *fsnotify.Watcher
 	statesMap    map[string]*stateParams
+	stateUpdates map[string]stateUpdate
 	stateChannel chan<- *pb.SMNotifications
 }
 
 type stateParams struct {
-	users                  []string
+	subjectID              string
 	serviceID              string
 	pendingChanges         bool
 	stateAccepted          bool
@@ -79,11 +82,14 @@ type stateParams struct {
  * Storage related API
  ******************************************************************************/
 
-func newStorageHandler(storageDir string, serviceProvider ServiceProvider,
-	stateChannel chan<- *pb.SMNotifications) (handler *storageHandler, err error) {
+func newStorageHandler(storageDir string, serviceProvider ServiceProvider, encryptor *storageEncryptor,
+	historySize int, stateChannel chan<- *pb.SMNotifications) (handler *storageHandler, err error) {
 	handler = &storageHandler{
 		serviceProvider: serviceProvider,
 		storageDir:      storageDir,
+		encryptor:       encryptor,
+		historySize:     historySize,
+		stateUpdates:    make(map[string]stateUpdate),
 		stateChannel:    stateChannel,
 	}
 
@@ -112,87 +118,104 @@ func (handler *storageHandler) Close() {
 	handler.watcher.Close()
 }
 
-func (handler *storageHandler) PrepareStorageFolder(users []string, service Service,
+func (handler *storageHandler) PrepareStorageFolder(subjectID string, service Service,
 	storageLimit, stateLimit uint64) (storageFolder string, err error) {
 	handler.Lock()
 	defer handler.Unlock()
 
 	log.WithFields(log.Fields{
 		"serviceID":    service.ID,
+		"subjectID":    subjectID,
 		"storageLimit": storageLimit,
 		"stateLimit":   stateLimit,
 	}).Debug("Mount storage folder")
 
-	usersService, err := handler.serviceProvider.GetUsersService(users, service.ID)
+	subjectService, err := handler.serviceProvider.GetSubjectService(subjectID, service.ID)
 	if err != nil {
 		return "", aoserrors.Wrap(err)
 	}
 
 	if storageLimit == 0 {
-		if usersService.StorageFolder != "" {
-			os.RemoveAll(usersService.StorageFolder)
+		if subjectService.StorageFolder != "" {
+			os.RemoveAll(subjectService.StorageFolder)
 		}
 
-		if err = handler.serviceProvider.SetUsersStorageFolder(users, service.ID, ""); err != nil {
+		if err = handler.serviceProvider.SetSubjectStorageFolder(subjectID, service.ID, ""); err != nil {
 			return "", aoserrors.Wrap(err)
 		}
 
 		return "", nil
 	}
 
-	if usersService.StorageFolder != "" {
-		if _, err = os.Stat(usersService.StorageFolder); err != nil {
+	storageDir := handler.storageDir
+
+	if handler.encryptor != nil {
+		if storageDir, err = handler.encryptor.getSubjectDir(subjectID); err != nil {
+			return "", aoserrors.Wrap(err)
+		}
+
+		if subjectService.StorageFolder != "" &&
+			!handler.encryptor.isSubjectFolder(subjectID, subjectService.StorageFolder) {
+			log.WithFields(log.Fields{
+				"folder":    subjectService.StorageFolder,
+				"serviceID": service.ID,
+			}).Warning("Storage folder is not encrypted")
+		}
+	}
+
+	if subjectService.StorageFolder != "" {
+		if _, err = os.Stat(subjectService.StorageFolder); err != nil {
 			if !os.IsNotExist(err) {
 				return "", aoserrors.Wrap(err)
 			}
 
 			log.WithFields(log.Fields{
-				"folder":    usersService.StorageFolder,
+				"folder":    subjectService.StorageFolder,
 				"serviceID": service.ID,
 			}).Warning("Storage folder doesn't exist")
 
-			usersService.StorageFolder = ""
+			subjectService.StorageFolder = ""
 		}
 	}
 
-	if usersService.StorageFolder == "" {
-		if usersService.StorageFolder, err = createStorageFolder(handler.storageDir, service.UID, service.GID); err != nil {
+	if subjectService.StorageFolder == "" {
+		if subjectService.StorageFolder, err = createStorageFolder(storageDir, service.UID, service.GID); err != nil {
 			return "", aoserrors.Wrap(err)
 		}
 
-		if err = handler.serviceProvider.SetUsersStorageFolder(users, service.ID, usersService.StorageFolder); err != nil {
+		if err = handler.serviceProvider.SetSubjectStorageFolder(subjectID, service.ID, subjectService.StorageFolder); err != nil {
 			return "", aoserrors.Wrap(err)
 		}
 
-		log.WithFields(log.Fields{"folder": usersService.StorageFolder, "serviceID": service.ID}).Debug("Create storage folder")
+		log.WithFields(log.Fields{"folder": subjectService.StorageFolder, "serviceID": service.ID}).Debug("Create storage folder")
 	}
 
 	if stateLimit == 0 {
-		if _, err = os.Stat(path.Join(usersService.StorageFolder, stateFile)); err != nil {
+		if _, err = os.Stat(path.Join(subjectService.StorageFolder, stateFile)); err != nil {
 			if !os.IsNotExist(err) {
 				return "", aoserrors.Wrap(err)
 			}
 		}
 
-		if err = handler.serviceProvider.SetUsersStateChecksum(users, service.ID, []byte{}); err != nil {
+		if err = handler.serviceProvider.SetSubjectStateChecksum(subjectID, service.ID, []byte{}); err != nil {
 			return "", aoserrors.Wrap(err)
 		}
 	}
 
 	if stateLimit > 0 {
-		if err = createStateFile(path.Join(usersService.StorageFolder, stateFile), service.UID, service.GID); err != nil {
+		if err = createStateFile(path.Join(subjectService.StorageFolder, stateFile), service.UID, service.GID); err != nil {
 			return "", aoserrors.Wrap(err)
 		}
 
-		if err = handler.startStateWatching(users, service); err != nil {
+		if err = handler.startStateWatching(subjectID, service); err != nil {
 			return "", aoserrors.Wrap(err)
 		}
 	}
 
-	return usersService.StorageFolder, nil
+	return subjectService.StorageFolder, nil
 }
 
-func (handler *storageHandler) StopStateWatching(users []string, service Service, stateLimit uint64) (err error) {
+func (handler *storageHandler) StopStateWatching(subjectID string, service Service, stateLimit uint64) (err error) {
 	handler.Lock()
 	defer handler.Unlock()
 
@@ -200,7 +223,7 @@ func (handler *storageHandler) StopStateWatching(users []string, service Service
 		return nil
 	}
 
-	usersService, err := handler.serviceProvider.GetUsersService(users, service.ID)
+	subjectService, err := handler.serviceProvider.GetSubjectService(subjectID, service.ID)
 	if err != nil {
 		if strings.Contains(err.Error(), "not exist") {
 			return nil
@@ -210,7 +233,7 @@ func (handler *storageHandler) StopStateWatching(users []string, service Service
 	}
 
 	return aoserrors.Wrap(handler.stopStateWatching(
-		path.Join(usersService.StorageFolder, stateFile), usersService.StorageFolder))
+		path.Join(subjectService.StorageFolder, stateFile), subjectService.StorageFolder))
 }
 
 func (handler *storageHandler) StateAcceptance(acceptance *pb.StateAcceptance) (err error) {
@@ -239,13 +262,14 @@ func (handler *storageHandler) StateAcceptance(acceptance *pb.StateAcceptance) (
 	return aoserrors.New("correlation ID not found")
 }
 
-func (handler *storageHandler) UpdateState(users []string, service Service, state []byte, checksum string,
+func (handler *storageHandler) UpdateState(subjectID string, service Service, state []byte, checksum string,
 	stateLimit uint64) (err error) {
 	handler.Lock()
 	defer handler.Unlock()
 
 	log.WithFields(log.Fields{
 		"serviceID":  service.ID,
+		"subjectID":  subjectID,
 		"checksum":   checksum,
 		"stateLimit": stateLimit,
 		"stateSize":  len(state),
@@ -259,12 +283,14 @@ func (handler *storageHandler) UpdateState(users []string, service Service, stat
 		return aoserrors.New("state is too big")
 	}
 
-	usersService, err := handler.serviceProvider.GetUsersService(users, service.ID)
+	subjectService, err := handler.serviceProvider.GetSubjectService(subjectID, service.ID)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if err = ioutil.WriteFile(path.Join(usersService.StorageFolder, stateFile), state, 0644); err != nil {
+	previousSnapshot := handler.prepareStateUpdate(subjectService)
+
+	if err = ioutil.WriteFile(path.Join(subjectService.StorageFolder, stateFile), state, 0644); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
@@ -273,31 +299,41 @@ func (handler *storageHandler) UpdateState(users []string, service Service, stat
 		return aoserrors.Wrap(err)
 	}
 
-	if err = handler.serviceProvider.SetUsersStateChecksum(users, service.ID, sumBytes); err != nil {
+	if err = handler.serviceProvider.SetSubjectStateChecksum(subjectID, service.ID, sumBytes); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
+	if handler.historySize > 0 {
+		if _, err = handler.saveStateSnapshot(subjectService.StorageFolder, state); err != nil {
+			log.WithField("serviceID", service.ID).Errorf("Can't save state snapshot: %s", err)
+		}
+
+		handler.stateUpdates[getStateUpdateKey(subjectID, service.ID)] = stateUpdate{
+			time: time.Now(), previousSnapshot: previousSnapshot,
+		}
+	}
+
 	return nil
 }
 
 // no mutex as it is called from locked context
-func (handler *storageHandler) startStateWatching(users []string, service Service) (err error) {
-	usersService, err := handler.serviceProvider.GetUsersService(users, service.ID)
+func (handler *storageHandler) startStateWatching(subjectID string, service Service) (err error) {
+	subjectService, err := handler.serviceProvider.GetSubjectService(subjectID, service.ID)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	stateFileName := path.Join(usersService.StorageFolder, stateFile)
+	stateFileName := path.Join(subjectService.StorageFolder, stateFile)
 
 	log.WithFields(log.Fields{"serviceID": service.ID, "stateFile": stateFileName}).Debug("Start state watching")
 
 	if _, ok := handler.statesMap[stateFileName]; ok {
-		if err = handler.stopStateWatching(stateFileName, usersService.StorageFolder); err != nil {
+		if err = handler.stopStateWatching(stateFileName, subjectService.StorageFolder); err != nil {
 			return aoserrors.Wrap(err)
 		}
 	}
 
-	state := stateParams{users: users, serviceID: service.ID}
+	state := stateParams{subjectID: subjectID, serviceID: service.ID}
 
 	state.changeTimerChannel = make(chan bool)
 	state.acceptanceTimerChannel = make(chan bool)
@@ -309,7 +345,7 @@ func (handler *storageHandler) startStateWatching(users []string, service Servic
 		return aoserrors.Wrap(err)
 	}
 
-	if !reflect.DeepEqual(usersService.StateChecksum, checksum) {
+	if !reflect.DeepEqual(subjectService.StateChecksum, checksum) {
 		log.WithFields(log.Fields{
 			"serviceID": service.ID,
 			"checksum":  hex.EncodeToString(checksum),
@@ -318,14 +354,14 @@ func (handler *storageHandler) startStateWatching(users []string, service Servic
 		// Send state request
 		if err := handler.pushServiceStateMessage(&pb.SMNotifications{SMNotification: &pb.SMNotifications_ServiceStateRequest{
 			ServiceStateRequest: &pb.ServiceStateRequest{
-				ServiceId: state.serviceID, Default: false, Users: &pb.Users{Users: users},
+				ServiceId: state.serviceID, Default: false, Users: &pb.Users{Users: []string{subjectID}},
 			},
 		}}); err != nil {
 			log.Warn("Can't send service state request: ", err.Error())
 		}
 	}
 
-	if err = handler.watcher.Add(usersService.StorageFolder); err != nil {
+	if err = handler.watcher.Add(subjectService.StorageFolder); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
@@ -358,7 +394,7 @@ func (handler *storageHandler) stopStateWatching(stateFileName, storageFolder st
 	return nil
 }
 
-func (handler *storageHandler) handleStateAcception(state *stateParams, checksum []byte) {
+func (handler *storageHandler) handleStateAcception(state *stateParams, stateData, checksum []byte) {
 	handler.Lock()
 	defer handler.Unlock()
 
@@ -368,14 +404,19 @@ func (handler *storageHandler) handleStateAcception(state *stateParams, checksum
 			"correlationID": state.correlationID,
 		}).Debug("State is accepted")
 
-		if err := handler.serviceProvider.SetUsersStateChecksum(state.users, state.serviceID, checksum); err != nil {
+		if err := handler.serviceProvider.SetSubjectStateChecksum(state.subjectID, state.serviceID,
+			checksum); err != nil {
 			log.WithField("serviceID", state.serviceID).Errorf("Can't set state checksum: %s", err)
 		}
+
+		if err := handler.saveAcceptedState(state, stateData); err != nil {
+			log.WithField("serviceID", state.serviceID).Errorf("Can't save state snapshot: %s", err)
+		}
 	} else {
 		// Send state request
 		if err := handler.pushServiceStateMessage(&pb.SMNotifications{SMNotification: &pb.SMNotifications_ServiceStateRequest{
 			ServiceStateRequest: &pb.ServiceStateRequest{
-				ServiceId: state.serviceID, Default: false, Users: &pb.Users{Users: state.users},
+				ServiceId: state.serviceID, Default: false, Users: &pb.Users{Users: []string{state.subjectID}},
 			},
 		}}); err != nil {
 			log.Warn("Can't send service state request: ", err.Error())
@@ -386,6 +427,24 @@ func (handler *storageHandler) handleStateAcception(state *stateParams, checksum
 	state.acceptanceTimer = nil
 }
 
+// no mutex as it is called from locked context
+func (handler *storageHandler) saveAcceptedState(state *stateParams, stateData []byte) (err error) {
+	if handler.historySize <= 0 {
+		return nil
+	}
+
+	subjectService, err := handler.serviceProvider.GetSubjectService(state.subjectID, state.serviceID)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if _, err = handler.saveStateSnapshot(subjectService.StorageFolder, stateData); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
 func (handler *storageHandler) stateChanged(fileName string, state *stateParams) {
 	handler.Lock()
 	defer handler.Unlock()
@@ -423,6 +482,7 @@ func (handler *storageHandler) stateChanged(fileName string, state *stateParams)
 				CorrelationId: state.correlationID,
 				ServiceState: &pb.ServiceState{
 					ServiceId:     state.serviceID,
+					Users:         &pb.Users{Users: []string{state.subjectID}},
 					StateChecksum: hex.EncodeToString(checksum),
 					State:         stateData,
 				},
@@ -445,7 +505,7 @@ func (handler *storageHandler) stateChanged(fileName string, state *stateParams)
 
 		case value := <-state.acceptanceTimerChannel:
 			if value {
-				handler.handleStateAcception(state, checksum)
+				handler.handleStateAcception(state, stateData, checksum)
 			}
 		}
 	}()
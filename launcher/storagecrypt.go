@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_servicemanager/platform"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+const subjectsStorageDir = "subjects"
+
+// length of subject ID hash used as subject storage dir name
+const subjectDirNameLen = 16
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// storageEncryptor keeps storage folders of each subject in separate fscrypt encrypted dir. Subject dir is
+// unlocked while the subject is active.
+type storageEncryptor struct {
+	sync.Mutex
+
+	storageDir  string
+	keyProvider StorageKeyProvider
+	unlocked    map[string]platform.EncryptionKeyID
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func newStorageEncryptor(storageDir string, keyProvider StorageKeyProvider) (encryptor *storageEncryptor, err error) {
+	log.WithField("storageDir", storageDir).Debug("New storage encryptor")
+
+	encryptor = &storageEncryptor{
+		storageDir:  storageDir,
+		keyProvider: keyProvider,
+		unlocked:    make(map[string]platform.EncryptionKeyID),
+	}
+
+	if err = os.MkdirAll(path.Join(storageDir, subjectsStorageDir), 0755); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return encryptor, nil
+}
+
+func (encryptor *storageEncryptor) close() {
+	encryptor.Lock()
+	defer encryptor.Unlock()
+
+	for subjectID := range encryptor.unlocked {
+		if err := encryptor.lock(subjectID); err != nil {
+			log.WithField("subjectID", subjectID).Errorf("Can't lock subject storage: %s", err)
+		}
+	}
+}
+
+func (encryptor *storageEncryptor) unlockSubjects(subjects []string) {
+	encryptor.Lock()
+	defer encryptor.Unlock()
+
+	for _, subjectID := range subjects {
+		if err := encryptor.unlock(subjectID); err != nil {
+			log.WithField("subjectID", subjectID).Errorf("Can't unlock subject storage: %s", err)
+		}
+	}
+}
+
+func (encryptor *storageEncryptor) lockSubjects(subjects []string) {
+	encryptor.Lock()
+	defer encryptor.Unlock()
+
+	for _, subjectID := range subjects {
+		if err := encryptor.lock(subjectID); err != nil {
+			log.WithField("subjectID", subjectID).Errorf("Can't lock subject storage: %s", err)
+		}
+	}
+}
+
+// getSubjectDir returns encrypted dir where subject storage folders should be created
+func (encryptor *storageEncryptor) getSubjectDir(subjectID string) (subjectDir string, err error) {
+	encryptor.Lock()
+	defer encryptor.Unlock()
+
+	if _, ok := encryptor.unlocked[subjectID]; !ok {
+		return "", aoserrors.Errorf("storage of subject %s is locked", subjectID)
+	}
+
+	return encryptor.subjectDir(subjectID), nil
+}
+
+func (encryptor *storageEncryptor) isSubjectFolder(subjectID, storageFolder string) (result bool) {
+	return path.Dir(storageFolder) == encryptor.subjectDir(subjectID)
+}
+
+func (encryptor *storageEncryptor) subjectDir(subjectID string) (subjectDir string) {
+	hash := sha256.Sum256([]byte(subjectID))
+
+	return path.Join(encryptor.storageDir, subjectsStorageDir, hex.EncodeToString(hash[:])[:subjectDirNameLen])
+}
+
+func (encryptor *storageEncryptor) unlock(subjectID string) (err error) {
+	if _, ok := encryptor.unlocked[subjectID]; ok {
+		return nil
+	}
+
+	log.WithField("subjectID", subjectID).Debug("Unlock subject storage")
+
+	key, err := encryptor.keyProvider.GetStorageKey(subjectID)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	keyID, err := platform.AddEncryptionKey(encryptor.storageDir, key)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	defer func() {
+		if err != nil {
+			if _, removeErr := platform.RemoveEncryptionKey(encryptor.storageDir, keyID); removeErr != nil {
+				log.WithField("subjectID", subjectID).Errorf("Can't remove storage key: %s", removeErr)
+			}
+		}
+	}()
+
+	if err = encryptor.checkSubjectDir(encryptor.subjectDir(subjectID), keyID); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	encryptor.unlocked[subjectID] = keyID
+
+	return nil
+}
+
+func (encryptor *storageEncryptor) lock(subjectID string) (err error) {
+	keyID, ok := encryptor.unlocked[subjectID]
+	if !ok {
+		return nil
+	}
+
+	log.WithField("subjectID", subjectID).Debug("Lock subject storage")
+
+	delete(encryptor.unlocked, subjectID)
+
+	filesBusy, err := platform.RemoveEncryptionKey(encryptor.storageDir, keyID)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if filesBusy {
+		log.WithField("subjectID", subjectID).Warn("Subject storage files are in use and stay unlocked until closed")
+	}
+
+	return nil
+}
+
+// checkSubjectDir creates encrypted subject dir or checks that existing one is encrypted with the key
+func (encryptor *storageEncryptor) checkSubjectDir(subjectDir string, keyID platform.EncryptionKeyID) (err error) {
+	dirKeyID, err := platform.GetEncryptionKeyID(subjectDir)
+	if err == nil {
+		if dirKeyID != keyID {
+			return aoserrors.New("subject storage is encrypted with different key")
+		}
+
+		return nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, platform.ErrNotEncrypted) {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = os.MkdirAll(subjectDir, 0755); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	items, err := ioutil.ReadDir(subjectDir)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if len(items) != 0 {
+		return aoserrors.New("subject storage dir is not encrypted and not empty")
+	}
+
+	if err = platform.SetEncryptionPolicy(subjectDir, keyID); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
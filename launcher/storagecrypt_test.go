@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher //nolint
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/aoscloud/aos_servicemanager/platform"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+type testStorageKeyProvider struct{}
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestStorageEncryptor(t *testing.T) {
+	storageDir, err := ioutil.TempDir("", "storage_")
+	if err != nil {
+		t.Fatalf("Can't create storage dir: %s", err)
+	}
+	defer os.RemoveAll(storageDir)
+
+	encryptor, err := newStorageEncryptor(storageDir, &testStorageKeyProvider{})
+	if err != nil {
+		t.Fatalf("Can't create storage encryptor: %s", err)
+	}
+	defer encryptor.close()
+
+	if encryptor.subjectDir("subject1") == encryptor.subjectDir("subject2") {
+		t.Error("Subjects should have different storage dirs")
+	}
+
+	if !encryptor.isSubjectFolder("subject1", path.Join(encryptor.subjectDir("subject1"), "folder")) ||
+		encryptor.isSubjectFolder("subject1", path.Join(storageDir, "folder")) {
+		t.Error("Wrong subject folder detection")
+	}
+
+	if _, err = encryptor.getSubjectDir("subject1"); err == nil {
+		t.Error("Error expected for locked subject storage")
+	}
+
+	// check fscrypt is supported by tmp file system
+	keyID, err := platform.AddEncryptionKey(storageDir, bytes.Repeat([]byte{1}, 64))
+	if err != nil {
+		t.Skipf("Encryption is not supported: %s", err)
+	}
+
+	if _, err = platform.RemoveEncryptionKey(storageDir, keyID); err != nil {
+		t.Fatalf("Can't remove encryption key: %s", err)
+	}
+
+	encryptor.unlockSubjects([]string{"subject1"})
+
+	subjectDir, err := encryptor.getSubjectDir("subject1")
+	if err != nil {
+		t.Fatalf("Can't get subject dir: %s", err)
+	}
+
+	if err = ioutil.WriteFile(path.Join(subjectDir, "data"), []byte("secret"), 0o600); err != nil {
+		t.Fatalf("Can't write subject data: %s", err)
+	}
+
+	encryptor.lockSubjects([]string{"subject1"})
+
+	if _, err = ioutil.ReadFile(path.Join(subjectDir, "data")); err == nil {
+		t.Error("Locked subject data should not be accessible")
+	}
+
+	encryptor.unlockSubjects([]string{"subject1"})
+
+	data, err := ioutil.ReadFile(path.Join(subjectDir, "data"))
+	if err != nil {
+		t.Fatalf("Can't read subject data: %s", err)
+	}
+
+	if string(data) != "secret" {
+		t.Errorf("Wrong subject data: %s", data)
+	}
+}
+
+/*******************************************************************************
+ * Interfaces
+ ******************************************************************************/
+
+func (provider *testStorageKeyProvider) GetStorageKey(subjectID string) (key []byte, err error) {
+	return bytes.Repeat([]byte(subjectID), 64)[:64], nil
+}
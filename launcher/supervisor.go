@@ -0,0 +1,309 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+// Restart policies
+const (
+	restartPolicyAlways    = "always"
+	restartPolicyOnFailure = "on-failure"
+	restartPolicyNever     = "never"
+)
+
+const (
+	defaultRestartBackoff    = 10 * time.Second
+	defaultRestartMaxBackoff = 5 * time.Minute
+	// restart retries are reset if instance runs longer than this period
+	restartResetPeriod = 10 * time.Minute
+	// crash loop alert is sent if instance is restarted this number of times in a row
+	crashLoopAlertRetries = 3
+)
+
+const instanceStateChannelSize = 32
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// restartPolicy describes how instance is restarted by supervisor when runtime gives up restarting it
+type restartPolicy struct {
+	Policy string `json:"policy,omitempty"`
+	// max number of restarts in a row, 0 - unlimited
+	MaxRetries uint64          `json:"maxRetries,omitempty"`
+	Backoff    config.Duration `json:"backoff"`
+	MaxBackoff config.Duration `json:"maxBackoff"`
+}
+
+// instanceStateEvent is sent by runtime backend when instance stopped by itself
+type instanceStateEvent struct {
+	instanceID string
+	state      string
+}
+
+type instanceRestarts struct {
+	retries     uint64
+	lastRestart time.Time
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func (config *aosServiceConfig) getRestartPolicy() (policy restartPolicy) {
+	if config.RestartPolicy != nil {
+		policy = *config.RestartPolicy
+	}
+
+	switch policy.Policy {
+	case restartPolicyAlways, restartPolicyOnFailure, restartPolicyNever:
+
+	default:
+		policy.Policy = restartPolicyAlways
+	}
+
+	if policy.Backoff.Duration == 0 {
+		policy.Backoff.Duration = defaultRestartBackoff
+	}
+
+	if policy.MaxBackoff.Duration == 0 {
+		policy.MaxBackoff.Duration = defaultRestartMaxBackoff
+	}
+
+	if policy.MaxBackoff.Duration < policy.Backoff.Duration {
+		policy.MaxBackoff.Duration = policy.Backoff.Duration
+	}
+
+	return policy
+}
+
+func isRestartAllowed(policy string, failed bool) (allowed bool) {
+	switch policy {
+	case restartPolicyNever:
+		return false
+
+	case restartPolicyOnFailure:
+		return failed
+
+	default:
+		return true
+	}
+}
+
+// getRestartDelay returns exponential backoff delay for specified restart retry
+func (policy restartPolicy) getRestartDelay(retry uint64) (delay time.Duration) {
+	delay = policy.Backoff.Duration
+
+	for i := uint64(1); i < retry && delay < policy.MaxBackoff.Duration; i++ {
+		delay *= 2
+	}
+
+	if delay > policy.MaxBackoff.Duration {
+		delay = policy.MaxBackoff.Duration
+	}
+
+	return delay
+}
+
+func (launcher *Launcher) superviseInstances() {
+	stateChannel := launcher.runtime.getInstanceStateChannel()
+
+	for {
+		select {
+		case event := <-stateChannel:
+			launcher.handleInstanceState(event)
+
+		case <-launcher.supervisorStopChannel:
+			return
+		}
+	}
+}
+
+func (launcher *Launcher) handleInstanceState(event instanceStateEvent) {
+	launcher.instancesMutex.Lock()
+	instance, ok := launcher.instances[event.instanceID]
+	launcher.instancesMutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	log.WithFields(log.Fields{"id": instance.id, "state": event.state}).Warn("Instance stopped")
+
+	policy := instance.restartPolicy
+
+	if !isRestartAllowed(policy.Policy, event.state == instanceStateFailed) {
+		launcher.finishInstance(instance)
+
+		return
+	}
+
+	retries := launcher.nextInstanceRestart(instance.id)
+
+	if retries >= stateRollbackRetries || (policy.MaxRetries != 0 && retries > policy.MaxRetries) {
+		if launcher.rollbackStateUpdate(instance, retries) {
+			launcher.instancesMutex.Lock()
+			delete(launcher.restarts, instance.id)
+			launcher.instancesMutex.Unlock()
+
+			retries = launcher.nextInstanceRestart(instance.id)
+		}
+	}
+
+	if policy.MaxRetries != 0 && retries > policy.MaxRetries {
+		log.WithField("id", instance.id).Errorf("Instance restart retries exceeded: %d", policy.MaxRetries)
+
+		launcher.sendCrashLoopAlert(instance, retries-1, "restart retries exceeded")
+		launcher.finishInstance(instance)
+
+		return
+	}
+
+	restartCount, err := launcher.serviceProvider.GetSubjectRestartCount(instance.subjectID, instance.service.ID)
+	if err != nil {
+		log.WithField("id", instance.id).Errorf("Can't get restart count: %s", err)
+	}
+
+	restartCount++
+
+	if err = launcher.serviceProvider.SetSubjectRestartCount(
+		instance.subjectID, instance.service.ID, restartCount); err != nil {
+		log.WithField("id", instance.id).Errorf("Can't set restart count: %s", err)
+	}
+
+	delay := policy.getRestartDelay(retries)
+
+	log.WithFields(log.Fields{
+		"id": instance.id, "retries": retries, "restartCount": restartCount,
+	}).Infof("Restart instance in %s", delay)
+
+	// single restarts are normal, alert only if instance crashes in a row
+	if retries >= crashLoopAlertRetries {
+		launcher.sendCrashLoopAlert(instance, restartCount, fmt.Sprintf("restart in %s", delay))
+	}
+
+	time.AfterFunc(delay, func() { launcher.restartInstance(instance) })
+}
+
+// nextInstanceRestart returns number of instance restarts in a row including the next one
+func (launcher *Launcher) nextInstanceRestart(instanceID string) (retries uint64) {
+	launcher.instancesMutex.Lock()
+	defer launcher.instancesMutex.Unlock()
+
+	restarts, ok := launcher.restarts[instanceID]
+	if !ok || time.Since(restarts.lastRestart) > restartResetPeriod {
+		restarts = &instanceRestarts{}
+		launcher.restarts[instanceID] = restarts
+	}
+
+	restarts.retries++
+	restarts.lastRestart = time.Now()
+
+	return restarts.retries
+}
+
+// rollbackStateUpdate restores previous accepted state if instance crash-loops after state update
+func (launcher *Launcher) rollbackStateUpdate(instance *serviceInstance, retries uint64) (rolledBack bool) {
+	snapshotID, err := launcher.storageHandler.RollbackStateUpdate(instance.subjectID, instance.service,
+		restartResetPeriod)
+	if err != nil {
+		log.WithField("id", instance.id).Errorf("Can't rollback state update: %s", err)
+
+		return false
+	}
+
+	if snapshotID == "" {
+		return false
+	}
+
+	log.WithFields(log.Fields{"id": instance.id, "snapshotID": snapshotID}).Warn("State update is rolled back")
+
+	launcher.sendCrashLoopAlert(instance, retries, fmt.Sprintf("state rolled back to %s", snapshotID))
+
+	return true
+}
+
+func (launcher *Launcher) isCurrentInstance(instance *serviceInstance) (current bool) {
+	launcher.instancesMutex.Lock()
+	defer launcher.instancesMutex.Unlock()
+
+	return launcher.instances[instance.id] == instance
+}
+
+func (launcher *Launcher) restartInstance(instance *serviceInstance) {
+	select {
+	case <-launcher.supervisorStopChannel:
+		return
+
+	default:
+	}
+
+	launcher.actionHandler.PutInQueue(instance.id, instance, func(id string, data interface{}) {
+		if !launcher.isCurrentInstance(instance) {
+			return
+		}
+
+		log.WithField("id", instance.id).Info("Restart instance")
+
+		if err := launcher.stopInstance(instance); err != nil {
+			log.WithField("id", instance.id).Errorf("Can't stop instance: %s", err)
+		}
+
+		if err := launcher.startInstance(instance); err != nil {
+			log.WithField("id", instance.id).Errorf("Can't start instance: %s", err)
+		}
+	})
+}
+
+// finishInstance releases resources of instance which should not be restarted anymore
+func (launcher *Launcher) finishInstance(instance *serviceInstance) {
+	launcher.instancesMutex.Lock()
+	delete(launcher.restarts, instance.id)
+	launcher.instancesMutex.Unlock()
+
+	launcher.actionHandler.PutInQueue(instance.id, instance, func(id string, data interface{}) {
+		if !launcher.isCurrentInstance(instance) {
+			return
+		}
+
+		if err := launcher.stopInstance(instance); err != nil {
+			log.WithField("id", instance.id).Errorf("Can't stop instance: %s", err)
+		}
+	})
+}
+
+func (launcher *Launcher) sendCrashLoopAlert(instance *serviceInstance, restartCount uint64, message string) {
+	if launcher.alertSender == nil || reflect.ValueOf(launcher.alertSender).IsNil() {
+		return
+	}
+
+	launcher.alertSender.SendServiceCrashLoopAlert(instance.service.ID, restartCount,
+		fmt.Sprintf("subject: %s, %s", instance.subjectID, message))
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher //nolint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestRestartPolicy(t *testing.T) {
+	policy := (&aosServiceConfig{}).getRestartPolicy()
+
+	if policy.Policy != restartPolicyAlways || policy.Backoff.Duration != defaultRestartBackoff ||
+		policy.MaxBackoff.Duration != defaultRestartMaxBackoff {
+		t.Errorf("Wrong default restart policy: %v", policy)
+	}
+
+	policy = (&aosServiceConfig{RestartPolicy: &restartPolicy{
+		Policy:     restartPolicyOnFailure,
+		Backoff:    config.Duration{Duration: 1 * time.Second},
+		MaxBackoff: config.Duration{Duration: 5 * time.Second},
+	}}).getRestartPolicy()
+
+	for i, delay := range []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second,
+		5 * time.Second, 5 * time.Second} {
+		if result := policy.getRestartDelay(uint64(i + 1)); result != delay {
+			t.Errorf("Wrong restart delay for retry %d: %s", i+1, result)
+		}
+	}
+
+	testData := []struct {
+		policy  string
+		failed  bool
+		allowed bool
+	}{
+		{restartPolicyAlways, false, true},
+		{restartPolicyAlways, true, true},
+		{restartPolicyOnFailure, false, false},
+		{restartPolicyOnFailure, true, true},
+		{restartPolicyNever, false, false},
+		{restartPolicyNever, true, false},
+		{"", false, true},
+	}
+
+	for _, item := range testData {
+		if allowed := isRestartAllowed(item.policy, item.failed); allowed != item.allowed {
+			t.Errorf("Wrong restart allowed for policy %s, failed %v: %v", item.policy, item.failed, allowed)
+		}
+	}
+}
@@ -0,0 +1,479 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/coreos/go-systemd/v22/dbus"
+	log "github.com/sirupsen/logrus"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+const serviceTemplate = `# This is template file used to launch AOS services
+# Known variables:
+# * ${ID}            - service instance id
+# * ${SERVICEPATH}   - path to service instance dir
+# * ${RUNNER}        - path to runner
+# * ${RESTART}       - systemd restart policy
+[Unit]
+Description=AOS Service
+After=network.target
+StartLimitIntervalSec=30
+StartLimitBurst=3
+
+
+[Service]
+Type=forking
+Restart=${RESTART}
+RestartSec=1
+ExecStartPre=${RUNNER} delete -f ${ID}
+ExecStart=${RUNNER} run -d --pid-file ${SERVICEPATH}/.pid -b ${SERVICEPATH} ${ID}
+
+ExecStop=${RUNNER} kill ${ID} SIGKILL
+ExecStopPost=${RUNNER} delete -f ${ID}
+PIDFile=${SERVICEPATH}/.pid
+SuccessExitStatus=SIGKILL
+
+[Install]
+WantedBy=multi-user.target
+`
+
+const serviceTemplateFile = "template.service"
+
+const restartPlaceholder = "${RESTART}"
+
+const (
+	unitStatusFailed   = "failed"
+	unitStatusActive   = "active"
+	unitStatusInactive = "inactive"
+)
+
+const unitStatusPollPeriod = 1 * time.Second
+
+const serviceDescription = "AOS Service"
+
+const errNotLoaded = "not loaded"
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+type systemdBackend struct {
+	sync.Mutex
+
+	systemd         *dbus.Conn
+	serviceTemplate string
+	runnerPath      string
+	// watched units: unit name -> instance id
+	units        map[string]string
+	stateChannel chan instanceStateEvent
+	stopChannel  chan struct{}
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func newSystemdBackend(workingDir, runnerPath string) (backend *systemdBackend, err error) {
+	backend = &systemdBackend{
+		runnerPath:   runnerPath,
+		units:        make(map[string]string),
+		stateChannel: make(chan instanceStateEvent, instanceStateChannelSize),
+		stopChannel:  make(chan struct{}),
+	}
+
+	// Create systemd connection
+	if backend.systemd, err = dbus.NewSystemConnectionContext(context.Background()); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	// Get systemd service template
+	if backend.serviceTemplate, err = getSystemdServiceTemplate(workingDir); err != nil {
+		backend.systemd.Close()
+
+		return nil, aoserrors.Wrap(err)
+	}
+
+	statusChannel, errChannel := backend.systemd.SubscribeUnitsCustom(unitStatusPollPeriod, 0,
+		func(status1, status2 *dbus.UnitStatus) bool { return status1.ActiveState != status2.ActiveState },
+		func(unitName string) bool { return !backend.isUnitWatched(unitName) })
+
+	go backend.watchUnits(statusChannel, errChannel)
+
+	return backend, nil
+}
+
+func (backend *systemdBackend) close() {
+	close(backend.stopChannel)
+
+	backend.systemd.Close()
+}
+
+func (backend *systemdBackend) getInstanceStateChannel() (channel <-chan instanceStateEvent) {
+	return backend.stateChannel
+}
+
+// getInstanceCgroupPath returns unit cgroup: the container should stay in the unit cgroup to be controlled by systemd
+func (backend *systemdBackend) getInstanceCgroupPath(instance *serviceInstance) (cgroupPath string) {
+	return path.Join(systemdServicesSlice, instance.unitName)
+}
+
+func (backend *systemdBackend) startInstance(instance *serviceInstance) (err error) {
+	if err = backend.createUnitFile(instance); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	fileName, err := filepath.Abs(path.Join(instance.path, instance.unitName))
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if _, err = backend.systemd.LinkUnitFilesContext(context.Background(),
+		[]string{fileName}, true, true); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = backend.systemd.ReloadContext(context.Background()); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	// failed unit should be reset, otherwise start limit could prevent unit start
+	if err = backend.systemd.ResetFailedUnitContext(context.Background(), instance.unitName); err != nil {
+		log.WithField("name", instance.unitName).Debugf("Can't reset failed unit: %s", err)
+	}
+
+	channel := make(chan string)
+	if _, err = backend.systemd.StartUnitContext(context.Background(),
+		instance.unitName, "replace", channel); err != nil {
+		return aoserrors.Wrap(err)
+	}
+	status := <-channel
+
+	backend.Lock()
+	backend.units[instance.unitName] = instance.id
+	backend.Unlock()
+
+	log.WithFields(log.Fields{"name": instance.unitName, "status": status}).Debug("Start instance")
+
+	return nil
+}
+
+func (backend *systemdBackend) stopInstance(instance *serviceInstance) (err error) {
+	backend.Lock()
+	delete(backend.units, instance.unitName)
+	backend.Unlock()
+
+	channel := make(chan string)
+	if _, err = backend.systemd.StopUnitContext(context.Background(),
+		instance.unitName, "replace", channel); err != nil {
+		if strings.Contains(err.Error(), errNotLoaded) {
+			log.WithField("id", instance.id).Warn("Instance not loaded")
+
+			return nil
+		}
+
+		return aoserrors.Wrap(err)
+	}
+
+	status := <-channel
+	log.WithFields(log.Fields{"id": instance.id, "status": status}).Debug("Stop instance")
+
+	if _, err = backend.systemd.DisableUnitFilesContext(context.Background(),
+		[]string{instance.unitName}, true); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err := backend.systemd.ReloadContext(context.Background()); err != nil {
+		log.Errorf("Can't reload systemd: %s", err)
+	}
+
+	return nil
+}
+
+func (backend *systemdBackend) checkInstanceHealth(instance *serviceInstance, timeout time.Duration) (err error) {
+	unitName := instance.unitName
+
+	subSet := backend.systemd.NewSubscriptionSet()
+
+	subSet.Add(unitName)
+
+	evChan, errChan := subSet.Subscribe()
+
+	var curretActiveStatus string
+
+	timeoutChannel := time.After(timeout)
+
+	for {
+		select {
+		case changes := <-evChan:
+			unitStatus, ok := changes[unitName]
+			if !ok {
+				break
+			}
+
+			if unitStatus == nil {
+				return aoserrors.Errorf("instance %s disabled", unitName)
+			}
+
+			if unitStatus.Name == unitName {
+				if unitStatus.ActiveState == unitStatusFailed {
+					return aoserrors.Errorf("instance %s failed", unitName)
+				}
+
+				curretActiveStatus = unitStatus.ActiveState
+			}
+
+		case err = <-errChan:
+			return aoserrors.Wrap(err)
+
+		case <-timeoutChannel:
+			if curretActiveStatus != unitStatusActive {
+				return aoserrors.Errorf("waiting for activating instance %s timeout", unitName)
+			}
+
+			return nil
+		}
+	}
+}
+
+func (backend *systemdBackend) createUnitFile(instance *serviceInstance) (err error) {
+	f, err := os.Create(path.Join(instance.path, instance.unitName))
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer f.Close()
+
+	absInstancePath, err := filepath.Abs(instance.path)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	lines := strings.SplitAfter(backend.serviceTemplate, "\n")
+	for _, line := range lines {
+		// skip comments
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// replaces variables with values
+		line = strings.ReplaceAll(line, "${RUNNER}", backend.runnerPath)
+		line = strings.ReplaceAll(line, "${ID}", instance.id)
+		line = strings.ReplaceAll(line, "${SERVICEPATH}", absInstancePath)
+		line = strings.ReplaceAll(line, restartPlaceholder, getSystemdRestartPolicy(instance.restartPolicy.Policy))
+
+		fmt.Fprint(f, line)
+	}
+
+	return aoserrors.Wrap(err)
+}
+
+func (backend *systemdBackend) isUnitWatched(unitName string) (watched bool) {
+	backend.Lock()
+	defer backend.Unlock()
+
+	_, watched = backend.units[unitName]
+
+	return watched
+}
+
+// watchUnits notifies supervisor about units which are stopped and not restarted by systemd
+func (backend *systemdBackend) watchUnits(statusChannel <-chan map[string]*dbus.UnitStatus, errChannel <-chan error) {
+	for {
+		select {
+		case changes := <-statusChannel:
+			for unitName, unitStatus := range changes {
+				// unloaded unit is reported as nil
+				state := unitStatusInactive
+
+				if unitStatus != nil {
+					state = unitStatus.ActiveState
+				}
+
+				if state != unitStatusFailed && state != unitStatusInactive {
+					continue
+				}
+
+				backend.Lock()
+				instanceID, ok := backend.units[unitName]
+				backend.Unlock()
+
+				if !ok {
+					continue
+				}
+
+				log.WithFields(log.Fields{"name": unitName, "state": state}).Debug("Unit state changed")
+
+				select {
+				case backend.stateChannel <- instanceStateEvent{instanceID: instanceID, state: state}:
+
+				case <-backend.stopChannel:
+					return
+				}
+			}
+
+		case err := <-errChannel:
+			log.Errorf("Can't get units status: %s", err)
+
+		case <-backend.stopChannel:
+			return
+		}
+	}
+}
+
+func getSystemdRestartPolicy(policy string) (systemdPolicy string) {
+	switch policy {
+	case restartPolicyNever:
+		return "no"
+
+	case restartPolicyOnFailure:
+		return restartPolicyOnFailure
+
+	default:
+		return restartPolicyAlways
+	}
+}
+
+func getSystemdServiceTemplate(workingDir string) (template string, err error) {
+	fileName := path.Join(workingDir, serviceTemplateFile)
+
+	fileContent, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return template, aoserrors.Wrap(err)
+		}
+
+		log.Warnf("Service template file does not exist. Creating %s", fileName)
+
+		if err = ioutil.WriteFile(fileName, []byte(serviceTemplate), 0644); err != nil {
+			return template, aoserrors.Wrap(err)
+		}
+
+		return serviceTemplate, nil
+	}
+
+	template = string(fileContent)
+
+	if !strings.Contains(template, restartPlaceholder) {
+		log.Warnf("Service template %s has no restart policy placeholder, update it", fileName)
+
+		template = addRestartPlaceholder(template)
+
+		if err = ioutil.WriteFile(fileName, []byte(template), 0644); err != nil {
+			return "", aoserrors.Wrap(err)
+		}
+	}
+
+	return template, nil
+}
+
+// addRestartPlaceholder replaces Restart directive of the service section with restart policy placeholder or adds
+// the placeholder if the directive is absent
+func addRestartPlaceholder(template string) (result string) {
+	lines := strings.SplitAfter(template, "\n")
+	serviceSection := false
+	restartDirective := "Restart=" + restartPlaceholder + "\n"
+
+	for i, line := range lines {
+		trimmedLine := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmedLine, "[") {
+			serviceSection = trimmedLine == "[Service]"
+
+			if serviceSection {
+				lines[i] = strings.TrimSuffix(line, "\n") + "\n" + restartDirective
+			}
+
+			continue
+		}
+
+		if serviceSection && strings.HasPrefix(trimmedLine, "Restart=") {
+			lines[i] = ""
+		}
+	}
+
+	return strings.Join(lines, "")
+}
+
+func cleanupSystemdServices() {
+	systemd, err := dbus.NewSystemConnectionContext(context.Background())
+	if err != nil {
+		log.Errorf("Can't connect to systemd: %s", err)
+
+		return
+	}
+	defer systemd.Close()
+
+	unitFiles, err := systemd.ListUnitFilesContext(context.Background())
+	if err != nil {
+		log.Errorf("Can't list systemd units: %s", err)
+	} else {
+		for _, unitFile := range unitFiles {
+			serviceName := filepath.Base(unitFile.Path)
+
+			if !strings.HasPrefix(serviceName, "aos_") {
+				continue
+			}
+
+			desc, err := systemd.GetUnitPropertyContext(context.Background(), serviceName, "Description")
+			if err != nil {
+				log.WithField("name", serviceName).Errorf("Can't get unit property: %s", err)
+				continue
+			}
+
+			value, ok := desc.Value.Value().(string)
+			if !ok {
+				log.WithField("name", serviceName).Error("Can't convert description")
+				continue
+			}
+
+			if value == serviceDescription {
+				log.WithField("name", serviceName).Debug("Deleting systemd service")
+
+				channel := make(chan string)
+				if _, err := systemd.StopUnitContext(context.Background(),
+					serviceName, "replace", channel); err != nil {
+					log.WithField("name", serviceName).Errorf("Can't stop unit: %s", err)
+				} else {
+					<-channel
+				}
+
+				if _, err := systemd.DisableUnitFilesContext(context.Background(),
+					[]string{serviceName}, true); err != nil {
+					log.WithField("name", serviceName).Error("Can't disable unit: ", err)
+				}
+			}
+		}
+	}
+
+	if err := systemd.ReloadContext(context.Background()); err != nil {
+		log.Errorf("Can't reload systemd: %s", err)
+	}
+}
@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package launcher //nolint
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestSystemdServiceTemplate(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "systemd_")
+	if err != nil {
+		t.Fatalf("Can't create tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oldTemplate := "[Unit]\nDescription=AOS Service\n\n[Service]\nType=forking\nRestart=always\nRestartSec=1\n"
+
+	if err = ioutil.WriteFile(path.Join(tmpDir, serviceTemplateFile), []byte(oldTemplate), 0o600); err != nil {
+		t.Fatalf("Can't write template: %s", err)
+	}
+
+	template, err := getSystemdServiceTemplate(tmpDir)
+	if err != nil {
+		t.Fatalf("Can't get service template: %s", err)
+	}
+
+	if strings.Count(template, "Restart=") != 1 || !strings.Contains(template, "[Service]\nRestart=${RESTART}\n") {
+		t.Errorf("Wrong service template: %s", template)
+	}
+
+	data, err := ioutil.ReadFile(path.Join(tmpDir, serviceTemplateFile))
+	if err != nil {
+		t.Fatalf("Can't read template: %s", err)
+	}
+
+	if string(data) != template {
+		t.Errorf("Template file is not updated: %s", data)
+	}
+}
@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layermanager
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	log "github.com/sirupsen/logrus"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// GarbageLayer layer collected by garbage collector.
+type GarbageLayer struct {
+	// empty for layer dirs which are not registered in DB
+	Digest string `json:"digest,omitempty"`
+	Path   string `json:"path"`
+	Size   uint64 `json:"size"`
+}
+
+// GarbageReport garbage collector report.
+type GarbageReport struct {
+	DryRun    bool           `json:"dryRun"`
+	Layers    []GarbageLayer `json:"layers"`
+	TotalSize uint64         `json:"totalSize"`
+}
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// CollectGarbage removes layers which are not referenced by installed services and layer dirs which
+// are not registered in DB. In dry run mode, layers are not removed but only reported. Garbage collection waits
+// for layer installs and for holders of LockLayers.
+func (layermanager *LayerManager) CollectGarbage(dryRun bool) (report GarbageReport, err error) {
+	log.WithField("dryRun", dryRun).Debug("Collect layers garbage")
+
+	// layers being installed or used by service install are not registered or referenced yet
+	layermanager.layersLock.Lock()
+	defer layermanager.layersLock.Unlock()
+
+	report.DryRun = dryRun
+
+	layers, err := layermanager.layerInfoProvider.GetLayersInfo()
+	if err != nil {
+		return report, aoserrors.Wrap(err)
+	}
+
+	// Mark: all registered layer dirs are known, referenced layers are alive
+	knownPaths := make(map[string]bool)
+
+	for _, layer := range layers {
+		layerPath, err := layermanager.layerInfoProvider.GetLayerPathByDigest(layer.Digest)
+		if err != nil {
+			return report, aoserrors.Wrap(err)
+		}
+
+		knownPaths[path.Clean(layerPath)] = true
+
+		serviceIDs, err := layermanager.layerInfoProvider.GetLayerServices(layer.Digest)
+		if err != nil {
+			return report, aoserrors.Wrap(err)
+		}
+
+		if len(serviceIDs) != 0 {
+			continue
+		}
+
+		report.Layers = append(report.Layers, GarbageLayer{
+			Digest: layer.Digest, Path: layerPath, Size: getDirSize(layerPath),
+		})
+	}
+
+	orphanedDirs, err := layermanager.getOrphanedLayerDirs(knownPaths)
+	if err != nil {
+		return report, aoserrors.Wrap(err)
+	}
+
+	for _, dir := range orphanedDirs {
+		report.Layers = append(report.Layers, GarbageLayer{Path: dir, Size: getDirSize(dir)})
+	}
+
+	for _, layer := range report.Layers {
+		report.TotalSize += layer.Size
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	// Sweep
+	for _, layer := range report.Layers {
+		log.WithFields(log.Fields{"digest": layer.Digest, "path": layer.Path}).Debug("Remove garbage layer")
+
+		if layer.Digest != "" {
+			if removeErr := layermanager.removeLayer(layer.Digest); removeErr != nil && err == nil {
+				err = aoserrors.Wrap(removeErr)
+			}
+
+			continue
+		}
+
+		if removeErr := os.RemoveAll(layer.Path); removeErr != nil && err == nil {
+			err = aoserrors.Wrap(removeErr)
+		}
+	}
+
+	return report, err
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+// getOrphanedLayerDirs returns layer dirs (<layersDir>/blobs/<algorithm>/<hex>) which are not known
+func (layermanager *LayerManager) getOrphanedLayerDirs(knownPaths map[string]bool) (dirs []string, err error) {
+	blobsDir := path.Join(layermanager.layersDir, "blobs")
+
+	algorithms, err := ioutil.ReadDir(blobsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, aoserrors.Wrap(err)
+	}
+
+	for _, algorithm := range algorithms {
+		if !algorithm.IsDir() {
+			continue
+		}
+
+		items, err := ioutil.ReadDir(path.Join(blobsDir, algorithm.Name()))
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		for _, item := range items {
+			itemPath := path.Join(blobsDir, algorithm.Name(), item.Name())
+
+			if !knownPaths[itemPath] {
+				dirs = append(dirs, itemPath)
+			}
+		}
+	}
+
+	return dirs, nil
+}
+
+func getDirSize(dir string) (size uint64) {
+	if err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if info.Mode().IsRegular() {
+			size += uint64(info.Size())
+		}
+
+		return nil
+	}); err != nil {
+		log.WithField("dir", dir).Warnf("Can't calculate dir size: %s", err)
+	}
+
+	return size
+}
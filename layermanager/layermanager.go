@@ -21,19 +21,24 @@ package layermanager
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
 
 	"github.com/aoscloud/aos_common/aoserrors"
 	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
 	"github.com/aoscloud/aos_common/image"
+	"github.com/opencontainers/go-digest"
 	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/aoscloud/aos_servicemanager/config"
+	"github.com/aoscloud/aos_servicemanager/progress"
 	"github.com/aoscloud/aos_servicemanager/utils/action"
 	"github.com/aoscloud/aos_servicemanager/utils/imageutils"
 )
@@ -44,10 +49,22 @@ import (
 const (
 	layerDirName       = "layers"
 	extractDirName     = "extract"
-	downloadDirName    = "download"
 	layerOCIDescriptor = "layer.json"
 )
 
+// Aos layer media types
+const (
+	mediaTypeAosLayer     = "application/vnd.aos.image.layer.v1.tar"
+	mediaTypeAosLayerGzip = "application/vnd.aos.image.layer.v1.tar+gzip"
+)
+
+/*******************************************************************************
+ * Vars
+ ******************************************************************************/
+
+// ErrLayerInUse is returned on attempt to remove layer which is used by installed services.
+var ErrLayerInUse = errors.New("layer is used by services")
+
 /*******************************************************************************
  * Types
  ******************************************************************************/
@@ -57,8 +74,12 @@ type LayerManager struct {
 	layersDir         string
 	layerInfoProvider LayerInfoProvider
 	extractDir        string
-	downloadDir       string
+	downloader        Downloader
+	progressTracker   ProgressTracker
+	signatureVerifier SignatureVerifier
 	actionHandler     *action.Handler
+	// garbage collector takes it exclusively, layer install and removal and layers users take it shared
+	layersLock sync.RWMutex
 }
 
 // LayerInfoProvider provides API to add, remove or access layer information.
@@ -68,6 +89,23 @@ type LayerInfoProvider interface {
 	GetLayerPathByDigest(digest string) (path string, err error)
 	GetLayersInfo() (layersList []*pb.LayerStatus, err error)
 	GetLayerInfoByDigest(digest string) (layer pb.LayerStatus, err error)
+	GetLayerServices(digest string) (serviceIDs []string, err error)
+}
+
+// Downloader downloads layer images.
+type Downloader interface {
+	Download(ctx context.Context, url string, fileInfo image.FileInfo) (fileName string, err error)
+	Release(fileName string)
+}
+
+// ProgressTracker tracks layer install progress.
+type ProgressTracker interface {
+	StartOperation(operationType, id string, aosVersion uint64) (reporter *progress.Reporter)
+}
+
+// SignatureVerifier verifies detached signature of layer descriptor.
+type SignatureVerifier interface {
+	VerifySignature(fileName string) (err error)
 }
 
 /*******************************************************************************
@@ -75,12 +113,15 @@ type LayerInfoProvider interface {
  ******************************************************************************/
 // New creates new launcher object.
 func New(config *config.Config,
-	infoProvider LayerInfoProvider) (layermanager *LayerManager, err error) {
+	infoProvider LayerInfoProvider, downloader Downloader,
+	progressTracker ProgressTracker, signatureVerifier SignatureVerifier) (layermanager *LayerManager, err error) {
 	layermanager = &LayerManager{
 		layersDir:         config.LayersDir,
 		layerInfoProvider: infoProvider,
 		extractDir:        path.Join(config.WorkingDir, extractDirName),
-		downloadDir:       path.Join(config.WorkingDir, downloadDirName),
+		downloader:        downloader,
+		progressTracker:   progressTracker,
+		signatureVerifier: signatureVerifier,
 	}
 
 	if layermanager.layersDir == "" {
@@ -95,8 +136,6 @@ func New(config *config.Config,
 		return nil, aoserrors.Wrap(err)
 	}
 
-	os.RemoveAll(layermanager.downloadDir)
-
 	return layermanager, nil
 }
 
@@ -117,6 +156,10 @@ func (layermanager *LayerManager) InstallLayer(installInfo *pb.InstallLayerReque
 		"digest":     installInfo.GetDigest(),
 	}).Debug("Install layer")
 
+	// unpacked layer dir is not registered in DB until install is finished, it should not be collected meanwhile
+	layermanager.layersLock.RLock()
+	defer layermanager.layersLock.RUnlock()
+
 	defer func() {
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -132,6 +175,15 @@ func (layermanager *LayerManager) InstallLayer(installInfo *pb.InstallLayerReque
 		return nil
 	}
 
+	var reporter *progress.Reporter
+
+	if layermanager.progressTracker != nil {
+		reporter = layermanager.progressTracker.StartOperation(progress.OperationTypeLayer,
+			installInfo.GetLayerId(), installInfo.GetAosVersion())
+	}
+
+	defer func() { reporter.Finish(err) }()
+
 	urlVal, err := url.Parse(installInfo.Url)
 	if err != nil {
 		return aoserrors.Wrap(err)
@@ -139,24 +191,30 @@ func (layermanager *LayerManager) InstallLayer(installInfo *pb.InstallLayerReque
 
 	var destinationFile string
 
+	fileInfo := image.FileInfo{Sha256: installInfo.Sha256, Sha512: installInfo.Sha512, Size: installInfo.Size}
+
 	if urlVal.Scheme != "file" {
-		if destinationFile, err = image.Download(context.Background(),
-			layermanager.downloadDir, installInfo.Url); err != nil {
+		reporter.SetPhase(progress.PhaseDownload)
+
+		// downloader checks file info of downloaded file
+		if destinationFile, err = layermanager.downloader.Download(progress.NewContext(context.Background(), reporter),
+			installInfo.Url, fileInfo); err != nil {
 			return aoserrors.Wrap(err)
 		}
 
-		defer os.RemoveAll(destinationFile)
+		defer layermanager.downloader.Release(destinationFile)
 	} else {
 		destinationFile = urlVal.Path
-	}
 
-	if err = image.CheckFileInfo(context.Background(), destinationFile, image.FileInfo{
-		Sha256: installInfo.Sha256,
-		Sha512: installInfo.Sha512, Size: installInfo.Size,
-	}); err != nil {
-		return aoserrors.Wrap(err)
+		reporter.SetPhase(progress.PhaseVerify)
+
+		if err = image.CheckFileInfo(context.Background(), destinationFile, fileInfo); err != nil {
+			return aoserrors.Wrap(err)
+		}
 	}
 
+	reporter.SetPhase(progress.PhaseUnpack)
+
 	unpackDir := path.Join(layermanager.extractDir, filepath.Base(destinationFile))
 
 	if err = imageutils.UnpackTarImage(destinationFile, unpackDir); err != nil {
@@ -164,6 +222,12 @@ func (layermanager *LayerManager) InstallLayer(installInfo *pb.InstallLayerReque
 	}
 	defer os.RemoveAll(unpackDir)
 
+	if layermanager.signatureVerifier != nil {
+		if err = layermanager.signatureVerifier.VerifySignature(path.Join(unpackDir, layerOCIDescriptor)); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
 	var byteValue []byte
 
 	if byteValue, err = ioutil.ReadFile(path.Join(unpackDir, layerOCIDescriptor)); err != nil {
@@ -210,26 +274,25 @@ func (layermanager *LayerManager) InstallLayer(installInfo *pb.InstallLayerReque
 	return nil
 }
 
-// UninstallLayer uninstalls layer.
+// UninstallLayer uninstalls layer. Layers used by installed services are not removed.
 func (layermanager *LayerManager) UninstallLayer(digest string) (err error) {
 	log.WithFields(log.Fields{"digest": digest}).Debug("Uninstall layer")
 
-	layerPath, err := layermanager.layerInfoProvider.GetLayerPathByDigest(digest)
+	layermanager.layersLock.RLock()
+	defer layermanager.layersLock.RUnlock()
+
+	serviceIDs, err := layermanager.layerInfoProvider.GetLayerServices(digest)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if err = os.RemoveAll(layerPath); err != nil {
-		return aoserrors.Wrap(err)
-	}
+	if len(serviceIDs) != 0 {
+		log.WithFields(log.Fields{"digest": digest, "services": serviceIDs}).Warn("Layer is used by services")
 
-	if err = layermanager.layerInfoProvider.DeleteLayerByDigest(digest); err != nil {
-		return aoserrors.Wrap(err)
+		return aoserrors.Wrap(ErrLayerInUse)
 	}
 
-	log.WithFields(log.Fields{"digest": digest}).Info("Layer successfully uninstalled")
-
-	return nil
+	return layermanager.removeLayer(digest)
 }
 
 // CheckLayersConsistency checks layers data to be consistent.
@@ -261,13 +324,16 @@ func (layermanager *LayerManager) CheckLayersConsistency() (err error) {
 
 // Cleanup clears all Layers.
 func (layermanager *LayerManager) Cleanup() (err error) {
+	layermanager.layersLock.RLock()
+	defer layermanager.layersLock.RUnlock()
+
 	layersInfo, err := layermanager.layerInfoProvider.GetLayersInfo()
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
 	for _, layerInfo := range layersInfo {
-		if curErr := layermanager.UninstallLayer(layerInfo.Digest); curErr != nil {
+		if curErr := layermanager.removeLayer(layerInfo.Digest); curErr != nil {
 			if err == nil {
 				err = aoserrors.Wrap(curErr)
 			}
@@ -277,6 +343,17 @@ func (layermanager *LayerManager) Cleanup() (err error) {
 	return aoserrors.Wrap(err)
 }
 
+// LockLayers prevents garbage collection of layers until UnlockLayers is called. It should be held while service
+// which uses not yet referenced layers is being installed. Multiple holders are allowed.
+func (layermanager *LayerManager) LockLayers() {
+	layermanager.layersLock.RLock()
+}
+
+// UnlockLayers allows garbage collection of layers locked by LockLayers.
+func (layermanager *LayerManager) UnlockLayers() {
+	layermanager.layersLock.RUnlock()
+}
+
 // GetLayerPathByDigest provied installed layer path by digest.
 func (layermanager *LayerManager) GetLayerPathByDigest(layerDigest string) (layerPath string, err error) {
 	layerPath, err = layermanager.layerInfoProvider.GetLayerPathByDigest(layerDigest)
@@ -296,7 +373,72 @@ func (layermanager *LayerManager) GetLayerInfoByDigest(digest string) (layer pb.
  * Private
  ******************************************************************************/
 
-func getValidLayerPath(layerDescriptor imagespec.Descriptor, unTarPath string) (layerPath string, err error) { //nolint
-	// TODO implement descriptor validation
-	return path.Join(unTarPath, layerDescriptor.Digest.Hex()), nil
+func (layermanager *LayerManager) removeLayer(digest string) (err error) {
+	layerPath, err := layermanager.layerInfoProvider.GetLayerPathByDigest(digest)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = os.RemoveAll(layerPath); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = layermanager.layerInfoProvider.DeleteLayerByDigest(digest); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	log.WithFields(log.Fields{"digest": digest}).Info("Layer successfully uninstalled")
+
+	return nil
+}
+
+func getValidLayerPath(layerDescriptor imagespec.Descriptor, unTarPath string) (layerPath string, err error) {
+	switch layerDescriptor.MediaType {
+	case mediaTypeAosLayer, mediaTypeAosLayerGzip, imagespec.MediaTypeImageLayer, imagespec.MediaTypeImageLayerGzip:
+
+	default:
+		return "", aoserrors.Errorf("unsupported layer media type: %s", layerDescriptor.MediaType)
+	}
+
+	if err = layerDescriptor.Digest.Validate(); err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	layerPath = path.Join(unTarPath, layerDescriptor.Digest.Hex())
+
+	fileInfo, err := os.Stat(layerPath)
+	if err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	if fileInfo.Size() != layerDescriptor.Size {
+		return "", aoserrors.Errorf("layer size mismatch: expected %d, actual %d", layerDescriptor.Size,
+			fileInfo.Size())
+	}
+
+	if err = validateLayerDigest(layerPath, layerDescriptor.Digest); err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	return layerPath, nil
+}
+
+func validateLayerDigest(layerPath string, layerDigest digest.Digest) (err error) {
+	file, err := os.Open(layerPath)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	verifier := layerDigest.Verifier()
+
+	if _, err = io.Copy(verifier, file); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if !verifier.Verified() {
+		return aoserrors.New("layer digest mismatch")
+	}
+
+	return nil
 }
@@ -21,6 +21,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -28,6 +29,7 @@ import (
 	"path"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/aoscloud/aos_common/aoserrors"
 	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
@@ -46,7 +48,13 @@ import (
 
 type testInfoProvider struct {
 	sync.Mutex
-	layers map[string]layerDesc
+	layers   map[string]layerDesc
+	services map[string][]string
+}
+
+type testSignatureVerifier struct {
+	fileNames []string
+	err       error
 }
 
 type layerDesc struct {
@@ -96,7 +104,7 @@ func TestMain(m *testing.M) {
  ******************************************************************************/
 
 func TestInstallRemoveLayer(t *testing.T) {
-	layerManager, err := layermanager.New(&config.Config{WorkingDir: tmpDir}, newTesInfoProvider())
+	layerManager, err := layermanager.New(&config.Config{WorkingDir: tmpDir}, newTesInfoProvider(), nil, nil, nil)
 	if err != nil {
 		t.Fatalf("Can't create layer manager: %s", err)
 	}
@@ -147,7 +155,7 @@ func TestInstallRemoveLayer(t *testing.T) {
 func TestLayerConsistencyCheck(t *testing.T) {
 	infoProvider := newTesInfoProvider()
 
-	layerManager, err := layermanager.New(&config.Config{WorkingDir: tmpDir}, infoProvider)
+	layerManager, err := layermanager.New(&config.Config{WorkingDir: tmpDir}, infoProvider, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("Can't create layer manager: %s", err)
 	}
@@ -203,11 +211,235 @@ func TestLayerConsistencyCheck(t *testing.T) {
 	}
 }
 
+func TestRemoveUsedLayer(t *testing.T) {
+	infoProvider := newTesInfoProvider()
+
+	layerManager, err := layermanager.New(&config.Config{WorkingDir: tmpDir}, infoProvider, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Can't create layer manager: %s", err)
+	}
+
+	layerFile, digest, fileInfo, err := createLayer(path.Join(tmpDir, "layerdir1"))
+	if err != nil {
+		t.Fatalf("Can't create layer: %s", err)
+	}
+
+	if err = layerManager.InstallLayer(&pb.InstallLayerRequest{
+		Url: layerFile, LayerId: "LayerId1", Digest: digest, AosVersion: 1,
+		Sha256: fileInfo.Sha256, Sha512: fileInfo.Sha512, Size: fileInfo.Size,
+	}); err != nil {
+		t.Fatalf("Can't install layer: %s", err)
+	}
+
+	infoProvider.setLayerServices(digest, []string{"service1"})
+
+	if err = layerManager.UninstallLayer(digest); !errors.Is(err, layermanager.ErrLayerInUse) {
+		t.Errorf("Layer in use error expected, got: %v", err)
+	}
+
+	infoProvider.setLayerServices(digest, nil)
+
+	if err = layerManager.UninstallLayer(digest); err != nil {
+		t.Errorf("Can't uninstall layer: %s", err)
+	}
+}
+
+func TestLayerSignatureVerification(t *testing.T) {
+	infoProvider := newTesInfoProvider()
+	verifier := &testSignatureVerifier{err: aoserrors.New("signature not found")}
+
+	layerManager, err := layermanager.New(&config.Config{WorkingDir: tmpDir}, infoProvider, nil, nil, verifier)
+	if err != nil {
+		t.Fatalf("Can't create layer manager: %s", err)
+	}
+
+	layerFile, digest, fileInfo, err := createLayer(path.Join(tmpDir, "layerdirSigned"))
+	if err != nil {
+		t.Fatalf("Can't create layer: %s", err)
+	}
+
+	installRequest := &pb.InstallLayerRequest{
+		Url: layerFile, LayerId: "LayerIdSigned", Digest: digest, AosVersion: 1,
+		Sha256: fileInfo.Sha256, Sha512: fileInfo.Sha512, Size: fileInfo.Size,
+	}
+
+	if err = layerManager.InstallLayer(installRequest); err == nil {
+		t.Fatal("Layer with invalid signature should not be installed")
+	}
+
+	if len(verifier.fileNames) != 1 || path.Base(verifier.fileNames[0]) != "layer.json" {
+		t.Errorf("Wrong verified files: %v", verifier.fileNames)
+	}
+
+	if _, err = layerManager.GetLayerInfoByDigest(digest); err == nil {
+		t.Error("Layer should not be added")
+	}
+
+	verifier.err = nil
+
+	if err = layerManager.InstallLayer(installRequest); err != nil {
+		t.Fatalf("Can't install layer: %s", err)
+	}
+
+	if err = layerManager.UninstallLayer(digest); err != nil {
+		t.Errorf("Can't uninstall layer: %s", err)
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	infoProvider := newTesInfoProvider()
+	workingDir := path.Join(tmpDir, "gc")
+
+	layerManager, err := layermanager.New(&config.Config{WorkingDir: workingDir}, infoProvider, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Can't create layer manager: %s", err)
+	}
+
+	var digests []string
+
+	for i := 0; i < 2; i++ {
+		layerFile, digest, fileInfo, err := createLayer(path.Join(tmpDir, fmt.Sprintf("gclayerdir%d", i)))
+		if err != nil {
+			t.Fatalf("Can't create layer: %s", err)
+		}
+
+		if err = layerManager.InstallLayer(&pb.InstallLayerRequest{
+			Url: layerFile, LayerId: fmt.Sprintf("LayerId%d", i), Digest: digest, AosVersion: 1,
+			Sha256: fileInfo.Sha256, Sha512: fileInfo.Sha512, Size: fileInfo.Size,
+		}); err != nil {
+			t.Fatalf("Can't install layer: %s", err)
+		}
+
+		digests = append(digests, digest)
+	}
+
+	infoProvider.setLayerServices(digests[0], []string{"service1"})
+
+	orphanedDir := path.Join(workingDir, "layers", "blobs", "sha256", "orphaned")
+
+	if err = os.MkdirAll(orphanedDir, 0755); err != nil {
+		t.Fatalf("Can't create orphaned dir: %s", err)
+	}
+
+	if err = ioutil.WriteFile(path.Join(orphanedDir, "data"), []byte("orphaned"), 0644); err != nil {
+		t.Fatalf("Can't write orphaned file: %s", err)
+	}
+
+	unusedPath, err := infoProvider.GetLayerPathByDigest(digests[1])
+	if err != nil {
+		t.Fatalf("Can't get layer path: %s", err)
+	}
+
+	report, err := layerManager.CollectGarbage(true)
+	if err != nil {
+		t.Fatalf("Can't collect garbage: %s", err)
+	}
+
+	if !report.DryRun || len(report.Layers) != 2 {
+		t.Fatalf("Wrong garbage report: %+v", report)
+	}
+
+	for _, layer := range report.Layers {
+		if (layer.Digest != digests[1] || layer.Path != unusedPath) && (layer.Digest != "" || layer.Path != orphanedDir) {
+			t.Errorf("Unexpected garbage layer: %+v", layer)
+		}
+	}
+
+	if report.TotalSize == 0 {
+		t.Error("Garbage total size should not be 0")
+	}
+
+	if _, err = os.Stat(orphanedDir); err != nil {
+		t.Errorf("Orphaned dir should not be removed in dry run mode: %s", err)
+	}
+
+	if report, err = layerManager.CollectGarbage(false); err != nil {
+		t.Fatalf("Can't collect garbage: %s", err)
+	}
+
+	if report.DryRun || len(report.Layers) != 2 {
+		t.Errorf("Wrong garbage report: %+v", report)
+	}
+
+	for _, removedPath := range []string{orphanedDir, unusedPath} {
+		if _, err = os.Stat(removedPath); !os.IsNotExist(err) {
+			t.Errorf("Garbage dir %s should be removed", removedPath)
+		}
+	}
+
+	list, err := layerManager.GetLayersInfo()
+	if err != nil {
+		t.Fatalf("Can't get layer list: %s", err)
+	}
+
+	if len(list) != 1 || list[0].Digest != digests[0] {
+		t.Errorf("Wrong layers list: %v", list)
+	}
+}
+
+func TestCollectGarbageLockedLayers(t *testing.T) {
+	infoProvider := newTesInfoProvider()
+	workingDir := path.Join(tmpDir, "gclock")
+
+	layerManager, err := layermanager.New(&config.Config{WorkingDir: workingDir}, infoProvider, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Can't create layer manager: %s", err)
+	}
+
+	layerFile, digest, fileInfo, err := createLayer(path.Join(tmpDir, "gclocklayerdir"))
+	if err != nil {
+		t.Fatalf("Can't create layer: %s", err)
+	}
+
+	if err = layerManager.InstallLayer(&pb.InstallLayerRequest{
+		Url: layerFile, LayerId: "LayerId", Digest: digest, AosVersion: 1,
+		Sha256: fileInfo.Sha256, Sha512: fileInfo.Sha512, Size: fileInfo.Size,
+	}); err != nil {
+		t.Fatalf("Can't install layer: %s", err)
+	}
+
+	// layer is locked by service install which sets layer services before unlock
+	layerManager.LockLayers()
+
+	gcDone := make(chan error, 1)
+
+	go func() {
+		_, err := layerManager.CollectGarbage(false)
+
+		gcDone <- err
+	}()
+
+	select {
+	case <-gcDone:
+		t.Fatal("Garbage is collected while layers are locked")
+
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	infoProvider.setLayerServices(digest, []string{"service1"})
+
+	layerManager.UnlockLayers()
+
+	select {
+	case err = <-gcDone:
+		if err != nil {
+			t.Errorf("Can't collect garbage: %s", err)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("Garbage collection is not finished")
+	}
+
+	if _, err = layerManager.GetLayerInfoByDigest(digest); err != nil {
+		t.Errorf("Used layer should not be removed: %s", err)
+	}
+}
+
 /*******************************************************************************
  * Interfaces
  ******************************************************************************/
 func newTesInfoProvider() (infoProvider *testInfoProvider) {
-	return &testInfoProvider{layers: make(map[string]layerDesc)}
+	return &testInfoProvider{layers: make(map[string]layerDesc), services: make(map[string][]string)}
 }
 
 func (infoProvider *testInfoProvider) AddLayer(digest, layerID, path, osVersion,
@@ -274,10 +506,30 @@ func (infoProvider *testInfoProvider) GetLayerInfoByDigest(digest string) (layer
 	return pb.LayerStatus{LayerId: layerInfo.id, Digest: digest, AosVersion: layerInfo.aosVersion}, nil
 }
 
+func (infoProvider *testInfoProvider) GetLayerServices(digest string) (serviceIDs []string, err error) {
+	infoProvider.Lock()
+	defer infoProvider.Unlock()
+
+	return infoProvider.services[digest], nil
+}
+
+func (infoProvider *testInfoProvider) setLayerServices(digest string, serviceIDs []string) {
+	infoProvider.Lock()
+	defer infoProvider.Unlock()
+
+	infoProvider.services[digest] = serviceIDs
+}
+
 /*******************************************************************************
  * Private
  ******************************************************************************/
 
+func (verifier *testSignatureVerifier) VerifySignature(fileName string) (err error) {
+	verifier.fileNames = append(verifier.fileNames, fileName)
+
+	return verifier.err
+}
+
 func setup() (err error) {
 	if tmpDir, err = ioutil.TempDir("", "aos_"); err != nil {
 		return aoserrors.Wrap(err)
@@ -334,7 +586,7 @@ func createLayer(dir string) (layerFile string, digest string, fileInfo image.Fi
 	layerDescriptor := imagespec.Descriptor{
 		MediaType: "application/vnd.aos.image.layer.v1.tar+gzip",
 		Digest:    layerDigest,
-		// TODO fulfill
+		Size:      int64(len(byteValue)),
 	}
 
 	dataJSON, err := json.Marshal(layerDescriptor)
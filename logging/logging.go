@@ -50,6 +50,7 @@ const (
 // ServiceProvider provides service info
 type ServiceProvider interface {
 	GetService(serviceID string) (service launcher.Service, err error)
+	GetSubjectServicesByServiceID(serviceID string) (subjectServices []launcher.SubjectService, err error)
 }
 
 // Logging instance
@@ -361,9 +362,9 @@ func (instance *Logging) getServiceCrashLog(request getLogRequest) {
 			return
 		}
 
-		var unitName string
+		var unitNames map[string]bool
 
-		unitName, err = instance.addServiceIDFilter(journal, serviceField, request.serviceID)
+		unitNames, err = instance.addServiceIDFilter(journal, serviceField, request.serviceID)
 		if err != nil {
 			err = aoserrors.Wrap(err)
 			return
@@ -393,7 +394,7 @@ func (instance *Logging) getServiceCrashLog(request getLogRequest) {
 				break
 			}
 
-			if serviceName, ok := logEntry.Fields[serviceField]; ok && unitName == serviceName {
+			if serviceName, ok := logEntry.Fields[serviceField]; ok && unitNames[serviceName] {
 				if err = archInstance.addLog(createLogString(logEntry, false)); err != nil {
 					err = aoserrors.Wrap(err)
 					return
@@ -416,22 +417,42 @@ func (instance *Logging) sendErrorResponse(errorStr, logID string) {
 	instance.logChannel <- response
 }
 
+// addServiceIDFilter adds journal matches for units of all service instances
 func (instance *Logging) addServiceIDFilter(journal *sdjournal.Journal,
-	fieldName, serviceID string) (unitName string, err error) {
+	fieldName, serviceID string) (unitNames map[string]bool, err error) {
+	unitNames = make(map[string]bool)
+
 	if serviceID == "" {
-		return unitName, nil
+		return unitNames, nil
 	}
 
 	service, err := instance.serviceProvider.GetService(serviceID)
 	if err != nil {
-		return unitName, nil
+		return unitNames, nil
+	}
+
+	subjectServices, err := instance.serviceProvider.GetSubjectServicesByServiceID(serviceID)
+	if err != nil {
+		return unitNames, aoserrors.Wrap(err)
+	}
+
+	for _, subjectService := range subjectServices {
+		if subjectService.UnitName != "" {
+			unitNames[subjectService.UnitName] = true
+		}
 	}
 
-	if err = journal.AddMatch(fieldName + "=" + service.UnitName); err != nil {
-		return unitName, aoserrors.Wrap(err)
+	if len(unitNames) == 0 {
+		unitNames[service.UnitName] = true
+	}
+
+	for unitName := range unitNames {
+		if err = journal.AddMatch(fieldName + "=" + unitName); err != nil {
+			return unitNames, aoserrors.Wrap(err)
+		}
 	}
 
-	return service.UnitName, nil
+	return unitNames, nil
 }
 
 func (instance *Logging) seekToTime(journal *sdjournal.Journal, from *time.Time) (err error) {
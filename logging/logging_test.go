@@ -378,6 +378,11 @@ func (serviceProvider *testServiceProvider) GetService(serviceID string) (servic
 	return *s, nil
 }
 
+func (serviceProvider *testServiceProvider) GetSubjectServicesByServiceID(
+	serviceID string) (subjectServices []launcher.SubjectService, err error) {
+	return nil, nil
+}
+
 /*******************************************************************************
  * Private
  ******************************************************************************/
@@ -0,0 +1,366 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics provides Prometheus metrics exporter
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+	"github.com/aoscloud/aos_servicemanager/launcher"
+	"github.com/aoscloud/aos_servicemanager/monitoring"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+const metricsPath = "/metrics"
+
+const metricsPrefix = "aos_sm_"
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+const readHeaderTimeout = 10 * time.Second
+
+// Metric types
+const (
+	metricTypeGauge   = "gauge"
+	metricTypeCounter = "counter"
+	metricTypeSummary = "summary"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// MonitoringProvider provides current monitoring data.
+type MonitoringProvider interface {
+	GetCurrentMonitoringData() (system *pb.SystemMonitoring, instances []monitoring.InstanceMonitoringData)
+}
+
+// TrafficProvider provides traffic counters.
+type TrafficProvider interface {
+	GetSystemTraffic() (inputTraffic, outputTraffic uint64, err error)
+}
+
+// AlertsProvider provides alerts counters.
+type AlertsProvider interface {
+	GetAlertCounts() (counts map[string]uint64)
+}
+
+// StorageProvider provides installed services and layers.
+type StorageProvider interface {
+	GetServices() (services []launcher.Service, err error)
+	GetLayersInfo() (layersList []*pb.LayerStatus, err error)
+}
+
+// OperationsProvider provides service operations statistics.
+type OperationsProvider interface {
+	GetOperationStats() (stats map[string]launcher.OperationStats)
+}
+
+// Exporter metrics exporter instance.
+type Exporter struct {
+	monitoringProvider MonitoringProvider
+	trafficProvider    TrafficProvider
+	alertsProvider     AlertsProvider
+	storageProvider    StorageProvider
+	operationsProvider OperationsProvider
+
+	listener net.Listener
+	server   *http.Server
+}
+
+type metricsWriter struct {
+	buffer bytes.Buffer
+}
+
+/*******************************************************************************
+ * Vars
+ ******************************************************************************/
+
+// ErrDisabled indicates that metrics exporter is disabled in the config.
+var ErrDisabled = errors.New("metrics exporter is disabled")
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// New creates metrics exporter. Providers which are not available should be set to nil.
+func New(cfg *config.Config, monitoringProvider MonitoringProvider, trafficProvider TrafficProvider,
+	alertsProvider AlertsProvider, storageProvider StorageProvider,
+	operationsProvider OperationsProvider) (exporter *Exporter, err error) {
+	log.Debug("Create metrics exporter")
+
+	if cfg.MetricsServerURL == "" {
+		return nil, ErrDisabled
+	}
+
+	exporter = &Exporter{
+		monitoringProvider: monitoringProvider,
+		trafficProvider:    trafficProvider,
+		alertsProvider:     alertsProvider,
+		storageProvider:    storageProvider,
+		operationsProvider: operationsProvider,
+	}
+
+	if exporter.listener, err = net.Listen("tcp", cfg.MetricsServerURL); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(metricsPath, exporter.handleMetrics)
+
+	exporter.server = &http.Server{Handler: mux, ReadHeaderTimeout: readHeaderTimeout}
+
+	go func() {
+		if err := exporter.server.Serve(exporter.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Metrics server error: %s", err)
+		}
+	}()
+
+	log.WithField("url", exporter.listener.Addr()).Debug("Metrics server started")
+
+	return exporter, nil
+}
+
+// Close closes metrics exporter.
+func (exporter *Exporter) Close() {
+	log.Debug("Close metrics exporter")
+
+	if err := exporter.server.Close(); err != nil {
+		log.Errorf("Can't close metrics server: %s", err)
+	}
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func (exporter *Exporter) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	writer := &metricsWriter{}
+
+	exporter.writeMonitoringMetrics(writer)
+	exporter.writeTrafficMetrics(writer)
+	exporter.writeAlertsMetrics(writer)
+	exporter.writeStorageMetrics(writer)
+	exporter.writeOperationsMetrics(writer)
+
+	w.Header().Set("Content-Type", contentType)
+
+	if _, err := w.Write(writer.buffer.Bytes()); err != nil {
+		log.Errorf("Can't write metrics: %s", err)
+	}
+}
+
+func (exporter *Exporter) writeMonitoringMetrics(writer *metricsWriter) {
+	if exporter.monitoringProvider == nil {
+		return
+	}
+
+	system, instances := exporter.monitoringProvider.GetCurrentMonitoringData()
+
+	writer.writeHeader("system_cpu_percent", metricTypeGauge, "System CPU usage in percent")
+	writer.writeValue("system_cpu_percent", nil, system.GetCpu())
+
+	writer.writeHeader("system_ram_bytes", metricTypeGauge, "System RAM usage in bytes")
+	writer.writeValue("system_ram_bytes", nil, system.GetRam())
+
+	writer.writeHeader("system_disk_used_bytes", metricTypeGauge, "System disk usage in bytes")
+	writer.writeValue("system_disk_used_bytes", nil, system.GetUsedDisk())
+
+	sort.Slice(instances, func(i, j int) bool { return instances[i].InstanceID < instances[j].InstanceID })
+
+	serviceMetrics := []struct {
+		name  string
+		help  string
+		value func(instance monitoring.InstanceMonitoringData) uint64
+	}{
+		{"service_cpu_percent", "Service instance CPU usage in percent",
+			func(instance monitoring.InstanceMonitoringData) uint64 { return instance.CPU }},
+		{"service_ram_bytes", "Service instance RAM usage in bytes",
+			func(instance monitoring.InstanceMonitoringData) uint64 { return instance.RAM }},
+		{"service_swap_bytes", "Service instance swap usage in bytes",
+			func(instance monitoring.InstanceMonitoringData) uint64 { return instance.Swap }},
+		{"service_disk_used_bytes", "Service instance disk usage in bytes",
+			func(instance monitoring.InstanceMonitoringData) uint64 { return instance.UsedDisk }},
+		{"service_pids", "Service instance number of processes",
+			func(instance monitoring.InstanceMonitoringData) uint64 { return instance.Pids }},
+		{"service_io_read_bytes_per_second", "Service instance IO read throughput",
+			func(instance monitoring.InstanceMonitoringData) uint64 { return instance.IORead }},
+		{"service_io_write_bytes_per_second", "Service instance IO write throughput",
+			func(instance monitoring.InstanceMonitoringData) uint64 { return instance.IOWrite }},
+		{"service_in_traffic_bytes", "Service instance incoming traffic in current traffic period",
+			func(instance monitoring.InstanceMonitoringData) uint64 { return instance.InTraffic }},
+		{"service_out_traffic_bytes", "Service instance outgoing traffic in current traffic period",
+			func(instance monitoring.InstanceMonitoringData) uint64 { return instance.OutTraffic }},
+	}
+
+	for _, metric := range serviceMetrics {
+		writer.writeHeader(metric.name, metricTypeGauge, metric.help)
+
+		for _, instance := range instances {
+			writer.writeValue(metric.name, []string{
+				"instance_id", instance.InstanceID, "service_id", instance.ServiceID, "subject_id", instance.SubjectID,
+			}, metric.value(instance))
+		}
+	}
+}
+
+func (exporter *Exporter) writeTrafficMetrics(writer *metricsWriter) {
+	if exporter.trafficProvider == nil {
+		return
+	}
+
+	inTraffic, outTraffic, err := exporter.trafficProvider.GetSystemTraffic()
+	if err != nil {
+		log.Errorf("Can't get system traffic: %s", err)
+
+		return
+	}
+
+	writer.writeHeader("system_traffic_bytes", metricTypeGauge, "System traffic in current traffic period")
+	writer.writeValue("system_traffic_bytes", []string{"direction", "in"}, inTraffic)
+	writer.writeValue("system_traffic_bytes", []string{"direction", "out"}, outTraffic)
+}
+
+func (exporter *Exporter) writeAlertsMetrics(writer *metricsWriter) {
+	if exporter.alertsProvider == nil {
+		return
+	}
+
+	counts := exporter.alertsProvider.GetAlertCounts()
+
+	tags := make([]string, 0, len(counts))
+
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+
+	sort.Strings(tags)
+
+	writer.writeHeader("alerts_total", metricTypeCounter, "Number of sent alerts by tag")
+
+	for _, tag := range tags {
+		writer.writeValue("alerts_total", []string{"tag", tag}, counts[tag])
+	}
+}
+
+func (exporter *Exporter) writeStorageMetrics(writer *metricsWriter) {
+	if exporter.storageProvider == nil {
+		return
+	}
+
+	if services, err := exporter.storageProvider.GetServices(); err != nil {
+		log.Errorf("Can't get services: %s", err)
+	} else {
+		writer.writeHeader("services", metricTypeGauge, "Number of installed services")
+		writer.writeValue("services", nil, uint64(len(services)))
+	}
+
+	if layers, err := exporter.storageProvider.GetLayersInfo(); err != nil {
+		log.Errorf("Can't get layers: %s", err)
+	} else {
+		writer.writeHeader("layers", metricTypeGauge, "Number of installed layers")
+		writer.writeValue("layers", nil, uint64(len(layers)))
+	}
+}
+
+func (exporter *Exporter) writeOperationsMetrics(writer *metricsWriter) {
+	if exporter.operationsProvider == nil {
+		return
+	}
+
+	stats := exporter.operationsProvider.GetOperationStats()
+
+	operations := make([]string, 0, len(stats))
+
+	for operation := range stats {
+		operations = append(operations, operation)
+	}
+
+	sort.Strings(operations)
+
+	writer.writeHeader("service_operation_duration_seconds", metricTypeSummary, "Duration of service operations")
+
+	for _, operation := range operations {
+		labels := []string{"operation", operation}
+
+		writer.writeFloatValue("service_operation_duration_seconds_sum", labels,
+			stats[operation].TotalDuration.Seconds())
+		writer.writeValue("service_operation_duration_seconds_count", labels, stats[operation].Count)
+	}
+
+	writer.writeHeader("service_operation_failures_total", metricTypeCounter, "Number of failed service operations")
+
+	for _, operation := range operations {
+		writer.writeValue("service_operation_failures_total", []string{"operation", operation},
+			stats[operation].Failures)
+	}
+}
+
+func (writer *metricsWriter) writeHeader(name, metricType, help string) {
+	fmt.Fprintf(&writer.buffer, "# HELP %s%s %s\n", metricsPrefix, name, help)
+	fmt.Fprintf(&writer.buffer, "# TYPE %s%s %s\n", metricsPrefix, name, metricType)
+}
+
+// writeValue writes metric sample, labels are set as name, value pairs
+func (writer *metricsWriter) writeValue(name string, labels []string, value uint64) {
+	fmt.Fprintf(&writer.buffer, "%s%s%s %d\n", metricsPrefix, name, formatLabels(labels), value)
+}
+
+func (writer *metricsWriter) writeFloatValue(name string, labels []string, value float64) {
+	fmt.Fprintf(&writer.buffer, "%s%s%s %g\n", metricsPrefix, name, formatLabels(labels), value)
+}
+
+func formatLabels(labels []string) (result string) {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1])))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabelValue(value string) (escaped string) {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+	"github.com/aoscloud/aos_servicemanager/launcher"
+	"github.com/aoscloud/aos_servicemanager/metrics"
+	"github.com/aoscloud/aos_servicemanager/monitoring"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+const metricsServerURL = "localhost:8099"
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+type testMonitoringProvider struct{}
+
+type testTrafficProvider struct{}
+
+type testAlertsProvider struct{}
+
+type testStorageProvider struct{}
+
+type testOperationsProvider struct{}
+
+/*******************************************************************************
+ * Init
+ ******************************************************************************/
+
+func init() {
+	log.SetFormatter(&log.TextFormatter{
+		DisableTimestamp: false,
+		TimestampFormat:  "2006-01-02 15:04:05.000",
+		FullTimestamp:    true,
+	})
+	log.SetLevel(log.DebugLevel)
+	log.SetOutput(os.Stdout)
+}
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestDisabled(t *testing.T) {
+	if _, err := metrics.New(&config.Config{}, nil, nil, nil, nil, nil); err != metrics.ErrDisabled {
+		t.Errorf("Wrong error: %v", err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	exporter, err := metrics.New(&config.Config{MetricsServerURL: metricsServerURL},
+		&testMonitoringProvider{}, &testTrafficProvider{}, &testAlertsProvider{},
+		&testStorageProvider{}, &testOperationsProvider{})
+	if err != nil {
+		t.Fatalf("Can't create metrics exporter: %s", err)
+	}
+	defer exporter.Close()
+
+	rsp, err := http.Get("http://" + metricsServerURL + "/metrics")
+	if err != nil {
+		t.Fatalf("Can't get metrics: %s", err)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("Wrong status code: %d", rsp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatalf("Can't read metrics: %s", err)
+	}
+
+	expectedMetrics := []string{
+		"# TYPE aos_sm_system_cpu_percent gauge",
+		"aos_sm_system_cpu_percent 30",
+		"aos_sm_system_ram_bytes 1024",
+		"aos_sm_system_disk_used_bytes 2048",
+		`aos_sm_service_ram_bytes{instance_id="service0_0011",service_id="service0",subject_id="subject0"} 512`,
+		`aos_sm_service_pids{instance_id="service0_0011",service_id="service0",subject_id="subject0"} 3`,
+		`aos_sm_service_io_write_bytes_per_second{instance_id="service0_0011",service_id="service0",subject_id="subject0"} 64`,
+		`aos_sm_system_traffic_bytes{direction="in"} 100`,
+		`aos_sm_system_traffic_bytes{direction="out"} 200`,
+		"# TYPE aos_sm_alerts_total counter",
+		`aos_sm_alerts_total{tag="resourceAlert"} 5`,
+		`aos_sm_alerts_total{tag="systemAlert"} 7`,
+		"aos_sm_services 2",
+		"aos_sm_layers 1",
+		"# TYPE aos_sm_service_operation_duration_seconds summary",
+		`aos_sm_service_operation_duration_seconds_sum{operation="install"} 1.5`,
+		`aos_sm_service_operation_duration_seconds_count{operation="install"} 3`,
+		`aos_sm_service_operation_failures_total{operation="install"} 1`,
+	}
+
+	for _, metric := range expectedMetrics {
+		if !strings.Contains(string(body), metric+"\n") {
+			t.Errorf("Metric not found: %s", metric)
+		}
+	}
+}
+
+/*******************************************************************************
+ * Interfaces
+ ******************************************************************************/
+
+func (provider *testMonitoringProvider) GetCurrentMonitoringData() (
+	system *pb.SystemMonitoring, instances []monitoring.InstanceMonitoringData) {
+	return &pb.SystemMonitoring{Cpu: 30, Ram: 1024, UsedDisk: 2048},
+		[]monitoring.InstanceMonitoringData{{
+			InstanceID: "service0_0011", ServiceID: "service0", SubjectID: "subject0",
+			RAM: 512, CPU: 10, Pids: 3, IOWrite: 64,
+		}}
+}
+
+func (provider *testTrafficProvider) GetSystemTraffic() (inputTraffic, outputTraffic uint64, err error) {
+	return 100, 200, nil
+}
+
+func (provider *testAlertsProvider) GetAlertCounts() (counts map[string]uint64) {
+	return map[string]uint64{"systemAlert": 7, "resourceAlert": 5}
+}
+
+func (provider *testStorageProvider) GetServices() (services []launcher.Service, err error) {
+	return []launcher.Service{{ID: "service0"}, {ID: "service1"}}, nil
+}
+
+func (provider *testStorageProvider) GetLayersInfo() (layersList []*pb.LayerStatus, err error) {
+	return []*pb.LayerStatus{{LayerId: "layer0"}}, nil
+}
+
+func (provider *testOperationsProvider) GetOperationStats() (stats map[string]launcher.OperationStats) {
+	return map[string]launcher.OperationStats{
+		launcher.OperationInstall: {Count: 3, Failures: 1, TotalDuration: 1500 * time.Millisecond},
+	}
+}
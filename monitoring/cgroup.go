@@ -0,0 +1,301 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoring
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+const defaultCgroupRoot = "/sys/fs/cgroup"
+
+// cgroup v2 files
+const (
+	cgroupV2ControllersFile = "cgroup.controllers"
+	cgroupV2CPUStatFile     = "cpu.stat"
+	cgroupV2MemoryFile      = "memory.current"
+	cgroupV2SwapFile        = "memory.swap.current"
+	cgroupV2PidsFile        = "pids.current"
+	cgroupV2IOStatFile      = "io.stat"
+)
+
+// cgroup v1 controllers and files
+const (
+	cgroupV1CPUAcctController = "cpuacct"
+	cgroupV1MemoryController  = "memory"
+	cgroupV1PidsController    = "pids"
+	cgroupV1BlkioController   = "blkio"
+	cgroupV1CPUUsageFile      = "cpuacct.usage"
+	cgroupV1MemoryFile        = "memory.usage_in_bytes"
+	cgroupV1MemSwapFile       = "memory.memsw.usage_in_bytes"
+	cgroupV1PidsFile          = "pids.current"
+	cgroupV1IOServiceFile     = "blkio.throttle.io_service_bytes"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// cgroupStats contains raw cgroup counters
+type cgroupStats struct {
+	// total CPU time in nanoseconds
+	cpuUsage uint64
+	// memory usage including page cache in bytes
+	ram uint64
+	// swap usage in bytes
+	swap uint64
+	// number of processes
+	pids uint64
+	// total read bytes
+	ioRead uint64
+	// total written bytes
+	ioWrite uint64
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+// getCgroupStats reads counters of cgroup located at cgroupPath relative to cgroup hierarchy root
+func getCgroupStats(cgroupRoot, cgroupPath string) (stats cgroupStats, err error) {
+	if cgroupPath == "" {
+		return stats, aoserrors.New("cgroup path is not set")
+	}
+
+	if isCgroupV2(cgroupRoot) {
+		return getCgroupV2Stats(path.Join(cgroupRoot, cgroupPath))
+	}
+
+	return getCgroupV1Stats(cgroupRoot, cgroupPath)
+}
+
+func isCgroupV2(cgroupRoot string) (result bool) {
+	_, err := os.Stat(path.Join(cgroupRoot, cgroupV2ControllersFile))
+
+	return err == nil
+}
+
+func getCgroupV2Stats(cgroupDir string) (stats cgroupStats, err error) {
+	cpuStat, err := readCgroupKeyValues(path.Join(cgroupDir, cgroupV2CPUStatFile))
+	if err != nil {
+		return stats, aoserrors.Wrap(err)
+	}
+
+	// cpu.stat reports usage in microseconds
+	stats.cpuUsage = cpuStat["usage_usec"] * 1000
+
+	if stats.ram, err = readCgroupValue(path.Join(cgroupDir, cgroupV2MemoryFile)); err != nil {
+		return stats, aoserrors.Wrap(err)
+	}
+
+	if stats.swap, err = readOptionalCgroupValue(path.Join(cgroupDir, cgroupV2SwapFile)); err != nil {
+		return stats, aoserrors.Wrap(err)
+	}
+
+	if stats.pids, err = readOptionalCgroupValue(path.Join(cgroupDir, cgroupV2PidsFile)); err != nil {
+		return stats, aoserrors.Wrap(err)
+	}
+
+	if stats.ioRead, stats.ioWrite, err = readCgroupV2IOStat(path.Join(cgroupDir, cgroupV2IOStatFile)); err != nil {
+		return stats, aoserrors.Wrap(err)
+	}
+
+	return stats, nil
+}
+
+func getCgroupV1Stats(cgroupRoot, cgroupPath string) (stats cgroupStats, err error) {
+	if stats.cpuUsage, err = readCgroupValue(
+		path.Join(cgroupRoot, cgroupV1CPUAcctController, cgroupPath, cgroupV1CPUUsageFile)); err != nil {
+		return stats, aoserrors.Wrap(err)
+	}
+
+	memoryDir := path.Join(cgroupRoot, cgroupV1MemoryController, cgroupPath)
+
+	if stats.ram, err = readCgroupValue(path.Join(memoryDir, cgroupV1MemoryFile)); err != nil {
+		return stats, aoserrors.Wrap(err)
+	}
+
+	// memsw is available only if swap accounting is enabled and contains memory + swap usage
+	memSwap, err := readOptionalCgroupValue(path.Join(memoryDir, cgroupV1MemSwapFile))
+	if err != nil {
+		return stats, aoserrors.Wrap(err)
+	}
+
+	if memSwap > stats.ram {
+		stats.swap = memSwap - stats.ram
+	}
+
+	if stats.pids, err = readOptionalCgroupValue(
+		path.Join(cgroupRoot, cgroupV1PidsController, cgroupPath, cgroupV1PidsFile)); err != nil {
+		return stats, aoserrors.Wrap(err)
+	}
+
+	if stats.ioRead, stats.ioWrite, err = readCgroupV1IOServiceBytes(
+		path.Join(cgroupRoot, cgroupV1BlkioController, cgroupPath, cgroupV1IOServiceFile)); err != nil {
+		return stats, aoserrors.Wrap(err)
+	}
+
+	return stats, nil
+}
+
+func readCgroupValue(fileName string) (value uint64, err error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	valueStr := strings.TrimSpace(string(data))
+
+	// pids.max and memory.max may contain "max" instead of value
+	if valueStr == "max" {
+		return 0, nil
+	}
+
+	if value, err = strconv.ParseUint(valueStr, 10, 64); err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	return value, nil
+}
+
+func readOptionalCgroupValue(fileName string) (value uint64, err error) {
+	if value, err = readCgroupValue(fileName); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return value, nil
+}
+
+// readCgroupKeyValues parses flat keyed files like cpu.stat: "<key> <value>" per line
+func readCgroupKeyValues(fileName string) (values map[string]uint64, err error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	values = make(map[string]uint64)
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		values[fields[0]] = value
+	}
+
+	return values, aoserrors.Wrap(scanner.Err())
+}
+
+// readCgroupV2IOStat parses io.stat: "<major>:<minor> rbytes=<value> wbytes=<value> ..." per device
+func readCgroupV2IOStat(fileName string) (readBytes, writeBytes uint64, err error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+
+		return 0, 0, aoserrors.Wrap(err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		for _, field := range fields[1:] {
+			keyValue := strings.SplitN(field, "=", 2)
+			if len(keyValue) != 2 {
+				continue
+			}
+
+			value, err := strconv.ParseUint(keyValue[1], 10, 64)
+			if err != nil {
+				return 0, 0, aoserrors.Wrap(err)
+			}
+
+			switch keyValue[0] {
+			case "rbytes":
+				readBytes += value
+
+			case "wbytes":
+				writeBytes += value
+			}
+		}
+	}
+
+	return readBytes, writeBytes, nil
+}
+
+// readCgroupV1IOServiceBytes parses blkio.throttle.io_service_bytes: "<major>:<minor> <op> <value>" per line
+func readCgroupV1IOServiceBytes(fileName string) (readBytes, writeBytes uint64, err error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+
+		return 0, 0, aoserrors.Wrap(err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return 0, 0, aoserrors.Wrap(err)
+		}
+
+		switch fields[1] {
+		case "Read":
+			readBytes += value
+
+		case "Write":
+			writeBytes += value
+		}
+	}
+
+	return readBytes, writeBytes, nil
+}
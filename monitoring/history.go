@@ -0,0 +1,245 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoring
+
+import (
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+// History levels
+const (
+	historyLevelRaw = iota
+	historyLevelDownsampled
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// HistorySample monitoring history sample. Service monitoring data is reported with service ID, InstanceIDs
+// contains instance ID of each service monitoring entry to distinguish instances of the same service.
+type HistorySample struct {
+	Data        *pb.Monitoring
+	InstanceIDs []string
+}
+
+// HistoryStorage provides API to store monitoring history.
+type HistoryStorage interface {
+	AddMonitoringData(level int, sample HistorySample, maxSamples uint64) (err error)
+	GetMonitoringData(level int, from, till time.Time) (samples []HistorySample, err error)
+}
+
+type historyDownsampler struct {
+	periodStart time.Time
+	samples     []HistorySample
+}
+
+type serviceAccumulator struct {
+	data  pb.ServiceMonitoring
+	count uint64
+}
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// GetMonitoringHistory returns monitoring history within time range. Downsampled samples are used for
+// the part of range which is not covered by raw samples. If serviceID is not empty, only monitoring data
+// of this service is returned.
+func (monitor *Monitor) GetMonitoringHistory(
+	serviceID string, from, till time.Time) (history []*pb.Monitoring, err error) {
+	if monitor.historyStorage == nil {
+		return nil, aoserrors.New("monitoring history is not available")
+	}
+
+	rawData, err := monitor.historyStorage.GetMonitoringData(historyLevelRaw, from, till)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	downsampledTill := till
+
+	if len(rawData) > 0 {
+		downsampledTill = rawData[0].Data.GetTimestamp().AsTime()
+	}
+
+	downsampledData, err := monitor.historyStorage.GetMonitoringData(historyLevelDownsampled, from, downsampledTill)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	history = make([]*pb.Monitoring, 0, len(downsampledData)+len(rawData))
+
+	for _, sample := range downsampledData {
+		if len(rawData) > 0 && !sample.Data.GetTimestamp().AsTime().Before(downsampledTill) {
+			continue
+		}
+
+		history = append(history, sample.Data)
+	}
+
+	for _, sample := range rawData {
+		history = append(history, sample.Data)
+	}
+
+	if serviceID != "" {
+		for _, sample := range history {
+			sample.ServiceMonitoring = filterServiceMonitoring(sample.GetServiceMonitoring(), serviceID)
+		}
+	}
+
+	return history, nil
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func (monitor *Monitor) storeHistory(sample HistorySample) {
+	if monitor.historyStorage == nil || monitor.config.History.MaxSamples == 0 {
+		return
+	}
+
+	if err := monitor.historyStorage.AddMonitoringData(
+		historyLevelRaw, sample, monitor.config.History.MaxSamples); err != nil {
+		log.Errorf("Can't store monitoring history: %s", err)
+	}
+
+	if monitor.config.History.DownsamplePeriod.Duration == 0 || monitor.config.History.MaxDownsampledSamples == 0 {
+		return
+	}
+
+	monitor.historyMutex.Lock()
+	defer monitor.historyMutex.Unlock()
+
+	periodStart := sample.Data.GetTimestamp().AsTime().Truncate(monitor.config.History.DownsamplePeriod.Duration)
+
+	if !periodStart.Equal(monitor.downsampler.periodStart) {
+		monitor.flushHistory()
+	}
+
+	monitor.downsampler.periodStart = periodStart
+	monitor.downsampler.samples = append(monitor.downsampler.samples, sample)
+}
+
+// flushHistory stores average of the open downsample period, history mutex should be locked
+func (monitor *Monitor) flushHistory() {
+	if monitor.historyStorage == nil || len(monitor.downsampler.samples) == 0 {
+		return
+	}
+
+	if err := monitor.historyStorage.AddMonitoringData(historyLevelDownsampled,
+		averageMonitoringData(monitor.downsampler.periodStart, monitor.downsampler.samples),
+		monitor.config.History.MaxDownsampledSamples); err != nil {
+		log.Errorf("Can't store downsampled monitoring history: %s", err)
+	}
+
+	monitor.downsampler.samples = nil
+}
+
+// averageMonitoringData calculates average values of samples. Service values are averaged per instance ID.
+func averageMonitoringData(timestamp time.Time, samples []HistorySample) (average HistorySample) {
+	var system pb.SystemMonitoring
+
+	instances := make(map[string]*serviceAccumulator)
+	instanceIDs := make([]string, 0)
+
+	for _, sample := range samples {
+		system.Ram += sample.Data.GetSystemMonitoring().GetRam()
+		system.Cpu += sample.Data.GetSystemMonitoring().GetCpu()
+		system.UsedDisk += sample.Data.GetSystemMonitoring().GetUsedDisk()
+		system.InTraffic += sample.Data.GetSystemMonitoring().GetInTraffic()
+		system.OutTraffic += sample.Data.GetSystemMonitoring().GetOutTraffic()
+
+		for i, service := range sample.Data.GetServiceMonitoring() {
+			// samples without instance IDs are averaged per service ID
+			instanceID := service.GetServiceId()
+
+			if i < len(sample.InstanceIDs) {
+				instanceID = sample.InstanceIDs[i]
+			}
+
+			accumulator, ok := instances[instanceID]
+			if !ok {
+				accumulator = &serviceAccumulator{}
+				accumulator.data.ServiceId = service.GetServiceId()
+
+				instances[instanceID] = accumulator
+				instanceIDs = append(instanceIDs, instanceID)
+			}
+
+			accumulator.data.Ram += service.GetRam()
+			accumulator.data.Cpu += service.GetCpu()
+			accumulator.data.UsedDisk += service.GetUsedDisk()
+			accumulator.data.InTraffic += service.GetInTraffic()
+			accumulator.data.OutTraffic += service.GetOutTraffic()
+			accumulator.count++
+		}
+	}
+
+	count := uint64(len(samples))
+
+	data := &pb.Monitoring{
+		Timestamp: timestamppb.New(timestamp),
+		SystemMonitoring: &pb.SystemMonitoring{
+			Ram:        system.Ram / count,
+			Cpu:        system.Cpu / count,
+			UsedDisk:   system.UsedDisk / count,
+			InTraffic:  system.InTraffic / count,
+			OutTraffic: system.OutTraffic / count,
+		},
+		ServiceMonitoring: make([]*pb.ServiceMonitoring, 0, len(instanceIDs)),
+	}
+
+	for _, instanceID := range instanceIDs {
+		accumulator := instances[instanceID]
+
+		data.ServiceMonitoring = append(data.ServiceMonitoring, &pb.ServiceMonitoring{
+			ServiceId:  accumulator.data.ServiceId,
+			Ram:        accumulator.data.Ram / accumulator.count,
+			Cpu:        accumulator.data.Cpu / accumulator.count,
+			UsedDisk:   accumulator.data.UsedDisk / accumulator.count,
+			InTraffic:  accumulator.data.InTraffic / accumulator.count,
+			OutTraffic: accumulator.data.OutTraffic / accumulator.count,
+		})
+	}
+
+	return HistorySample{Data: data, InstanceIDs: instanceIDs}
+}
+
+func filterServiceMonitoring(
+	services []*pb.ServiceMonitoring, serviceID string) (filtered []*pb.ServiceMonitoring) {
+	filtered = make([]*pb.ServiceMonitoring, 0, 1)
+
+	for _, service := range services {
+		if service.GetServiceId() == serviceID {
+			filtered = append(filtered, service)
+		}
+	}
+
+	return filtered
+}
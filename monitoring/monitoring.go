@@ -36,7 +36,6 @@ import (
 	"github.com/shirou/gopsutil/disk"
 	"github.com/shirou/gopsutil/load"
 	"github.com/shirou/gopsutil/mem"
-	"github.com/shirou/gopsutil/process"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
@@ -81,6 +80,10 @@ type ServiceAlertRules struct {
 	UsedDisk   *config.AlertRule `json:"usedDisk,omitempty"`
 	InTraffic  *config.AlertRule `json:"inTraffic,omitempty"`
 	OutTraffic *config.AlertRule `json:"outTraffic,omitempty"`
+	Swap       *config.AlertRule `json:"swap,omitempty"`
+	Pids       *config.AlertRule `json:"pids,omitempty"`
+	IORead     *config.AlertRule `json:"ioRead,omitempty"`
+	IOWrite    *config.AlertRule `json:"ioWrite,omitempty"`
 }
 
 // Monitor instance
@@ -91,6 +94,7 @@ type Monitor struct {
 	config     config.Monitoring
 	workingDir string
 	storageDir string
+	cgroupRoot string
 
 	sendTimer *time.Ticker
 	pollTimer *time.Ticker
@@ -103,11 +107,19 @@ type Monitor struct {
 
 	serviceMap        map[string]*serviceMonitoring
 	trafficMonitoring TrafficMonitoring
+
+	historyStorage HistoryStorage
+	// separate lock as monitor lock may be held while monitoring data is sent to the channel
+	historyMutex sync.Mutex
+	downsampler  historyDownsampler
 }
 
 // ServiceMonitoringConfig contains info about service and rules for monitoring alerts
 type ServiceMonitoringConfig struct {
+	ServiceID     string
+	SubjectID     string
 	ServiceDir    string
+	CgroupPath    string
 	IPAddress     string
 	UID           uint32
 	GID           uint32
@@ -116,11 +128,35 @@ type ServiceMonitoringConfig struct {
 	ServiceRules  *ServiceAlertRules
 }
 
+// InstanceMonitoringData contains current monitoring data of service instance
+type InstanceMonitoringData struct {
+	InstanceID string
+	ServiceID  string
+	SubjectID  string
+	RAM        uint64
+	CPU        uint64
+	UsedDisk   uint64
+	InTraffic  uint64
+	OutTraffic uint64
+	Swap       uint64
+	Pids       uint64
+	IORead     uint64
+	IOWrite    uint64
+}
+
 type serviceMonitoring struct {
+	subjectID              string
 	serviceDir             string
+	cgroupPath             string
 	uid                    uint32
 	gid                    uint32
 	monitoringData         pb.ServiceMonitoring
+	swap                   uint64
+	pids                   uint64
+	ioRead                 uint64
+	ioWrite                uint64
+	prevStats              *cgroupStats
+	prevStatsTime          time.Time
 	alertProcessorElements []*list.Element
 }
 
@@ -136,20 +172,22 @@ var ErrDisabled = errors.New("monitoring is disabled")
  ******************************************************************************/
 
 // New creates new monitor instance
-func New(config *config.Config, sender MonitoringAndAlertSender, trafficMonitoring TrafficMonitoring) (monitor *Monitor, err error) {
+func New(config *config.Config, sender MonitoringAndAlertSender, trafficMonitoring TrafficMonitoring,
+	historyStorage HistoryStorage) (monitor *Monitor, err error) {
 	log.Debug("Create monitor")
 
 	if config.Monitoring.Disabled {
 		return nil, ErrDisabled
 	}
 
-	monitor = &Monitor{dataSender: sender, trafficMonitoring: trafficMonitoring}
+	monitor = &Monitor{dataSender: sender, trafficMonitoring: trafficMonitoring, historyStorage: historyStorage}
 
 	monitor.monitoringChannel = make(chan *pb.Monitoring, monitoringChannelSize)
 
 	monitor.config = config.Monitoring
 	monitor.workingDir = config.WorkingDir
 	monitor.storageDir = config.StorageDir
+	monitor.cgroupRoot = defaultCgroupRoot
 
 	monitor.alertProcessors = list.New()
 
@@ -225,35 +263,51 @@ func (monitor *Monitor) Close() {
 
 	monitor.sendTimer.Stop()
 	monitor.pollTimer.Stop()
+
+	monitor.historyMutex.Lock()
+	defer monitor.historyMutex.Unlock()
+
+	// open downsample period is kept in memory only
+	monitor.flushHistory()
 }
 
 func (monitor *Monitor) GetMonitoringDataChannel() (monitoringChannel <-chan *pb.Monitoring) {
 	return monitor.monitoringChannel
 }
 
-// StartMonitorService starts monitoring service
-func (monitor *Monitor) StartMonitorService(serviceID string, monitoringConfig ServiceMonitoringConfig) (err error) {
+// StartMonitorService starts monitoring service instance
+func (monitor *Monitor) StartMonitorService(instanceID string, monitoringConfig ServiceMonitoringConfig) (err error) {
 	monitor.Lock()
 	defer monitor.Unlock()
 
 	_, _ = load.Misc()
 
-	if _, ok := monitor.serviceMap[serviceID]; ok {
-		log.WithField("id", serviceID).Warning("Service already under monitoring")
+	if _, ok := monitor.serviceMap[instanceID]; ok {
+		log.WithField("id", instanceID).Warning("Service already under monitoring")
 		return nil
 	}
 
+	// Monitoring data and alerts are reported with service ID
+	serviceID := monitoringConfig.ServiceID
+	if serviceID == "" {
+		serviceID = instanceID
+	}
+
 	log.WithFields(log.Fields{
-		"id": serviceID,
-		"ip": monitoringConfig.IPAddress,
+		"id":        instanceID,
+		"serviceID": serviceID,
+		"subjectID": monitoringConfig.SubjectID,
+		"ip":        monitoringConfig.IPAddress,
 	}).Debug("Start service monitoring")
 
 	// convert id to hashed u64 value
 	hash := fnv.New64a()
-	hash.Write([]byte(serviceID))
+	hash.Write([]byte(instanceID))
 
 	serviceMonitoring := serviceMonitoring{
+		subjectID:  monitoringConfig.SubjectID,
 		serviceDir: monitoringConfig.ServiceDir,
+		cgroupPath: monitoringConfig.CgroupPath,
 		uid:        monitoringConfig.UID,
 		gid:        monitoringConfig.GID,
 		monitoringData: pb.ServiceMonitoring{
@@ -265,12 +319,12 @@ func (monitor *Monitor) StartMonitorService(serviceID string, monitoringConfig S
 
 	if monitor.dataSender != nil {
 		// For optimization capacity should be equals numbers of measurement values
-		// 5 - RAM, CPU, UsedDisk, InTraffic, OutTraffic
-		serviceMonitoring.alertProcessorElements = make([]*list.Element, 0, 5)
+		// 9 - RAM, CPU, UsedDisk, InTraffic, OutTraffic, Swap, Pids, IORead, IOWrite
+		serviceMonitoring.alertProcessorElements = make([]*list.Element, 0, 9)
 
 		if rules != nil && rules.CPU != nil {
 			e := monitor.alertProcessors.PushBack(createAlertProcessor(
-				serviceID+" CPU",
+				instanceID+" CPU",
 				&serviceMonitoring.monitoringData.Cpu,
 				func(time time.Time, value uint64) {
 					monitor.dataSender.SendResourceAlert(serviceID, "cpu", time, value)
@@ -282,7 +336,7 @@ func (monitor *Monitor) StartMonitorService(serviceID string, monitoringConfig S
 
 		if rules != nil && rules.RAM != nil {
 			e := monitor.alertProcessors.PushBack(createAlertProcessor(
-				serviceID+" RAM",
+				instanceID+" RAM",
 				&serviceMonitoring.monitoringData.Ram,
 				func(time time.Time, value uint64) {
 					monitor.dataSender.SendResourceAlert(serviceID, "ram", time, value)
@@ -294,7 +348,7 @@ func (monitor *Monitor) StartMonitorService(serviceID string, monitoringConfig S
 
 		if rules != nil && rules.UsedDisk != nil {
 			e := monitor.alertProcessors.PushBack(createAlertProcessor(
-				serviceID+" Disk",
+				instanceID+" Disk",
 				&serviceMonitoring.monitoringData.UsedDisk,
 				func(time time.Time, value uint64) {
 					monitor.dataSender.SendResourceAlert(serviceID, "disk", time, value)
@@ -306,7 +360,7 @@ func (monitor *Monitor) StartMonitorService(serviceID string, monitoringConfig S
 
 		if rules != nil && rules.InTraffic != nil {
 			e := monitor.alertProcessors.PushBack(createAlertProcessor(
-				serviceID+" Traffic IN",
+				instanceID+" Traffic IN",
 				&serviceMonitoring.monitoringData.InTraffic,
 				func(time time.Time, value uint64) {
 					monitor.dataSender.SendResourceAlert(serviceID, "inTraffic", time, value)
@@ -318,7 +372,7 @@ func (monitor *Monitor) StartMonitorService(serviceID string, monitoringConfig S
 
 		if rules != nil && rules.OutTraffic != nil {
 			e := monitor.alertProcessors.PushBack(createAlertProcessor(
-				serviceID+" Traffic OUT",
+				instanceID+" Traffic OUT",
 				&serviceMonitoring.monitoringData.OutTraffic,
 				func(time time.Time, value uint64) {
 					monitor.dataSender.SendResourceAlert(serviceID, "outTraffic", time, value)
@@ -327,33 +381,116 @@ func (monitor *Monitor) StartMonitorService(serviceID string, monitoringConfig S
 
 			serviceMonitoring.alertProcessorElements = append(serviceMonitoring.alertProcessorElements, e)
 		}
+
+		if rules != nil && rules.Swap != nil {
+			e := monitor.alertProcessors.PushBack(createAlertProcessor(
+				instanceID+" Swap",
+				&serviceMonitoring.swap,
+				func(time time.Time, value uint64) {
+					monitor.dataSender.SendResourceAlert(serviceID, "swap", time, value)
+				},
+				*rules.Swap))
+
+			serviceMonitoring.alertProcessorElements = append(serviceMonitoring.alertProcessorElements, e)
+		}
+
+		if rules != nil && rules.Pids != nil {
+			e := monitor.alertProcessors.PushBack(createAlertProcessor(
+				instanceID+" Pids",
+				&serviceMonitoring.pids,
+				func(time time.Time, value uint64) {
+					monitor.dataSender.SendResourceAlert(serviceID, "pids", time, value)
+				},
+				*rules.Pids))
+
+			serviceMonitoring.alertProcessorElements = append(serviceMonitoring.alertProcessorElements, e)
+		}
+
+		if rules != nil && rules.IORead != nil {
+			e := monitor.alertProcessors.PushBack(createAlertProcessor(
+				instanceID+" IO Read",
+				&serviceMonitoring.ioRead,
+				func(time time.Time, value uint64) {
+					monitor.dataSender.SendResourceAlert(serviceID, "ioRead", time, value)
+				},
+				*rules.IORead))
+
+			serviceMonitoring.alertProcessorElements = append(serviceMonitoring.alertProcessorElements, e)
+		}
+
+		if rules != nil && rules.IOWrite != nil {
+			e := monitor.alertProcessors.PushBack(createAlertProcessor(
+				instanceID+" IO Write",
+				&serviceMonitoring.ioWrite,
+				func(time time.Time, value uint64) {
+					monitor.dataSender.SendResourceAlert(serviceID, "ioWrite", time, value)
+				},
+				*rules.IOWrite))
+
+			serviceMonitoring.alertProcessorElements = append(serviceMonitoring.alertProcessorElements, e)
+		}
 	}
 
-	monitor.serviceMap[serviceID] = &serviceMonitoring
+	monitor.serviceMap[instanceID] = &serviceMonitoring
 
 	return nil
 }
 
-// StopMonitorService stops monitoring service
-func (monitor *Monitor) StopMonitorService(serviceID string) (err error) {
+// StopMonitorService stops monitoring service instance
+func (monitor *Monitor) StopMonitorService(instanceID string) (err error) {
 	monitor.Lock()
 	defer monitor.Unlock()
 
-	log.WithField("id", serviceID).Debug("Stop service monitoring")
+	log.WithField("id", instanceID).Debug("Stop service monitoring")
 
-	if _, ok := monitor.serviceMap[serviceID]; !ok {
+	if _, ok := monitor.serviceMap[instanceID]; !ok {
 		return nil
 	}
 
-	for _, e := range monitor.serviceMap[serviceID].alertProcessorElements {
+	for _, e := range monitor.serviceMap[instanceID].alertProcessorElements {
 		monitor.alertProcessors.Remove(e)
 	}
 
-	delete(monitor.serviceMap, serviceID)
+	delete(monitor.serviceMap, instanceID)
 
 	return nil
 }
 
+// GetCurrentMonitoringData returns last polled system and service instances monitoring data
+func (monitor *Monitor) GetCurrentMonitoringData() (system *pb.SystemMonitoring, instances []InstanceMonitoringData) {
+	monitor.Lock()
+	defer monitor.Unlock()
+
+	system = &pb.SystemMonitoring{
+		Ram:        monitor.currentSystemData.Ram,
+		Cpu:        monitor.currentSystemData.Cpu,
+		UsedDisk:   monitor.currentSystemData.UsedDisk,
+		InTraffic:  monitor.currentSystemData.InTraffic,
+		OutTraffic: monitor.currentSystemData.OutTraffic,
+	}
+
+	instances = make([]InstanceMonitoringData, 0, len(monitor.serviceMap))
+
+	for instanceID, service := range monitor.serviceMap {
+		instances = append(instances, InstanceMonitoringData{
+			InstanceID: instanceID,
+			ServiceID:  service.monitoringData.ServiceId,
+			SubjectID:  service.subjectID,
+			RAM:        service.monitoringData.Ram,
+			CPU:        service.monitoringData.Cpu,
+			UsedDisk:   service.monitoringData.UsedDisk,
+			InTraffic:  service.monitoringData.InTraffic,
+			OutTraffic: service.monitoringData.OutTraffic,
+			Swap:       service.swap,
+			Pids:       service.pids,
+			IORead:     service.ioRead,
+			IOWrite:    service.ioWrite,
+		})
+	}
+
+	return system, instances
+}
+
 // GetServicePid returns service PID
 func GetServicePid(servicePath string) (pid int32, err error) {
 	pidStr, err := ioutil.ReadFile(path.Join(servicePath, ".pid"))
@@ -395,16 +532,20 @@ func (monitor *Monitor) sendMonitoringData() {
 	// Update services
 	channelData := &pb.Monitoring{}
 	channelData.ServiceMonitoring = make([]*pb.ServiceMonitoring, 0, len(monitor.serviceMap))
+	instanceIDs := make([]string, 0, len(monitor.serviceMap))
 
-	for _, service := range monitor.serviceMap {
+	for instanceID, service := range monitor.serviceMap {
 		serviceMonitoringData := service.monitoringData // nolint
 		channelData.ServiceMonitoring = append(channelData.ServiceMonitoring, &serviceMonitoringData)
+		instanceIDs = append(instanceIDs, instanceID)
 	}
 
 	currentSystemMonitoring := monitor.currentSystemData // nolint
 	channelData.SystemMonitoring = &currentSystemMonitoring
 	channelData.Timestamp = timestamppb.Now()
 
+	monitor.storeHistory(HistorySample{Data: channelData, InstanceIDs: instanceIDs})
+
 	monitor.monitoringChannel <- channelData
 }
 
@@ -442,16 +583,11 @@ func (monitor *Monitor) getCurrentSystemData() {
 
 func (monitor *Monitor) getCurrentServicesData() {
 	for serviceID, value := range monitor.serviceMap {
-		cpuUsage, err := getServiceCPUUsage(int32(value.uid))
-		if err != nil {
-			log.Errorf("Can't get service CPU: %s", err)
-		}
-
-		value.monitoringData.Cpu = uint64(math.Round(cpuUsage / float64(runtime.NumCPU())))
-
-		value.monitoringData.Ram, err = getServiceRAMUsage(int32(value.uid))
+		stats, err := getCgroupStats(monitor.cgroupRoot, value.cgroupPath)
 		if err != nil {
-			log.Errorf("Can't get service RAM: %s", err)
+			log.Errorf("Can't get service cgroup stats: %s", err)
+		} else {
+			value.updateCgroupData(stats, time.Now())
 		}
 
 		value.monitoringData.UsedDisk, err = getServiceDiskUsage(monitor.storageDir, value.uid, value.gid)
@@ -471,10 +607,36 @@ func (monitor *Monitor) getCurrentServicesData() {
 			"Disk": value.monitoringData.UsedDisk,
 			"IN":   value.monitoringData.InTraffic,
 			"OUT":  value.monitoringData.OutTraffic,
+			"Swap": value.swap,
+			"Pids": value.pids,
+			"IOR":  value.ioRead,
+			"IOW":  value.ioWrite,
 		}).Debug("Service monitoring data")
 	}
 }
 
+// updateCgroupData calculates CPU usage in percent and IO throughput in bytes per second
+// as difference between current and previous cgroup counters
+func (service *serviceMonitoring) updateCgroupData(stats cgroupStats, currentTime time.Time) {
+	service.monitoringData.Ram = stats.ram
+	service.swap = stats.swap
+	service.pids = stats.pids
+
+	if service.prevStats != nil {
+		if elapsed := currentTime.Sub(service.prevStatsTime); elapsed > 0 {
+			service.monitoringData.Cpu = uint64(math.Round(float64(counterDelta(stats.cpuUsage,
+				service.prevStats.cpuUsage)) * 100 / float64(elapsed.Nanoseconds()) / float64(runtime.NumCPU())))
+			service.ioRead = uint64(math.Round(float64(counterDelta(stats.ioRead,
+				service.prevStats.ioRead)) / elapsed.Seconds()))
+			service.ioWrite = uint64(math.Round(float64(counterDelta(stats.ioWrite,
+				service.prevStats.ioWrite)) / elapsed.Seconds()))
+		}
+	}
+
+	service.prevStats = &stats
+	service.prevStatsTime = currentTime
+}
+
 func (monitor *Monitor) processAlerts() {
 	currentTime := time.Now()
 
@@ -515,64 +677,6 @@ func getSystemDiskUsage(path string) (discUse uint64, err error) {
 	return v.Used, nil
 }
 
-// getServiceCPUUsage returns service CPU usage in percent
-func getServiceCPUUsage(uid int32) (cpuUse float64, err error) {
-	processes, err := process.Processes()
-	if err != nil {
-		return 0, aoserrors.Wrap(err)
-	}
-
-	for _, process := range processes {
-		uids, err := process.Uids()
-		if err != nil {
-			continue
-		}
-
-		for _, id := range uids {
-			if id == uid {
-				cpu, err := process.CPUPercent()
-				if err != nil {
-					return 0, err
-				}
-
-				cpuUse += cpu
-				break
-			}
-		}
-	}
-
-	return cpuUse, nil
-}
-
-// getServiceRAMUsage returns service RAM usage in bytes
-func getServiceRAMUsage(uid int32) (ram uint64, err error) {
-	processes, err := process.Processes()
-	if err != nil {
-		return 0, aoserrors.Wrap(err)
-	}
-
-	for _, process := range processes {
-		uids, err := process.Uids()
-		if err != nil {
-			continue
-		}
-
-		for _, id := range uids {
-			if id == uid {
-				memInfo, err := process.MemoryInfo()
-				if err != nil {
-					return 0, err
-				}
-
-				ram += memInfo.RSS
-				break
-			}
-		}
-	}
-
-	return ram, nil
-}
-
 // getServiceDiskUsage returns service disk usage in bytes
 func getServiceDiskUsage(path string, uid, gid uint32) (diskUse uint64, err error) {
 	if diskUse, err = platform.GetUserFSQuotaUsage(path, uid, gid); err != nil {
@@ -581,3 +685,12 @@ func getServiceDiskUsage(path string, uid, gid uint32) (diskUse uint64, err erro
 
 	return diskUse, nil
 }
+
+// counterDelta returns difference between counters, counter reset is treated as zero delta
+func counterDelta(current, prev uint64) (delta uint64) {
+	if current < prev {
+		return 0
+	}
+
+	return current - prev
+}
@@ -24,12 +24,17 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"reflect"
+	"runtime"
 	"testing"
 	"time"
 
 	"github.com/aoscloud/aos_common/aoserrors"
+	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
 	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/aoscloud/aos_servicemanager/config"
 	"github.com/aoscloud/aos_servicemanager/networkmanager"
@@ -66,6 +71,10 @@ type testTrafficStorage struct {
 	chainData map[string]chainData
 }
 
+type testHistoryStorage struct {
+	data map[int][]HistorySample
+}
+
 /*******************************************************************************
  * Vars
  ******************************************************************************/
@@ -146,7 +155,7 @@ func TestPeriodicReport(t *testing.T) {
 			PollPeriod: config.Duration{Duration: 1 * time.Second},
 		},
 	},
-		sender, networkManager)
+		sender, networkManager, nil)
 	if err != nil {
 		t.Fatalf("Can't create monitoring instance: %s", err)
 	}
@@ -223,7 +232,7 @@ func TestSystemAlerts(t *testing.T) {
 			},
 		},
 		sender,
-		networkManager)
+		networkManager, nil)
 	if err != nil {
 		t.Fatalf("Can't create monitoring instance: %s", err)
 	}
@@ -268,7 +277,7 @@ func TestServices(t *testing.T) {
 			},
 		},
 		sender,
-		networkManager)
+		networkManager, nil)
 	if err != nil {
 		t.Fatalf("Can't create monitoring instance: %s", err)
 	}
@@ -435,7 +444,7 @@ func TestTrafficLimit(t *testing.T) {
 				PollPeriod: config.Duration{Duration: 1 * time.Second},
 			},
 		},
-		sender, networkManager)
+		sender, networkManager, nil)
 	if err != nil {
 		t.Fatalf("Can't create monitoring instance: %s", err)
 	}
@@ -456,7 +465,7 @@ func TestTrafficLimit(t *testing.T) {
 	// Wait while .ip amd .pid files are created
 	time.Sleep(1 * time.Second)
 
-	ipAddress, err := networkManager.GetServiceIP("service1", "default")
+	ipAddress, _, err := networkManager.GetServiceIP("service1", "default")
 	if err != nil {
 		t.Fatalf("Can't get service IP: %s", err)
 	}
@@ -490,7 +499,7 @@ func TestTrafficLimit(t *testing.T) {
 		t.Fatalf("Can't start service: %s", err)
 	}
 
-	if ipAddress, err = networkManager.GetServiceIP("service1", "default"); err != nil {
+	if ipAddress, _, err = networkManager.GetServiceIP("service1", "default"); err != nil {
 		t.Fatalf("Can't get service IP: %s", err)
 	}
 
@@ -516,6 +525,195 @@ func TestTrafficLimit(t *testing.T) {
 	}
 }
 
+func TestCgroupV2Stats(t *testing.T) {
+	cgroupRoot := path.Join(tmpDir, "cgroupv2")
+	cgroupPath := "/aos/service1"
+
+	if err := writeCgroupFiles(cgroupRoot, map[string]string{
+		"cgroup.controllers":                         "cpu io memory pids",
+		path.Join(cgroupPath, "cpu.stat"):            "usage_usec 2000\nuser_usec 1500\nsystem_usec 500\n",
+		path.Join(cgroupPath, "memory.current"):      "4096\n",
+		path.Join(cgroupPath, "memory.swap.current"): "1024\n",
+		path.Join(cgroupPath, "pids.current"):        "3\n",
+		path.Join(cgroupPath, "io.stat"): "8:0 rbytes=100 wbytes=200 rios=1 wios=2\n" +
+			"8:16 rbytes=10 wbytes=20 rios=1 wios=2\n",
+	}); err != nil {
+		t.Fatalf("Can't create cgroup files: %s", err)
+	}
+
+	stats, err := getCgroupStats(cgroupRoot, cgroupPath)
+	if err != nil {
+		t.Fatalf("Can't get cgroup stats: %s", err)
+	}
+
+	expectedStats := cgroupStats{cpuUsage: 2000000, ram: 4096, swap: 1024, pids: 3, ioRead: 110, ioWrite: 220}
+
+	if stats != expectedStats {
+		t.Errorf("Wrong cgroup stats: %v", stats)
+	}
+}
+
+func TestCgroupV1Stats(t *testing.T) {
+	cgroupRoot := path.Join(tmpDir, "cgroupv1")
+	cgroupPath := "/aos/service1"
+
+	if err := writeCgroupFiles(cgroupRoot, map[string]string{
+		path.Join("cpuacct", cgroupPath, "cpuacct.usage"):              "2000000\n",
+		path.Join("memory", cgroupPath, "memory.usage_in_bytes"):       "4096\n",
+		path.Join("memory", cgroupPath, "memory.memsw.usage_in_bytes"): "5120\n",
+		path.Join("pids", cgroupPath, "pids.current"):                  "3\n",
+		path.Join("blkio", cgroupPath, "blkio.throttle.io_service_bytes"): "8:0 Read 100\n8:0 Write 200\n" +
+			"8:0 Sync 300\n8:0 Total 300\n8:16 Read 10\n8:16 Write 20\nTotal 330\n",
+	}); err != nil {
+		t.Fatalf("Can't create cgroup files: %s", err)
+	}
+
+	stats, err := getCgroupStats(cgroupRoot, cgroupPath)
+	if err != nil {
+		t.Fatalf("Can't get cgroup stats: %s", err)
+	}
+
+	expectedStats := cgroupStats{cpuUsage: 2000000, ram: 4096, swap: 1024, pids: 3, ioRead: 110, ioWrite: 220}
+
+	if stats != expectedStats {
+		t.Errorf("Wrong cgroup stats: %v", stats)
+	}
+}
+
+func TestCgroupData(t *testing.T) {
+	var service serviceMonitoring
+
+	currentTime := time.Now()
+
+	service.updateCgroupData(cgroupStats{cpuUsage: 0, ram: 4096, ioRead: 0, ioWrite: 0}, currentTime)
+
+	service.updateCgroupData(cgroupStats{
+		cpuUsage: uint64(runtime.NumCPU()) * uint64(time.Second/2), ram: 8192, ioRead: 2048, ioWrite: 4096,
+	}, currentTime.Add(time.Second))
+
+	if service.monitoringData.Cpu != 50 {
+		t.Errorf("Wrong CPU usage: %d", service.monitoringData.Cpu)
+	}
+
+	if service.monitoringData.Ram != 8192 {
+		t.Errorf("Wrong RAM usage: %d", service.monitoringData.Ram)
+	}
+
+	if service.ioRead != 2048 || service.ioWrite != 4096 {
+		t.Errorf("Wrong IO throughput: %d, %d", service.ioRead, service.ioWrite)
+	}
+}
+
+func TestMonitoringHistory(t *testing.T) {
+	storage := &testHistoryStorage{data: make(map[int][]HistorySample)}
+
+	monitor := &Monitor{
+		config: config.Monitoring{History: config.MonitoringHistory{
+			MaxSamples:            4,
+			DownsamplePeriod:      config.Duration{Duration: 2 * time.Minute},
+			MaxDownsampledSamples: 10,
+		}},
+		historyStorage: storage,
+	}
+
+	startTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 10; i++ {
+		monitor.storeHistory(HistorySample{
+			Data: &pb.Monitoring{
+				Timestamp:        timestamppb.New(startTime.Add(time.Duration(i) * time.Minute)),
+				SystemMonitoring: &pb.SystemMonitoring{Cpu: uint64(i * 10)},
+				ServiceMonitoring: []*pb.ServiceMonitoring{
+					{ServiceId: "service1", Ram: uint64(i * 100)},
+					{ServiceId: "service2", Ram: uint64(i * 200)},
+				},
+			},
+			InstanceIDs: []string{"instance1", "instance2"},
+		})
+	}
+
+	history, err := monitor.GetMonitoringHistory("service1", startTime, startTime.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Can't get monitoring history: %s", err)
+	}
+
+	// 3 downsampled samples (0-1, 2-3, 4-5 min) and 4 raw samples (6-9 min)
+	expectedCPU := []uint64{5, 25, 45, 60, 70, 80, 90}
+
+	if len(history) != len(expectedCPU) {
+		t.Fatalf("Wrong history samples count: %d", len(history))
+	}
+
+	for i, sample := range history {
+		if sample.GetSystemMonitoring().GetCpu() != expectedCPU[i] {
+			t.Errorf("Wrong system CPU: %d", sample.GetSystemMonitoring().GetCpu())
+		}
+
+		if len(sample.GetServiceMonitoring()) != 1 || sample.GetServiceMonitoring()[0].GetServiceId() != "service1" {
+			t.Fatalf("Wrong service monitoring: %v", sample.GetServiceMonitoring())
+		}
+
+		if sample.GetServiceMonitoring()[0].GetRam() != expectedCPU[i]*10 {
+			t.Errorf("Wrong service RAM: %d", sample.GetServiceMonitoring()[0].GetRam())
+		}
+	}
+}
+
+func TestMonitoringHistoryInstances(t *testing.T) {
+	storage := &testHistoryStorage{data: make(map[int][]HistorySample)}
+
+	monitor := &Monitor{
+		config: config.Monitoring{History: config.MonitoringHistory{
+			MaxSamples:            10,
+			DownsamplePeriod:      config.Duration{Duration: time.Hour},
+			MaxDownsampledSamples: 10,
+		}},
+		historyStorage: storage,
+		pollTimer:      time.NewTicker(time.Hour),
+		sendTimer:      time.NewTicker(time.Hour),
+	}
+
+	startTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// instances of the same service for different subjects
+	for i := 0; i < 2; i++ {
+		monitor.storeHistory(HistorySample{
+			Data: &pb.Monitoring{
+				Timestamp: timestamppb.New(startTime.Add(time.Duration(i) * time.Minute)),
+				ServiceMonitoring: []*pb.ServiceMonitoring{
+					{ServiceId: "service1", Ram: uint64(100 + i*10)},
+					{ServiceId: "service1", Ram: uint64(1000 + i*10)},
+				},
+			},
+			InstanceIDs: []string{"instance1", "instance2"},
+		})
+	}
+
+	if len(storage.data[historyLevelDownsampled]) != 0 {
+		t.Fatal("Open downsample period should not be stored")
+	}
+
+	// open downsample period is stored on close
+	monitor.Close()
+
+	if len(storage.data[historyLevelDownsampled]) != 1 {
+		t.Fatalf("Wrong downsampled samples count: %d", len(storage.data[historyLevelDownsampled]))
+	}
+
+	sample := storage.data[historyLevelDownsampled][0]
+
+	if !reflect.DeepEqual(sample.InstanceIDs, []string{"instance1", "instance2"}) {
+		t.Errorf("Wrong instance IDs: %v", sample.InstanceIDs)
+	}
+
+	services := sample.Data.GetServiceMonitoring()
+
+	if len(services) != 2 || services[0].GetServiceId() != "service1" || services[0].GetRam() != 105 ||
+		services[1].GetServiceId() != "service1" || services[1].GetRam() != 1005 {
+		t.Errorf("Wrong service monitoring: %v", services)
+	}
+}
+
 /*******************************************************************************
  * Interfaces
  ******************************************************************************/
@@ -524,6 +722,30 @@ func (instance *testSender) SendResourceAlert(source, resource string, time time
 	instance.callback(source, resource, time, value)
 }
 
+func (storage *testHistoryStorage) AddMonitoringData(
+	level int, sample HistorySample, maxSamples uint64) (err error) {
+	storage.data[level] = append(storage.data[level], sample)
+
+	if len(storage.data[level]) > int(maxSamples) {
+		storage.data[level] = storage.data[level][len(storage.data[level])-int(maxSamples):]
+	}
+
+	return nil
+}
+
+func (storage *testHistoryStorage) GetMonitoringData(
+	level int, from, till time.Time) (samples []HistorySample, err error) {
+	for _, sample := range storage.data[level] {
+		if !sample.Data.GetTimestamp().AsTime().Before(from) && !sample.Data.GetTimestamp().AsTime().After(till) {
+			samples = append(samples, HistorySample{
+				Data: proto.Clone(sample.Data).(*pb.Monitoring), InstanceIDs: sample.InstanceIDs,
+			})
+		}
+	}
+
+	return samples, nil
+}
+
 func (storage *testTrafficStorage) SetTrafficMonitorData(chain string, timestamp time.Time, value uint64) (err error) {
 	storage.chainData[chain] = chainData{timestamp, value}
 
@@ -562,7 +784,7 @@ func setup() (err error) {
 		return aoserrors.Wrap(err)
 	}
 
-	if networkManager, err = networkmanager.New(&config.Config{WorkingDir: tmpDir}, &trafficStorage); err != nil {
+	if networkManager, err = networkmanager.New(&config.Config{WorkingDir: tmpDir}, &trafficStorage, nil); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
@@ -706,3 +928,17 @@ func runContainerWait(containerID string, cmd *exec.Cmd) (err error) {
 
 	return aoserrors.Wrap(err)
 }
+
+func writeCgroupFiles(cgroupRoot string, files map[string]string) (err error) {
+	for fileName, content := range files {
+		if err = os.MkdirAll(path.Dir(path.Join(cgroupRoot, fileName)), 0o755); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if err = ioutil.WriteFile(path.Join(cgroupRoot, fileName), []byte(content), 0o600); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return nil
+}
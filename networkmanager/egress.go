@@ -0,0 +1,1030 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networkmanager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/coreos/go-iptables/iptables"
+	log "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/sys/unix"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+const (
+	// DNS queries of services with egress policy are redirected to the proxy port on SP bridge gateway
+	dnsProxyPort    = 5053
+	dnsUpstreamPort = 53
+	dnsTimeout      = 5 * time.Second
+	dnsMaxSize      = 65535
+	// max number of DNS queries and TCP connections handled concurrently by one proxy, others are dropped
+	dnsMaxConcurrentQueries = 64
+	// resolved addresses are kept in egress set at least for this time (seconds)
+	egressMinTTL = 60
+	// default egress set entry timeout (seconds)
+	egressSetTimeout = 3600
+	// period to check denied connections counters
+	egressCheckPeriod = 10 * time.Second
+	// size of egress alert channel
+	egressAlertChannelSize = 32
+	// ipset IPv6 address attribute, vendored netlink supports IPv4 sets only
+	ipsetAttrIPAddrIPv6 = 2
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// EgressPolicy service outbound connections allowlist. Hosts are FQDNs, "*." prefix allows subdomains.
+// Networks are CIDRs. Connections to service networks are always allowed.
+type EgressPolicy struct {
+	Hosts    []string
+	Networks []string
+}
+
+// EgressAlert denied service outbound connection
+type EgressAlert struct {
+	ServiceID string
+	Message   string
+}
+
+type egressFilter struct {
+	sync.Mutex
+	iptables  *iptables.IPTables
+	ip6tables *iptables.IPTables
+	// connections to services of other providers are controlled by allowed connections
+	serviceNetworks []string
+	services        map[string]*egressService
+	proxies         map[string]*dnsProxy
+	// names resolved by SP network DNS: SP ID -> service ID -> host names
+	localHosts     map[string]map[string][]string
+	alertChannel   chan EgressAlert
+	stopChannel    chan struct{}
+	checkWaitGroup sync.WaitGroup
+}
+
+type egressService struct {
+	serviceID      string
+	spID           string
+	ip             string
+	ipv6           string
+	hosts          []string
+	chain          string
+	natChain       string
+	setName        string
+	setNameIPv6    string
+	droppedPackets uint64
+}
+
+type dnsProxy struct {
+	spID        string
+	upstream    string
+	udpConn     *net.UDPConn
+	tcpListener *net.TCPListener
+	filter      *egressFilter
+	closed      chan struct{}
+	semaphore   chan struct{}
+}
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// GetEgressAlertChannel returns channel of denied outbound connections of services with egress policy
+func (manager *NetworkManager) GetEgressAlertChannel() (channel <-chan EgressAlert) {
+	if manager.egressFilter == nil {
+		return nil
+	}
+
+	return manager.egressFilter.alertChannel
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func (manager *NetworkManager) setupServiceEgress(serviceID, spID string, result *current.Result,
+	params *NetworkParams) (err error) {
+	policy := params.EgressPolicy
+
+	if manager.egressFilter != nil {
+		// dnsname plugin resolves pod name, hostname and aliases within SP network
+		manager.egressFilter.setLocalHosts(serviceID, spID,
+			append([]string{serviceID, params.Hostname}, params.Aliases...))
+	}
+
+	if policy == nil {
+		if manager.egressFilter == nil {
+			return nil
+		}
+
+		return manager.egressFilter.deleteServicePolicy(serviceID)
+	}
+
+	if manager.egressFilter == nil {
+		return aoserrors.New("egress filter is not available")
+	}
+
+	serviceIP, serviceIPv6 := getResultIPConfigs(result)
+	if serviceIP == nil || serviceIP.Gateway == nil {
+		return aoserrors.Errorf("service %s has no IPv4 gateway", serviceID)
+	}
+
+	return manager.egressFilter.addService(serviceID, spID, serviceIP, serviceIPv6, policy)
+}
+
+func newEgressFilter(poolNetworks []*networkToSplit, ipv6 bool) (filter *egressFilter, err error) {
+	filter = &egressFilter{
+		services:     make(map[string]*egressService),
+		proxies:      make(map[string]*dnsProxy),
+		localHosts:   make(map[string]map[string][]string),
+		alertChannel: make(chan EgressAlert, egressAlertChannelSize),
+		stopChannel:  make(chan struct{}),
+	}
+
+	for _, poolNetwork := range poolNetworks {
+		filter.serviceNetworks = append(filter.serviceNetworks, poolNetwork.ipSubNet)
+	}
+
+	if filter.iptables, err = iptables.NewWithProtocol(iptables.ProtocolIPv4); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if ipv6 {
+		if filter.ip6tables, err = iptables.NewWithProtocol(iptables.ProtocolIPv6); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+	}
+
+	filter.checkWaitGroup.Add(1)
+
+	go filter.checkDeniedConnections()
+
+	return filter, nil
+}
+
+func (filter *egressFilter) close() {
+	close(filter.stopChannel)
+	filter.checkWaitGroup.Wait()
+
+	filter.Lock()
+	defer filter.Unlock()
+
+	for serviceID := range filter.services {
+		if err := filter.deleteService(serviceID); err != nil {
+			log.WithField("serviceID", serviceID).Errorf("Can't remove service egress policy: %s", err)
+		}
+	}
+}
+
+// addService applies egress policy to the service, rules left since previous start are replaced
+func (filter *egressFilter) addService(serviceID, spID string, serviceIP, serviceIPv6 *current.IPConfig,
+	policy *EgressPolicy) (err error) {
+	filter.Lock()
+	defer filter.Unlock()
+
+	log.WithFields(log.Fields{"serviceID": serviceID, "spID": spID}).Debug("Add service egress policy")
+
+	if err = filter.deleteService(serviceID); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(serviceID))
+	chainBase := "AOS_" + strconv.FormatUint(hash.Sum64(), 16)
+
+	service := &egressService{
+		serviceID: serviceID,
+		spID:      spID,
+		ip:        serviceIP.Address.IP.String(),
+		chain:     chainBase + "_EGRESS",
+		natChain:  chainBase + "_DNS",
+		setName:   chainBase + "_EGRESS",
+	}
+
+	if filter.ip6tables != nil && serviceIPv6 != nil {
+		service.ipv6 = serviceIPv6.Address.IP.String()
+		service.setNameIPv6 = chainBase + "_EGRESS6"
+	}
+
+	for _, host := range policy.Hosts {
+		service.hosts = append(service.hosts, normalizeHostName(host))
+	}
+
+	var networks, ipv6Networks []string
+
+	for _, network := range policy.Networks {
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if ipNet.IP.To4() != nil {
+			networks = append(networks, ipNet.String())
+		} else {
+			ipv6Networks = append(ipv6Networks, ipNet.String())
+		}
+	}
+
+	defer func() {
+		if err != nil {
+			if removeErr := filter.removeServiceRules(service); removeErr != nil {
+				log.WithField("serviceID", serviceID).Errorf("Can't remove service egress rules: %s", removeErr)
+			}
+		}
+	}()
+
+	timeout := uint32(egressSetTimeout)
+
+	if err = netlink.IpsetCreate(service.setName, "hash:ip",
+		netlink.IpsetCreateOptions{Replace: true, Timeout: &timeout}); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	allowedNetworks := append([]string{ipNetToSubnet(serviceIP.Address)}, filter.serviceNetworks...)
+
+	if err = createEgressChain(filter.iptables, service.chain, service.ip,
+		append(allowedNetworks, networks...), service.setName); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = createDNSRedirectChain(filter.iptables, service.natChain, service.ip,
+		serviceIP.Gateway.String()); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if service.ipv6 != "" {
+		if err = ipsetCreateIPv6(service.setNameIPv6, timeout); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if err = createEgressChain(filter.ip6tables, service.chain, service.ipv6,
+			append([]string{ipNetToSubnet(serviceIPv6.Address)}, ipv6Networks...), service.setNameIPv6); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	if _, ok := filter.proxies[spID]; !ok {
+		proxy, err := newDNSProxy(filter, spID, serviceIP.Gateway)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		filter.proxies[spID] = proxy
+	}
+
+	filter.services[serviceID] = service
+
+	return nil
+}
+
+// removeService removes egress policy and local host names of the service
+func (filter *egressFilter) removeService(serviceID string) (err error) {
+	filter.Lock()
+	defer filter.Unlock()
+
+	for spID, hosts := range filter.localHosts {
+		delete(hosts, serviceID)
+
+		if len(hosts) == 0 {
+			delete(filter.localHosts, spID)
+		}
+	}
+
+	return filter.deleteService(serviceID)
+}
+
+func (filter *egressFilter) deleteServicePolicy(serviceID string) (err error) {
+	filter.Lock()
+	defer filter.Unlock()
+
+	return filter.deleteService(serviceID)
+}
+
+func (filter *egressFilter) setLocalHosts(serviceID, spID string, hosts []string) {
+	filter.Lock()
+	defer filter.Unlock()
+
+	var normalizedHosts []string
+
+	for _, host := range hosts {
+		if host != "" {
+			normalizedHosts = append(normalizedHosts, normalizeHostName(host))
+		}
+	}
+
+	if _, ok := filter.localHosts[spID]; !ok {
+		filter.localHosts[spID] = make(map[string][]string)
+	}
+
+	filter.localHosts[spID][serviceID] = normalizedHosts
+}
+
+// isLocalHost checks if host is resolved by SP network DNS: names in SP domain are never forwarded by it,
+// single label names are allowed only if they are registered in SP network.
+func (filter *egressFilter) isLocalHost(spID, host string) (result bool) {
+	if host == spID || strings.HasSuffix(host, "."+spID) {
+		return true
+	}
+
+	filter.Lock()
+	defer filter.Unlock()
+
+	for _, hosts := range filter.localHosts[spID] {
+		for _, localHost := range hosts {
+			if host == localHost {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// deleteService removes egress policy of the service, called with locked mutex
+func (filter *egressFilter) deleteService(serviceID string) (err error) {
+	service, ok := filter.services[serviceID]
+	if !ok {
+		return nil
+	}
+
+	log.WithField("serviceID", serviceID).Debug("Remove service egress policy")
+
+	delete(filter.services, serviceID)
+
+	err = filter.removeServiceRules(service)
+
+	for _, otherService := range filter.services {
+		if otherService.spID == service.spID {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	if proxy, ok := filter.proxies[service.spID]; ok {
+		proxy.close()
+
+		delete(filter.proxies, service.spID)
+	}
+
+	return aoserrors.Wrap(err)
+}
+
+func (filter *egressFilter) removeServiceRules(service *egressService) (err error) {
+	if ruleErr := deleteIPTablesChain(filter.iptables, "filter", service.chain, "FORWARD"); ruleErr != nil {
+		err = ruleErr
+	}
+
+	if ruleErr := deleteIPTablesChain(filter.iptables, "nat", service.natChain, "PREROUTING"); ruleErr != nil &&
+		err == nil {
+		err = ruleErr
+	}
+
+	if filter.ip6tables != nil {
+		if ruleErr := deleteIPTablesChain(filter.ip6tables, "filter", service.chain, "FORWARD"); ruleErr != nil &&
+			err == nil {
+			err = ruleErr
+		}
+	}
+
+	for _, setName := range []string{service.setName, service.setNameIPv6} {
+		if setName == "" {
+			continue
+		}
+
+		if setErr := netlink.IpsetDestroy(setName); setErr != nil && err == nil {
+			if _, listErr := netlink.IpsetList(setName); listErr == nil {
+				err = setErr
+			}
+		}
+	}
+
+	return aoserrors.Wrap(err)
+}
+
+func (filter *egressFilter) getServiceByIP(ip net.IP) (service *egressService) {
+	filter.Lock()
+	defer filter.Unlock()
+
+	for _, service := range filter.services {
+		if service.ip == ip.String() {
+			return service
+		}
+	}
+
+	return nil
+}
+
+func (filter *egressFilter) sendAlert(serviceID, message string) {
+	log.WithFields(log.Fields{"serviceID": serviceID}).Warnf("Egress denied: %s", message)
+
+	select {
+	case filter.alertChannel <- EgressAlert{ServiceID: serviceID, Message: message}:
+
+	default:
+		log.WithField("serviceID", serviceID).Error("Egress alert channel is full")
+	}
+}
+
+// checkDeniedConnections sends alerts when counters of egress drop rules are increased
+func (filter *egressFilter) checkDeniedConnections() {
+	defer filter.checkWaitGroup.Done()
+
+	ticker := time.NewTicker(egressCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			filter.Lock()
+
+			for _, service := range filter.services {
+				packets, err := filter.getDroppedPackets(service)
+				if err != nil {
+					log.WithField("serviceID", service.serviceID).Errorf("Can't get denied packets: %s", err)
+
+					continue
+				}
+
+				if packets > service.droppedPackets {
+					filter.sendAlert(service.serviceID,
+						fmt.Sprintf("%d outbound packets denied", packets-service.droppedPackets))
+				}
+
+				service.droppedPackets = packets
+			}
+
+			filter.Unlock()
+
+		case <-filter.stopChannel:
+			return
+		}
+	}
+}
+
+func (filter *egressFilter) getDroppedPackets(service *egressService) (packets uint64, err error) {
+	if packets, err = getChainPackets(filter.iptables, service.chain); err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	if filter.ip6tables != nil && service.ipv6 != "" {
+		ipv6Packets, err := getChainPackets(filter.ip6tables, service.chain)
+		if err != nil {
+			return 0, aoserrors.Wrap(err)
+		}
+
+		packets += ipv6Packets
+	}
+
+	return packets, nil
+}
+
+// isHostAllowed checks host name against service policy
+func (service *egressService) isHostAllowed(host string) (result bool) {
+	for _, allowedHost := range service.hosts {
+		if strings.HasPrefix(allowedHost, "*.") {
+			if strings.HasSuffix(host, allowedHost[1:]) {
+				return true
+			}
+
+			continue
+		}
+
+		if host == allowedHost {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newDNSProxy(filter *egressFilter, spID string, gateway net.IP) (proxy *dnsProxy, err error) {
+	log.WithFields(log.Fields{"spID": spID, "address": gateway}).Debug("Start DNS proxy")
+
+	proxy = &dnsProxy{
+		spID:      spID,
+		upstream:  net.JoinHostPort(gateway.String(), strconv.Itoa(dnsUpstreamPort)),
+		filter:    filter,
+		closed:    make(chan struct{}),
+		semaphore: make(chan struct{}, dnsMaxConcurrentQueries),
+	}
+
+	if proxy.udpConn, err = net.ListenUDP("udp", &net.UDPAddr{IP: gateway, Port: dnsProxyPort}); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if proxy.tcpListener, err = net.ListenTCP("tcp", &net.TCPAddr{IP: gateway, Port: dnsProxyPort}); err != nil {
+		proxy.udpConn.Close()
+
+		return nil, aoserrors.Wrap(err)
+	}
+
+	go proxy.serveUDP()
+	go proxy.serveTCP()
+
+	return proxy, nil
+}
+
+func (proxy *dnsProxy) close() {
+	log.WithField("spID", proxy.spID).Debug("Stop DNS proxy")
+
+	close(proxy.closed)
+
+	proxy.udpConn.Close()
+	proxy.tcpListener.Close()
+}
+
+func (proxy *dnsProxy) isClosed() (result bool) {
+	select {
+	case <-proxy.closed:
+		return true
+
+	default:
+		return false
+	}
+}
+
+func (proxy *dnsProxy) serveUDP() {
+	buffer := make([]byte, dnsMaxSize)
+
+	for {
+		size, addr, err := proxy.udpConn.ReadFromUDP(buffer)
+		if err != nil {
+			if proxy.isClosed() {
+				return
+			}
+
+			log.WithField("spID", proxy.spID).Errorf("Can't read DNS query: %s", err)
+
+			continue
+		}
+
+		if !proxy.acquire() {
+			log.WithField("spID", proxy.spID).Warn("Too many DNS queries, query dropped")
+
+			continue
+		}
+
+		query := append([]byte{}, buffer[:size]...)
+
+		go func() {
+			defer proxy.release()
+
+			if response := proxy.handleQuery(query, addr.IP, "udp"); response != nil {
+				if _, err := proxy.udpConn.WriteToUDP(response, addr); err != nil {
+					log.WithField("spID", proxy.spID).Errorf("Can't write DNS response: %s", err)
+				}
+			}
+		}()
+	}
+}
+
+func (proxy *dnsProxy) serveTCP() {
+	for {
+		conn, err := proxy.tcpListener.AcceptTCP()
+		if err != nil {
+			if proxy.isClosed() {
+				return
+			}
+
+			log.WithField("spID", proxy.spID).Errorf("Can't accept DNS connection: %s", err)
+
+			continue
+		}
+
+		if !proxy.acquire() {
+			log.WithField("spID", proxy.spID).Warn("Too many DNS connections, connection dropped")
+
+			conn.Close()
+
+			continue
+		}
+
+		go func() {
+			defer proxy.release()
+
+			proxy.handleTCPConnection(conn)
+		}()
+	}
+}
+
+func (proxy *dnsProxy) acquire() (result bool) {
+	select {
+	case proxy.semaphore <- struct{}{}:
+		return true
+
+	default:
+		return false
+	}
+}
+
+func (proxy *dnsProxy) release() {
+	<-proxy.semaphore
+}
+
+func (proxy *dnsProxy) handleTCPConnection(conn *net.TCPConn) {
+	defer conn.Close()
+
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+
+	for {
+		if err := conn.SetDeadline(time.Now().Add(dnsTimeout)); err != nil {
+			return
+		}
+
+		query, err := readTCPMessage(conn)
+		if err != nil {
+			return
+		}
+
+		response := proxy.handleQuery(query, addr.IP, "tcp")
+		if response == nil {
+			return
+		}
+
+		if err = writeTCPMessage(conn, response); err != nil {
+			return
+		}
+	}
+}
+
+// handleQuery refuses queries of not allowed hosts, forwards others to SP DNS server and adds resolved
+// addresses to service egress sets.
+func (proxy *dnsProxy) handleQuery(query []byte, clientIP net.IP, network string) (response []byte) {
+	var parser dnsmessage.Parser
+
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil
+	}
+
+	question, err := parser.Question()
+	if err != nil {
+		return nil
+	}
+
+	service := proxy.filter.getServiceByIP(clientIP)
+	if service == nil {
+		return makeDNSResponse(header, question, dnsmessage.RCodeRefused)
+	}
+
+	host := normalizeHostName(question.Name.String())
+	localHost := proxy.filter.isLocalHost(service.spID, host)
+
+	if !localHost && !service.isHostAllowed(host) {
+		proxy.filter.sendAlert(service.serviceID, "DNS query of not allowed host "+host)
+
+		return makeDNSResponse(header, question, dnsmessage.RCodeRefused)
+	}
+
+	if response, err = exchangeDNS(network, proxy.upstream, query); err != nil {
+		log.WithFields(log.Fields{"spID": proxy.spID, "host": host}).Errorf("Can't forward DNS query: %s", err)
+
+		return makeDNSResponse(header, question, dnsmessage.RCodeServerFailure)
+	}
+
+	if !localHost {
+		addResolvedAddresses(service, response)
+	}
+
+	return response
+}
+
+func addResolvedAddresses(service *egressService, response []byte) {
+	var parser dnsmessage.Parser
+
+	if _, err := parser.Start(response); err != nil {
+		return
+	}
+
+	if err := parser.SkipAllQuestions(); err != nil {
+		return
+	}
+
+	for {
+		answer, err := parser.AnswerHeader()
+		if err != nil {
+			return
+		}
+
+		timeout := answer.TTL
+		if timeout < egressMinTTL {
+			timeout = egressMinTTL
+		}
+
+		switch {
+		case answer.Type == dnsmessage.TypeA:
+			var resource dnsmessage.AResource
+
+			if resource, err = parser.AResource(); err != nil {
+				return
+			}
+
+			ip := net.IP(resource.A[:])
+
+			if err = netlink.IpsetAdd(service.setName,
+				&netlink.IPSetEntry{IP: ip, Timeout: &timeout, Replace: true}); err != nil {
+				log.WithFields(log.Fields{"serviceID": service.serviceID, "IP": ip}).Errorf(
+					"Can't add address to egress set: %s", err)
+			}
+
+		case answer.Type == dnsmessage.TypeAAAA && service.setNameIPv6 != "":
+			var resource dnsmessage.AAAAResource
+
+			if resource, err = parser.AAAAResource(); err != nil {
+				return
+			}
+
+			ip := net.IP(resource.AAAA[:])
+
+			if err = ipsetAddIPv6(service.setNameIPv6, ip, timeout); err != nil {
+				log.WithFields(log.Fields{"serviceID": service.serviceID, "IP": ip}).Errorf(
+					"Can't add address to egress set: %s", err)
+			}
+
+		default:
+			if err = parser.SkipAnswer(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ipsetCreateIPv6 creates inet6 hash:ip set, existing set is kept
+func ipsetCreateIPv6(setName string, timeout uint32) (err error) {
+	req := newIpsetRequest(nl.IPSET_CMD_CREATE)
+
+	req.AddData(nl.NewRtAttr(nl.IPSET_ATTR_SETNAME, nl.ZeroTerminated(setName)))
+	req.AddData(nl.NewRtAttr(nl.IPSET_ATTR_TYPENAME, nl.ZeroTerminated("hash:ip")))
+	req.AddData(nl.NewRtAttr(nl.IPSET_ATTR_REVISION, nl.Uint8Attr(0)))
+	req.AddData(nl.NewRtAttr(nl.IPSET_ATTR_FAMILY, nl.Uint8Attr(unix.AF_INET6)))
+
+	data := nl.NewRtAttr(nl.IPSET_ATTR_DATA|int(nl.NLA_F_NESTED), nil)
+	data.AddChild(&nl.Uint32Attribute{Type: nl.IPSET_ATTR_TIMEOUT | nl.NLA_F_NET_BYTEORDER, Value: timeout})
+	req.AddData(data)
+
+	if _, err = req.Execute(unix.NETLINK_NETFILTER, 0); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// ipsetAddIPv6 adds address to inet6 set, existing entry timeout is updated
+func ipsetAddIPv6(setName string, ip net.IP, timeout uint32) (err error) {
+	req := newIpsetRequest(nl.IPSET_CMD_ADD)
+
+	req.AddData(nl.NewRtAttr(nl.IPSET_ATTR_SETNAME, nl.ZeroTerminated(setName)))
+
+	data := nl.NewRtAttr(nl.IPSET_ATTR_DATA|int(nl.NLA_F_NESTED), nil)
+	data.AddChild(&nl.Uint32Attribute{Type: nl.IPSET_ATTR_TIMEOUT | nl.NLA_F_NET_BYTEORDER, Value: timeout})
+
+	address := nl.NewRtAttr(ipsetAttrIPAddrIPv6|int(nl.NLA_F_NET_BYTEORDER), ip.To16())
+	data.AddChild(nl.NewRtAttr(nl.IPSET_ATTR_IP|int(nl.NLA_F_NESTED), address.Serialize()))
+	data.AddChild(&nl.Uint32Attribute{Type: nl.IPSET_ATTR_LINENO | nl.NLA_F_NET_BYTEORDER, Value: 0})
+	req.AddData(data)
+
+	if _, err = req.Execute(unix.NETLINK_NETFILTER, 0); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func newIpsetRequest(cmd int) (req *nl.NetlinkRequest) {
+	req = nl.NewNetlinkRequest(cmd|(unix.NFNL_SUBSYS_IPSET<<8), nl.GetIpsetFlags(cmd))
+
+	req.AddData(&nl.Nfgenmsg{NfgenFamily: uint8(unix.AF_NETLINK), Version: nl.NFNETLINK_V0})
+	req.AddData(nl.NewRtAttr(nl.IPSET_ATTR_PROTOCOL, nl.Uint8Attr(nl.IPSET_PROTOCOL)))
+
+	return req
+}
+
+func makeDNSResponse(header dnsmessage.Header, question dnsmessage.Question,
+	rcode dnsmessage.RCode) (response []byte) {
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 header.ID,
+		Response:           true,
+		OpCode:             header.OpCode,
+		RecursionDesired:   header.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              rcode,
+	})
+
+	if err := builder.StartQuestions(); err != nil {
+		return nil
+	}
+
+	if err := builder.Question(question); err != nil {
+		return nil
+	}
+
+	response, err := builder.Finish()
+	if err != nil {
+		return nil
+	}
+
+	return response
+}
+
+func exchangeDNS(network, address string, query []byte) (response []byte, err error) {
+	conn, err := net.DialTimeout(network, address, dnsTimeout)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(dnsTimeout)); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	if network == "tcp" {
+		if err = writeTCPMessage(conn, query); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		return readTCPMessage(conn)
+	}
+
+	if _, err = conn.Write(query); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	buffer := make([]byte, dnsMaxSize)
+
+	size, err := conn.Read(buffer)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return buffer[:size], nil
+}
+
+// DNS over TCP messages are prefixed with two bytes length
+func readTCPMessage(reader io.Reader) (message []byte, err error) {
+	var size uint16
+
+	if err = binary.Read(reader, binary.BigEndian, &size); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	message = make([]byte, size)
+
+	if _, err = io.ReadFull(reader, message); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return message, nil
+}
+
+func writeTCPMessage(writer io.Writer, message []byte) (err error) {
+	data := make([]byte, 2, 2+len(message))
+
+	binary.BigEndian.PutUint16(data, uint16(len(message)))
+
+	if _, err = writer.Write(append(data, message...)); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func createEgressChain(ipt *iptables.IPTables, chain, address string, allowedNetworks []string,
+	setName string) (err error) {
+	if err = ipt.ClearChain("filter", chain); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	rules := [][]string{
+		{"!", "-s", address, "-j", "RETURN"},
+		{"-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "RETURN"},
+	}
+
+	for _, network := range allowedNetworks {
+		rules = append(rules, []string{"-d", network, "-j", "RETURN"})
+	}
+
+	if setName != "" {
+		rules = append(rules, []string{"-m", "set", "--match-set", setName, "dst", "-j", "RETURN"})
+	}
+
+	// the last rule counts denied packets
+	rules = append(rules, []string{"-j", "DROP"})
+
+	for _, rule := range rules {
+		if err = ipt.Append("filter", chain, rule...); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	if err = deleteAllRules(ipt, "filter", "FORWARD", "-j", chain); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = ipt.Insert("filter", "FORWARD", 1, "-j", chain); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func createDNSRedirectChain(ipt *iptables.IPTables, chain, address, gateway string) (err error) {
+	if err = ipt.ClearChain("nat", chain); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	for _, protocol := range []string{"udp", "tcp"} {
+		if err = ipt.Append("nat", chain, "-s", address, "-d", gateway, "-p", protocol,
+			"--dport", strconv.Itoa(dnsUpstreamPort), "-j", "DNAT",
+			"--to-destination", net.JoinHostPort(gateway, strconv.Itoa(dnsProxyPort))); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	if err = deleteAllRules(ipt, "nat", "PREROUTING", "-j", chain); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = ipt.Insert("nat", "PREROUTING", 1, "-j", chain); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+func getChainPackets(ipt *iptables.IPTables, chain string) (value uint64, err error) {
+	stats, err := ipt.ListWithCounters("filter", chain)
+	if err != nil {
+		return 0, aoserrors.Wrap(err)
+	}
+
+	if len(stats) > 0 {
+		items := strings.Fields(stats[len(stats)-1])
+		for i, item := range items {
+			if item == "-c" && len(items) >= i+3 {
+				return strconv.ParseUint(items[i+1], 10, 64)
+			}
+		}
+	}
+
+	return 0, aoserrors.New("statistic for chain not found")
+}
+
+func getResultIPConfigs(result *current.Result) (ipConfig, ipv6Config *current.IPConfig) {
+	for _, resultIPConfig := range result.IPs {
+		if resultIPConfig.Address.IP.To4() != nil {
+			if ipConfig == nil {
+				ipConfig = resultIPConfig
+			}
+
+			continue
+		}
+
+		if ipv6Config == nil {
+			ipv6Config = resultIPConfig
+		}
+	}
+
+	return ipConfig, ipv6Config
+}
+
+func ipNetToSubnet(address net.IPNet) (subnet string) {
+	return (&net.IPNet{IP: address.IP.Mask(address.Mask), Mask: address.Mask}).String()
+}
+
+func normalizeHostName(host string) (normalized string) {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networkmanager
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestEgressHostAllowed(t *testing.T) {
+	service := &egressService{
+		spID:  "sp1",
+		hosts: []string{normalizeHostName("Example.com."), "*.example.org"},
+	}
+
+	testData := []struct {
+		host    string
+		allowed bool
+	}{
+		{host: "example.com", allowed: true},
+		{host: "www.example.com", allowed: false},
+		{host: "api.example.org", allowed: true},
+		{host: "a.b.example.org", allowed: true},
+		{host: "example.org", allowed: false},
+		{host: "badexample.org", allowed: false},
+		{host: "service1.sp1", allowed: false},
+	}
+
+	for _, item := range testData {
+		if allowed := service.isHostAllowed(item.host); allowed != item.allowed {
+			t.Errorf("Wrong host %s allowed result: %v", item.host, allowed)
+		}
+	}
+}
+
+func TestEgressLocalHost(t *testing.T) {
+	filter := &egressFilter{localHosts: make(map[string]map[string][]string)}
+
+	filter.setLocalHosts("service1", "sp1", []string{"service1", "Host1", "", "alias1"})
+	filter.setLocalHosts("service2", "sp2", []string{"service2"})
+
+	testData := []struct {
+		host  string
+		local bool
+	}{
+		{host: "service1", local: true},
+		{host: "host1", local: true},
+		{host: "alias1", local: true},
+		{host: "service1.sp1", local: true},
+		{host: "any.sp1", local: true},
+		{host: "sp1", local: true},
+		{host: "service2", local: false},
+		{host: "service1.sp2", local: false},
+		{host: "unknown", local: false},
+		{host: "example.com", local: false},
+	}
+
+	for _, item := range testData {
+		if local := filter.isLocalHost("sp1", item.host); local != item.local {
+			t.Errorf("Wrong host %s local result: %v", item.host, local)
+		}
+	}
+
+	if err := filter.removeService("service1"); err != nil {
+		t.Fatalf("Can't remove service: %s", err)
+	}
+
+	if filter.isLocalHost("sp1", "host1") {
+		t.Error("Host of removed service should not be local")
+	}
+}
+
+func TestDNSProxyQuery(t *testing.T) {
+	clientIP := net.ParseIP("172.17.0.2")
+
+	filter := &egressFilter{
+		services: map[string]*egressService{"service1": {
+			serviceID: "service1", spID: "sp1", ip: clientIP.String(), hosts: []string{"example.com"},
+		}},
+		localHosts:   make(map[string]map[string][]string),
+		alertChannel: make(chan EgressAlert, egressAlertChannelSize),
+	}
+
+	proxy := &dnsProxy{spID: "sp1", filter: filter}
+
+	testData := []struct {
+		clientIP  net.IP
+		host      string
+		queryType dnsmessage.Type
+		rcode     dnsmessage.RCode
+		alert     bool
+	}{
+		{
+			clientIP: clientIP, host: "denied.com.", queryType: dnsmessage.TypeA,
+			rcode: dnsmessage.RCodeRefused, alert: true,
+		},
+		{
+			clientIP: clientIP, host: "unknown.", queryType: dnsmessage.TypeA,
+			rcode: dnsmessage.RCodeRefused, alert: true,
+		},
+		// upstream is not available in test, so allowed query fails
+		{
+			clientIP: clientIP, host: "example.com.", queryType: dnsmessage.TypeAAAA,
+			rcode: dnsmessage.RCodeServerFailure,
+		},
+		{
+			clientIP: net.ParseIP("172.17.0.3"), host: "example.com.", queryType: dnsmessage.TypeA,
+			rcode: dnsmessage.RCodeRefused,
+		},
+	}
+
+	for i, item := range testData {
+		question := dnsmessage.Question{
+			Name: dnsmessage.MustNewName(item.host), Type: item.queryType, Class: dnsmessage.ClassINET,
+		}
+
+		query := makeDNSResponse(dnsmessage.Header{ID: uint16(i)}, question, dnsmessage.RCodeSuccess)
+		if query == nil {
+			t.Fatal("Can't build DNS query")
+		}
+
+		var parser dnsmessage.Parser
+
+		header, err := parser.Start(proxy.handleQuery(query, item.clientIP, "udp"))
+		if err != nil {
+			t.Fatalf("Can't parse DNS response: %s", err)
+		}
+
+		if err = parser.SkipAllQuestions(); err != nil {
+			t.Fatalf("Can't parse DNS questions: %s", err)
+		}
+
+		answers, err := parser.AllAnswers()
+		if err != nil {
+			t.Fatalf("Can't parse DNS answers: %s", err)
+		}
+
+		if header.ID != uint16(i) || header.RCode != item.rcode || len(answers) != 0 {
+			t.Errorf("Wrong DNS response for host %s: %v", item.host, header)
+		}
+
+		select {
+		case alert := <-filter.alertChannel:
+			if !item.alert || alert.ServiceID != "service1" {
+				t.Errorf("Unexpected egress alert: %v", alert)
+			}
+
+		default:
+			if item.alert {
+				t.Errorf("Egress alert expected for host %s", item.host)
+			}
+		}
+	}
+}
+
+func TestDNSTCPMessage(t *testing.T) {
+	var buffer bytes.Buffer
+
+	if err := writeTCPMessage(&buffer, []byte("message")); err != nil {
+		t.Fatalf("Can't write TCP message: %s", err)
+	}
+
+	if buffer.Len() != len("message")+2 {
+		t.Errorf("Wrong TCP message size: %d", buffer.Len())
+	}
+
+	message, err := readTCPMessage(&buffer)
+	if err != nil {
+		t.Fatalf("Can't read TCP message: %s", err)
+	}
+
+	if string(message) != "message" {
+		t.Errorf("Wrong TCP message: %s", message)
+	}
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/aoscloud/aos_common/aoserrors"
 	log "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
 )
 
 /*******************************************************************************
@@ -32,24 +33,38 @@ import (
 type ipSubnetwork struct {
 	predefinedPrivateNetworks []*net.IPNet
 	usedIPSubnetNetworks      map[string]*net.IPNet
+	predefinedIPv6Networks    []*net.IPNet
+	usedIPv6SubnetNetworks    map[string]*net.IPNet
 }
 
 /*******************************************************************************
  * Private
  ******************************************************************************/
 
-func newIPam() (ipam *ipSubnetwork, err error) {
-	log.Debug("Create ipam allocator")
+func newIPam(poolNetworks []*networkToSplit, excludedRanges []*net.IPNet,
+	ipv6Prefix string) (ipam *ipSubnetwork, err error) {
+	log.WithField("ipv6Prefix", ipv6Prefix).Debug("Create ipam allocator")
 
 	ipam = &ipSubnetwork{}
-	if ipam.predefinedPrivateNetworks, err = makeNetPools(); err != nil {
+	if ipam.predefinedPrivateNetworks, err = makeNetPools(poolNetworks, excludedRanges); err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
 	ipam.usedIPSubnetNetworks = make(map[string]*net.IPNet)
 
+	if ipv6Prefix != "" {
+		if ipam.predefinedIPv6Networks, err = makeIPv6NetPool(ipv6Prefix, excludedRanges); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+		ipam.usedIPv6SubnetNetworks = make(map[string]*net.IPNet)
+	}
+
 	return ipam, nil
 }
 
+func (ipam *ipSubnetwork) isIPv6Enabled() (enabled bool) {
+	return ipam.usedIPv6SubnetNetworks != nil
+}
+
 func (ipam *ipSubnetwork) tryToGetExistIPNetFromPool(spID string) (allocIPNet *net.IPNet, usedIPNet bool) {
 	allocIPNet, usedIPNet = ipam.usedIPSubnetNetworks[spID]
 	if usedIPNet {
@@ -77,7 +92,43 @@ func (ipam *ipSubnetwork) requestIPNetPool(spID string) (allocIPNet *net.IPNet,
 	return allocIPNet, usedIPNet, nil
 }
 
+func (ipam *ipSubnetwork) tryToGetExistIPv6NetFromPool(spID string) (allocIPNet *net.IPNet, usedIPNet bool) {
+	allocIPNet, usedIPNet = ipam.usedIPv6SubnetNetworks[spID]
+	if usedIPNet {
+		return allocIPNet, usedIPNet
+	}
+	return nil, false
+}
+
+func (ipam *ipSubnetwork) requestIPv6NetPool(spID string) (allocIPNet *net.IPNet, err error) {
+	if !ipam.isIPv6Enabled() {
+		return nil, aoserrors.New("IPv6 is disabled")
+	}
+
+	if allocIPNet, usedIPNet := ipam.tryToGetExistIPv6NetFromPool(spID); usedIPNet {
+		return allocIPNet, nil
+	}
+
+	if len(ipam.predefinedIPv6Networks) == 0 {
+		return nil, aoserrors.Errorf("IPv6 subnet pool is empty")
+	}
+
+	if allocIPNet, ipam.predefinedIPv6Networks, err = findUnusedNetwork(
+		ipam.predefinedIPv6Networks, netlink.FAMILY_V6); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+	ipam.usedIPv6SubnetNetworks[spID] = allocIPNet
+
+	return allocIPNet, nil
+}
+
 func (ipam *ipSubnetwork) releaseIPNetPool(spID string) {
+	if ip, exist := ipam.usedIPv6SubnetNetworks[spID]; exist {
+		delete(ipam.usedIPv6SubnetNetworks, spID)
+
+		ipam.predefinedIPv6Networks = append(ipam.predefinedIPv6Networks, ip)
+	}
+
 	ip, exist := ipam.usedIPSubnetNetworks[spID]
 	if !exist {
 		return
@@ -88,18 +139,66 @@ func (ipam *ipSubnetwork) releaseIPNetPool(spID string) {
 	ipam.predefinedPrivateNetworks = append(ipam.predefinedPrivateNetworks, ip)
 }
 
+// reserveIPNetPool reserves previously allocated subnet for service provider
+func (ipam *ipSubnetwork) reserveIPNetPool(spID string, subnet *net.IPNet) (err error) {
+	usedNetworks, pool := ipam.usedIPSubnetNetworks, &ipam.predefinedPrivateNetworks
+
+	if subnet.IP.To4() == nil {
+		if !ipam.isIPv6Enabled() {
+			return aoserrors.New("IPv6 is disabled")
+		}
+
+		usedNetworks, pool = ipam.usedIPv6SubnetNetworks, &ipam.predefinedIPv6Networks
+	}
+
+	if _, ok := usedNetworks[spID]; ok {
+		return aoserrors.Errorf("service provider %s subnet is already allocated", spID)
+	}
+
+	for i, network := range *pool {
+		if network.String() == subnet.String() {
+			*pool = append((*pool)[:i], (*pool)[i+1:]...)
+			usedNetworks[spID] = network
+
+			return nil
+		}
+	}
+
+	return aoserrors.Errorf("subnet %s is not available", subnet)
+}
+
+// getOverlappedNetworks returns service providers which subnets overlap the network
+func (ipam *ipSubnetwork) getOverlappedNetworks(network *net.IPNet) (spIDs []string) {
+	for _, usedNetworks := range []map[string]*net.IPNet{ipam.usedIPSubnetNetworks, ipam.usedIPv6SubnetNetworks} {
+		for spID, subnet := range usedNetworks {
+			if isNetworkOverlaps(subnet, []*net.IPNet{network}) {
+				spIDs = append(spIDs, spID)
+			}
+		}
+	}
+
+	return spIDs
+}
+
 func (ipam *ipSubnetwork) findUnusedIPSubnetwork() (unusedIPNet *net.IPNet, err error) {
-	networks, err := getNetworkRoutes()
-	if err != nil {
+	if unusedIPNet, ipam.predefinedPrivateNetworks, err = findUnusedNetwork(
+		ipam.predefinedPrivateNetworks, netlink.FAMILY_V4); err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
-	for i, nw := range ipam.predefinedPrivateNetworks {
+
+	return unusedIPNet, nil
+}
+
+func findUnusedNetwork(pool []*net.IPNet, family int) (unusedIPNet *net.IPNet, leftPool []*net.IPNet, err error) {
+	networks, err := getNetworkRoutes(family)
+	if err != nil {
+		return nil, pool, aoserrors.Wrap(err)
+	}
+	for i, nw := range pool {
 		if !checkRouteOverlaps(nw, networks) {
-			ipam.predefinedPrivateNetworks =
-				append(ipam.predefinedPrivateNetworks[:i], ipam.predefinedPrivateNetworks[i+1:]...)
-			return nw, nil
+			return nw, append(pool[:i], pool[i+1:]...), nil
 		}
 	}
 
-	return nil, aoserrors.Errorf("no available network")
+	return nil, pool, aoserrors.Errorf("no available network")
 }
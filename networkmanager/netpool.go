@@ -22,12 +22,29 @@ import (
 	"net"
 
 	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/apparentlymart/go-cidr/cidr"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+const (
+	ipv6SubnetSize    = 64
+	ipv6MinPrefixSize = 48
+	// max number of subnets in one pool is 65536
+	maxPoolSplitBits = 16
+	maxIPv4PoolSize  = 30
 )
 
 /*******************************************************************************
  * Var
  ******************************************************************************/
 
+var _, ipv6ULANetwork, _ = net.ParseCIDR("fc00::/7")
+
 var predefinedPrivateNetworks = []*networkToSplit{
 	{"172.17.0.0/16", 16},
 	{"172.18.0.0/16", 16},
@@ -50,44 +67,122 @@ type networkToSplit struct {
  * Private
  ******************************************************************************/
 
-func makeNetPools() (listIPNetPool []*net.IPNet, err error) {
-	listIPNetPool = make([]*net.IPNet, 0, len(predefinedPrivateNetworks))
+// getPoolNetworks returns configured pools or predefined ones if pools are not configured
+func getPoolNetworks(pools []config.NetworkPool) (poolNetworks []*networkToSplit) {
+	if len(pools) == 0 {
+		return predefinedPrivateNetworks
+	}
+
+	poolNetworks = make([]*networkToSplit, 0, len(pools))
+
+	for _, pool := range pools {
+		poolNetworks = append(poolNetworks, &networkToSplit{pool.Base, pool.Size})
+	}
+
+	return poolNetworks
+}
+
+func makeNetPools(poolNetworks []*networkToSplit, excludedRanges []*net.IPNet) (listIPNetPool []*net.IPNet, err error) {
+	listIPNetPool = make([]*net.IPNet, 0, len(poolNetworks))
 
-	for _, poolNet := range predefinedPrivateNetworks {
-		_, b, err := net.ParseCIDR(poolNet.ipSubNet)
+	for _, poolNet := range poolNetworks {
+		ip, b, err := net.ParseCIDR(poolNet.ipSubNet)
 		if err != nil {
 			return nil, aoserrors.Errorf("invalid base pool %q: %v", poolNet.ipSubNet, err)
 		}
+		if ip.To4() == nil {
+			return nil, aoserrors.Errorf("base pool %q is not IPv4 network", poolNet.ipSubNet)
+		}
 		ones, _ := b.Mask.Size()
-		if poolNet.size <= 0 || poolNet.size < ones {
+		if poolNet.size <= 0 || poolNet.size < ones || poolNet.size > maxIPv4PoolSize ||
+			poolNet.size-ones > maxPoolSplitBits {
 			return nil, aoserrors.Errorf("invalid pools size: %d", poolNet.size)
 		}
-		listIPNetPool = append(listIPNetPool, makeNetPool(poolNet.size, b)...)
+		pool, err := makeNetPool(poolNet.size, b)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		listIPNetPool = append(listIPNetPool, excludeNetworks(pool, excludedRanges)...)
 	}
 
 	return listIPNetPool, nil
 }
 
-func makeNetPool(size int, base *net.IPNet) (listIPNet []*net.IPNet) {
-	one, bits := base.Mask.Size()
-	mask := net.CIDRMask(size, bits)
+func makeIPv6NetPool(prefix string, excludedRanges []*net.IPNet) (listIPNetPool []*net.IPNet, err error) {
+	ip, base, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, aoserrors.Errorf("invalid IPv6 prefix %q: %v", prefix, err)
+	}
+
+	if ip.To4() != nil || !ipv6ULANetwork.Contains(ip) {
+		return nil, aoserrors.Errorf("IPv6 prefix %q is not unique local address", prefix)
+	}
+
+	// limit pool to 65536 subnets
+	if ones, _ := base.Mask.Size(); ones < ipv6MinPrefixSize || ones > ipv6SubnetSize {
+		return nil, aoserrors.Errorf("invalid IPv6 prefix size: %d", ones)
+	}
+
+	if listIPNetPool, err = makeNetPool(ipv6SubnetSize, base); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return excludeNetworks(listIPNetPool, excludedRanges), nil
+}
+
+func makeNetPool(size int, base *net.IPNet) (listIPNet []*net.IPNet, err error) {
+	one, _ := base.Mask.Size()
 	n := 1 << uint(size-one)
-	s := uint(bits - size)
 	listIPNet = make([]*net.IPNet, 0, n)
 
 	for i := 0; i < n; i++ {
-		ip := make([]byte, len(base.IP))
-		copy(ip, base.IP)
-		addIntToIP(ip, uint(i<<s))
-		listIPNet = append(listIPNet, &net.IPNet{IP: ip, Mask: mask})
+		subnet, err := cidr.Subnet(base, size-one, i)
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		listIPNet = append(listIPNet, subnet)
+	}
+
+	return listIPNet, nil
+}
+
+func parseNetworks(cidrs []string) (networks []*net.IPNet, err error) {
+	for _, cidrStr := range cidrs {
+		_, network, err := net.ParseCIDR(cidrStr)
+		if err != nil {
+			return nil, aoserrors.Errorf("invalid network %q: %v", cidrStr, err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func excludeNetworks(pool []*net.IPNet, excludedRanges []*net.IPNet) (leftPool []*net.IPNet) {
+	if len(excludedRanges) == 0 {
+		return pool
 	}
 
-	return listIPNet
+	leftPool = make([]*net.IPNet, 0, len(pool))
+
+	for _, network := range pool {
+		if !isNetworkOverlaps(network, excludedRanges) {
+			leftPool = append(leftPool, network)
+		}
+	}
+
+	return leftPool
 }
 
-func addIntToIP(array net.IP, ordinal uint) {
-	for i := len(array) - 1; i >= 0; i-- {
-		array[i] |= (byte)(ordinal & 0xff)
-		ordinal >>= 8
+func isNetworkOverlaps(toCheck *net.IPNet, networks []*net.IPNet) (overlaps bool) {
+	for _, network := range networks {
+		if toCheck.Contains(network.IP) || network.Contains(toCheck.IP) {
+			return true
+		}
 	}
+
+	return false
 }
@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networkmanager
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestIPv6NetPool(t *testing.T) {
+	pool, err := makeIPv6NetPool("fd12:3456:789a::/48", nil)
+	if err != nil {
+		t.Fatalf("Can't make IPv6 net pool: %s", err)
+	}
+
+	if len(pool) != 1<<16 {
+		t.Errorf("Wrong pool size: %d", len(pool))
+	}
+
+	if pool[1].String() != "fd12:3456:789a:1::/64" {
+		t.Errorf("Wrong pool subnet: %s", pool[1])
+	}
+
+	for _, prefix := range []string{"10.0.0.0/8", "2001:db8::/48", "fd12::/16", "fd12:3456:789a:1:2::/80"} {
+		if _, err = makeIPv6NetPool(prefix, nil); err == nil {
+			t.Errorf("Error expected for prefix %s", prefix)
+		}
+	}
+}
+
+func TestNetPools(t *testing.T) {
+	pool, err := makeNetPools(getPoolNetworks(nil), nil)
+	if err != nil {
+		t.Fatalf("Can't make net pools: %s", err)
+	}
+
+	if len(pool) != 15 || pool[0].String() != "172.17.0.0/16" || pool[14].String() != "172.31.0.0/16" {
+		t.Errorf("Wrong predefined pool: %v", pool)
+	}
+
+	excludedRanges, err := parseNetworks([]string{"10.100.10.0/24", "10.100.12.0/23"})
+	if err != nil {
+		t.Fatalf("Can't parse excluded ranges: %s", err)
+	}
+
+	if pool, err = makeNetPools(getPoolNetworks([]config.NetworkPool{{Base: "10.100.0.0/20", Size: 24}}),
+		excludedRanges); err != nil {
+		t.Fatalf("Can't make net pools: %s", err)
+	}
+
+	if len(pool) != 13 {
+		t.Errorf("Wrong pool size: %d", len(pool))
+	}
+
+	for _, network := range pool {
+		if isNetworkOverlaps(network, excludedRanges) {
+			t.Errorf("Pool contains excluded network: %s", network)
+		}
+	}
+
+	for _, pool := range []config.NetworkPool{
+		{Base: "10.0.0.0/8", Size: 30}, {Base: "10.0.0.0/24", Size: 16}, {Base: "fd00::/48", Size: 64},
+	} {
+		if _, err = makeNetPools(getPoolNetworks([]config.NetworkPool{pool}), nil); err == nil {
+			t.Errorf("Error expected for pool %v", pool)
+		}
+	}
+}
+
+func TestReserveIPNetPool(t *testing.T) {
+	ipam, err := newIPam(getPoolNetworks(nil), nil, "fd12:3456:789a::/48")
+	if err != nil {
+		t.Fatalf("Can't create ipam: %s", err)
+	}
+
+	_, subnet, _ := net.ParseCIDR("172.20.0.0/16")
+	_, ipv6Subnet, _ := net.ParseCIDR("fd12:3456:789a:5::/64")
+
+	if err = ipam.reserveIPNetPool("sp1", subnet); err != nil {
+		t.Fatalf("Can't reserve subnet: %s", err)
+	}
+
+	if err = ipam.reserveIPNetPool("sp1", ipv6Subnet); err != nil {
+		t.Fatalf("Can't reserve subnet: %s", err)
+	}
+
+	if err = ipam.reserveIPNetPool("sp2", subnet); err == nil {
+		t.Error("Error expected for already reserved subnet")
+	}
+
+	if allocIPNet, exist := ipam.tryToGetExistIPNetFromPool("sp1"); !exist || allocIPNet.String() != subnet.String() {
+		t.Errorf("Wrong reserved subnet: %v", allocIPNet)
+	}
+
+	_, route, _ := net.ParseCIDR("172.20.10.0/24")
+
+	if spIDs := ipam.getOverlappedNetworks(route); len(spIDs) != 1 || spIDs[0] != "sp1" {
+		t.Errorf("Wrong overlapped networks: %v", spIDs)
+	}
+
+	ipam.releaseIPNetPool("sp1")
+
+	if err = ipam.reserveIPNetPool("sp2", subnet); err != nil {
+		t.Errorf("Can't reserve released subnet: %s", err)
+	}
+
+	if err = ipam.reserveIPNetPool("sp2", ipv6Subnet); err != nil {
+		t.Errorf("Can't reserve released subnet: %s", err)
+	}
+}
+
+func TestDualStackBridgeConfig(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("172.17.0.0/16")
+	_, ipv6Subnet, _ := net.ParseCIDR("fd12:3456:789a:1::/64")
+
+	data, err := getBridgePluginConfig("/tmp", "sp1", subnet, ipv6Subnet,
+		[]string{"172.17.0.2", "fd12:3456:789a:1::2"})
+	if err != nil {
+		t.Fatalf("Can't get bridge config: %s", err)
+	}
+
+	var config struct {
+		IPAM struct {
+			Subnet string `json:"subnet"`
+			Ranges [][]struct {
+				Subnet     string `json:"subnet"`
+				RangeStart string `json:"rangeStart"`
+			} `json:"ranges"`
+			Routes []struct {
+				Dst string `json:"dst"`
+			} `json:"routes"`
+		} `json:"ipam"`
+		Args struct {
+			CNI struct {
+				IPs []string `json:"ips"`
+			} `json:"cni"`
+		} `json:"args"`
+	}
+
+	if err = json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("Can't unmarshal bridge config: %s", err)
+	}
+
+	if config.IPAM.Subnet != "172.17.0.0/16" {
+		t.Errorf("Wrong IPv4 subnet: %s", config.IPAM.Subnet)
+	}
+
+	if len(config.IPAM.Ranges) != 1 || len(config.IPAM.Ranges[0]) != 1 ||
+		config.IPAM.Ranges[0][0].Subnet != "fd12:3456:789a:1::/64" ||
+		config.IPAM.Ranges[0][0].RangeStart != "fd12:3456:789a:1::1" {
+		t.Errorf("Wrong IPv6 ranges: %+v", config.IPAM.Ranges)
+	}
+
+	if len(config.IPAM.Routes) != 2 || config.IPAM.Routes[1].Dst != "::/0" {
+		t.Errorf("Wrong routes: %+v", config.IPAM.Routes)
+	}
+
+	if len(config.Args.CNI.IPs) != 2 || config.Args.CNI.IPs[1] != "fd12:3456:789a:1::2" {
+		t.Errorf("Wrong requested IPs: %v", config.Args.CNI.IPs)
+	}
+}
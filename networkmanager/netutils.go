@@ -23,6 +23,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"strings"
 	"syscall"
 
 	"github.com/aoscloud/aos_common/aoserrors"
@@ -31,7 +32,7 @@ import (
 	"github.com/vishvananda/netns"
 )
 
-func getNetworkRoutes() (routeIPList []netlink.Route, err error) {
+func getNetworkRoutes(family int) (routeIPList []netlink.Route, err error) {
 	initNl, err := netlink.NewHandle(syscall.NETLINK_ROUTE, syscall.NETLINK_NETFILTER)
 	if err != nil {
 		return nil, aoserrors.Errorf("could not create netlink handle on initial namespace: %v", err)
@@ -39,7 +40,7 @@ func getNetworkRoutes() (routeIPList []netlink.Route, err error) {
 
 	defer initNl.Delete()
 
-	routeIPList, err = initNl.RouteList(nil, netlink.FAMILY_V4)
+	routeIPList, err = initNl.RouteList(nil, family)
 	if err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
@@ -57,6 +58,15 @@ func checkRouteOverlaps(toCheck *net.IPNet, networks []netlink.Route) (overlapsI
 	return false
 }
 
+func isBridgeRoute(route netlink.Route) (result bool) {
+	link, err := netlink.LinkByIndex(route.LinkIndex)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(link.Attrs().Name, bridgePrefix)
+}
+
 func removeBridgeInterface(spID string) (err error) {
 	br, err := netlink.LinkByName(bridgePrefix + spID)
 	if err != nil {
@@ -117,7 +127,7 @@ func getIPAddressRange(subnetwork *net.IPNet) (ipLowNetRange net.IP, ipHighNetRa
 	return cidr.Inc(minIPRange), cidr.Dec(maxIPRange)
 }
 
-func checkExistNetInterface(name string) (ipNet *net.IPNet, err error) {
+func checkExistNetInterface(name string, ipv6 bool) (ipNet *net.IPNet, err error) {
 	netInterface, err := net.InterfaceByName(name)
 	if err != nil {
 		return nil, aoserrors.Errorf("unable to find interface %s", err)
@@ -131,6 +141,15 @@ func checkExistNetInterface(name string) (ipNet *net.IPNet, err error) {
 	for _, addr := range addrs {
 		switch v := addr.(type) {
 		case *net.IPNet:
+			if ipv6 {
+				if v.IP.To4() == nil && !v.IP.IsLinkLocalUnicast() {
+					_, ipSubnet, _ := net.ParseCIDR(v.String())
+					return ipSubnet, nil
+				}
+
+				continue
+			}
+
 			if ipv4 := v.IP.To4(); ipv4 != nil {
 				_, ipSubnet, _ := net.ParseCIDR(v.String())
 				return ipSubnet, nil
@@ -138,5 +157,9 @@ func checkExistNetInterface(name string) (ipNet *net.IPNet, err error) {
 		}
 	}
 
+	if ipv6 {
+		return nil, aoserrors.Errorf("interface has not IPv6 address")
+	}
+
 	return nil, aoserrors.Errorf("interface has not IPv4 address")
 }
@@ -26,6 +26,7 @@ import (
 	"net"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -37,7 +38,9 @@ import (
 	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
 
 	"github.com/aoscloud/aos_servicemanager/config"
 )
@@ -53,6 +56,8 @@ const (
 	cniBinPath       = "/opt/cni/bin"
 	cniVersion       = "0.4.0"
 	adminChainPrefix = "SERVICE_"
+	// size of network migration channel
+	migrationChannelSize = 16
 )
 
 /*******************************************************************************
@@ -62,11 +67,41 @@ const (
 // NetworkManager network manager instance
 type NetworkManager struct {
 	sync.Mutex
-	cniConfig         *cni.CNIConfig
-	ipamSubnetwork    *ipSubnetwork
-	hosts             []config.Host
-	networkDir        string
-	trafficMonitoring *trafficMonitoring
+	cniConfig          *cni.CNIConfig
+	ipamSubnetwork     *ipSubnetwork
+	hosts              []config.Host
+	networkDir         string
+	trafficMonitoring  *trafficMonitoring
+	networkStorage     NetworkStorage
+	migrationChannel   chan string
+	routeWatcherCancel chan struct{}
+	serviceIPs         map[string]ServiceIPInfo
+	egressFilter       *egressFilter
+}
+
+// NetworkStorage provides API to store service provider networks
+type NetworkStorage interface {
+	SetNetwork(network NetworkInfo) (err error)
+	RemoveNetwork(spID string) (err error)
+	GetNetworks() (networks []NetworkInfo, err error)
+	SetServiceIP(serviceIP ServiceIPInfo) (err error)
+	RemoveServiceIP(serviceID string) (err error)
+	GetServiceIPs() (serviceIPs []ServiceIPInfo, err error)
+}
+
+// NetworkInfo service provider network subnets
+type NetworkInfo struct {
+	SpID       string
+	Subnet     string
+	IPv6Subnet string
+}
+
+// ServiceIPInfo service IP addresses reservation
+type ServiceIPInfo struct {
+	ServiceID string
+	SpID      string
+	IP        string
+	IPv6      string
 }
 
 // NetworkParams network parameters set for service
@@ -83,6 +118,20 @@ type NetworkParams struct {
 	ResolvConfFilePath string
 	UploadLimit        uint64
 	DownloadLimit      uint64
+	// static IP addresses within service provider subnets, empty to use reserved or allocate new ones
+	IP             string
+	IPv6           string
+	PublishedPorts []PortMapping
+	// outbound connections allowlist, nil means outbound connections are not restricted
+	EgressPolicy *EgressPolicy
+}
+
+// PortMapping publishes service port on host port, empty host IP means all host addresses
+type PortMapping struct {
+	HostIP        string
+	HostPort      uint16
+	ContainerPort uint16
+	Protocol      string
 }
 
 type cniNetwork struct {
@@ -103,6 +152,14 @@ type bridgeNetConf struct {
 	PromiscMode      bool                 `json:"promiscMode,omitempty"`
 	Vlan             int                  `json:"vlan,omitempty"`
 	IPAM             allocator.IPAMConfig `json:"ipam"`
+	Args             *bridgeArgs          `json:"args,omitempty"`
+}
+
+// bridgeArgs passes requested IP addresses to host-local IPAM plugin
+type bridgeArgs struct {
+	CNI struct {
+		IPs []string `json:"ips"`
+	} `json:"cni"`
 }
 
 type bandwidthNetConf struct {
@@ -114,12 +171,27 @@ type bandwidthNetConf struct {
 }
 
 type aosFirewallNetConf struct {
-	Type                   string               `json:"type"`
-	UUID                   string               `json:"uuid"`
-	IptablesAdminChainName string               `json:"iptablesAdminChainName"`
-	AllowPublicConnections bool                 `json:"allowPublicConnections"`
-	InputAccess            []inputAccessConfig  `json:"inputAccess,omitempty"`
-	OutputAccess           []outputAccessConfig `json:"outputAccess,omitempty"`
+	Type                   string `json:"type"`
+	UUID                   string `json:"uuid"`
+	IptablesAdminChainName string `json:"iptablesAdminChainName"`
+	// IP6tablesAdminChainName ip6tables admin chain, empty if IPv6 is disabled
+	IP6tablesAdminChainName string               `json:"ip6tablesAdminChainName,omitempty"`
+	AllowPublicConnections  bool                 `json:"allowPublicConnections"`
+	InputAccess             []inputAccessConfig  `json:"inputAccess,omitempty"`
+	OutputAccess            []outputAccessConfig `json:"outputAccess,omitempty"`
+}
+
+type portMapNetConf struct {
+	Type         string          `json:"type"`
+	SNAT         bool            `json:"snat"`
+	Capabilities map[string]bool `json:"capabilities"`
+}
+
+type portMapEntry struct {
+	HostPort      int    `json:"hostPort"`
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol"`
+	HostIP        string `json:"hostIP,omitempty"`
 }
 
 type aosDNSNetConf struct {
@@ -144,38 +216,65 @@ type outputAccessConfig struct {
  * Vars
  ******************************************************************************/
 
-var skipNetworkFileNames = []string{"lock", "last_reserved_ip.0"}
+var skipNetworkFileNames = []string{"lock", "last_reserved_ip.0", "last_reserved_ip.1"}
 
 /*******************************************************************************
  * Public
  ******************************************************************************/
 
 // New creates network manager instance
-func New(cfg *config.Config, trafficStorage TrafficStorage) (manager *NetworkManager, err error) {
+func New(cfg *config.Config, trafficStorage TrafficStorage,
+	networkStorage NetworkStorage) (manager *NetworkManager, err error) {
 	log.Debug("Create network manager")
 
 	cniDir := path.Join(cfg.WorkingDir, "cni")
 
 	manager = &NetworkManager{
-		hosts:      cfg.Hosts,
-		cniConfig:  cni.NewCNIConfigWithCacheDir([]string{cniBinPath}, cniDir, nil),
-		networkDir: path.Join(cniDir, "networks"),
+		hosts:            cfg.Hosts,
+		cniConfig:        cni.NewCNIConfigWithCacheDir([]string{cniBinPath}, cniDir, nil),
+		networkDir:       path.Join(cniDir, "networks"),
+		networkStorage:   networkStorage,
+		migrationChannel: make(chan string, migrationChannelSize),
+		serviceIPs:       make(map[string]ServiceIPInfo),
+	}
+
+	ipv6Prefix := ""
+
+	if cfg.Network.IPv6 {
+		ipv6Prefix = cfg.Network.IPv6Prefix
 	}
 
-	if manager.ipamSubnetwork, err = newIPam(); err != nil {
+	excludedRanges, err := parseNetworks(cfg.Network.ExcludedRanges)
+	if err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
 
-	if err = manager.DeleteAllNetworks(); err != nil {
-		log.Errorf("Can't delete all networks: %s", err)
+	poolNetworks := getPoolNetworks(cfg.Network.Pools)
+
+	if manager.ipamSubnetwork, err = newIPam(poolNetworks, excludedRanges, ipv6Prefix); err != nil {
+		return nil, aoserrors.Wrap(err)
 	}
 
-	if err = os.RemoveAll(cniDir); err != nil {
+	if manager.networkStorage != nil {
+		manager.restoreNetworks()
+		manager.restoreServiceIPs()
+	}
+
+	if err = manager.reconcileNetworks(); err != nil {
+		log.Errorf("Can't reconcile networks: %s", err)
+	}
+
+	// services with egress allowlist should not run without filter
+	if manager.egressFilter, err = newEgressFilter(poolNetworks, cfg.Network.IPv6); err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
 
+	if err = manager.startRouteWatcher(); err != nil {
+		log.Errorf("Can't watch host routes: %s", err)
+	}
+
 	if trafficStorage != nil {
-		manager.trafficMonitoring, err = newTrafficMonitor(trafficStorage)
+		manager.trafficMonitoring, err = newTrafficMonitor(trafficStorage, poolNetworks, cfg.Network.IPv6)
 		if err != nil {
 			return manager, err
 		}
@@ -190,6 +289,14 @@ func New(cfg *config.Config, trafficStorage TrafficStorage) (manager *NetworkMan
 func (manager *NetworkManager) Close() (err error) {
 	log.Debug("Close network manager")
 
+	if manager.routeWatcherCancel != nil {
+		close(manager.routeWatcherCancel)
+	}
+
+	if manager.egressFilter != nil {
+		manager.egressFilter.close()
+	}
+
 	if manager.trafficMonitoring != nil {
 		if err := manager.trafficMonitoring.deleteAllTrafficChains(); err != nil {
 			return aoserrors.Wrap(err)
@@ -199,6 +306,59 @@ func (manager *NetworkManager) Close() (err error) {
 	return nil
 }
 
+// GetNetworkMigrationChannel returns channel of service provider IDs which network subnet conflicts with host
+// routes. Services of these providers should be removed from the network and the network should be deleted,
+// new subnet is allocated when services are added back.
+func (manager *NetworkManager) GetNetworkMigrationChannel() (channel <-chan string) {
+	return manager.migrationChannel
+}
+
+// ParsePortMapping parses published port in format [hostIP:]hostPort:containerPort[/protocol],
+// IPv6 host IP should be enclosed in square brackets, default protocol is tcp
+func ParsePortMapping(port string) (mapping PortMapping, err error) {
+	mapping.Protocol = "tcp"
+
+	portConfig := strings.Split(port, "/")
+	if len(portConfig) > 2 {
+		return mapping, aoserrors.Errorf("unsupported published port format %s", port)
+	}
+
+	if len(portConfig) == 2 {
+		if portConfig[1] != "tcp" && portConfig[1] != "udp" {
+			return mapping, aoserrors.Errorf("unsupported published port protocol %s", portConfig[1])
+		}
+
+		mapping.Protocol = portConfig[1]
+	}
+
+	separator := strings.LastIndex(portConfig[0], ":")
+	if separator < 0 {
+		return mapping, aoserrors.Errorf("unsupported published port format %s", port)
+	}
+
+	if mapping.ContainerPort, err = parsePort(portConfig[0][separator+1:]); err != nil {
+		return mapping, aoserrors.Wrap(err)
+	}
+
+	hostPort := portConfig[0][:separator]
+
+	if strings.Contains(hostPort, ":") {
+		if mapping.HostIP, hostPort, err = net.SplitHostPort(hostPort); err != nil {
+			return mapping, aoserrors.Wrap(err)
+		}
+
+		if net.ParseIP(mapping.HostIP) == nil {
+			return mapping, aoserrors.Errorf("invalid published port host IP %s", mapping.HostIP)
+		}
+	}
+
+	if mapping.HostPort, err = parsePort(hostPort); err != nil {
+		return mapping, aoserrors.Wrap(err)
+	}
+
+	return mapping, nil
+}
+
 // GetNetNsPathByName get path to service network namespace
 func GetNetNsPathByName(serviceID string) (pathToNetNS string) {
 	return path.Join(pathToNetNs, serviceID)
@@ -212,25 +372,56 @@ func (manager *NetworkManager) AddServiceToNetwork(serviceID, spID string, param
 	log.WithFields(log.Fields{"serviceID": serviceID, "spID": spID}).Debug("Add service to network")
 
 	if err = manager.isServiceInNetwork(serviceID, spID); err == nil {
-		log.WithFields(log.Fields{"serviceID": serviceID, "spID": spID}).Warn("Service already in the network")
+		if _, err = os.Stat(GetNetNsPathByName(serviceID)); err == nil {
+			log.WithFields(log.Fields{"serviceID": serviceID, "spID": spID}).Debug("Service already in the network")
 
-		return aoserrors.Wrap(err)
+			return aoserrors.Wrap(manager.restoreServiceNetwork(serviceID, spID, &params))
+		}
+
+		log.WithFields(log.Fields{"serviceID": serviceID, "spID": spID}).Warn("Remove stale service network")
+
+		if err = manager.removeServiceFromNetwork(serviceID, spID); err != nil {
+			log.WithField("serviceID", serviceID).Errorf("Can't remove stale service network: %s", err)
+		}
 	}
 
+	allocated := false
+
+	defer func() {
+		if err != nil && allocated {
+			manager.ipamSubnetwork.releaseIPNetPool(spID)
+		}
+	}()
+
 	ipSubnet, exist := manager.ipamSubnetwork.tryToGetExistIPNetFromPool(spID)
 	if !exist {
-		if ipSubnet, err = checkExistNetInterface(bridgePrefix + spID); err != nil {
+		if ipSubnet, err = checkExistNetInterface(bridgePrefix+spID, false); err != nil {
 			if ipSubnet, _, err = manager.ipamSubnetwork.requestIPNetPool(spID); err != nil {
 				return aoserrors.Wrap(err)
 			}
+
+			allocated = true
 		}
 	}
 
-	defer func() {
-		if err != nil {
-			manager.ipamSubnetwork.releaseIPNetPool(spID)
+	var ipv6Subnet *net.IPNet
+
+	if manager.ipamSubnetwork.isIPv6Enabled() {
+		if ipv6Subnet, exist = manager.ipamSubnetwork.tryToGetExistIPv6NetFromPool(spID); !exist {
+			if ipv6Subnet, err = checkExistNetInterface(bridgePrefix+spID, true); err != nil {
+				if ipv6Subnet, err = manager.ipamSubnetwork.requestIPv6NetPool(spID); err != nil {
+					return aoserrors.Wrap(err)
+				}
+
+				allocated = true
+			}
 		}
-	}()
+	}
+
+	requestedIPs, err := manager.getRequestedIPs(serviceID, spID, ipSubnet, ipv6Subnet, &params)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
 
 	if err = createNetNS(serviceID); err != nil {
 		return aoserrors.Wrap(err)
@@ -244,12 +435,13 @@ func (manager *NetworkManager) AddServiceToNetwork(serviceID, spID string, param
 		}
 	}()
 
-	netConfig, err := prepareNetworkConfigList(manager.networkDir, serviceID, spID, ipSubnet, &params)
+	netConfig, err := prepareNetworkConfigList(manager.networkDir, serviceID, spID, ipSubnet, ipv6Subnet,
+		requestedIPs, &params)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	runtimeConfig, err := prepareRuntimeConfig(serviceID, spID, params.Hostname, params.Aliases)
+	runtimeConfig, err := prepareRuntimeConfig(serviceID, spID, params.Hostname, params.Aliases, params.PublishedPorts)
 	if err != nil {
 		return aoserrors.Wrap(err)
 	}
@@ -276,40 +468,21 @@ func (manager *NetworkManager) AddServiceToNetwork(serviceID, spID string, param
 		return aoserrors.Wrap(err)
 	}
 
-	if len(result.IPs) == 0 {
-		return aoserrors.Errorf("error getting IP address for service %s", serviceID)
-	}
-
-	serviceIP := result.IPs[0].Address.IP.String()
-
-	if params.HostsFilePath != "" {
-		if err = writeHostToHostsFile(params.HostsFilePath, serviceIP,
-			serviceID, params.Hostname, params.Hosts); err != nil {
-			return aoserrors.Wrap(err)
-		}
+	serviceIP, serviceIPv6, err := manager.setupServiceNetwork(serviceID, spID, result, &params)
+	if err != nil {
+		return aoserrors.Wrap(err)
 	}
 
-	if params.ResolvConfFilePath != "" {
-		mainServers := []string{"8.8.8.8"}
-
-		if len(result.DNS.Nameservers) != 0 {
-			mainServers = result.DNS.Nameservers
-		}
-
-		if err = writeResolveConfFile(params.ResolvConfFilePath, mainServers, params.DNSSevers); err != nil {
-			return aoserrors.Wrap(err)
-		}
+	if allocated {
+		manager.saveNetwork(spID, ipSubnet, ipv6Subnet)
 	}
 
-	if manager.trafficMonitoring != nil {
-		if err = manager.trafficMonitoring.startTrafficMonitor(serviceID, serviceIP, params.DownloadLimit, params.UploadLimit); err != nil {
-			return aoserrors.Wrap(err)
-		}
-	}
+	manager.saveServiceIP(ServiceIPInfo{ServiceID: serviceID, SpID: spID, IP: serviceIP, IPv6: serviceIPv6})
 
 	log.WithFields(log.Fields{
 		"serviceID": serviceID,
 		"IP":        serviceIP,
+		"IPv6":      serviceIPv6,
 	}).Debug("Service has been added to the network")
 
 	return nil
@@ -334,6 +507,12 @@ func (manager *NetworkManager) RemoveServiceFromNetwork(serviceID, spID string)
 		}
 	}
 
+	if manager.egressFilter != nil {
+		if err = manager.egressFilter.removeService(serviceID); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
 	if err = manager.removeServiceFromNetwork(serviceID, spID); err != nil {
 		return aoserrors.Wrap(err)
 	}
@@ -351,8 +530,8 @@ func (manager *NetworkManager) IsServiceInNetwork(serviceID, spID string) (err e
 	return aoserrors.Wrap(manager.isServiceInNetwork(serviceID, spID))
 }
 
-// GetServiceIP return service IP address
-func (manager *NetworkManager) GetServiceIP(serviceID, spID string) (ip string, err error) {
+// GetServiceIP return service IPv4 and IPv6 addresses, IPv6 address is empty if IPv6 is disabled
+func (manager *NetworkManager) GetServiceIP(serviceID, spID string) (ip, ipv6 string, err error) {
 	manager.Lock()
 	defer manager.Unlock()
 
@@ -360,27 +539,25 @@ func (manager *NetworkManager) GetServiceIP(serviceID, spID string) (ip string,
 
 	cachedResult, err := manager.cniConfig.GetNetworkListCachedResult(getRuntimeNetConfig(serviceID, spID))
 	if err != nil {
-		return "", aoserrors.Wrap(err)
+		return "", "", aoserrors.Wrap(err)
 	}
 
 	if cachedResult == nil {
-		return "", aoserrors.Errorf("service %s not found in network %s", serviceID, spID)
+		return "", "", aoserrors.Errorf("service %s not found in network %s", serviceID, spID)
 	}
 
 	result, err := current.GetResult(cachedResult)
 	if err != nil {
-		return "", aoserrors.Wrap(err)
+		return "", "", aoserrors.Wrap(err)
 	}
 
-	if len(result.IPs) == 0 {
-		return "", aoserrors.Errorf("error in getting the IP address for the service: %s", serviceID)
+	if ip, ipv6 = getResultIPs(result); ip == "" {
+		return "", "", aoserrors.Errorf("error in getting the IP address for the service: %s", serviceID)
 	}
 
-	ip = result.IPs[0].Address.IP.String()
+	log.Debugf("IP address %s %s for service %s", ip, ipv6, serviceID)
 
-	log.Debugf("IP address %s for service %s", ip, serviceID)
-
-	return ip, nil
+	return ip, ipv6, nil
 }
 
 // DeleteNetwork deletes SP network
@@ -388,6 +565,15 @@ func (manager *NetworkManager) DeleteNetwork(spID string) (err error) {
 	manager.Lock()
 	defer manager.Unlock()
 
+	if manager.networkStorage != nil {
+		if err = manager.networkStorage.RemoveNetwork(spID); err != nil {
+			log.WithField("spID", spID).Errorf("Can't remove network from storage: %s", err)
+		}
+	}
+
+	// reserved addresses belong to the subnet which is released with the network
+	manager.releaseNetworkServiceIPs(spID)
+
 	return aoserrors.Wrap(manager.deleteNetwork(spID))
 }
 
@@ -508,23 +694,27 @@ func (manager *NetworkManager) deleteNetwork(spID string) (err error) {
 		return nil
 	}
 
-	filesServiceID, err := ioutil.ReadDir(networkDir)
-	if err != nil {
-		return aoserrors.Wrap(err)
+	err = manager.removeNetworkServices(spID)
+
+	if clearErr := manager.postSPNetworkClear(spID); clearErr != nil {
+		if err == nil {
+			err = clearErr
+		}
 	}
 
-	for _, serviceIDFile := range filesServiceID {
-		skip := false
+	os.RemoveAll(networkDir)
 
-		for _, skipFile := range skipNetworkFileNames {
-			if serviceIDFile.Name() == skipFile {
-				skip = true
+	return aoserrors.Wrap(err)
+}
 
-				break
-			}
-		}
+func (manager *NetworkManager) removeNetworkServices(spID string) (err error) {
+	filesServiceID, err := ioutil.ReadDir(path.Join(manager.networkDir, spID))
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
 
-		if skip {
+	for _, serviceIDFile := range filesServiceID {
+		if isSkipNetworkFile(serviceIDFile.Name()) {
 			continue
 		}
 
@@ -535,15 +725,82 @@ func (manager *NetworkManager) deleteNetwork(spID string) (err error) {
 		}
 	}
 
-	if clearErr := manager.postSPNetworkClear(spID); clearErr != nil {
-		if err == nil {
-			err = clearErr
+	return aoserrors.Wrap(err)
+}
+
+func (manager *NetworkManager) setupServiceNetwork(serviceID, spID string, result *current.Result,
+	params *NetworkParams) (serviceIP, serviceIPv6 string, err error) {
+	if serviceIP, serviceIPv6 = getResultIPs(result); serviceIP == "" {
+		return "", "", aoserrors.Errorf("error getting IP address for service %s", serviceID)
+	}
+
+	if params.HostsFilePath != "" {
+		serviceIPs := []string{serviceIP}
+
+		if serviceIPv6 != "" {
+			serviceIPs = append(serviceIPs, serviceIPv6)
+		}
+
+		if err = writeHostToHostsFile(params.HostsFilePath, serviceIPs,
+			serviceID, params.Hostname, params.Hosts); err != nil {
+			return "", "", aoserrors.Wrap(err)
 		}
 	}
 
-	os.RemoveAll(networkDir)
+	if params.ResolvConfFilePath != "" {
+		mainServers := []string{"8.8.8.8"}
 
-	return aoserrors.Wrap(err)
+		if len(result.DNS.Nameservers) != 0 {
+			mainServers = result.DNS.Nameservers
+		}
+
+		if err = writeResolveConfFile(params.ResolvConfFilePath, mainServers, params.DNSSevers); err != nil {
+			return "", "", aoserrors.Wrap(err)
+		}
+	}
+
+	if manager.trafficMonitoring != nil {
+		if _, ok := manager.trafficMonitoring.serviceChainsMap[serviceID]; !ok {
+			if err = manager.trafficMonitoring.startTrafficMonitor(serviceID, serviceIP, serviceIPv6,
+				params.DownloadLimit, params.UploadLimit); err != nil {
+				return "", "", aoserrors.Wrap(err)
+			}
+		}
+	}
+
+	if err = manager.setupServiceEgress(serviceID, spID, result, params); err != nil {
+		return "", "", aoserrors.Wrap(err)
+	}
+
+	return serviceIP, serviceIPv6, nil
+}
+
+// restoreServiceNetwork sets up service which network is kept since previous start
+func (manager *NetworkManager) restoreServiceNetwork(serviceID, spID string, params *NetworkParams) (err error) {
+	cachedResult, err := manager.cniConfig.GetNetworkListCachedResult(getRuntimeNetConfig(serviceID, spID))
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	result, err := current.GetResult(cachedResult)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	serviceIP, serviceIPv6, err := manager.setupServiceNetwork(serviceID, spID, result, params)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if !isSameIP(params.IP, serviceIP) || !isSameIP(params.IPv6, serviceIPv6) {
+		log.WithFields(log.Fields{
+			"serviceID": serviceID, "IP": serviceIP, "IPv6": serviceIPv6,
+		}).Warn("Service static IP is changed, it is applied on the next network setup")
+	}
+
+	manager.saveServiceIP(ServiceIPInfo{ServiceID: serviceID, SpID: spID, IP: serviceIP, IPv6: serviceIPv6})
+
+	return nil
 }
 
 func (manager *NetworkManager) removeServiceFromNetwork(serviceID, spID string) (err error) {
@@ -582,11 +839,332 @@ func (manager *NetworkManager) removeServiceFromNetwork(serviceID, spID string)
 		}
 	}
 
+	if manager.egressFilter != nil {
+		if err = manager.egressFilter.removeService(serviceID); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
 	log.WithFields(log.Fields{"serviceID": serviceID}).Debug("Service successfully removed from network")
 
 	return nil
 }
 
+func (manager *NetworkManager) saveNetwork(spID string, subnet, ipv6Subnet *net.IPNet) {
+	if manager.networkStorage == nil {
+		return
+	}
+
+	network := NetworkInfo{SpID: spID, Subnet: subnet.String()}
+
+	if ipv6Subnet != nil {
+		network.IPv6Subnet = ipv6Subnet.String()
+	}
+
+	if err := manager.networkStorage.SetNetwork(network); err != nil {
+		log.WithField("spID", spID).Errorf("Can't store network: %s", err)
+	}
+}
+
+// restoreNetworks reserves subnets allocated before, subnets which conflict with host routes are dropped
+func (manager *NetworkManager) restoreNetworks() {
+	networks, err := manager.networkStorage.GetNetworks()
+	if err != nil {
+		log.Errorf("Can't get stored networks: %s", err)
+
+		return
+	}
+
+	for _, network := range networks {
+		if err = manager.restoreNetwork(network); err != nil {
+			log.WithField("spID", network.SpID).Warnf("Can't restore network, new subnet will be allocated: %s", err)
+
+			manager.ipamSubnetwork.releaseIPNetPool(network.SpID)
+
+			if err = manager.networkStorage.RemoveNetwork(network.SpID); err != nil {
+				log.WithField("spID", network.SpID).Errorf("Can't remove network from storage: %s", err)
+			}
+
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"spID": network.SpID, "subnet": network.Subnet, "ipv6Subnet": network.IPv6Subnet,
+		}).Debug("Network restored")
+	}
+}
+
+func (manager *NetworkManager) restoreNetwork(network NetworkInfo) (err error) {
+	subnets := []string{network.Subnet}
+
+	if manager.ipamSubnetwork.isIPv6Enabled() {
+		if network.IPv6Subnet == "" {
+			return aoserrors.New("no IPv6 subnet")
+		}
+
+		subnets = append(subnets, network.IPv6Subnet)
+	}
+
+	for _, subnetStr := range subnets {
+		_, subnet, err := net.ParseCIDR(subnetStr)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		family := netlink.FAMILY_V4
+
+		if subnet.IP.To4() == nil {
+			family = netlink.FAMILY_V6
+		}
+
+		routes, err := getNetworkRoutes(family)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if checkRouteOverlaps(subnet, routes) {
+			return aoserrors.Errorf("subnet %s conflicts with host routes", subnet)
+		}
+
+		if err = manager.ipamSubnetwork.reserveIPNetPool(network.SpID, subnet); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// reconcileNetworks keeps networks of services which are still alive since previous start and removes stale ones
+func (manager *NetworkManager) reconcileNetworks() (err error) {
+	spDirs, err := ioutil.ReadDir(manager.networkDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return aoserrors.Wrap(err)
+	}
+
+	for _, spDir := range spDirs {
+		if netErr := manager.reconcileNetwork(spDir.Name()); netErr != nil {
+			log.WithField("spID", spDir.Name()).Errorf("Can't reconcile network: %s", netErr)
+
+			if err == nil {
+				err = netErr
+			}
+		}
+	}
+
+	return aoserrors.Wrap(err)
+}
+
+func (manager *NetworkManager) reconcileNetwork(spID string) (err error) {
+	if err = manager.reserveBridgeSubnets(spID); err != nil {
+		log.WithField("spID", spID).Warnf("Network can't be kept: %s", err)
+
+		return aoserrors.Wrap(manager.clearNetwork(spID))
+	}
+
+	services, err := manager.getNetworkServices(spID)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	keptServices := 0
+
+	for serviceID, ipFiles := range services {
+		if _, statErr := os.Stat(GetNetNsPathByName(serviceID)); statErr == nil &&
+			manager.isServiceInNetwork(serviceID, spID) == nil {
+			log.WithFields(log.Fields{"serviceID": serviceID, "spID": spID}).Debug("Keep service network")
+
+			keptServices++
+
+			continue
+		}
+
+		log.WithFields(log.Fields{"serviceID": serviceID, "spID": spID}).Debug("Remove stale service network")
+
+		if manager.isServiceInNetwork(serviceID, spID) == nil {
+			if netErr := manager.removeServiceFromNetwork(serviceID, spID); netErr != nil && err == nil {
+				err = netErr
+			}
+
+			continue
+		}
+
+		// IPAM allocations without cached result can't be released by plugin
+		for _, ipFile := range ipFiles {
+			if removeErr := os.Remove(ipFile); removeErr != nil && err == nil {
+				err = removeErr
+			}
+		}
+
+		if _, statErr := os.Stat(GetNetNsPathByName(serviceID)); statErr == nil {
+			if delErr := netns.DeleteNamed(serviceID); delErr != nil && err == nil {
+				err = delErr
+			}
+		}
+	}
+
+	if keptServices == 0 {
+		return aoserrors.Wrap(manager.clearNetwork(spID))
+	}
+
+	return aoserrors.Wrap(err)
+}
+
+// reserveBridgeSubnets checks that existing bridge subnets match reserved ones or reserves them
+func (manager *NetworkManager) reserveBridgeSubnets(spID string) (err error) {
+	var ipv6Subnet *net.IPNet
+
+	subnet, err := checkExistNetInterface(bridgePrefix+spID, false)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	bridgeNetwork := NetworkInfo{SpID: spID, Subnet: subnet.String()}
+
+	if manager.ipamSubnetwork.isIPv6Enabled() {
+		if ipv6Subnet, err = checkExistNetInterface(bridgePrefix+spID, true); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		bridgeNetwork.IPv6Subnet = ipv6Subnet.String()
+	}
+
+	reservedSubnet, exist := manager.ipamSubnetwork.tryToGetExistIPNetFromPool(spID)
+	if !exist {
+		if err = manager.restoreNetwork(bridgeNetwork); err != nil {
+			manager.ipamSubnetwork.releaseIPNetPool(spID)
+
+			return aoserrors.Wrap(err)
+		}
+
+		manager.saveNetwork(spID, subnet, ipv6Subnet)
+
+		return nil
+	}
+
+	if reservedSubnet.String() != bridgeNetwork.Subnet {
+		return aoserrors.Errorf("bridge subnet %s differs from reserved %s", bridgeNetwork.Subnet, reservedSubnet)
+	}
+
+	if ipv6Subnet != nil {
+		if reservedIPv6Subnet, exist := manager.ipamSubnetwork.tryToGetExistIPv6NetFromPool(spID); !exist ||
+			reservedIPv6Subnet.String() != bridgeNetwork.IPv6Subnet {
+			return aoserrors.Errorf("bridge subnet %s differs from reserved one", bridgeNetwork.IPv6Subnet)
+		}
+	}
+
+	return nil
+}
+
+// getNetworkServices returns IPAM allocation files of network services
+func (manager *NetworkManager) getNetworkServices(spID string) (services map[string][]string, err error) {
+	networkDir := path.Join(manager.networkDir, spID)
+
+	files, err := ioutil.ReadDir(networkDir)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	services = make(map[string][]string)
+
+	for _, file := range files {
+		if isSkipNetworkFile(file.Name()) {
+			continue
+		}
+
+		fileName := path.Join(networkDir, file.Name())
+
+		serviceID, err := readServiceIDFromFile(fileName)
+		if err != nil {
+			log.WithField("file", fileName).Warnf("Can't read service ID: %s", err)
+
+			continue
+		}
+
+		services[serviceID] = append(services[serviceID], fileName)
+	}
+
+	return services, nil
+}
+
+// clearNetwork removes network services and bridge but keeps subnet reservation
+func (manager *NetworkManager) clearNetwork(spID string) (err error) {
+	log.WithField("spID", spID).Debug("Clear network")
+
+	if _, statErr := os.Stat(path.Join(manager.networkDir, spID)); statErr == nil {
+		err = manager.removeNetworkServices(spID)
+	}
+
+	if bridgeErr := removeBridgeInterface(spID); bridgeErr != nil && err == nil {
+		err = bridgeErr
+	}
+
+	if removeErr := os.RemoveAll(path.Join(manager.networkDir, spID)); removeErr != nil && err == nil {
+		err = removeErr
+	}
+
+	return aoserrors.Wrap(err)
+}
+
+func (manager *NetworkManager) startRouteWatcher() (err error) {
+	routeChannel := make(chan netlink.RouteUpdate)
+	manager.routeWatcherCancel = make(chan struct{})
+
+	if err = netlink.RouteSubscribe(routeChannel, manager.routeWatcherCancel); err != nil {
+		close(manager.routeWatcherCancel)
+		manager.routeWatcherCancel = nil
+
+		return aoserrors.Wrap(err)
+	}
+
+	go func() {
+		// channel is closed when watcher is canceled
+		for update := range routeChannel {
+			if update.Type == unix.RTM_NEWROUTE {
+				manager.handleNewRoute(update.Route)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (manager *NetworkManager) handleNewRoute(route netlink.Route) {
+	if route.Dst == nil || isBridgeRoute(route) {
+		return
+	}
+
+	manager.Lock()
+	defer manager.Unlock()
+
+	for _, spID := range manager.ipamSubnetwork.getOverlappedNetworks(route.Dst) {
+		log.WithFields(log.Fields{"spID": spID, "route": route.Dst}).Warn("Network conflicts with host route")
+
+		// network is in use, services should be moved to new subnet
+		if _, err := os.Stat(path.Join(manager.networkDir, spID)); err == nil {
+			select {
+			case manager.migrationChannel <- spID:
+
+			default:
+				log.WithField("spID", spID).Error("Network migration channel is full")
+			}
+
+			continue
+		}
+
+		manager.ipamSubnetwork.releaseIPNetPool(spID)
+
+		if manager.networkStorage != nil {
+			if err := manager.networkStorage.RemoveNetwork(spID); err != nil {
+				log.WithField("spID", spID).Errorf("Can't remove network from storage: %s", err)
+			}
+		}
+	}
+}
+
 func (manager *NetworkManager) postSPNetworkClear(spID string) (err error) {
 	manager.ipamSubnetwork.releaseIPNetPool(spID)
 
@@ -614,6 +1192,25 @@ func (manager *NetworkManager) tryRemoveServiceFromNetwork(serviceIDFileName, sp
 	return nil
 }
 
+func parsePort(port string) (value uint16, err error) {
+	parsed, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || parsed == 0 {
+		return 0, aoserrors.Errorf("invalid port %s", port)
+	}
+
+	return uint16(parsed), nil
+}
+
+func isSkipNetworkFile(fileName string) (skip bool) {
+	for _, skipFile := range skipNetworkFileNames {
+		if fileName == skipFile {
+			return true
+		}
+	}
+
+	return false
+}
+
 func readServiceIDFromFile(pathToServiceID string) (serviceID string, err error) {
 	f, err := os.Open(pathToServiceID)
 	if err != nil {
@@ -636,7 +1233,26 @@ func readServiceIDFromFile(pathToServiceID string) (serviceID string, err error)
 	return cniServiceInfo[0], nil
 }
 
-func getBridgePluginConfig(networkDir, spID string, subnetwork *net.IPNet) (config json.RawMessage, err error) {
+func getResultIPs(result *current.Result) (ip, ipv6 string) {
+	for _, ipConfig := range result.IPs {
+		if ipConfig.Address.IP.To4() != nil {
+			if ip == "" {
+				ip = ipConfig.Address.IP.String()
+			}
+
+			continue
+		}
+
+		if ipv6 == "" {
+			ipv6 = ipConfig.Address.IP.String()
+		}
+	}
+
+	return ip, ipv6
+}
+
+func getBridgePluginConfig(networkDir, spID string, subnetwork, ipv6Subnetwork *net.IPNet,
+	requestedIPs []string) (config json.RawMessage, err error) {
 	minIPRange, maxIPRange := getIPAddressRange(subnetwork)
 	_, defaultRoute, _ := net.ParseCIDR("0.0.0.0/0")
 
@@ -662,6 +1278,24 @@ func getBridgePluginConfig(networkDir, spID string, subnetwork *net.IPNet) (conf
 		},
 	}
 
+	// IPv4 range is set by Range field, host-local plugin puts it in front of Ranges
+	if ipv6Subnetwork != nil {
+		minIPv6Range, maxIPv6Range := getIPAddressRange(ipv6Subnetwork)
+		_, defaultIPv6Route, _ := net.ParseCIDR("::/0")
+
+		configBridge.IPAM.Ranges = []allocator.RangeSet{{{
+			RangeStart: minIPv6Range,
+			RangeEnd:   maxIPv6Range,
+			Subnet:     types.IPNet(*ipv6Subnetwork),
+		}}}
+		configBridge.IPAM.Routes = append(configBridge.IPAM.Routes, &types.Route{Dst: *defaultIPv6Route})
+	}
+
+	if len(requestedIPs) != 0 {
+		configBridge.Args = &bridgeArgs{}
+		configBridge.Args.CNI.IPs = requestedIPs
+	}
+
 	if config, err = json.Marshal(configBridge); err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
@@ -669,7 +1303,8 @@ func getBridgePluginConfig(networkDir, spID string, subnetwork *net.IPNet) (conf
 	return config, nil
 }
 
-func getFirewallPluginConfig(serviceID string, exposedPorts, allowedConnections []string) (config json.RawMessage, err error) {
+func getFirewallPluginConfig(serviceID string, exposedPorts, allowedConnections []string,
+	ipv6 bool) (config json.RawMessage, err error) {
 	aosFirewall := &aosFirewallNetConf{
 		Type:                   "aos-firewall",
 		UUID:                   serviceID,
@@ -677,6 +1312,11 @@ func getFirewallPluginConfig(serviceID string, exposedPorts, allowedConnections
 		AllowPublicConnections: true,
 	}
 
+	// the same access rules are applied to service IPv6 address with ip6tables
+	if ipv6 {
+		aosFirewall.IP6tablesAdminChainName = adminChainPrefix + serviceID
+	}
+
 	// ExposedPorts format port/protocol
 	for _, exposePort := range exposedPorts {
 		portConfig := strings.Split(exposePort, "/")
@@ -739,6 +1379,20 @@ func getBandwidthPluginConfig(ingressKbit, egressKbit uint64) (config json.RawMe
 	return config, nil
 }
 
+func getPortMapPluginConfig() (config json.RawMessage, err error) {
+	configPortMap := &portMapNetConf{
+		Type:         "portmap",
+		SNAT:         true,
+		Capabilities: map[string]bool{"portMappings": true},
+	}
+
+	if config, err = json.Marshal(configPortMap); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return config, nil
+}
+
 func getDNSPluginConfig(spID string) (config json.RawMessage, err error) {
 	configDNS := &aosDNSNetConf{
 		Type:         "dnsname",
@@ -769,7 +1423,8 @@ func getRuntimeNetConfig(serviceID, spID string) (networkingConfig *cni.NetworkC
 	return networkingConfig, runtimeConfig
 }
 
-func prepareRuntimeConfig(serviceID, spID, hostname string, aliases []string) (runtimeConfig *cni.RuntimeConf, err error) {
+func prepareRuntimeConfig(serviceID, spID, hostname string, aliases []string,
+	publishedPorts []PortMapping) (runtimeConfig *cni.RuntimeConf, err error) {
 	runtimeConfig = &cni.RuntimeConf{
 		ContainerID: serviceID,
 		NetNS:       GetNetNsPathByName(serviceID),
@@ -789,16 +1444,31 @@ func prepareRuntimeConfig(serviceID, spID, hostname string, aliases []string) (r
 		runtimeConfig.CapabilityArgs["aliases"] = map[string][]string{spID: aliases}
 	}
 
+	if len(publishedPorts) != 0 {
+		portMappings := make([]portMapEntry, 0, len(publishedPorts))
+
+		for _, port := range publishedPorts {
+			portMappings = append(portMappings, portMapEntry{
+				HostPort:      int(port.HostPort),
+				ContainerPort: int(port.ContainerPort),
+				Protocol:      port.Protocol,
+				HostIP:        port.HostIP,
+			})
+		}
+
+		runtimeConfig.CapabilityArgs["portMappings"] = portMappings
+	}
+
 	return runtimeConfig, nil
 }
 
-func prepareNetworkConfigList(networkDir, serviceID, spID string, subnetwork *net.IPNet,
-	params *NetworkParams) (cniNetworkConfig *cni.NetworkConfigList, err error) {
+func prepareNetworkConfigList(networkDir, serviceID, spID string, subnetwork, ipv6Subnetwork *net.IPNet,
+	requestedIPs []string, params *NetworkParams) (cniNetworkConfig *cni.NetworkConfigList, err error) {
 	networkConfig := cniNetwork{Name: spID, CNIVersion: cniVersion}
 
 	// Bridge
 
-	bridgeConfig, err := getBridgePluginConfig(networkDir, spID, subnetwork)
+	bridgeConfig, err := getBridgePluginConfig(networkDir, spID, subnetwork, ipv6Subnetwork, requestedIPs)
 	if err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
@@ -807,8 +1477,16 @@ func prepareNetworkConfigList(networkDir, serviceID, spID string, subnetwork *ne
 
 	// Firewall
 
-	if len(params.AllowedConnections) > 0 || len(params.ExposedPorts) > 0 {
-		firefallConfig, err := getFirewallPluginConfig(serviceID, params.ExposedPorts, params.AllowedConnections)
+	// published ports should be accessible through the firewall
+	exposedPorts := append([]string{}, params.ExposedPorts...)
+
+	for _, port := range params.PublishedPorts {
+		exposedPorts = append(exposedPorts, strconv.Itoa(int(port.ContainerPort))+"/"+port.Protocol)
+	}
+
+	if len(params.AllowedConnections) > 0 || len(exposedPorts) > 0 {
+		firefallConfig, err := getFirewallPluginConfig(serviceID, exposedPorts, params.AllowedConnections,
+			ipv6Subnetwork != nil)
 		if err != nil {
 			return nil, aoserrors.Wrap(err)
 		}
@@ -816,6 +1494,17 @@ func prepareNetworkConfigList(networkDir, serviceID, spID string, subnetwork *ne
 		networkConfig.Plugins = append(networkConfig.Plugins, firefallConfig)
 	}
 
+	// Port mapping
+
+	if len(params.PublishedPorts) > 0 {
+		portMapConfig, err := getPortMapPluginConfig()
+		if err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		networkConfig.Plugins = append(networkConfig.Plugins, portMapConfig)
+	}
+
 	// Bandwidth
 
 	if params.IngressKbit > 0 || params.EgressKbit > 0 {
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networkmanager
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestParsePortMapping(t *testing.T) {
+	testData := []struct {
+		port    string
+		mapping PortMapping
+		fail    bool
+	}{
+		{port: "8080:80", mapping: PortMapping{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}},
+		{port: "5000:53/udp", mapping: PortMapping{HostPort: 5000, ContainerPort: 53, Protocol: "udp"}},
+		{
+			port:    "192.168.0.1:8080:80/tcp",
+			mapping: PortMapping{HostIP: "192.168.0.1", HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+		},
+		{
+			port:    "[fd00::1]:8080:80",
+			mapping: PortMapping{HostIP: "fd00::1", HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+		},
+		{port: "80", fail: true},
+		{port: "8080:80/sctp", fail: true},
+		{port: "70000:80", fail: true},
+		{port: "8080:0", fail: true},
+		{port: "host:8080:80", fail: true},
+	}
+
+	for _, item := range testData {
+		mapping, err := ParsePortMapping(item.port)
+		if item.fail {
+			if err == nil {
+				t.Errorf("Error expected for port %s", item.port)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Can't parse port %s: %s", item.port, err)
+
+			continue
+		}
+
+		if mapping != item.mapping {
+			t.Errorf("Wrong port mapping: %+v", mapping)
+		}
+	}
+}
+
+func TestPublishedPortsConfig(t *testing.T) {
+	publishedPorts := []PortMapping{{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}}
+
+	runtimeConfig, err := prepareRuntimeConfig("service1", "sp1", "", nil, publishedPorts)
+	if err != nil {
+		t.Fatalf("Can't prepare runtime config: %s", err)
+	}
+
+	portMappings, ok := runtimeConfig.CapabilityArgs["portMappings"].([]portMapEntry)
+	if !ok || len(portMappings) != 1 || portMappings[0].HostPort != 8080 || portMappings[0].ContainerPort != 80 {
+		t.Errorf("Wrong port mappings: %v", runtimeConfig.CapabilityArgs)
+	}
+
+	config, err := getPortMapPluginConfig()
+	if err != nil {
+		t.Fatalf("Can't get port map config: %s", err)
+	}
+
+	var portMapConfig portMapNetConf
+
+	if err = json.Unmarshal(config, &portMapConfig); err != nil {
+		t.Fatalf("Can't unmarshal port map config: %s", err)
+	}
+
+	if portMapConfig.Type != "portmap" || !portMapConfig.Capabilities["portMappings"] {
+		t.Errorf("Wrong port map config: %+v", portMapConfig)
+	}
+}
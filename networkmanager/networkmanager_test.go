@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
 	"path"
@@ -104,7 +105,7 @@ func TestAddRemoveService(t *testing.T) {
 			t.Errorf("Service should be in network: %s", err)
 		}
 
-		if _, err := manager.GetServiceIP(fmt.Sprintf("service%d", i), "network0"); err != nil {
+		if _, _, err := manager.GetServiceIP(fmt.Sprintf("service%d", i), "network0"); err != nil {
 			t.Errorf("Can't get service ip: %s", err)
 		}
 	}
@@ -179,6 +180,86 @@ func TestInternet(t *testing.T) {
 	}
 }
 
+func TestServiceIPReservation(t *testing.T) {
+	t.Cleanup(func() {
+		_ = manager.ReleaseServiceIP("servicenm5")
+		_ = manager.DeleteNetwork("network0")
+	})
+
+	if err := manager.AddServiceToNetwork("servicenm5", "network0", networkmanager.NetworkParams{}); err != nil {
+		t.Fatalf("Can't add service to network: %s", err)
+	}
+
+	ip, _, err := manager.GetServiceIP("servicenm5", "network0")
+	if err != nil {
+		t.Fatalf("Can't get service IP: %s", err)
+	}
+
+	if err = manager.RemoveServiceFromNetwork("servicenm5", "network0"); err != nil {
+		t.Fatalf("Can't remove service from network: %s", err)
+	}
+
+	// reserved address should not be given to other service
+	if err = manager.AddServiceToNetwork("servicenm6", "network0", networkmanager.NetworkParams{}); err != nil {
+		t.Fatalf("Can't add service to network: %s", err)
+	}
+
+	otherIP, _, err := manager.GetServiceIP("servicenm6", "network0")
+	if err != nil {
+		t.Fatalf("Can't get service IP: %s", err)
+	}
+
+	if otherIP == ip {
+		t.Errorf("Reserved IP %s is given to other service", ip)
+	}
+
+	if err = manager.RemoveServiceFromNetwork("servicenm6", "network0"); err != nil {
+		t.Fatalf("Can't remove service from network: %s", err)
+	}
+
+	if err = manager.ReleaseServiceIP("servicenm6"); err != nil {
+		t.Fatalf("Can't release service IP: %s", err)
+	}
+
+	if err = manager.AddServiceToNetwork("servicenm5", "network0", networkmanager.NetworkParams{}); err != nil {
+		t.Fatalf("Can't add service to network: %s", err)
+	}
+
+	restoredIP, _, err := manager.GetServiceIP("servicenm5", "network0")
+	if err != nil {
+		t.Fatalf("Can't get service IP: %s", err)
+	}
+
+	if restoredIP != ip {
+		t.Errorf("Wrong restored service IP: %s", restoredIP)
+	}
+
+	if err = manager.RemoveServiceFromNetwork("servicenm5", "network0"); err != nil {
+		t.Fatalf("Can't remove service from network: %s", err)
+	}
+
+	staticIP := net.ParseIP(ip).To4()
+	staticIP[3] += 10
+
+	if err = manager.AddServiceToNetwork("servicenm5", "network0", networkmanager.NetworkParams{
+		IP: staticIP.String(),
+	}); err != nil {
+		t.Fatalf("Can't add service to network: %s", err)
+	}
+
+	if restoredIP, _, err = manager.GetServiceIP("servicenm5", "network0"); err != nil {
+		t.Fatalf("Can't get service IP: %s", err)
+	}
+
+	if restoredIP != staticIP.String() {
+		t.Errorf("Wrong static service IP: %s", restoredIP)
+	}
+
+	if err = manager.RemoveServiceFromNetwork("servicenm5", "network0"); err != nil {
+		t.Fatalf("Can't remove service from network: %s", err)
+	}
+}
+
 func TestInterServiceConnection(t *testing.T) {
 	t.Cleanup(func() {
 		_ = killOCIContainer("servicenm2")
@@ -203,7 +284,7 @@ func TestInterServiceConnection(t *testing.T) {
 		t.Fatalf("Can't create service container: %s", err)
 	}
 
-	ip, err := manager.GetServiceIP("servicenm2", "network0")
+	ip, _, err := manager.GetServiceIP("servicenm2", "network0")
 	if err != nil {
 		t.Fatalf("Can't get ip address from service: %s", err)
 	}
@@ -261,7 +342,7 @@ func TestExposedPortAndAllowedConnection(t *testing.T) {
 		t.Fatalf("Can't add service to network: %s", err)
 	}
 
-	servIP, err := manager.GetServiceIP(serverServiceID, "networkSP1")
+	servIP, _, err := manager.GetServiceIP(serverServiceID, "networkSP1")
 	if err != nil {
 		t.Fatalf("Can't get ip address from service: %s", err)
 	}
@@ -395,7 +476,7 @@ func TestBandwidth(t *testing.T) {
 
 	go runOCIContainer(container0Path, "service0") // nolint:errcheck
 
-	ip, err := manager.GetServiceIP("service0", "network0")
+	ip, _, err := manager.GetServiceIP("service0", "network0")
 	if err != nil {
 		t.Fatalf("Can't get ip address from service: %s", err)
 	}
@@ -457,7 +538,7 @@ func setup() (err error) {
 		return aoserrors.Wrap(err)
 	}
 
-	if manager, err = networkmanager.New(&config.Config{WorkingDir: tmpDir}, nil); err != nil {
+	if manager, err = networkmanager.New(&config.Config{WorkingDir: tmpDir}, nil, nil); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
@@ -42,7 +42,8 @@ var defaultContent = []config.Host{
  * Private
  ******************************************************************************/
 
-func writeHostToHostsFile(hostsFilePath, ip, serviceID, hostname string, hosts []config.Host) (err error) {
+func writeHostToHostsFile(hostsFilePath string, ips []string, serviceID, hostname string,
+	hosts []config.Host) (err error) {
 	content := bytes.NewBuffer(nil)
 
 	if err = writeHosts(content, defaultContent); err != nil {
@@ -55,7 +56,13 @@ func writeHostToHostsFile(hostsFilePath, ip, serviceID, hostname string, hosts [
 		ownHosts = ownHosts + " " + hostname
 	}
 
-	if err = writeHosts(content, append([]config.Host{{IP: ip, Hostname: ownHosts}}, hosts...)); err != nil {
+	ownContent := make([]config.Host, 0, len(ips)+len(hosts))
+
+	for _, ip := range ips {
+		ownContent = append(ownContent, config.Host{IP: ip, Hostname: ownHosts})
+	}
+
+	if err = writeHosts(content, append(ownContent, hosts...)); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
@@ -0,0 +1,231 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networkmanager
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"path"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/apparentlymart/go-cidr/cidr"
+	log "github.com/sirupsen/logrus"
+)
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// ReleaseServiceIP removes service IP addresses reservation, should be called when service is removed
+func (manager *NetworkManager) ReleaseServiceIP(serviceID string) (err error) {
+	manager.Lock()
+	defer manager.Unlock()
+
+	log.WithField("serviceID", serviceID).Debug("Release service IP")
+
+	if _, ok := manager.serviceIPs[serviceID]; !ok {
+		return nil
+	}
+
+	delete(manager.serviceIPs, serviceID)
+
+	if manager.networkStorage != nil {
+		if err = manager.networkStorage.RemoveServiceIP(serviceID); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func (manager *NetworkManager) restoreServiceIPs() {
+	serviceIPs, err := manager.networkStorage.GetServiceIPs()
+	if err != nil {
+		log.Errorf("Can't get stored service IPs: %s", err)
+
+		return
+	}
+
+	for _, serviceIP := range serviceIPs {
+		manager.serviceIPs[serviceIP.ServiceID] = serviceIP
+	}
+}
+
+func (manager *NetworkManager) saveServiceIP(serviceIP ServiceIPInfo) {
+	if reserved, ok := manager.serviceIPs[serviceIP.ServiceID]; ok && reserved == serviceIP {
+		return
+	}
+
+	manager.serviceIPs[serviceIP.ServiceID] = serviceIP
+
+	if manager.networkStorage == nil {
+		return
+	}
+
+	if err := manager.networkStorage.SetServiceIP(serviceIP); err != nil {
+		log.WithField("serviceID", serviceIP.ServiceID).Errorf("Can't store service IP: %s", err)
+	}
+}
+
+func (manager *NetworkManager) releaseNetworkServiceIPs(spID string) {
+	for serviceID, serviceIP := range manager.serviceIPs {
+		if serviceIP.SpID != spID {
+			continue
+		}
+
+		delete(manager.serviceIPs, serviceID)
+
+		if manager.networkStorage == nil {
+			continue
+		}
+
+		if err := manager.networkStorage.RemoveServiceIP(serviceID); err != nil {
+			log.WithField("serviceID", serviceID).Errorf("Can't remove service IP from storage: %s", err)
+		}
+	}
+}
+
+// getRequestedIPs returns addresses which are requested from IPAM plugin: static address has priority,
+// then address reserved on previous start is used, otherwise the first free address of the subnet is taken.
+func (manager *NetworkManager) getRequestedIPs(serviceID, spID string, subnet, ipv6Subnet *net.IPNet,
+	params *NetworkParams) (requestedIPs []string, err error) {
+	reserved := manager.serviceIPs[serviceID]
+
+	if reserved.SpID != spID {
+		reserved = ServiceIPInfo{}
+	}
+
+	usedIPs := manager.getUsedIPs(serviceID, spID)
+
+	ip, err := selectServiceIP(subnet, params.IP, reserved.IP, usedIPs)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	requestedIPs = append(requestedIPs, ip)
+
+	if ipv6Subnet == nil {
+		if params.IPv6 != "" {
+			return nil, aoserrors.New("static IPv6 address is requested but IPv6 is disabled")
+		}
+
+		return requestedIPs, nil
+	}
+
+	ipv6, err := selectServiceIP(ipv6Subnet, params.IPv6, reserved.IPv6, usedIPs)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return append(requestedIPs, ipv6), nil
+}
+
+// getUsedIPs returns addresses reserved by other services of the network and addresses allocated by IPAM plugin
+func (manager *NetworkManager) getUsedIPs(serviceID, spID string) (usedIPs map[string]bool) {
+	usedIPs = make(map[string]bool)
+
+	for _, serviceIP := range manager.serviceIPs {
+		if serviceIP.ServiceID == serviceID || serviceIP.SpID != spID {
+			continue
+		}
+
+		usedIPs[serviceIP.IP] = true
+
+		if serviceIP.IPv6 != "" {
+			usedIPs[serviceIP.IPv6] = true
+		}
+	}
+
+	// host-local plugin names allocation files by addresses
+	files, _ := ioutil.ReadDir(path.Join(manager.networkDir, spID))
+
+	for _, file := range files {
+		if ip := net.ParseIP(file.Name()); ip != nil {
+			usedIPs[ip.String()] = true
+		}
+	}
+
+	return usedIPs
+}
+
+func selectServiceIP(subnet *net.IPNet, staticIP, reservedIP string,
+	usedIPs map[string]bool) (ip string, err error) {
+	if staticIP != "" {
+		requestedIP := net.ParseIP(staticIP)
+		if requestedIP == nil {
+			return "", aoserrors.Errorf("invalid static IP address %s", staticIP)
+		}
+
+		if !isServiceIPInSubnet(requestedIP, subnet) {
+			return "", aoserrors.Errorf("static IP address %s is out of network %s", staticIP, subnet)
+		}
+
+		if usedIPs[requestedIP.String()] {
+			return "", aoserrors.Errorf("static IP address %s is already in use", staticIP)
+		}
+
+		return requestedIP.String(), nil
+	}
+
+	if reserved := net.ParseIP(reservedIP); reserved != nil &&
+		isServiceIPInSubnet(reserved, subnet) && !usedIPs[reserved.String()] {
+		return reserved.String(), nil
+	}
+
+	minIP, maxIP := getServiceIPRange(subnet)
+
+	for current := minIP; ; current = cidr.Inc(current) {
+		if !usedIPs[current.String()] {
+			return current.String(), nil
+		}
+
+		if current.Equal(maxIP) {
+			break
+		}
+	}
+
+	return "", aoserrors.Errorf("no free IP address in network %s", subnet)
+}
+
+// getServiceIPRange returns range of service addresses, the first address of the subnet range is the gateway
+func getServiceIPRange(subnet *net.IPNet) (minIP, maxIP net.IP) {
+	minIP, maxIP = getIPAddressRange(subnet)
+
+	return cidr.Inc(minIP), maxIP
+}
+
+func isServiceIPInSubnet(ip net.IP, subnet *net.IPNet) (result bool) {
+	minIP, maxIP := getServiceIPRange(subnet)
+
+	return subnet.Contains(ip) &&
+		bytes.Compare(ip.To16(), minIP.To16()) >= 0 && bytes.Compare(ip.To16(), maxIP.To16()) <= 0
+}
+
+// isSameIP returns true if requested address is not set or equals to the actual one
+func isSameIP(requestedIP, actualIP string) (result bool) {
+	if requestedIP == "" {
+		return true
+	}
+
+	return net.ParseIP(requestedIP).Equal(net.ParseIP(actualIP))
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networkmanager
+
+import (
+	"net"
+	"testing"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestSelectServiceIP(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("172.17.0.0/29")
+
+	usedIPs := map[string]bool{"172.17.0.2": true}
+
+	testData := []struct {
+		staticIP   string
+		reservedIP string
+		ip         string
+		fail       bool
+	}{
+		{ip: "172.17.0.3"},
+		{reservedIP: "172.17.0.5", ip: "172.17.0.5"},
+		{reservedIP: "172.17.0.2", ip: "172.17.0.3"},
+		{reservedIP: "172.18.0.5", ip: "172.17.0.3"},
+		{staticIP: "172.17.0.6", reservedIP: "172.17.0.5", ip: "172.17.0.6"},
+		{staticIP: "172.17.0.2", fail: true},
+		{staticIP: "172.17.0.1", fail: true},
+		{staticIP: "172.17.0.7", fail: true},
+		{staticIP: "172.18.0.3", fail: true},
+		{staticIP: "invalid", fail: true},
+	}
+
+	for _, item := range testData {
+		ip, err := selectServiceIP(subnet, item.staticIP, item.reservedIP, usedIPs)
+		if item.fail {
+			if err == nil {
+				t.Errorf("Error expected for static IP %s", item.staticIP)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Can't select service IP: %s", err)
+
+			continue
+		}
+
+		if ip != item.ip {
+			t.Errorf("Wrong service IP: %s", ip)
+		}
+	}
+
+	for _, ip := range []string{"172.17.0.3", "172.17.0.4", "172.17.0.5", "172.17.0.6"} {
+		usedIPs[ip] = true
+	}
+
+	if _, err := selectServiceIP(subnet, "", "", usedIPs); err == nil {
+		t.Error("Error expected for exhausted network")
+	}
+
+	_, ipv6Subnet, _ := net.ParseCIDR("fd00:a05:0:1::/64")
+
+	ip, err := selectServiceIP(ipv6Subnet, "fd00:a05:0:1:0::10", "", usedIPs)
+	if err != nil {
+		t.Fatalf("Can't select service IP: %s", err)
+	}
+
+	if ip != "fd00:a05:0:1::10" {
+		t.Errorf("Wrong service IP: %s", ip)
+	}
+}
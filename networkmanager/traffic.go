@@ -58,27 +58,32 @@ type trafficChains struct {
 }
 
 type trafficData struct {
-	disabled     bool
-	addresses    string
-	currentValue uint64
-	initialValue uint64
-	subValue     uint64
-	limit        uint64
-	lastUpdate   time.Time
+	disabled  bool
+	addresses string
+	// ipv6Addresses IPv6 addresses of ip6tables chain, empty if there is no such chain
+	ipv6Addresses string
+	currentValue  uint64
+	initialValue  uint64
+	subValue      uint64
+	limit         uint64
+	lastUpdate    time.Time
 }
 
 type trafficMonitoring struct {
-	iptables         *iptables.IPTables
-	trafficPeriod    int
-	skipAddresses    string
-	inChain          string
-	outChain         string
-	trafficMap       map[string]*trafficData
-	serviceChainsMap map[string]*trafficChains
-	trafficStorage   TrafficStorage
+	iptables          *iptables.IPTables
+	ip6tables         *iptables.IPTables
+	trafficPeriod     int
+	skipAddresses     string
+	skipIPv6Addresses string
+	inChain           string
+	outChain          string
+	trafficMap        map[string]*trafficData
+	serviceChainsMap  map[string]*trafficChains
+	trafficStorage    TrafficStorage
 }
 
-func newTrafficMonitor(trafficStorage TrafficStorage) (monitor *trafficMonitoring, err error) {
+func newTrafficMonitor(trafficStorage TrafficStorage, poolNetworks []*networkToSplit,
+	ipv6 bool) (monitor *trafficMonitoring, err error) {
 	monitor = &trafficMonitoring{
 		trafficPeriod:  DayPeriod,
 		trafficStorage: trafficStorage,
@@ -92,6 +97,12 @@ func newTrafficMonitor(trafficStorage TrafficStorage) (monitor *trafficMonitorin
 		return nil, aoserrors.Wrap(err)
 	}
 
+	if ipv6 {
+		if monitor.ip6tables, err = iptables.NewWithProtocol(iptables.ProtocolIPv6); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+	}
+
 	monitor.inChain = "AOS_SYSTEM_IN"
 	monitor.outChain = "AOS_SYSTEM_OUT"
 
@@ -105,17 +116,20 @@ func newTrafficMonitor(trafficStorage TrafficStorage) (monitor *trafficMonitorin
 		"127.0.0.0/8", "10.0.0.0/8", "192.168.0.0/16", "172.16.0.0/12",
 	}
 
-	for _, bridgeSubnet := range predefinedPrivateNetworks {
+	for _, bridgeSubnet := range poolNetworks {
 		skipNetworks = append(skipNetworks, bridgeSubnet.ipSubNet)
 	}
 
 	monitor.skipAddresses = strings.Join(skipNetworks, ",")
 
-	if err = monitor.createTrafficChain(monitor.inChain, "INPUT", "0/0"); err != nil {
+	// Service IPv6 networks are allocated from unique local addresses
+	monitor.skipIPv6Addresses = strings.Join([]string{"::1/128", "fe80::/10", "fc00::/7"}, ",")
+
+	if err = monitor.createTrafficChain(monitor.inChain, "INPUT", "0/0", "::/0"); err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
 
-	if err = monitor.createTrafficChain(monitor.outChain, "OUTPUT", "0/0"); err != nil {
+	if err = monitor.createTrafficChain(monitor.outChain, "OUTPUT", "0/0", "::/0"); err != nil {
 		return nil, aoserrors.Wrap(err)
 	}
 
@@ -130,8 +144,25 @@ func newTrafficMonitor(trafficStorage TrafficStorage) (monitor *trafficMonitorin
  * Private
  ******************************************************************************/
 
-func (monitor *trafficMonitoring) getTrafficChainBytes(chain string) (value uint64, err error) {
-	stats, err := monitor.iptables.ListWithCounters("filter", chain)
+func (monitor *trafficMonitoring) getTrafficChainBytes(chain string, traffic *trafficData) (value uint64, err error) {
+	if value, err = getChainBytes(monitor.iptables, chain); err != nil {
+		return 0, err
+	}
+
+	if monitor.ip6tables != nil && traffic.ipv6Addresses != "" {
+		ipv6Value, err := getChainBytes(monitor.ip6tables, chain)
+		if err != nil {
+			return 0, err
+		}
+
+		value += ipv6Value
+	}
+
+	return value, nil
+}
+
+func getChainBytes(ipt *iptables.IPTables, chain string) (value uint64, err error) {
+	stats, err := ipt.ListWithCounters("filter", chain)
 	if err != nil {
 		return 0, err
 	}
@@ -178,9 +209,23 @@ func (monitor *trafficMonitoring) isSamePeriod(t1, t2 time.Time) (result bool) {
 	}
 }
 
-func (monitor *trafficMonitoring) setChainState(chain, addresses string, enable bool) (err error) {
+func (monitor *trafficMonitoring) setChainState(chain string, traffic *trafficData, enable bool) (err error) {
 	log.WithFields(log.Fields{"chain": chain, "state": enable}).Debug("Set chain state")
 
+	if err = setIPTablesChainState(monitor.iptables, chain, traffic.addresses, enable); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if monitor.ip6tables != nil && traffic.ipv6Addresses != "" {
+		if err = setIPTablesChainState(monitor.ip6tables, chain, traffic.ipv6Addresses, enable); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func setIPTablesChainState(ipt *iptables.IPTables, chain, addresses string, enable bool) (err error) {
 	var addrType string
 
 	if strings.HasSuffix(chain, "_IN") {
@@ -192,19 +237,19 @@ func (monitor *trafficMonitoring) setChainState(chain, addresses string, enable
 	}
 
 	if enable {
-		if err = monitor.deleteAllRules(chain, addrType, addresses, "-j", "DROP"); err != nil {
+		if err = deleteAllRules(ipt, "filter", chain, addrType, addresses, "-j", "DROP"); err != nil {
 			return aoserrors.Wrap(err)
 		}
 
-		if err = monitor.iptables.Append("filter", chain, addrType, addresses); err != nil {
+		if err = ipt.Append("filter", chain, addrType, addresses); err != nil {
 			return aoserrors.Wrap(err)
 		}
 	} else {
-		if err = monitor.deleteAllRules(chain, addrType, addresses); err != nil {
+		if err = deleteAllRules(ipt, "filter", chain, addrType, addresses); err != nil {
 			return aoserrors.Wrap(err)
 		}
 
-		if err = monitor.iptables.Append("filter", chain, addrType, addresses, "-j", "DROP"); err != nil {
+		if err = ipt.Append("filter", chain, addrType, addresses, "-j", "DROP"); err != nil {
 			return aoserrors.Wrap(err)
 		}
 	}
@@ -212,9 +257,9 @@ func (monitor *trafficMonitoring) setChainState(chain, addresses string, enable
 	return nil
 }
 
-func (monitor *trafficMonitoring) deleteAllRules(chain string, rulespec ...string) (err error) {
+func deleteAllRules(ipt *iptables.IPTables, table, chain string, rulespec ...string) (err error) {
 	for {
-		if err = monitor.iptables.Delete("filter", chain, rulespec...); err != nil {
+		if err = ipt.Delete(table, chain, rulespec...); err != nil {
 			errIPTables, ok := err.(*iptables.Error)
 			if ok && errIPTables.IsNotExist() {
 				return nil
@@ -225,11 +270,37 @@ func (monitor *trafficMonitoring) deleteAllRules(chain string, rulespec ...strin
 	}
 }
 
-func (monitor *trafficMonitoring) createTrafficChain(chain, rootChain, addresses string) (err error) {
-	var skipAddrType, addrType string
-
+func (monitor *trafficMonitoring) createTrafficChain(chain, rootChain, addresses, ipv6Addresses string) (err error) {
 	log.WithField("chain", chain).Debug("Create iptables chain")
 
+	if err = createIPTablesChain(monitor.iptables, chain, rootChain, monitor.skipAddresses, addresses); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	traffic := trafficData{addresses: addresses}
+
+	if monitor.ip6tables != nil && ipv6Addresses != "" {
+		if err = createIPTablesChain(
+			monitor.ip6tables, chain, rootChain, monitor.skipIPv6Addresses, ipv6Addresses); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		traffic.ipv6Addresses = ipv6Addresses
+	}
+
+	if traffic.lastUpdate, traffic.initialValue, err =
+		monitor.trafficStorage.GetTrafficMonitorData(chain); err != nil && !strings.Contains(err.Error(), "not exist") {
+		return aoserrors.Wrap(err)
+	}
+
+	monitor.trafficMap[chain] = &traffic
+
+	return nil
+}
+
+func createIPTablesChain(ipt *iptables.IPTables, chain, rootChain, skipAddresses, addresses string) (err error) {
+	var skipAddrType, addrType string
+
 	if strings.HasSuffix(chain, "_IN") {
 		skipAddrType = "-s"
 		addrType = "-d"
@@ -240,34 +311,25 @@ func (monitor *trafficMonitoring) createTrafficChain(chain, rootChain, addresses
 		addrType = "-s"
 	}
 
-	if err = monitor.iptables.NewChain("filter", chain); err != nil {
+	if err = ipt.NewChain("filter", chain); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if err = monitor.iptables.Insert("filter", rootChain, 1, "-j", chain); err != nil {
+	if err = ipt.Insert("filter", rootChain, 1, "-j", chain); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
 	// This addresses will be not count but returned back to the root chain
-	if monitor.skipAddresses != "" {
-		if err = monitor.iptables.Append("filter", chain, skipAddrType, monitor.skipAddresses, "-j", "RETURN"); err != nil {
+	if skipAddresses != "" {
+		if err = ipt.Append("filter", chain, skipAddrType, skipAddresses, "-j", "RETURN"); err != nil {
 			return aoserrors.Wrap(err)
 		}
 	}
 
-	if err = monitor.iptables.Append("filter", chain, addrType, addresses); err != nil {
-		return aoserrors.Wrap(err)
-	}
-
-	traffic := trafficData{addresses: addresses}
-
-	if traffic.lastUpdate, traffic.initialValue, err =
-		monitor.trafficStorage.GetTrafficMonitorData(chain); err != nil && !strings.Contains(err.Error(), "not exist") {
+	if err = ipt.Append("filter", chain, addrType, addresses); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	monitor.trafficMap[chain] = &traffic
-
 	return nil
 }
 
@@ -284,15 +346,38 @@ func (monitor *trafficMonitoring) deleteTrafficChain(chain, rootChain string) (e
 
 	delete(monitor.trafficMap, chain)
 
-	if err = monitor.deleteAllRules(rootChain, "-j", chain); err != nil {
+	if err = deleteIPTablesChain(monitor.iptables, "filter", chain, rootChain); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if err = monitor.iptables.ClearChain("filter", chain); err != nil {
+	if monitor.ip6tables != nil {
+		if err = deleteIPTablesChain(monitor.ip6tables, "filter", chain, rootChain); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func deleteIPTablesChain(ipt *iptables.IPTables, table, chain, rootChain string) (err error) {
+	exist, err := ipt.ChainExists(table, chain)
+	if err != nil {
 		return aoserrors.Wrap(err)
 	}
 
-	if err = monitor.iptables.DeleteChain("filter", chain); err != nil {
+	if !exist {
+		return nil
+	}
+
+	if err = deleteAllRules(ipt, table, rootChain, "-j", chain); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = ipt.ClearChain(table, chain); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = ipt.DeleteChain(table, chain); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
@@ -307,7 +392,7 @@ func (monitor *trafficMonitoring) processTrafficMonitor() error {
 		var err error
 
 		if !traffic.disabled {
-			value, err = monitor.getTrafficChainBytes(chain)
+			value, err = monitor.getTrafficChainBytes(chain, traffic)
 			if err != nil {
 				log.WithField("chain", chain).Errorf("Can't get chain byte count: %s", err)
 				continue
@@ -330,7 +415,7 @@ func (monitor *trafficMonitoring) processTrafficMonitor() error {
 		if traffic.limit != 0 {
 			if traffic.currentValue > traffic.limit && !traffic.disabled {
 				// disable chain
-				if err := monitor.setChainState(chain, traffic.addresses, false); err != nil {
+				if err := monitor.setChainState(chain, traffic, false); err != nil {
 					log.WithField("chain", chain).Errorf("Can't disable chain: %s", err)
 				} else {
 					traffic.disabled = true
@@ -341,7 +426,7 @@ func (monitor *trafficMonitoring) processTrafficMonitor() error {
 
 			if traffic.currentValue < traffic.limit && traffic.disabled {
 				// enable chain
-				if err = monitor.setChainState(chain, traffic.addresses, true); err != nil {
+				if err = monitor.setChainState(chain, traffic, true); err != nil {
 					log.WithField("chain", chain).Errorf("Can't enable chain: %s", err)
 				} else {
 					traffic.disabled = false
@@ -372,6 +457,30 @@ func (monitor *trafficMonitoring) deleteAllTrafficChains() (err error) {
 		return aoserrors.Wrap(err)
 	}
 
+	// ip6tables chains could be left without iptables ones
+	if monitor.ip6tables != nil {
+		ipv6ChainList, err := monitor.ip6tables.ListChains("filter")
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		for _, chain := range ipv6ChainList {
+			found := false
+
+			for _, existingChain := range chainList {
+				if chain == existingChain {
+					found = true
+
+					break
+				}
+			}
+
+			if !found {
+				chainList = append(chainList, chain)
+			}
+		}
+	}
+
 	for _, chain := range chainList {
 		switch {
 		case !strings.HasPrefix(chain, "AOS_"):
@@ -398,7 +507,8 @@ func (monitor *trafficMonitoring) deleteAllTrafficChains() (err error) {
 	return nil
 }
 
-func (monitor *trafficMonitoring) startTrafficMonitor(serviceID, IPAddress string, downloadLimit, uploadLimit uint64) (err error) {
+func (monitor *trafficMonitoring) startTrafficMonitor(serviceID, IPAddress, IPv6Address string,
+	downloadLimit, uploadLimit uint64) (err error) {
 	if IPAddress == "" {
 		return nil
 	}
@@ -408,13 +518,13 @@ func (monitor *trafficMonitoring) startTrafficMonitor(serviceID, IPAddress strin
 	chainBase := strconv.FormatUint(hash.Sum64(), 16)
 	serviceChains := trafficChains{inChain: "AOS_" + chainBase + "_IN", outChain: "AOS_" + chainBase + "_OUT"}
 
-	if err = monitor.createTrafficChain(serviceChains.inChain, "FORWARD", IPAddress); err != nil {
+	if err = monitor.createTrafficChain(serviceChains.inChain, "FORWARD", IPAddress, IPv6Address); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
 	monitor.trafficMap[serviceChains.inChain].limit = downloadLimit
 
-	if err = monitor.createTrafficChain(serviceChains.outChain, "FORWARD", IPAddress); err != nil {
+	if err = monitor.createTrafficChain(serviceChains.outChain, "FORWARD", IPAddress, IPv6Address); err != nil {
 		return aoserrors.Wrap(err)
 	}
 
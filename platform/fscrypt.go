@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"errors"
+	"os"
+	"unsafe"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"golang.org/x/sys/unix"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// EncryptionKeyID fscrypt master key identifier.
+type EncryptionKeyID [unix.FSCRYPT_KEY_IDENTIFIER_SIZE]byte
+
+/*******************************************************************************
+ * Vars
+ ******************************************************************************/
+
+// ErrNotEncrypted is returned when directory has no encryption policy.
+var ErrNotEncrypted = errors.New("directory is not encrypted")
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// AddEncryptionKey adds fscrypt master key to the file system which contains path and returns key identifier.
+func AddEncryptionKey(path string, key []byte) (keyID EncryptionKeyID, err error) {
+	if len(key) == 0 || len(key) > unix.FSCRYPT_MAX_KEY_SIZE {
+		return keyID, aoserrors.Errorf("wrong encryption key size: %d", len(key))
+	}
+
+	argSize := int(unsafe.Sizeof(unix.FscryptAddKeyArg{}))
+	buffer := make([]byte, argSize+len(key))
+
+	arg := (*unix.FscryptAddKeyArg)(unsafe.Pointer(&buffer[0]))
+	arg.Key_spec.Type = unix.FSCRYPT_KEY_SPEC_TYPE_IDENTIFIER
+	arg.Raw_size = uint32(len(key))
+
+	copy(buffer[argSize:], key)
+
+	err = ioctl(path, unix.FS_IOC_ADD_ENCRYPTION_KEY, unsafe.Pointer(&buffer[0]))
+
+	// wipe raw key copy
+	for i := range buffer[argSize:] {
+		buffer[argSize+i] = 0
+	}
+
+	if err != nil {
+		return keyID, aoserrors.Wrap(err)
+	}
+
+	copy(keyID[:], arg.Key_spec.U[:])
+
+	return keyID, nil
+}
+
+// RemoveEncryptionKey removes fscrypt master key from the file system which contains path. Files which are in use
+// stay accessible until they are closed.
+func RemoveEncryptionKey(path string, keyID EncryptionKeyID) (filesBusy bool, err error) {
+	arg := unix.FscryptRemoveKeyArg{}
+	arg.Key_spec.Type = unix.FSCRYPT_KEY_SPEC_TYPE_IDENTIFIER
+
+	copy(arg.Key_spec.U[:], keyID[:])
+
+	if err = ioctl(path, unix.FS_IOC_REMOVE_ENCRYPTION_KEY, unsafe.Pointer(&arg)); err != nil {
+		return false, aoserrors.Wrap(err)
+	}
+
+	return arg.Removal_status_flags&unix.FSCRYPT_KEY_REMOVAL_STATUS_FLAG_FILES_BUSY != 0, nil
+}
+
+// SetEncryptionPolicy sets fscrypt v2 encryption policy on empty directory.
+func SetEncryptionPolicy(dir string, keyID EncryptionKeyID) (err error) {
+	policy := unix.FscryptPolicyV2{
+		Version:                   unix.FSCRYPT_POLICY_V2,
+		Contents_encryption_mode:  unix.FSCRYPT_MODE_AES_256_XTS,
+		Filenames_encryption_mode: unix.FSCRYPT_MODE_AES_256_CTS,
+		Flags:                     unix.FSCRYPT_POLICY_FLAGS_PAD_32,
+		Master_key_identifier:     keyID,
+	}
+
+	if err = ioctl(dir, unix.FS_IOC_SET_ENCRYPTION_POLICY, unsafe.Pointer(&policy)); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// GetEncryptionKeyID returns master key identifier of directory fscrypt v2 encryption policy.
+func GetEncryptionKeyID(dir string) (keyID EncryptionKeyID, err error) {
+	arg := unix.FscryptGetPolicyExArg{Size: uint64(unsafe.Sizeof(unix.FscryptPolicyV2{}))}
+
+	if err = ioctl(dir, unix.FS_IOC_GET_ENCRYPTION_POLICY_EX, unsafe.Pointer(&arg)); err != nil {
+		if errors.Is(err, unix.ENODATA) {
+			return keyID, ErrNotEncrypted
+		}
+
+		return keyID, aoserrors.Wrap(err)
+	}
+
+	policy := (*unix.FscryptPolicyV2)(unsafe.Pointer(&arg.Policy[0]))
+
+	if policy.Version != unix.FSCRYPT_POLICY_V2 {
+		return keyID, aoserrors.Errorf("unsupported encryption policy version: %d", policy.Version)
+	}
+
+	return policy.Master_key_identifier, nil
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func ioctl(path string, request uintptr, arg unsafe.Pointer) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, file.Fd(), request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
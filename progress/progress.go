@@ -0,0 +1,280 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package progress tracks progress of service and layer install operations
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+// AlertTagInstallProgress tag of alerts which contain install progress notifications.
+const AlertTagInstallProgress = "installProgress"
+
+// Operation types.
+const (
+	OperationTypeService = "service"
+	OperationTypeLayer   = "layer"
+)
+
+// Install phases.
+const (
+	PhaseDownload = "download"
+	PhaseVerify   = "verify"
+	PhaseUnpack   = "unpack"
+	PhaseChown    = "chown"
+	PhaseStart    = "start"
+	PhaseDone     = "done"
+	PhaseFailed   = "failed"
+)
+
+const notificationChannelSize = 32
+
+// download progress is notified not often than this period
+const downloadNotificationPeriod = 1 * time.Second
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// Operation install operation progress.
+type Operation struct {
+	Type       string          `json:"type"`
+	ID         string          `json:"id"`
+	AosVersion uint64          `json:"aosVersion"`
+	Phase      string          `json:"phase"`
+	Downloaded uint64          `json:"downloaded"`
+	Total      uint64          `json:"total"`
+	StartTime  time.Time       `json:"startTime"`
+	UpdateTime time.Time       `json:"updateTime"`
+	Elapsed    config.Duration `json:"elapsed"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// Tracker keeps in-flight install operations and notifies their progress.
+type Tracker struct {
+	sync.Mutex
+
+	operations          map[operationKey]*Reporter
+	notificationChannel chan *pb.Alert
+}
+
+// Reporter reports progress of one install operation. All methods are safe to call on nil reporter.
+type Reporter struct {
+	tracker          *Tracker
+	operation        Operation
+	finished         bool
+	lastNotification time.Time
+}
+
+type operationKey struct {
+	operationType string
+	id            string
+}
+
+type contextKey struct{}
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// New creates new progress tracker.
+func New() (tracker *Tracker) {
+	return &Tracker{
+		operations:          make(map[operationKey]*Reporter),
+		notificationChannel: make(chan *pb.Alert, notificationChannelSize),
+	}
+}
+
+// GetProgressChannel returns channel of install progress notifications.
+func (tracker *Tracker) GetProgressChannel() (channel <-chan *pb.Alert) {
+	return tracker.notificationChannel
+}
+
+// GetOperations returns in-flight install operations.
+func (tracker *Tracker) GetOperations() (operations []Operation) {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	operations = make([]Operation, 0, len(tracker.operations))
+
+	for _, reporter := range tracker.operations {
+		operations = append(operations, reporter.getOperation())
+	}
+
+	sort.Slice(operations, func(i, j int) bool { return operations[i].StartTime.Before(operations[j].StartTime) })
+
+	return operations
+}
+
+// StartOperation starts tracking of new install operation. Previous operation with the same type and ID is replaced.
+func (tracker *Tracker) StartOperation(operationType, id string, aosVersion uint64) (reporter *Reporter) {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	now := time.Now()
+
+	reporter = &Reporter{tracker: tracker, operation: Operation{
+		Type: operationType, ID: id, AosVersion: aosVersion, StartTime: now, UpdateTime: now,
+	}}
+
+	tracker.operations[operationKey{operationType, id}] = reporter
+
+	return reporter
+}
+
+// NewContext returns context which carries progress reporter.
+func NewContext(ctx context.Context, reporter *Reporter) (reporterCtx context.Context) {
+	return context.WithValue(ctx, contextKey{}, reporter)
+}
+
+// FromContext returns progress reporter carried by context or nil.
+func FromContext(ctx context.Context) (reporter *Reporter) {
+	reporter, _ = ctx.Value(contextKey{}).(*Reporter)
+
+	return reporter
+}
+
+// SetPhase sets current install phase.
+func (reporter *Reporter) SetPhase(phase string) {
+	if reporter == nil {
+		return
+	}
+
+	reporter.tracker.Lock()
+	defer reporter.tracker.Unlock()
+
+	if reporter.finished || reporter.operation.Phase == phase {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"type": reporter.operation.Type, "id": reporter.operation.ID, "phase": phase,
+	}).Debug("Install phase")
+
+	reporter.operation.Phase = phase
+	reporter.operation.UpdateTime = time.Now()
+
+	reporter.notify()
+}
+
+// SetDownloaded sets number of downloaded bytes.
+func (reporter *Reporter) SetDownloaded(downloaded, total uint64) {
+	if reporter == nil {
+		return
+	}
+
+	reporter.tracker.Lock()
+	defer reporter.tracker.Unlock()
+
+	if reporter.finished {
+		return
+	}
+
+	reporter.operation.Downloaded = downloaded
+	reporter.operation.Total = total
+	reporter.operation.UpdateTime = time.Now()
+
+	if downloaded != total && time.Since(reporter.lastNotification) < downloadNotificationPeriod {
+		return
+	}
+
+	reporter.notify()
+}
+
+// Finish finishes install operation and removes it from in-flight operations.
+func (reporter *Reporter) Finish(err error) {
+	if reporter == nil {
+		return
+	}
+
+	reporter.tracker.Lock()
+	defer reporter.tracker.Unlock()
+
+	if reporter.finished {
+		return
+	}
+
+	reporter.finished = true
+	reporter.operation.UpdateTime = time.Now()
+
+	if err != nil {
+		reporter.operation.Phase = PhaseFailed
+		reporter.operation.Error = err.Error()
+	} else {
+		reporter.operation.Phase = PhaseDone
+	}
+
+	key := operationKey{reporter.operation.Type, reporter.operation.ID}
+
+	if reporter.tracker.operations[key] == reporter {
+		delete(reporter.tracker.operations, key)
+	}
+
+	reporter.notify()
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func (reporter *Reporter) getOperation() (operation Operation) {
+	operation = reporter.operation
+	operation.Elapsed = config.Duration{Duration: time.Since(operation.StartTime)}
+
+	return operation
+}
+
+func (reporter *Reporter) notify() {
+	reporter.lastNotification = time.Now()
+
+	message, err := json.Marshal(reporter.getOperation())
+	if err != nil {
+		log.Errorf("Can't marshal install progress: %s", err)
+
+		return
+	}
+
+	alert := &pb.Alert{
+		Timestamp:  timestamppb.Now(),
+		Tag:        AlertTagInstallProgress,
+		Source:     reporter.operation.ID,
+		AosVersion: reporter.operation.AosVersion,
+		Payload:    &pb.Alert_SystemAlert{SystemAlert: &pb.SystemAlert{Message: string(message)}},
+	}
+
+	select {
+	case reporter.tracker.notificationChannel <- alert:
+
+	default:
+		log.WithField("id", reporter.operation.ID).Warn("Install progress channel is full, drop notification")
+	}
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package progress_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aoscloud/aos_servicemanager/progress"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestInstallProgress(t *testing.T) {
+	tracker := progress.New()
+
+	reporter := tracker.StartOperation(progress.OperationTypeLayer, "layer1", 1)
+
+	if progress.FromContext(progress.NewContext(context.Background(), reporter)) != reporter {
+		t.Error("Wrong context reporter")
+	}
+
+	reporter.SetPhase(progress.PhaseDownload)
+
+	// first download progress is throttled, last one is always notified
+	reporter.SetDownloaded(10, 100)
+	reporter.SetDownloaded(100, 100)
+
+	operations := tracker.GetOperations()
+	if len(operations) != 1 || operations[0].Type != progress.OperationTypeLayer ||
+		operations[0].Downloaded != 100 || operations[0].Total != 100 {
+		t.Errorf("Wrong operations: %+v", operations)
+	}
+
+	reporter.Finish(errors.New("unpack error"))
+
+	// updates after finish are ignored
+	reporter.SetPhase(progress.PhaseUnpack)
+
+	if operations = tracker.GetOperations(); len(operations) != 0 {
+		t.Errorf("Finished operation is not removed: %+v", operations)
+	}
+
+	var phases []string
+
+	for len(tracker.GetProgressChannel()) != 0 {
+		alert := <-tracker.GetProgressChannel()
+
+		var operation progress.Operation
+
+		if err := json.Unmarshal([]byte(alert.GetSystemAlert().GetMessage()), &operation); err != nil {
+			t.Fatalf("Can't unmarshal progress: %s", err)
+		}
+
+		if alert.GetTag() != progress.AlertTagInstallProgress || alert.GetSource() != "layer1" {
+			t.Errorf("Wrong progress alert: %v", alert)
+		}
+
+		phases = append(phases, operation.Phase)
+
+		if operation.Phase == progress.PhaseFailed && operation.Error != "unpack error" {
+			t.Errorf("Wrong operation error: %s", operation.Error)
+		}
+	}
+
+	if len(phases) != 3 || phases[0] != progress.PhaseDownload || phases[1] != progress.PhaseDownload ||
+		phases[2] != progress.PhaseFailed {
+		t.Errorf("Wrong notified phases: %v", phases)
+	}
+
+	// nil reporter is allowed when progress is not tracked
+	var nilReporter *progress.Reporter
+
+	nilReporter.SetPhase(progress.PhaseDownload)
+	nilReporter.Finish(nil)
+}
@@ -25,6 +25,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -97,6 +98,8 @@ type BoardConfiguration struct {
 	VendorVersion string           `json:"vendorVersion"`
 	Devices       []DeviceResource `json:"devices"`
 	Resources     []BoardResource  `json:"resources"`
+	// host ports which services are allowed to publish, format: port[-port][/protocol]
+	PublishedPorts []string `json:"publishedPorts,omitempty"`
 }
 
 /*******************************************************************************
@@ -277,6 +280,27 @@ func (resourcemanager *ResourceManager) RequestBoardResourceByName(name string)
 	return boardResource, aoserrors.Errorf("resource is not present in board configuration")
 }
 
+// CheckPublishedPort checks that board config allows services to publish the host port
+func (resourcemanager *ResourceManager) CheckPublishedPort(port uint16, protocol string) (err error) {
+	resourcemanager.Lock()
+	defer resourcemanager.Unlock()
+
+	log.Debugf("ResourceManager: CheckPublishedPort(%d/%s)", port, protocol)
+
+	for _, portRange := range resourcemanager.boardConfiguration.PublishedPorts {
+		minPort, maxPort, rangeProtocol, err := parsePortRange(portRange)
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		if port >= minPort && port <= maxPort && protocol == rangeProtocol {
+			return nil
+		}
+	}
+
+	return aoserrors.Errorf("host port %d/%s is not allowed by board configuration", port, protocol)
+}
+
 // ReleaseDevice request to release device for service id
 func (resourcemanager *ResourceManager) ReleaseDevice(device string, serviceID string) (err error) {
 	resourcemanager.Lock()
@@ -447,6 +471,12 @@ func (resourcemanager *ResourceManager) validateBoardConfig(config BoardConfigur
 		return aoserrors.Wrap(err)
 	}
 
+	for _, portRange := range config.PublishedPorts {
+		if _, _, _, err = parsePortRange(portRange); err != nil {
+			return aoserrors.Wrap(err)
+		}
+	}
+
 	return nil
 }
 
@@ -504,6 +534,46 @@ func (resourcemanager *ResourceManager) getAvailableDeviceByName(
 	return deviceResource, aoserrors.Errorf("device is not presented at available resources")
 }
 
+// parsePortRange parses port range in format port[-port][/protocol], default protocol is tcp
+func parsePortRange(portRange string) (minPort, maxPort uint16, protocol string, err error) {
+	protocol = "tcp"
+
+	rangeConfig := strings.Split(portRange, "/")
+	if len(rangeConfig) > 2 {
+		return 0, 0, "", aoserrors.Errorf("unsupported port range format %s", portRange)
+	}
+
+	if len(rangeConfig) == 2 {
+		if protocol = rangeConfig[1]; protocol != "tcp" && protocol != "udp" {
+			return 0, 0, "", aoserrors.Errorf("unsupported port range protocol %s", protocol)
+		}
+	}
+
+	ports := strings.Split(rangeConfig[0], "-")
+	if len(ports) > 2 {
+		return 0, 0, "", aoserrors.Errorf("unsupported port range format %s", portRange)
+	}
+
+	values := make([]uint16, 0, len(ports))
+
+	for _, port := range ports {
+		value, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || value == 0 {
+			return 0, 0, "", aoserrors.Errorf("invalid port %s", port)
+		}
+
+		values = append(values, uint16(value))
+	}
+
+	minPort, maxPort = values[0], values[len(values)-1]
+
+	if minPort > maxPort {
+		return 0, 0, "", aoserrors.Errorf("invalid port range %s", portRange)
+	}
+
+	return minPort, maxPort, protocol, nil
+}
+
 func contains(arr []string, str string) bool {
 	for _, a := range arr {
 		if strings.Contains(a, str) {
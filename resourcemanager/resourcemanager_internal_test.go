@@ -339,6 +339,47 @@ func TestRequestBoardResourceByName(t *testing.T) {
 	}
 }
 
+func TestCheckPublishedPort(t *testing.T) {
+	if err := writeTestBoardConfigFile(`{
+	"formatVersion": 1,
+	"vendorVersion": "1.0",
+	"devices": [],
+	"publishedPorts": ["8080-8090", "5000/udp"]
+}`); err != nil {
+		t.Fatalf("Can't write resource configuration: %s", err)
+	}
+
+	rm, err := New(path.Join(tmpDir, "aos_board.cfg"), testAlertSender)
+	if err != nil {
+		t.Fatalf("Can't create resource manager: %s", err)
+	}
+
+	if err = rm.boardConfigError; err != nil {
+		t.Fatalf("Board config error: %s", err)
+	}
+
+	for _, port := range []struct {
+		port     uint16
+		protocol string
+		allowed  bool
+	}{
+		{8080, "tcp", true}, {8090, "tcp", true}, {8091, "tcp", false}, {8085, "udp", false},
+		{5000, "udp", true}, {5000, "tcp", false},
+	} {
+		if err = rm.CheckPublishedPort(port.port, port.protocol); (err == nil) != port.allowed {
+			t.Errorf("Wrong check result for port %d/%s: %v", port.port, port.protocol, err)
+		}
+	}
+
+	if _, err = rm.CheckBoardConfig(`{
+	"formatVersion": 1,
+	"vendorVersion": "2.0",
+	"publishedPorts": ["8090-8080"]
+}`); err == nil {
+		t.Error("Error expected for invalid published ports")
+	}
+}
+
 func TestRequestLimitDeviceResources(t *testing.T) {
 	if err := writeTestBoardConfigFile(createTestBoardConfigJSON("1.0")); err != nil {
 		t.Errorf("Can't write resource configuration")
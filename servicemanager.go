@@ -25,6 +25,7 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"strings"
 	"syscall"
 
 	"github.com/aoscloud/aos_common/aoserrors"
@@ -32,18 +33,25 @@ import (
 	"github.com/coreos/go-systemd/daemon"
 	"github.com/coreos/go-systemd/journal"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/aoscloud/aos_servicemanager/alerts"
+	extpb "github.com/aoscloud/aos_servicemanager/api/servicemanager/v1"
 	"github.com/aoscloud/aos_servicemanager/config"
 	"github.com/aoscloud/aos_servicemanager/database"
+	"github.com/aoscloud/aos_servicemanager/downloader"
 	"github.com/aoscloud/aos_servicemanager/iamclient"
 	"github.com/aoscloud/aos_servicemanager/launcher"
 	"github.com/aoscloud/aos_servicemanager/layermanager"
 	"github.com/aoscloud/aos_servicemanager/logging"
+	"github.com/aoscloud/aos_servicemanager/metrics"
 	"github.com/aoscloud/aos_servicemanager/monitoring"
 	"github.com/aoscloud/aos_servicemanager/networkmanager"
+	"github.com/aoscloud/aos_servicemanager/progress"
 	resource "github.com/aoscloud/aos_servicemanager/resourcemanager"
 	"github.com/aoscloud/aos_servicemanager/smserver"
+	"github.com/aoscloud/aos_servicemanager/utils/signature"
 )
 
 /*******************************************************************************
@@ -57,18 +65,31 @@ const dbFileName = "servicemanager.db"
  ******************************************************************************/
 
 type serviceManager struct {
-	cryptoContext   *cryptutils.CryptoContext
-	alerts          *alerts.Alerts
-	smServer        *smserver.SMServer
-	cfg             *config.Config
-	db              *database.Database
-	launcher        *launcher.Launcher
-	resourcemanager *resource.ResourceManager
-	logging         *logging.Logging
-	monitor         *monitoring.Monitor
-	network         *networkmanager.NetworkManager
-	iam             *iamclient.Client
-	layerMgr        *layermanager.LayerManager
+	cryptoContext     *cryptutils.CryptoContext
+	signatureVerifier *signature.Verifier
+	backupSigner      *signature.Signer
+	alerts            *alerts.Alerts
+	smServer          *smserver.SMServer
+	cfg               *config.Config
+	db                *database.Database
+	launcher          *launcher.Launcher
+	resourcemanager   *resource.ResourceManager
+	logging           *logging.Logging
+	monitor           *monitoring.Monitor
+	network           *networkmanager.NetworkManager
+	iam               *iamclient.Client
+	layerMgr          *layermanager.LayerManager
+	downloader        *downloader.Downloader
+	progress          *progress.Tracker
+	metrics           *metrics.Exporter
+}
+
+// smCommand requests running service manager to perform command line commands
+type smCommand struct {
+	cryptoContext *cryptutils.CryptoContext
+	iam           *iamclient.Client
+	connection    *grpc.ClientConn
+	client        extpb.SMExtServiceClient
 }
 
 type journalHook struct {
@@ -113,7 +134,7 @@ func cleanup(cfg *config.Config, dbFile string) {
 
 	log.Debug("Delete networks")
 
-	network, err := networkmanager.New(cfg, nil)
+	network, err := networkmanager.New(cfg, nil, nil)
 	if err != nil {
 		log.Errorf("Can't create network: %s", err)
 	}
@@ -123,6 +144,140 @@ func cleanup(cfg *config.Config, dbFile string) {
 	}
 }
 
+// runCommand performs backup, restore or bundle install command by running service manager
+func runCommand(cfg *config.Config, backupFile, restoreFile, bundleDir, services string, replace bool) (err error) {
+	command, err := newSMCommand(cfg)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer command.close()
+
+	var serviceIDs []string
+
+	if services != "" {
+		serviceIDs = strings.Split(services, ",")
+	}
+
+	switch {
+	case backupFile != "":
+		return command.backup(backupFile, serviceIDs)
+
+	case restoreFile != "":
+		return command.restore(restoreFile, serviceIDs)
+
+	default:
+		return command.installBundle(bundleDir, replace)
+	}
+}
+
+func newSMCommand(cfg *config.Config) (command *smCommand, err error) {
+	command = &smCommand{}
+
+	defer func() {
+		if err != nil {
+			command.close()
+			command = nil
+		}
+	}()
+
+	if command.cryptoContext, err = cryptutils.NewCryptoContext(cfg.CACert); err != nil {
+		return command, aoserrors.Wrap(err)
+	}
+
+	if command.iam, err = iamclient.New(cfg, command.cryptoContext, false); err != nil {
+		return command, aoserrors.Wrap(err)
+	}
+
+	certURL, keyURL, err := command.iam.GetCertKeyURL(cfg.CertStorage)
+	if err != nil {
+		return command, aoserrors.Wrap(err)
+	}
+
+	tlsConfig, err := command.cryptoContext.GetClientMutualTLSConfig(certURL, keyURL)
+	if err != nil {
+		return command, aoserrors.Wrap(err)
+	}
+
+	serverURL := cfg.SMServerURL
+
+	if strings.HasPrefix(serverURL, ":") {
+		serverURL = "localhost" + serverURL
+	}
+
+	if command.connection, err = grpc.Dial(serverURL,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))); err != nil {
+		return command, aoserrors.Wrap(err)
+	}
+
+	command.client = extpb.NewSMExtServiceClient(command.connection)
+
+	return command, nil
+}
+
+func (command *smCommand) close() {
+	if command.connection != nil {
+		command.connection.Close()
+	}
+
+	if command.iam != nil {
+		command.iam.Close()
+	}
+
+	if command.cryptoContext != nil {
+		command.cryptoContext.Close()
+	}
+}
+
+// backup creates backup archive, relative archive path is relative to backup dir
+func (command *smCommand) backup(archive string, serviceIDs []string) (err error) {
+	request := &extpb.BackupRequest{ArchivePath: archive, ServiceIds: serviceIDs}
+
+	result, err := command.client.BackupServices(context.Background(), request)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	log.WithFields(log.Fields{"archive": request.ArchivePath, "services": result.ServiceIds}).Info("Backup done")
+
+	return nil
+}
+
+// restore restores backup archive, relative archive path is relative to backup dir
+func (command *smCommand) restore(archive string, serviceIDs []string) (err error) {
+	request := &extpb.BackupRequest{ArchivePath: archive, ServiceIds: serviceIDs}
+
+	result, err := command.client.RestoreBackup(context.Background(), request)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	log.WithFields(log.Fields{"archive": request.ArchivePath, "services": result.ServiceIds}).Info("Restore done")
+
+	return nil
+}
+
+// installBundle installs offline bundle, relative bundle path is relative to bundle dir
+func (command *smCommand) installBundle(bundleDir string, replace bool) (err error) {
+	request := &extpb.InstallBundleRequest{BundlePath: bundleDir, Replace: replace}
+
+	result, err := command.client.InstallBundle(context.Background(), request)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	for _, service := range result.Services {
+		log.WithFields(log.Fields{
+			"serviceID": service.ServiceId, "aosVersion": service.AosVersion, "vendorVersion": service.VendorVersion,
+		}).Info("Bundle service installed")
+	}
+
+	log.WithFields(log.Fields{
+		"bundle": request.BundlePath, "boardConfigVersion": result.BoardConfigVersion,
+	}).Info("Bundle install done")
+
+	return nil
+}
+
 func newServiceManager(cfg *config.Config) (sm *serviceManager, err error) {
 	defer func() {
 		if err != nil {
@@ -168,7 +323,10 @@ func newServiceManager(cfg *config.Config) (sm *serviceManager, err error) {
 		}
 	}
 
-	if sm.layerMgr, err = layermanager.New(cfg, sm.db); err != nil {
+	sm.progress = progress.New()
+
+	// Create downloader
+	if sm.downloader, err = downloader.New(cfg); err != nil {
 		return sm, aoserrors.Wrap(err)
 	}
 
@@ -176,11 +334,27 @@ func newServiceManager(cfg *config.Config) (sm *serviceManager, err error) {
 		return sm, aoserrors.Wrap(err)
 	}
 
+	// Create image signature verifier
+	if sm.signatureVerifier, err = signature.New(cfg.ImageSignaturePolicy,
+		sm.cryptoContext.GetCACertPool()); err != nil {
+		return sm, aoserrors.Wrap(err)
+	}
+
+	if sm.layerMgr, err = layermanager.New(cfg, sm.db, sm.downloader, sm.progress,
+		sm.signatureVerifier); err != nil {
+		return sm, aoserrors.Wrap(err)
+	}
+
 	// Create IAM client
 	if sm.iam, err = iamclient.New(cfg, sm.cryptoContext, false); err != nil {
 		return sm, aoserrors.Wrap(err)
 	}
 
+	// Create backup signer
+	if sm.backupSigner, err = signature.NewSigner(sm.iam, sm.cryptoContext, cfg.CertStorage); err != nil {
+		return sm, aoserrors.Wrap(err)
+	}
+
 	// Create alerts
 	if sm.alerts, err = alerts.New(cfg, sm.db, sm.db); err != nil {
 		if err == alerts.ErrDisabled {
@@ -191,12 +365,12 @@ func newServiceManager(cfg *config.Config) (sm *serviceManager, err error) {
 	}
 
 	// Create network
-	if sm.network, err = networkmanager.New(cfg, sm.db); err != nil {
+	if sm.network, err = networkmanager.New(cfg, sm.db, sm.db); err != nil {
 		return sm, aoserrors.Wrap(err)
 	}
 
 	// Create monitor
-	if sm.monitor, err = monitoring.New(cfg, sm.alerts, sm.network); err != nil {
+	if sm.monitor, err = monitoring.New(cfg, sm.alerts, sm.network, sm.db); err != nil {
 		if err == monitoring.ErrDisabled {
 			log.Warn(err)
 		} else {
@@ -211,7 +385,8 @@ func newServiceManager(cfg *config.Config) (sm *serviceManager, err error) {
 
 	// Create launcher
 	if sm.launcher, err = launcher.New(cfg, sm.db, sm.layerMgr, sm.monitor,
-		sm.network, sm.resourcemanager, sm.iam); err != nil {
+		sm.network, sm.resourcemanager, sm.iam, sm.alerts, sm.downloader, sm.progress, sm.signatureVerifier,
+		sm.iam, sm.backupSigner); err != nil {
 		return sm, aoserrors.Wrap(err)
 	}
 
@@ -220,11 +395,21 @@ func newServiceManager(cfg *config.Config) (sm *serviceManager, err error) {
 		return sm, aoserrors.Wrap(err)
 	}
 
-	if sm.smServer, err = smserver.New(cfg, sm.launcher, sm.layerMgr,
-		sm.alerts, sm.monitor, sm.resourcemanager, sm.logging, sm.cryptoContext, sm.iam, false); err != nil {
+	if sm.smServer, err = smserver.New(cfg, sm.launcher, sm.layerMgr, sm.alerts, sm.monitor,
+		sm.resourcemanager, sm.logging, sm.db, sm.progress, sm.cryptoContext, sm.iam, sm.signatureVerifier,
+		false); err != nil {
 		return sm, aoserrors.Wrap(err)
 	}
 
+	// Create metrics exporter
+	if sm.metrics, err = sm.createMetricsExporter(); err != nil {
+		if err == metrics.ErrDisabled {
+			log.Warn(err)
+		} else {
+			return sm, aoserrors.Wrap(err)
+		}
+	}
+
 	if err = sm.checkConsistency(); err != nil {
 		log.Errorf("Consistency error: %s. Cleanup...", err)
 
@@ -259,7 +444,30 @@ func (sm *serviceManager) handleChannels(ctx context.Context) {
 	}
 }
 
+func (sm *serviceManager) createMetricsExporter() (exporter *metrics.Exporter, err error) {
+	var (
+		monitoringProvider metrics.MonitoringProvider
+		alertsProvider     metrics.AlertsProvider
+	)
+
+	// Monitor and alerts may be disabled: avoid passing typed nil pointers as interfaces
+	if sm.monitor != nil {
+		monitoringProvider = sm.monitor
+	}
+
+	if sm.alerts != nil {
+		alertsProvider = sm.alerts
+	}
+
+	return metrics.New(sm.cfg, monitoringProvider, sm.network, alertsProvider, sm.db, sm.launcher)
+}
+
 func (sm *serviceManager) close() {
+	// Close metrics exporter
+	if sm.metrics != nil {
+		sm.metrics.Close()
+	}
+
 	// Close logging
 	if sm.logging != nil {
 		sm.logging.Close()
@@ -275,6 +483,11 @@ func (sm *serviceManager) close() {
 		sm.launcher.Close()
 	}
 
+	// Close downloader
+	if sm.downloader != nil {
+		sm.downloader.Close()
+	}
+
 	// Close monitor
 	if sm.monitor != nil {
 		sm.monitor.Close()
@@ -364,6 +577,13 @@ func main() {
 	doCleanup := flag.Bool("reset", false, `Removes all services, wipes services and storages and remove DB`)
 	showVersion := flag.Bool("version", false, `Show service manager version`)
 	useJournal := flag.Bool("j", false, "output logs to systemd journal")
+	backupFile := flag.String("backup", "",
+		"backup services data of running service manager to signed archive in backup dir")
+	restoreFile := flag.String("restore", "",
+		"restore services data from signed archive in backup dir by running service manager")
+	services := flag.String("services", "", "comma separated IDs of services to backup or restore, all by default")
+	bundleDir := flag.String("bundle", "", "install offline bundle from dir in bundle dir by running service manager")
+	replace := flag.Bool("replace", false, "remove installed services and layers which are not in offline bundle")
 
 	flag.Parse()
 
@@ -400,6 +620,14 @@ func main() {
 		return
 	}
 
+	if *backupFile != "" || *restoreFile != "" || *bundleDir != "" {
+		if err = runCommand(cfg, *backupFile, *restoreFile, *bundleDir, *services, *replace); err != nil {
+			log.Fatalf("Command failed: %s", err)
+		}
+
+		return
+	}
+
 	sm, err := newServiceManager(cfg)
 	if err != nil {
 		log.Fatalf("Can't create service manager: %s", err)
@@ -0,0 +1,360 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smserver
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/aoscloud/aos_servicemanager/progress"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+// NotificationFilterKey gRPC metadata key used to subscribe only for specified notification types.
+// The value is comma separated list of notification types. All notifications are sent if key is not set.
+const NotificationFilterKey = "aos-notification-types"
+
+// Notification types
+const (
+	NotificationTypeAlert      = "alert"
+	NotificationTypeMonitoring = "monitoring"
+	NotificationTypeState      = "state"
+	NotificationTypeLog        = "log"
+	NotificationTypeProgress   = "progress"
+)
+
+const subscriberBufferSize = 64
+
+// filtered subscriber is disconnected if it doesn't read notifications during this number of sequential
+// notifications
+const maxDroppedNotifications = 256
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// notificationBroker reads notifications from providers and dispatches them to subscribers.
+// Providers channels are read only when there is at least one subscriber. If durable queue is set,
+// alerts, state and logs notifications are always read and stored in the queue. Install progress notifications are
+// not stored in the queue.
+// Subscribers never block the broker, so a stalled stream doesn't delay notifications of other subscribers.
+// Subscribers without filter are legacy SubscribeSMNotifications clients which expect stream without gaps: such
+// subscriber is disconnected as soon as its buffer overflows instead of dropping notifications. Lossless delivery
+// of alerts, state and logs is provided by the durable queue. Filtered subscribers notifications are dropped on
+// buffer overflow and the subscriber is disconnected if it doesn't read notifications for a long time.
+type notificationBroker struct {
+	sync.Mutex
+
+	queue *notificationQueue
+
+	alertChannel      <-chan *pb.Alert
+	monitoringChannel <-chan *pb.Monitoring
+	stateChannel      <-chan *pb.SMNotifications
+	logsChannel       <-chan *pb.LogData
+	progressChannel   <-chan *pb.Alert
+
+	subscribers        map[*notificationSubscriber]struct{}
+	subscribersChanged chan struct{}
+	closeChannel       chan struct{}
+	closeOnce          sync.Once
+}
+
+type notificationSubscriber struct {
+	// nil means all notification types
+	types map[string]bool
+	// buffered notifications
+	channel chan *pb.SMNotifications
+	// closed when subscriber is disconnected by broker as slow consumer
+	overflowChannel chan struct{}
+	// closed when subscriber is unsubscribed
+	doneChannel chan struct{}
+	// number of sequentially dropped notifications
+	dropped uint64
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func newNotificationBroker(alertChannel <-chan *pb.Alert, monitoringChannel <-chan *pb.Monitoring,
+	stateChannel <-chan *pb.SMNotifications, logsChannel <-chan *pb.LogData, progressChannel <-chan *pb.Alert,
+	queue *notificationQueue) (broker *notificationBroker) {
+	broker = &notificationBroker{
+		queue:              queue,
+		alertChannel:       alertChannel,
+		monitoringChannel:  monitoringChannel,
+		stateChannel:       stateChannel,
+		logsChannel:        logsChannel,
+		progressChannel:    progressChannel,
+		subscribers:        make(map[*notificationSubscriber]struct{}),
+		subscribersChanged: make(chan struct{}, 1),
+		closeChannel:       make(chan struct{}),
+	}
+
+	go broker.run()
+
+	return broker
+}
+
+func (broker *notificationBroker) close() {
+	broker.closeOnce.Do(func() { close(broker.closeChannel) })
+}
+
+func (broker *notificationBroker) subscribe(types map[string]bool) (subscriber *notificationSubscriber) {
+	broker.Lock()
+	defer broker.Unlock()
+
+	subscriber = &notificationSubscriber{
+		types:           types,
+		channel:         make(chan *pb.SMNotifications, subscriberBufferSize),
+		overflowChannel: make(chan struct{}),
+		doneChannel:     make(chan struct{}),
+	}
+
+	broker.subscribers[subscriber] = struct{}{}
+
+	log.WithField("subscribers", len(broker.subscribers)).Debug("Notification subscriber added")
+
+	broker.notifySubscribersChanged()
+
+	return subscriber
+}
+
+func (broker *notificationBroker) unsubscribe(subscriber *notificationSubscriber) {
+	broker.Lock()
+	defer broker.Unlock()
+
+	if _, ok := broker.subscribers[subscriber]; !ok {
+		return
+	}
+
+	delete(broker.subscribers, subscriber)
+	close(subscriber.doneChannel)
+
+	log.WithField("subscribers", len(broker.subscribers)).Debug("Notification subscriber removed")
+
+	broker.notifySubscribersChanged()
+}
+
+func (broker *notificationBroker) notifySubscribersChanged() {
+	select {
+	case broker.subscribersChanged <- struct{}{}:
+
+	default:
+	}
+}
+
+func (broker *notificationBroker) hasSubscribers() (result bool) {
+	broker.Lock()
+	defer broker.Unlock()
+
+	return len(broker.subscribers) != 0
+}
+
+func (broker *notificationBroker) run() {
+	for {
+		var (
+			alertChannel      <-chan *pb.Alert
+			monitoringChannel <-chan *pb.Monitoring
+			stateChannel      <-chan *pb.SMNotifications
+			logsChannel       <-chan *pb.LogData
+			progressChannel   <-chan *pb.Alert
+		)
+
+		// Keep notifications in providers channels until someone subscribes
+		hasSubscribers := broker.hasSubscribers()
+
+		if hasSubscribers {
+			monitoringChannel = broker.monitoringChannel
+			progressChannel = broker.progressChannel
+		}
+
+		if hasSubscribers || broker.queue != nil {
+			alertChannel = broker.alertChannel
+			stateChannel = broker.stateChannel
+			logsChannel = broker.logsChannel
+		}
+
+		select {
+		case alert, ok := <-alertChannel:
+			if !ok {
+				broker.alertChannel = nil
+				break
+			}
+
+			broker.publishDurable(&pb.SMNotifications{SMNotification: &pb.SMNotifications_Alert{Alert: alert}})
+
+		case monitoringData, ok := <-monitoringChannel:
+			if !ok {
+				broker.monitoringChannel = nil
+				break
+			}
+
+			broker.publish(&pb.SMNotifications{
+				SMNotification: &pb.SMNotifications_Monitoring{Monitoring: monitoringData},
+			})
+
+		case progressAlert, ok := <-progressChannel:
+			if !ok {
+				broker.progressChannel = nil
+				break
+			}
+
+			broker.publish(&pb.SMNotifications{SMNotification: &pb.SMNotifications_Alert{Alert: progressAlert}})
+
+		case stateMsg, ok := <-stateChannel:
+			if !ok {
+				broker.stateChannel = nil
+				break
+			}
+
+			broker.publishDurable(stateMsg)
+
+		case logs, ok := <-logsChannel:
+			if !ok {
+				broker.logsChannel = nil
+				break
+			}
+
+			broker.publishDurable(&pb.SMNotifications{SMNotification: &pb.SMNotifications_Log{Log: logs}})
+
+		case <-broker.subscribersChanged:
+
+		case <-broker.closeChannel:
+			return
+		}
+	}
+}
+
+func (broker *notificationBroker) publishDurable(notification *pb.SMNotifications) {
+	if broker.queue != nil {
+		broker.queue.add(notification)
+	}
+
+	broker.publish(notification)
+}
+
+// publish sends notification to subscribers without blocking.
+func (broker *notificationBroker) publish(notification *pb.SMNotifications) {
+	broker.Lock()
+	defer broker.Unlock()
+
+	notificationType := getNotificationType(notification)
+
+	for subscriber := range broker.subscribers {
+		if subscriber.types != nil && !subscriber.types[notificationType] {
+			continue
+		}
+
+		select {
+		case subscriber.channel <- notification:
+			subscriber.dropped = 0
+
+		default:
+			// subscriber without filter expects stream without gaps: disconnect it instead of dropping
+			if subscriber.types == nil {
+				log.Warn("Disconnect slow notification subscriber without filter")
+
+				broker.disconnectSubscriber(subscriber)
+
+				continue
+			}
+
+			subscriber.dropped++
+
+			if subscriber.dropped == 1 {
+				log.WithField("type", notificationType).Warn("Subscriber buffer is full, drop notifications")
+			}
+
+			if subscriber.dropped >= maxDroppedNotifications {
+				log.Warn("Disconnect slow notification subscriber")
+
+				broker.disconnectSubscriber(subscriber)
+			}
+		}
+	}
+}
+
+func (broker *notificationBroker) disconnectSubscriber(subscriber *notificationSubscriber) {
+	close(subscriber.overflowChannel)
+	delete(broker.subscribers, subscriber)
+}
+
+func getNotificationType(notification *pb.SMNotifications) (notificationType string) {
+	switch notification.GetSMNotification().(type) {
+	case *pb.SMNotifications_Alert:
+		if notification.GetAlert().GetTag() == progress.AlertTagInstallProgress {
+			return NotificationTypeProgress
+		}
+
+		return NotificationTypeAlert
+
+	case *pb.SMNotifications_Monitoring:
+		return NotificationTypeMonitoring
+
+	case *pb.SMNotifications_Log:
+		return NotificationTypeLog
+
+	default:
+		return NotificationTypeState
+	}
+}
+
+// getNotificationFilter returns requested notification types from stream metadata or nil if all types requested
+func getNotificationFilter(ctx context.Context) (types map[string]bool, err error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+
+	values := md.Get(NotificationFilterKey)
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	types = make(map[string]bool)
+
+	for _, value := range values {
+		for _, notificationType := range strings.Split(value, ",") {
+			notificationType = strings.TrimSpace(notificationType)
+
+			switch notificationType {
+			case NotificationTypeAlert, NotificationTypeMonitoring, NotificationTypeState, NotificationTypeLog,
+				NotificationTypeProgress:
+				types[notificationType] = true
+
+			case "":
+
+			default:
+				return nil, status.Errorf(codes.InvalidArgument, "unknown notification type: %s", notificationType)
+			}
+		}
+	}
+
+	return types, nil
+}
@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smserver
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+
+	"github.com/aoscloud/aos_servicemanager/progress"
+)
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestSlowSubscriber(t *testing.T) {
+	alertChannel := make(chan *pb.Alert)
+
+	broker := newNotificationBroker(alertChannel, nil, nil, nil, nil, nil)
+	defer broker.close()
+
+	slowSubscriber := broker.subscribe(map[string]bool{NotificationTypeAlert: true})
+	subscriber := broker.subscribe(map[string]bool{NotificationTypeAlert: true})
+
+	for i := 0; i < subscriberBufferSize+maxDroppedNotifications; i++ {
+		select {
+		case alertChannel <- &pb.Alert{Tag: "systemAlert"}:
+
+		case <-time.After(5 * time.Second):
+			t.Fatal("Broker is blocked")
+		}
+
+		select {
+		case <-subscriber.channel:
+
+		case <-time.After(5 * time.Second):
+			t.Fatal("Notification is not received")
+		}
+	}
+
+	select {
+	case <-slowSubscriber.overflowChannel:
+
+	case <-time.After(5 * time.Second):
+		t.Error("Slow subscriber is not disconnected")
+	}
+}
+
+func TestLosslessSubscriber(t *testing.T) {
+	alertChannel := make(chan *pb.Alert)
+
+	broker := newNotificationBroker(alertChannel, nil, nil, nil, nil, nil)
+	defer broker.close()
+
+	stalledSubscriber := broker.subscribe(nil)
+	subscriber := broker.subscribe(nil)
+
+	// stalled subscriber doesn't block broker and other subscribers
+	for i := 0; i < subscriberBufferSize+1; i++ {
+		select {
+		case alertChannel <- &pb.Alert{Tag: fmt.Sprintf("alert%d", i)}:
+
+		case <-time.After(5 * time.Second):
+			t.Fatal("Broker is blocked")
+		}
+
+		select {
+		case notification := <-subscriber.channel:
+			if tag := notification.GetAlert().GetTag(); tag != fmt.Sprintf("alert%d", i) {
+				t.Fatalf("Wrong notification: %s", tag)
+			}
+
+		case <-subscriber.overflowChannel:
+			t.Fatal("Subscriber is disconnected")
+
+		case <-time.After(5 * time.Second):
+			t.Fatal("Notification is not received")
+		}
+	}
+
+	// stalled subscriber is disconnected on first overflow, buffered notifications are without gaps
+	select {
+	case <-stalledSubscriber.overflowChannel:
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stalled subscriber is not disconnected")
+	}
+
+	for i := 0; i < subscriberBufferSize; i++ {
+		notification := <-stalledSubscriber.channel
+
+		if tag := notification.GetAlert().GetTag(); tag != fmt.Sprintf("alert%d", i) {
+			t.Fatalf("Wrong notification: %s", tag)
+		}
+	}
+}
+
+func TestFilterSubscriber(t *testing.T) {
+	alertChannel := make(chan *pb.Alert, 1)
+	monitoringChannel := make(chan *pb.Monitoring, 1)
+
+	broker := newNotificationBroker(alertChannel, monitoringChannel, nil, nil, nil, nil)
+	defer broker.close()
+
+	subscriber := broker.subscribe(map[string]bool{NotificationTypeMonitoring: true})
+
+	alertChannel <- &pb.Alert{Tag: "systemAlert"}
+	monitoringChannel <- &pb.Monitoring{}
+
+	select {
+	case notification := <-subscriber.channel:
+		if notification.GetMonitoring() == nil {
+			t.Errorf("Unexpected notification: %v", notification)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notification is not received")
+	}
+
+	select {
+	case notification := <-subscriber.channel:
+		t.Errorf("Unexpected notification: %v", notification)
+
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestProgressSubscriber(t *testing.T) {
+	alertChannel := make(chan *pb.Alert, 1)
+	progressChannel := make(chan *pb.Alert, 1)
+
+	broker := newNotificationBroker(alertChannel, nil, nil, nil, progressChannel, nil)
+	defer broker.close()
+
+	progressSubscriber := broker.subscribe(map[string]bool{NotificationTypeProgress: true})
+	alertSubscriber := broker.subscribe(map[string]bool{NotificationTypeAlert: true})
+
+	alertChannel <- &pb.Alert{Tag: "systemAlert"}
+	progressChannel <- &pb.Alert{Tag: progress.AlertTagInstallProgress}
+
+	for _, item := range []struct {
+		subscriber *notificationSubscriber
+		tag        string
+	}{
+		{progressSubscriber, progress.AlertTagInstallProgress},
+		{alertSubscriber, "systemAlert"},
+	} {
+		select {
+		case notification := <-item.subscriber.channel:
+			if notification.GetAlert().GetTag() != item.tag {
+				t.Errorf("Unexpected notification: %v", notification)
+			}
+
+		case <-time.After(5 * time.Second):
+			t.Fatal("Notification is not received")
+		}
+
+		select {
+		case notification := <-item.subscriber.channel:
+			t.Errorf("Unexpected notification: %v", notification)
+
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smserver
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+// number of notifications read from storage at once
+const notificationsReadLimit = 32
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// DurableNotification queued notification. Data contains protobuf encoded SMNotifications message.
+type DurableNotification struct {
+	Seq  uint64 `json:"seq"`
+	Data []byte `json:"data"`
+}
+
+// NotificationStorage provides API to store outbound notifications queue.
+type NotificationStorage interface {
+	AddNotification(data []byte, maxCount uint64) (seq uint64, err error)
+	GetNotifications(fromSeq uint64, limit uint64) (notifications []DurableNotification, err error)
+	RemoveNotifications(tillSeq uint64) (err error)
+}
+
+// notificationQueue persistent queue of alerts, state and logs notifications. Notifications are kept in
+// the storage until they are acknowledged by the durable subscriber. Only one durable subscriber is
+// supported: new subscription cancels the previous one.
+type notificationQueue struct {
+	sync.Mutex
+
+	storage  NotificationStorage
+	maxCount uint64
+	// closed and recreated on each added notification
+	addedChannel     chan struct{}
+	cancelSubscriber context.CancelFunc
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func newNotificationQueue(storage NotificationStorage, maxCount uint64) (queue *notificationQueue) {
+	return &notificationQueue{storage: storage, maxCount: maxCount, addedChannel: make(chan struct{})}
+}
+
+func (queue *notificationQueue) add(notification *pb.SMNotifications) {
+	data, err := proto.Marshal(notification)
+	if err != nil {
+		log.Errorf("Can't marshal notification: %s", err)
+
+		return
+	}
+
+	queue.Lock()
+	defer queue.Unlock()
+
+	seq, err := queue.storage.AddNotification(data, queue.maxCount)
+	if err != nil {
+		log.Errorf("Can't store notification: %s", err)
+
+		return
+	}
+
+	log.WithField("seq", seq).Debug("Notification queued")
+
+	close(queue.addedChannel)
+	queue.addedChannel = make(chan struct{})
+}
+
+func (queue *notificationQueue) acknowledge(seq uint64) (err error) {
+	log.WithField("seq", seq).Debug("Notifications acknowledged")
+
+	return aoserrors.Wrap(queue.storage.RemoveNotifications(seq))
+}
+
+// subscribe replaces current durable subscriber. Returned context is canceled when subscriber is replaced.
+func (queue *notificationQueue) subscribe(ctx context.Context) (subscriberCtx context.Context) {
+	queue.Lock()
+	defer queue.Unlock()
+
+	if queue.cancelSubscriber != nil {
+		log.Warn("Replace durable notification subscriber")
+
+		queue.cancelSubscriber()
+	}
+
+	subscriberCtx, queue.cancelSubscriber = context.WithCancel(ctx)
+
+	return subscriberCtx
+}
+
+// getNotifications returns notifications after fromSeq and channel which is closed when new notification
+// is added to the queue.
+func (queue *notificationQueue) getNotifications(
+	fromSeq uint64) (notifications []DurableNotification, addedChannel <-chan struct{}, err error) {
+	queue.Lock()
+	defer queue.Unlock()
+
+	if notifications, err = queue.storage.GetNotifications(fromSeq, notificationsReadLimit); err != nil {
+		return nil, nil, aoserrors.Wrap(err)
+	}
+
+	return notifications, queue.addedChannel, nil
+}
+
+func (queue *notificationQueue) send(ctx context.Context, send func(notification *DurableNotification) error) (
+	err error) {
+	var lastSeq uint64
+
+	for {
+		notifications, addedChannel, err := queue.getNotifications(lastSeq)
+		if err != nil {
+			return err
+		}
+
+		for i := range notifications {
+			if err = send(&notifications[i]); err != nil {
+				return aoserrors.Wrap(err)
+			}
+
+			lastSeq = notifications[i].Seq
+		}
+
+		if len(notifications) != 0 {
+			continue
+		}
+
+		select {
+		case <-addedChannel:
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -20,6 +20,10 @@ package smserver
 import (
 	"context"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/aoscloud/aos_common/aoserrors"
 	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
@@ -27,10 +31,21 @@ import (
 	"github.com/golang/protobuf/ptypes/empty"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	extpb "github.com/aoscloud/aos_servicemanager/api/servicemanager/v1"
+	"github.com/aoscloud/aos_servicemanager/bundle"
 	"github.com/aoscloud/aos_servicemanager/config"
+	"github.com/aoscloud/aos_servicemanager/launcher"
+	"github.com/aoscloud/aos_servicemanager/layermanager"
+	"github.com/aoscloud/aos_servicemanager/monitoring"
+	"github.com/aoscloud/aos_servicemanager/progress"
 )
 
 /*******************************************************************************
@@ -48,6 +63,7 @@ import (
 // ServiceLauncher services launcher interface
 type ServiceLauncher interface {
 	SetUsers(users []string) (err error)
+	GetUsers() (users []string)
 	InstallService(serviceInfo *pb.InstallServiceRequest) (status *pb.ServiceStatus, err error)
 	UninstallService(removeReq *pb.RemoveServiceRequest) (err error)
 	GetServicesInfo() (services []*pb.ServiceStatus, err error)
@@ -57,12 +73,22 @@ type ServiceLauncher interface {
 	GetStateMessageChannel() (stateChannel <-chan *pb.SMNotifications)
 	RestartServices()
 	ProcessDesiredEnvVarsList(envVars []*pb.OverrideEnvVar) (status []*pb.EnvVarStatus, err error)
+	GetBlockedServices() (blockedServices []launcher.BlockedService)
+	ApplyDesiredState(services []*pb.InstallServiceRequest,
+		layers []*pb.InstallLayerRequest) (status []*pb.ServiceStatus, err error)
+	InstallServices(services []*pb.InstallServiceRequest,
+		layers []*pb.InstallLayerRequest) (status []*pb.ServiceStatus, err error)
+	GetServiceStateHistory(serviceID, subjectID string) (snapshots []launcher.StateSnapshot, err error)
+	RestoreServiceState(serviceID, subjectID, snapshotID string) (err error)
+	BackupServices(archivePath string, serviceIDs []string) (backedUp []string, err error)
+	RestoreServices(archivePath string, serviceIDs []string) (restored []string, err error)
 }
 
 // LayerProvider services layer manager interface
 type LayerProvider interface {
 	GetLayersInfo() (info []*pb.LayerStatus, err error)
 	InstallLayer(installInfo *pb.InstallLayerRequest) (err error)
+	CollectGarbage(dryRun bool) (report layermanager.GarbageReport, err error)
 }
 
 // AlertsProvider alert data provider interface
@@ -73,6 +99,8 @@ type AlertsProvider interface {
 // MonitoringDataProvider monitoring data provider interface
 type MonitoringDataProvider interface {
 	GetMonitoringDataChannel() (monitoringChannel <-chan *pb.Monitoring)
+	GetMonitoringHistory(serviceID string, from, till time.Time) (history []*pb.Monitoring, err error)
+	GetCurrentMonitoringData() (system *pb.SystemMonitoring, instances []monitoring.InstanceMonitoringData)
 }
 
 // BoardConfigProcessor board configuration handler
@@ -82,6 +110,11 @@ type BoardConfigProcessor interface {
 	UpdateBoardConfig(configJSON string) (err error)
 }
 
+// BundleVerifier verifies offline bundle manifest signature
+type BundleVerifier interface {
+	VerifySignature(fileName string) (err error)
+}
+
 // LogsProvider logs data provider interface
 type LogsProvider interface {
 	GetServiceLog(request *pb.ServiceLogRequest)
@@ -90,6 +123,12 @@ type LogsProvider interface {
 	GetLogsDataChannel() (channel <-chan *pb.LogData)
 }
 
+// ProgressProvider install progress provider interface
+type ProgressProvider interface {
+	GetProgressChannel() (channel <-chan *pb.Alert)
+	GetOperations() (operations []progress.Operation)
+}
+
 // CertificateProvider certificate and key provider interface
 type CertificateProvider interface {
 	GetCertKeyURL(keyType string) (certURL, keyURL string, err error)
@@ -104,12 +143,15 @@ type SMServer struct {
 	listener             net.Listener
 	boardConfigProcessor BoardConfigProcessor
 	logsProvider         LogsProvider
-	notificationStream   pb.SMService_SubscribeSMNotificationsServer
-	alertChannel         <-chan *pb.Alert
-	monitoringChannel    <-chan *pb.Monitoring
-	stateChannel         <-chan *pb.SMNotifications
-	logsChannel          <-chan *pb.LogData
+	monitoringProvider   MonitoringDataProvider
+	progressProvider     ProgressProvider
+	bundleVerifier       BundleVerifier
+	backupDir            string
+	bundleDir            string
+	notificationBroker   *notificationBroker
+	notificationQueue    *notificationQueue
 	pb.UnimplementedSMServiceServer
+	extpb.UnimplementedSMExtServiceServer
 }
 
 /*******************************************************************************
@@ -119,27 +161,41 @@ type SMServer struct {
 // New creates new IAM server instance.
 func New(cfg *config.Config, launcher ServiceLauncher, layerProvider LayerProvider, alertsProvider AlertsProvider,
 	monitoringProvider MonitoringDataProvider,
-	boardConfigProcessor BoardConfigProcessor, logsProvider LogsProvider, cryptcoxontext *cryptutils.CryptoContext,
-	certProvider CertificateProvider, insecure bool) (server *SMServer, err error) {
+	boardConfigProcessor BoardConfigProcessor, logsProvider LogsProvider, notificationStorage NotificationStorage,
+	progressProvider ProgressProvider, cryptcoxontext *cryptutils.CryptoContext, certProvider CertificateProvider,
+	bundleVerifier BundleVerifier, insecure bool) (server *SMServer, err error) {
 	server = &SMServer{
 		launcher: launcher, layerProvider: layerProvider, boardConfigProcessor: boardConfigProcessor,
-		logsProvider: logsProvider,
+		logsProvider: logsProvider, progressProvider: progressProvider, bundleVerifier: bundleVerifier,
 	}
 
+	var (
+		alertChannel      <-chan *pb.Alert
+		monitoringChannel <-chan *pb.Monitoring
+		stateChannel      <-chan *pb.SMNotifications
+		logsChannel       <-chan *pb.LogData
+		progressChannel   <-chan *pb.Alert
+	)
+
 	if alertsProvider != nil {
-		server.alertChannel = alertsProvider.GetAlertsChannel()
+		alertChannel = alertsProvider.GetAlertsChannel()
 	}
 
 	if monitoringProvider != nil {
-		server.monitoringChannel = monitoringProvider.GetMonitoringDataChannel()
+		server.monitoringProvider = monitoringProvider
+		monitoringChannel = monitoringProvider.GetMonitoringDataChannel()
 	}
 
 	if launcher != nil {
-		server.stateChannel = launcher.GetStateMessageChannel()
+		stateChannel = launcher.GetStateMessageChannel()
 	}
 
 	if logsProvider != nil {
-		server.logsChannel = logsProvider.GetLogsDataChannel()
+		logsChannel = logsProvider.GetLogsDataChannel()
+	}
+
+	if progressProvider != nil {
+		progressChannel = progressProvider.GetProgressChannel()
 	}
 
 	var opts []grpc.ServerOption
@@ -161,10 +217,20 @@ func New(cfg *config.Config, launcher ServiceLauncher, layerProvider LayerProvid
 	}
 
 	server.url = cfg.SMServerURL
+	server.backupDir = cfg.BackupDir
+	server.bundleDir = cfg.BundleDir
+
+	if notificationStorage != nil && cfg.NotificationQueueSize != 0 {
+		server.notificationQueue = newNotificationQueue(notificationStorage, cfg.NotificationQueueSize)
+	}
+
+	server.notificationBroker = newNotificationBroker(alertChannel, monitoringChannel, stateChannel, logsChannel,
+		progressChannel, server.notificationQueue)
 
 	server.grpcServer = grpc.NewServer(opts...)
 
 	pb.RegisterSMServiceServer(server.grpcServer, server)
+	extpb.RegisterSMExtServiceServer(server.grpcServer, server)
 
 	return server, nil
 }
@@ -190,6 +256,8 @@ func (server *SMServer) Stop() {
 	if server.listener != nil {
 		server.listener.Close()
 	}
+
+	server.notificationBroker.close()
 }
 
 // GetUsersStatus gets current SM status for user.
@@ -278,13 +346,36 @@ func (server *SMServer) InstallLayer(ctx context.Context, layer *pb.InstallLayer
 	return &emptypb.Empty{}, server.layerProvider.InstallLayer(layer)
 }
 
-// SubscribeSMNotifications subscribes for SM notifications.
+// SubscribeSMNotifications subscribes for SM notifications. Multiple subscribers are supported.
+// Subscriber may request only specific notification types using NotificationFilterKey metadata. Subscriber without
+// filter receives all notifications without gaps and is disconnected as soon as it doesn't keep up, filtered
+// subscriber is disconnected if it doesn't read notifications for a long time. Use durable notifications to
+// receive alerts, state and logs without losses.
 func (server *SMServer) SubscribeSMNotifications(req *empty.Empty, stream pb.SMService_SubscribeSMNotificationsServer) (err error) {
-	server.notificationStream = stream
+	types, err := getNotificationFilter(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	subscriber := server.notificationBroker.subscribe(types)
+	defer server.notificationBroker.unsubscribe(subscriber)
 
-	server.handleChannels()
+	for {
+		select {
+		case notification := <-subscriber.channel:
+			if err := stream.Send(notification); err != nil {
+				log.Errorf("Can't send notification: %s", err)
 
-	return nil
+				return aoserrors.Wrap(err)
+			}
+
+		case <-subscriber.overflowChannel:
+			return status.Error(codes.ResourceExhausted, "subscriber doesn't read notifications")
+
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
 }
 
 // GetSystemLog gets system logs.
@@ -308,52 +399,383 @@ func (server *SMServer) GetServiceCrashLog(ctx context.Context, req *pb.ServiceL
 	return &emptypb.Empty{}, nil
 }
 
-/*******************************************************************************
- * private
- ******************************************************************************/
+// GetMonitoringHistory returns stored monitoring data within requested time range.
+func (server *SMServer) GetMonitoringHistory(ctx context.Context,
+	req *extpb.MonitoringHistoryRequest) (history *extpb.MonitoringHistory, err error) {
+	if server.monitoringProvider == nil {
+		return nil, aoserrors.New("monitoring is not available")
+	}
 
-func (server *SMServer) handleChannels() {
-	for {
-		select {
-		case alert := <-server.alertChannel:
-			alertNtf := &pb.SMNotifications_Alert{Alert: alert}
+	var from time.Time
 
-			if err := server.notificationStream.Send(&pb.SMNotifications{SMNotification: alertNtf}); err != nil {
-				log.Errorf("Can't send alert: %s ", err)
+	if req.From != nil {
+		from = req.From.AsTime()
+	}
 
-				return
-			}
+	till := time.Now()
+
+	if req.Till != nil {
+		till = req.Till.AsTime()
+	}
+
+	history = &extpb.MonitoringHistory{}
+
+	if history.Data, err = server.monitoringProvider.GetMonitoringHistory(req.ServiceId, from, till); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return history, nil
+}
+
+// GetInstancesMonitoring returns last polled system and service instances monitoring data. Unlike monitoring
+// notifications, it contains swap, number of processes and IO usage of each instance.
+func (server *SMServer) GetInstancesMonitoring(ctx context.Context,
+	req *emptypb.Empty) (monitoringData *extpb.InstancesMonitoring, err error) {
+	if server.monitoringProvider == nil {
+		return nil, aoserrors.New("monitoring is not available")
+	}
+
+	system, instances := server.monitoringProvider.GetCurrentMonitoringData()
+
+	monitoringData = &extpb.InstancesMonitoring{
+		SystemMonitoring: system, Instances: make([]*extpb.InstanceMonitoring, 0, len(instances)),
+	}
+
+	for _, instance := range instances {
+		monitoringData.Instances = append(monitoringData.Instances, &extpb.InstanceMonitoring{
+			InstanceId: instance.InstanceID,
+			ServiceId:  instance.ServiceID,
+			SubjectId:  instance.SubjectID,
+			Ram:        instance.RAM,
+			Cpu:        instance.CPU,
+			UsedDisk:   instance.UsedDisk,
+			InTraffic:  instance.InTraffic,
+			OutTraffic: instance.OutTraffic,
+			Swap:       instance.Swap,
+			Pids:       instance.Pids,
+			IoRead:     instance.IORead,
+			IoWrite:    instance.IOWrite,
+		})
+	}
+
+	return monitoringData, nil
+}
 
-		case monitoringData := <-server.monitoringChannel:
-			if err := server.notificationStream.Send(
-				&pb.SMNotifications{
-					SMNotification: &pb.SMNotifications_Monitoring{
-						Monitoring: monitoringData,
-					},
-				}); err != nil {
-				log.Errorf("Can't send monitoring notification: %s ", err)
+// SubscribeNotifications subscribes for durable notifications. All not acknowledged notifications are sent first.
+// Only one durable subscriber is supported: new subscription closes the previous one.
+func (server *SMServer) SubscribeNotifications(req *emptypb.Empty,
+	stream extpb.SMExtService_SubscribeNotificationsServer) (err error) {
+	if server.notificationQueue == nil {
+		return status.Error(codes.Unavailable, "notification queue is disabled")
+	}
 
-				return
+	return server.notificationQueue.send(server.notificationQueue.subscribe(stream.Context()),
+		func(notification *DurableNotification) (err error) {
+			durableNotification := &extpb.DurableNotification{
+				Seq: notification.Seq, Notification: &pb.SMNotifications{},
 			}
 
-		case stateMsg := <-server.stateChannel:
-			if err := server.notificationStream.Send(stateMsg); err != nil {
-				log.Errorf("Can't send state notification :%s ", err)
-				return
+			if err = proto.Unmarshal(notification.Data, durableNotification.Notification); err != nil {
+				return aoserrors.Wrap(err)
 			}
 
-		case logs := <-server.logsChannel:
-			if err := server.notificationStream.Send(
-				&pb.SMNotifications{
-					SMNotification: &pb.SMNotifications_Log{Log: logs},
-				}); err != nil {
-				log.Errorf("Can't send logs: %s ", err)
+			return stream.Send(durableNotification)
+		})
+}
+
+// AcknowledgeNotifications removes acknowledged notifications from the durable queue.
+func (server *SMServer) AcknowledgeNotifications(ctx context.Context,
+	ack *extpb.NotificationsAck) (ret *emptypb.Empty, err error) {
+	if server.notificationQueue == nil {
+		return nil, status.Error(codes.Unavailable, "notification queue is disabled")
+	}
+
+	return &emptypb.Empty{}, server.notificationQueue.acknowledge(ack.Seq)
+}
+
+// CollectLayersGarbage removes layers which are not used by installed services. In dry run mode
+// layers are not removed but only reported.
+func (server *SMServer) CollectLayersGarbage(ctx context.Context,
+	req *extpb.LayersGarbageRequest) (report *extpb.GarbageReport, err error) {
+	garbageReport, err := server.layerProvider.CollectGarbage(req.DryRun)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	report = &extpb.GarbageReport{
+		DryRun: garbageReport.DryRun, TotalSize: garbageReport.TotalSize, Layers: []*extpb.GarbageLayer{},
+	}
+
+	for _, layer := range garbageReport.Layers {
+		report.Layers = append(report.Layers, &extpb.GarbageLayer{
+			Digest: layer.Digest, Path: layer.Path, Size: layer.Size,
+		})
+	}
+
+	return report, nil
+}
+
+// GetBlockedServices returns services which are not started due to unsatisfied dependencies.
+func (server *SMServer) GetBlockedServices(ctx context.Context,
+	req *emptypb.Empty) (blocked *extpb.BlockedServices, err error) {
+	blocked = &extpb.BlockedServices{Services: []*extpb.BlockedService{}}
+
+	for _, service := range server.launcher.GetBlockedServices() {
+		blocked.Services = append(blocked.Services, &extpb.BlockedService{
+			ServiceId: service.ServiceID, SubjectId: service.SubjectID, BlockedBy: service.BlockedBy,
+		})
+	}
+
+	return blocked, nil
+}
+
+// ApplyDesiredState installs, updates and removes services and layers to match desired state. On any failure,
+// all changes are rolled back.
+func (server *SMServer) ApplyDesiredState(ctx context.Context,
+	state *extpb.DesiredState) (status *extpb.DesiredStateStatus, err error) {
+	services, err := server.launcher.ApplyDesiredState(state.Services, state.Layers)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return &extpb.DesiredStateStatus{Services: services}, nil
+}
+
+// GetStateHistory returns accepted state snapshots of service subject, the newest goes first.
+func (server *SMServer) GetStateHistory(ctx context.Context,
+	req *extpb.StateHistoryRequest) (history *extpb.StateHistory, err error) {
+	history = &extpb.StateHistory{Snapshots: []*extpb.StateSnapshot{}}
+
+	snapshots, err := server.launcher.GetServiceStateHistory(req.ServiceId, req.SubjectId)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	for _, snapshot := range snapshots {
+		history.Snapshots = append(history.Snapshots, &extpb.StateSnapshot{
+			Id: snapshot.ID, Timestamp: timestamppb.New(snapshot.Timestamp), Checksum: snapshot.Checksum,
+			Size: snapshot.Size,
+		})
+	}
+
+	return history, nil
+}
+
+// RestoreState restores service subject state from snapshot.
+func (server *SMServer) RestoreState(ctx context.Context,
+	req *extpb.RestoreStateRequest) (ret *emptypb.Empty, err error) {
+	ret = &emptypb.Empty{}
+
+	if err = server.launcher.RestoreServiceState(req.ServiceId, req.SubjectId, req.SnapshotId); err != nil {
+		return ret, aoserrors.Wrap(err)
+	}
+
+	return ret, nil
+}
+
+// BackupServices saves services data to signed archive on the unit.
+func (server *SMServer) BackupServices(ctx context.Context,
+	req *extpb.BackupRequest) (result *extpb.BackupResult, err error) {
+	if server.backupDir == "" {
+		return nil, aoserrors.New("backup dir is not configured")
+	}
+
+	if err = os.MkdirAll(server.backupDir, 0o700); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	archivePath, err := getConfinedPath(server.backupDir, req.ArchivePath)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	result = &extpb.BackupResult{ServiceIds: []string{}}
+
+	backedUp, err := server.launcher.BackupServices(archivePath, req.ServiceIds)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	result.ServiceIds = append(result.ServiceIds, backedUp...)
+
+	return result, nil
+}
+
+// RestoreBackup restores services data from signed archive on the unit.
+func (server *SMServer) RestoreBackup(ctx context.Context,
+	req *extpb.BackupRequest) (result *extpb.BackupResult, err error) {
+	if server.backupDir == "" {
+		return nil, aoserrors.New("backup dir is not configured")
+	}
+
+	archivePath, err := getConfinedPath(server.backupDir, req.ArchivePath)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	result = &extpb.BackupResult{ServiceIds: []string{}}
+
+	restored, err := server.launcher.RestoreServices(archivePath, req.ServiceIds)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	result.ServiceIds = append(result.ServiceIds, restored...)
+
+	return result, nil
+}
 
-				return
+// InstallBundle installs offline bundle from bundle dir: validates bundle and board config, sets bundle users,
+// installs bundle services and layers and updates board config. Installed services and layers which are not in the
+// bundle are removed only if replace is requested.
+func (server *SMServer) InstallBundle(ctx context.Context,
+	req *extpb.InstallBundleRequest) (result *extpb.InstallBundleResult, err error) {
+	if server.bundleDir == "" {
+		return nil, aoserrors.New("bundle dir is not configured")
+	}
+
+	bundlePath, err := getConfinedPath(server.bundleDir, req.BundlePath)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	log.WithFields(log.Fields{"path": bundlePath, "replace": req.Replace}).Info("Install bundle")
+
+	installBundle, err := bundle.Load(ctx, bundlePath, server.bundleVerifier)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	result = &extpb.InstallBundleResult{Services: []*pb.ServiceStatus{}}
+
+	updateBoardConfig := false
+
+	if installBundle.BoardConfig != "" {
+		if result.BoardConfigVersion, err = server.boardConfigProcessor.CheckBoardConfig(
+			installBundle.BoardConfig); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		updateBoardConfig = result.BoardConfigVersion != server.boardConfigProcessor.GetBoardConfigInfo()
+	}
+
+	if len(installBundle.Users) != 0 {
+		prevUsers := server.launcher.GetUsers()
+
+		if err = server.launcher.SetUsers(installBundle.Users); err != nil {
+			return nil, aoserrors.Wrap(err)
+		}
+
+		defer func() {
+			if err != nil {
+				if usersErr := server.launcher.SetUsers(prevUsers); usersErr != nil {
+					log.Errorf("Can't restore users: %s", usersErr)
+				}
 			}
+		}()
+	}
 
-		case <-server.notificationStream.Context().Done():
-			return
+	installServices := server.launcher.InstallServices
+
+	if req.Replace {
+		installServices = server.launcher.ApplyDesiredState
+	}
+
+	// services and layers are installed or rolled back in one transaction
+	services, err := installServices(installBundle.Services, installBundle.Layers)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	result.Services = append(result.Services, services...)
+
+	// board config is updated last, so it is not changed if bundle install fails
+	if updateBoardConfig {
+		if err = server.boardConfigProcessor.UpdateBoardConfig(installBundle.BoardConfig); err != nil {
+			return nil, aoserrors.Wrap(err)
 		}
+
+		server.launcher.RestartServices()
+	}
+
+	return result, nil
+}
+
+// GetInstallOperations returns in-flight service and layer install operations.
+func (server *SMServer) GetInstallOperations(ctx context.Context,
+	req *emptypb.Empty) (operations *extpb.InstallOperations, err error) {
+	operations = &extpb.InstallOperations{Operations: []*extpb.InstallOperation{}}
+
+	if server.progressProvider == nil {
+		return operations, nil
 	}
+
+	for _, operation := range server.progressProvider.GetOperations() {
+		operations.Operations = append(operations.Operations, &extpb.InstallOperation{
+			Type:       operation.Type,
+			Id:         operation.ID,
+			AosVersion: operation.AosVersion,
+			Phase:      operation.Phase,
+			Downloaded: operation.Downloaded,
+			Total:      operation.Total,
+			StartTime:  timestamppb.New(operation.StartTime),
+			UpdateTime: timestamppb.New(operation.UpdateTime),
+			Elapsed:    durationpb.New(operation.Elapsed.Duration),
+			Error:      operation.Error,
+		})
+	}
+
+	return operations, nil
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+// getConfinedPath returns path of the file inside base dir. Relative names are relative to base dir, names with
+// ".." elements and names which resolve out of base dir through symlinks are rejected.
+func getConfinedPath(baseDir, name string) (fileName string, err error) {
+	if name == "" {
+		return "", aoserrors.New("path is not specified")
+	}
+
+	for _, element := range strings.Split(filepath.ToSlash(name), "/") {
+		if element == ".." {
+			return "", aoserrors.Errorf("path should not contain parent dir elements: %s", name)
+		}
+	}
+
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(baseDir, name)
+	}
+
+	resolvedBaseDir, err := filepath.EvalSymlinks(baseDir)
+	if err != nil {
+		return "", aoserrors.Wrap(err)
+	}
+
+	// the file itself may not exist yet, so symlinks of its nearest existing parent are resolved
+	existingPath, remainingPath := filepath.Clean(name), ""
+
+	for {
+		resolvedPath, err := filepath.EvalSymlinks(existingPath)
+		if err == nil {
+			fileName = filepath.Join(resolvedPath, remainingPath)
+
+			break
+		}
+
+		if !os.IsNotExist(err) || existingPath == filepath.Dir(existingPath) {
+			return "", aoserrors.Wrap(err)
+		}
+
+		remainingPath = filepath.Join(filepath.Base(existingPath), remainingPath)
+		existingPath = filepath.Dir(existingPath)
+	}
+
+	if !strings.HasPrefix(fileName, resolvedBaseDir+string(os.PathSeparator)) {
+		return "", aoserrors.Errorf("path is out of %s: %s", baseDir, name)
+	}
+
+	return fileName, nil
 }
@@ -19,22 +19,35 @@ package smserver_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aoscloud/aos_common/aoserrors"
 	pb "github.com/aoscloud/aos_common/api/servicemanager/v1"
+	"github.com/aoscloud/aos_common/image"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/aoscloud/aos_servicemanager/alerts"
+	extpb "github.com/aoscloud/aos_servicemanager/api/servicemanager/v1"
+	"github.com/aoscloud/aos_servicemanager/bundle"
 	"github.com/aoscloud/aos_servicemanager/config"
+	"github.com/aoscloud/aos_servicemanager/launcher"
+	"github.com/aoscloud/aos_servicemanager/layermanager"
+	"github.com/aoscloud/aos_servicemanager/monitoring"
+	"github.com/aoscloud/aos_servicemanager/progress"
 	"github.com/aoscloud/aos_servicemanager/smserver"
 )
 
@@ -52,6 +65,8 @@ const (
 
 type testLauncher struct {
 	stateChannel chan *pb.SMNotifications
+	users        []string
+	replaced     bool
 }
 
 type testLayerManager struct{}
@@ -59,6 +74,7 @@ type testLayerManager struct{}
 type testClient struct {
 	connection *grpc.ClientConn
 	pbclient   pb.SMServiceClient
+	extclient  extpb.SMExtServiceClient
 }
 
 type testAlertProvider struct {
@@ -67,10 +83,21 @@ type testAlertProvider struct {
 
 type testMonitoringProvider struct {
 	monitoringChannel chan *pb.Monitoring
+	history           []*pb.Monitoring
+	instances         []monitoring.InstanceMonitoringData
 }
 
 type testResourceManager struct {
-	version string
+	version     string
+	boardConfig string
+}
+
+type testBundleVerifier struct{}
+
+type testNotificationStorage struct {
+	sync.Mutex
+	lastSeq       uint64
+	notifications []smserver.DurableNotification
 }
 
 /*******************************************************************************
@@ -110,7 +137,8 @@ func TestConnection(t *testing.T) {
 		SMServerURL: serverURL,
 	}
 
-	smServer, err := smserver.New(&smConfig, launcher, layerMgr, nil, nil, resourseManager, nil, nil, nil, true)
+	smServer, err := smserver.New(&smConfig, launcher, layerMgr, nil, nil, resourseManager, nil, nil, nil, nil, nil,
+		nil, true)
 	if err != nil {
 		t.Fatalf("Can't create SM server: %s", err)
 	}
@@ -179,7 +207,7 @@ func TestAlertNotifications(t *testing.T) {
 	testAlerts := &testAlertProvider{alertsChannel: make(chan *pb.Alert, 10)}
 
 	smServer, err := smserver.New(&smConfig, nil, nil, testAlerts, nil, nil,
-		nil, nil, nil, true)
+		nil, nil, nil, nil, nil, nil, true)
 	if err != nil {
 		t.Fatalf("Can't create: SM Server %s", err)
 	}
@@ -301,7 +329,7 @@ func TestMonitoringNotifications(t *testing.T) {
 
 	testMonitoring := &testMonitoringProvider{monitoringChannel: make(chan *pb.Monitoring, 10)}
 
-	smServer, err := smserver.New(&smConfig, nil, nil, nil, testMonitoring, nil, nil, nil, nil, true)
+	smServer, err := smserver.New(&smConfig, nil, nil, nil, testMonitoring, nil, nil, nil, nil, nil, nil, nil, true)
 	if err != nil {
 		t.Fatalf("Can't create: SM Server %s", err)
 	}
@@ -349,14 +377,15 @@ func TestMonitoringNotifications(t *testing.T) {
 	}
 }
 
-func TestServiceStateProcessing(t *testing.T) {
+func TestMultipleSubscribers(t *testing.T) {
 	smConfig := config.Config{
 		SMServerURL: serverURL,
 	}
 
-	launcher := &testLauncher{stateChannel: make(chan *pb.SMNotifications, 10)}
+	testAlerts := &testAlertProvider{alertsChannel: make(chan *pb.Alert, 10)}
+	testMonitoring := &testMonitoringProvider{monitoringChannel: make(chan *pb.Monitoring, 10)}
 
-	smServer, err := smserver.New(&smConfig, launcher, nil, nil, nil, nil, nil, nil, nil, true)
+	smServer, err := smserver.New(&smConfig, nil, nil, testAlerts, testMonitoring, nil, nil, nil, nil, nil, nil, nil, true)
 	if err != nil {
 		t.Fatalf("Can't create: SM Server %s", err)
 	}
@@ -377,141 +406,1058 @@ func TestServiceStateProcessing(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	notifications, err := client.pbclient.SubscribeSMNotifications(ctx, &emptypb.Empty{})
+	allNotifications, err := client.pbclient.SubscribeSMNotifications(ctx, &emptypb.Empty{})
 	if err != nil {
 		t.Fatalf("Can't subscribe: %s", err)
 	}
 
-	etalonNewStateMsg := &pb.NewServiceState{
-		CorrelationId: "corelationID",
-		ServiceState:  &pb.ServiceState{ServiceId: "serviecId1", StateChecksum: "someCheckSum", State: []byte("state1")},
+	// Stalled subscriber should not block others
+	if _, err = client.pbclient.SubscribeSMNotifications(ctx, &emptypb.Empty{}); err != nil {
+		t.Fatalf("Can't subscribe: %s", err)
 	}
 
-	launcher.stateChannel <- &pb.SMNotifications{
-		SMNotification: &pb.SMNotifications_NewServiceState{NewServiceState: etalonNewStateMsg},
+	monitoringNotifications, err := client.pbclient.SubscribeSMNotifications(
+		metadata.AppendToOutgoingContext(ctx, smserver.NotificationFilterKey, smserver.NotificationTypeMonitoring),
+		&emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("Can't subscribe: %s", err)
 	}
 
-	receiveNewSate, err := notifications.Recv()
+	// Wait subscribers are registered on server side
+	time.Sleep(500 * time.Millisecond)
+
+	alertToSend := &pb.Alert{Tag: "systemAlert", Source: "system"}
+	monitoringToSend := &pb.Monitoring{SystemMonitoring: &pb.SystemMonitoring{Ram: 10}}
+
+	testAlerts.alertsChannel <- alertToSend
+	testMonitoring.monitoringChannel <- monitoringToSend
+
+	for i := 0; i < 2; i++ {
+		notification, err := allNotifications.Recv()
+		if err != nil {
+			t.Fatalf("Can't receive notification: %s", err)
+		}
+
+		if notification.GetAlert() == nil && notification.GetMonitoring() == nil {
+			t.Errorf("Unexpected notification: %v", notification)
+		}
+	}
+
+	notification, err := monitoringNotifications.Recv()
 	if err != nil {
-		t.Errorf("Can't receive monitoring data: %s", err)
+		t.Fatalf("Can't receive notification: %s", err)
 	}
 
-	if !proto.Equal(receiveNewSate.GetNewServiceState(), etalonNewStateMsg) {
-		log.Error("received newSate data != sent data")
+	if !proto.Equal(notification.GetMonitoring(), monitoringToSend) {
+		t.Errorf("Unexpected notification: %v", notification)
 	}
 
-	etalonStateRequest := &pb.ServiceStateRequest{ServiceId: "serviceId2", Default: false}
+	invalidNotifications, err := client.pbclient.SubscribeSMNotifications(
+		metadata.AppendToOutgoingContext(ctx, smserver.NotificationFilterKey, "unknown"), &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("Can't subscribe: %s", err)
+	}
 
-	launcher.stateChannel <- &pb.SMNotifications{
-		SMNotification: &pb.SMNotifications_ServiceStateRequest{
-			ServiceStateRequest: etalonStateRequest,
-		},
+	if _, err = invalidNotifications.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Wrong error: %v", err)
 	}
+}
 
-	receivedSateRequest, err := notifications.Recv()
+func TestDurableNotifications(t *testing.T) {
+	smConfig := config.Config{
+		SMServerURL:           serverURL,
+		NotificationQueueSize: 10,
+	}
+
+	testAlerts := &testAlertProvider{alertsChannel: make(chan *pb.Alert, 10)}
+
+	smServer, err := smserver.New(&smConfig, nil, nil, testAlerts, nil, nil, nil, &testNotificationStorage{},
+		nil, nil, nil, nil, true)
 	if err != nil {
-		t.Errorf("Can't receive monitoring data: %s", err)
+		t.Fatalf("Can't create: SM Server %s", err)
 	}
 
-	if !proto.Equal(receivedSateRequest.GetServiceStateRequest(), etalonStateRequest) {
-		log.Error("received state request data != sent data")
+	go func() {
+		if err := smServer.Start(); err != nil {
+			t.Errorf("Can't start sm server")
+		}
+	}()
+	defer smServer.Stop()
+
+	client, err := newTestClient(serverURL)
+	if err != nil {
+		t.Fatalf("Can't create test client: %s", err)
 	}
-}
+	defer client.close()
 
-/*******************************************************************************
- * Interfaces
- ******************************************************************************/
+	// Alerts sent before subscription should be queued
+	for i := 1; i <= 3; i++ {
+		testAlerts.alertsChannel <- &pb.Alert{Tag: fmt.Sprintf("alert%d", i)}
+	}
 
-func (launcher *testLauncher) SetUsers(users []string) (err error) {
-	return nil
-}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
-func (launcher *testLauncher) GetServicesInfo() (currentServices []*pb.ServiceStatus, err error) {
-	currentServices = append(currentServices, &pb.ServiceStatus{ServiceId: "123"})
+	if err = receiveDurableNotifications(ctx, client, []string{"alert1", "alert2", "alert3"}); err != nil {
+		t.Errorf("Receive notifications error: %s", err)
+	}
 
-	return currentServices, nil
-}
+	if _, err = client.extclient.AcknowledgeNotifications(ctx, &extpb.NotificationsAck{Seq: 2}); err != nil {
+		t.Fatalf("Can't acknowledge notifications: %s", err)
+	}
 
-func (launcher *testLauncher) InstallService(serviceInfo *pb.InstallServiceRequest) (status *pb.ServiceStatus, err error) {
-	return &pb.ServiceStatus{ServiceId: serviceInfo.ServiceId, StateChecksum: "some state check sum"}, nil
-}
+	testAlerts.alertsChannel <- &pb.Alert{Tag: "alert4"}
 
-func (launcher *testLauncher) UninstallService(removeReq *pb.RemoveServiceRequest) (err error) {
-	return nil
+	// Not acknowledged notifications should be replayed after reconnect
+	if err = receiveDurableNotifications(ctx, client, []string{"alert3", "alert4"}); err != nil {
+		t.Errorf("Receive notifications error: %s", err)
+	}
 }
 
-func (launcher *testLauncher) StateAcceptance(acceptance *pb.StateAcceptance) (err error) {
-	return nil
-}
+func TestMonitoringHistory(t *testing.T) {
+	smConfig := config.Config{
+		SMServerURL: serverURL,
+	}
 
-func (launcher *testLauncher) SetServiceState(state *pb.ServiceState) (err error) {
-	return nil
-}
+	startTime := time.Now().Add(-time.Hour)
 
-func (launcher *testLauncher) GetStateMessageChannel() (channel <-chan *pb.SMNotifications) {
-	return launcher.stateChannel
-}
+	testMonitoring := &testMonitoringProvider{monitoringChannel: make(chan *pb.Monitoring, 10)}
 
-func (launcher *testLauncher) RestartServices() {}
+	for i := 0; i < 5; i++ {
+		testMonitoring.history = append(testMonitoring.history, &pb.Monitoring{
+			Timestamp:        timestamppb.New(startTime.Add(time.Duration(i) * time.Minute)),
+			SystemMonitoring: &pb.SystemMonitoring{Ram: uint64(i)},
+			ServiceMonitoring: []*pb.ServiceMonitoring{
+				{ServiceId: "service1", Ram: uint64(i)},
+				{ServiceId: "service2", Ram: uint64(i)},
+			},
+		})
+	}
 
-func (launcher *testLauncher) ProcessDesiredEnvVarsList(envVars []*pb.OverrideEnvVar) (status []*pb.EnvVarStatus, err error) {
-	return status, nil
-}
+	smServer, err := smserver.New(&smConfig, nil, nil, nil, testMonitoring, nil, nil, nil, nil, nil, nil, nil, true)
+	if err != nil {
+		t.Fatalf("Can't create: SM Server %s", err)
+	}
 
-func (launcher *testLauncher) GetServicesLayersInfoByUsers(users []string) (servicesInfo []*pb.ServiceStatus,
-	layersInfo []*pb.LayerStatus, err error) {
-	return servicesInfo, layersInfo, nil
-}
+	go func() {
+		if err := smServer.Start(); err != nil {
+			t.Errorf("Can't start sm server")
+		}
+	}()
+	defer smServer.Stop()
 
-func (layerMgr *testLayerManager) GetLayersInfo() (layersList []*pb.LayerStatus, err error) {
-	return layersList, nil
-}
+	client, err := newTestClient(serverURL)
+	if err != nil {
+		t.Fatalf("Can't create test client: %s", err)
+	}
+	defer client.close()
 
-func (layerMgr *testLayerManager) InstallLayer(installInfo *pb.InstallLayerRequest) (err error) {
-	return nil
-}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
-func (alerts *testAlertProvider) GetAlertsChannel() (channel <-chan *pb.Alert) {
-	return alerts.alertsChannel
-}
+	history, err := client.extclient.GetMonitoringHistory(ctx, &extpb.MonitoringHistoryRequest{
+		ServiceId: "service1",
+		From:      timestamppb.New(startTime.Add(1 * time.Minute)),
+		Till:      timestamppb.New(startTime.Add(3 * time.Minute)),
+	})
+	if err != nil {
+		t.Fatalf("Can't get monitoring history: %s", err)
+	}
 
-func (monitoring *testMonitoringProvider) GetMonitoringDataChannel() (channel <-chan *pb.Monitoring) {
-	return monitoring.monitoringChannel
-}
+	if len(history.Data) != 3 {
+		t.Fatalf("Wrong history samples count: %d", len(history.Data))
+	}
 
-func (resMgr *testResourceManager) GetBoardConfigInfo() (version string) {
-	return resMgr.version
-}
+	for i, sample := range history.Data {
+		if !proto.Equal(sample.GetTimestamp(), testMonitoring.history[i+1].GetTimestamp()) {
+			t.Errorf("Wrong sample timestamp: %s", sample.GetTimestamp().AsTime())
+		}
 
-func (resMgr *testResourceManager) CheckBoardConfig(configJSON string) (vendorVersion string, err error) {
-	return resMgr.version, nil
+		if sample.GetSystemMonitoring().GetRam() != uint64(i+1) {
+			t.Errorf("Wrong system RAM: %d", sample.GetSystemMonitoring().GetRam())
+		}
+
+		if len(sample.GetServiceMonitoring()) != 1 || sample.GetServiceMonitoring()[0].GetServiceId() != "service1" {
+			t.Errorf("Wrong service monitoring: %v", sample.GetServiceMonitoring())
+		}
+	}
 }
 
-func (resMgr *testResourceManager) UpdateBoardConfig(configJSON string) (err error) {
-	return nil
+func TestInstancesMonitoring(t *testing.T) {
+	smConfig := config.Config{
+		SMServerURL: serverURL,
+	}
+
+	testMonitoring := &testMonitoringProvider{
+		monitoringChannel: make(chan *pb.Monitoring, 10),
+		instances: []monitoring.InstanceMonitoringData{{
+			InstanceID: "instance1", ServiceID: "service1", SubjectID: "subject1",
+			RAM: 1, CPU: 2, Swap: 3, Pids: 4, IORead: 5, IOWrite: 6,
+		}},
+	}
+
+	smServer, err := smserver.New(&smConfig, nil, nil, nil, testMonitoring, nil, nil, nil, nil, nil, nil, nil, true)
+	if err != nil {
+		t.Fatalf("Can't create: SM Server %s", err)
+	}
+
+	go func() {
+		if err := smServer.Start(); err != nil {
+			t.Errorf("Can't start sm server")
+		}
+	}()
+	defer smServer.Stop()
+
+	client, err := newTestClient(serverURL)
+	if err != nil {
+		t.Fatalf("Can't create test client: %s", err)
+	}
+	defer client.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	monitoringData, err := client.extclient.GetInstancesMonitoring(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("Can't get instances monitoring: %s", err)
+	}
+
+	if monitoringData.GetSystemMonitoring().GetRam() != 1024 {
+		t.Errorf("Wrong system RAM: %d", monitoringData.GetSystemMonitoring().GetRam())
+	}
+
+	expectedInstance := &extpb.InstanceMonitoring{
+		InstanceId: "instance1", ServiceId: "service1", SubjectId: "subject1",
+		Ram: 1, Cpu: 2, Swap: 3, Pids: 4, IoRead: 5, IoWrite: 6,
+	}
+
+	if len(monitoringData.GetInstances()) != 1 || !proto.Equal(monitoringData.GetInstances()[0], expectedInstance) {
+		t.Errorf("Wrong instances monitoring: %v", monitoringData.GetInstances())
+	}
 }
 
-/*******************************************************************************
- * Private
- ******************************************************************************/
+func TestCollectLayersGarbage(t *testing.T) {
+	smConfig := config.Config{
+		SMServerURL: serverURL,
+	}
 
-func newTestClient(url string) (client *testClient, err error) {
-	client = &testClient{}
+	smServer, err := smserver.New(&smConfig, nil, &testLayerManager{}, nil, nil, nil, nil, nil, nil, nil, nil, nil, true)
+	if err != nil {
+		t.Fatalf("Can't create: SM Server %s", err)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	go func() {
+		if err := smServer.Start(); err != nil {
+			t.Errorf("Can't start sm server")
+		}
+	}()
+	defer smServer.Stop()
+
+	client, err := newTestClient(serverURL)
+	if err != nil {
+		t.Fatalf("Can't create test client: %s", err)
+	}
+	defer client.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	if client.connection, err = grpc.DialContext(ctx, url, grpc.WithInsecure(), grpc.WithBlock()); err != nil {
-		return nil, aoserrors.Wrap(err)
+	report, err := client.extclient.CollectLayersGarbage(ctx, &extpb.LayersGarbageRequest{DryRun: true})
+	if err != nil {
+		t.Fatalf("Can't collect layers garbage: %s", err)
 	}
 
-	client.pbclient = pb.NewSMServiceClient(client.connection)
+	if !report.DryRun || report.TotalSize != 1024 || len(report.Layers) != 1 ||
+		report.Layers[0].Digest != "sha256:1" || report.Layers[0].Path != "/layers/1" {
+		t.Errorf("Wrong garbage report: %+v", report)
+	}
+}
 
-	return client, nil
+func TestGetBlockedServices(t *testing.T) {
+	smConfig := config.Config{
+		SMServerURL: serverURL,
+	}
+
+	smServer, err := smserver.New(&smConfig, &testLauncher{}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, true)
+	if err != nil {
+		t.Fatalf("Can't create: SM Server %s", err)
+	}
+
+	go func() {
+		if err := smServer.Start(); err != nil {
+			t.Errorf("Can't start sm server")
+		}
+	}()
+	defer smServer.Stop()
+
+	client, err := newTestClient(serverURL)
+	if err != nil {
+		t.Fatalf("Can't create test client: %s", err)
+	}
+	defer client.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	blocked, err := client.extclient.GetBlockedServices(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("Can't get blocked services: %s", err)
+	}
+
+	if len(blocked.Services) != 1 || blocked.Services[0].ServiceId != "service1" ||
+		blocked.Services[0].SubjectId != "subject1" || len(blocked.Services[0].BlockedBy) != 1 ||
+		blocked.Services[0].BlockedBy[0] != "broker" {
+		t.Errorf("Wrong blocked services: %+v", blocked.Services)
+	}
 }
 
-func (client *testClient) close() {
-	if client.connection != nil {
-		client.connection.Close()
+func TestServiceStateHistory(t *testing.T) {
+	smConfig := config.Config{
+		SMServerURL: serverURL,
+	}
+
+	smServer, err := smserver.New(&smConfig, &testLauncher{}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, true)
+	if err != nil {
+		t.Fatalf("Can't create: SM Server %s", err)
 	}
+
+	go func() {
+		if err := smServer.Start(); err != nil {
+			t.Errorf("Can't start sm server")
+		}
+	}()
+	defer smServer.Stop()
+
+	client, err := newTestClient(serverURL)
+	if err != nil {
+		t.Fatalf("Can't create test client: %s", err)
+	}
+	defer client.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	history, err := client.extclient.GetStateHistory(ctx,
+		&extpb.StateHistoryRequest{ServiceId: "service1", SubjectId: "subject1"})
+	if err != nil {
+		t.Fatalf("Can't get state history: %s", err)
+	}
+
+	if len(history.Snapshots) != 2 || history.Snapshots[0].Id != "2" || history.Snapshots[1].Id != "1" {
+		t.Errorf("Wrong state history: %+v", history.Snapshots)
+	}
+
+	if _, err = client.extclient.RestoreState(ctx, &extpb.RestoreStateRequest{
+		ServiceId: "service1", SubjectId: "subject1", SnapshotId: "1",
+	}); err != nil {
+		t.Errorf("Can't restore state: %s", err)
+	}
+
+	if _, err = client.extclient.RestoreState(ctx, &extpb.RestoreStateRequest{
+		ServiceId: "service1", SubjectId: "subject1", SnapshotId: "3",
+	}); err == nil {
+		t.Error("Error expected for unknown snapshot")
+	}
+}
+
+func TestBackupServices(t *testing.T) {
+	backupDir, err := ioutil.TempDir("", "backup_")
+	if err != nil {
+		t.Fatalf("Can't create backup dir: %s", err)
+	}
+	defer os.RemoveAll(backupDir)
+
+	if err = os.Symlink("/tmp", path.Join(backupDir, "link")); err != nil {
+		t.Fatalf("Can't create symlink: %s", err)
+	}
+
+	smConfig := config.Config{
+		SMServerURL: serverURL,
+		BackupDir:   backupDir,
+	}
+
+	smServer, err := smserver.New(&smConfig, &testLauncher{}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, true)
+	if err != nil {
+		t.Fatalf("Can't create: SM Server %s", err)
+	}
+
+	go func() {
+		if err := smServer.Start(); err != nil {
+			t.Errorf("Can't start sm server")
+		}
+	}()
+	defer smServer.Stop()
+
+	client, err := newTestClient(serverURL)
+	if err != nil {
+		t.Fatalf("Can't create test client: %s", err)
+	}
+	defer client.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := client.extclient.BackupServices(ctx, &extpb.BackupRequest{ArchivePath: "backup.tar.gz"})
+	if err != nil {
+		t.Fatalf("Can't backup services: %s", err)
+	}
+
+	if len(result.ServiceIds) != 2 || result.ServiceIds[0] != "service1" || result.ServiceIds[1] != "service2" {
+		t.Errorf("Wrong backed up services: %v", result.ServiceIds)
+	}
+
+	if result, err = client.extclient.RestoreBackup(ctx, &extpb.BackupRequest{
+		ArchivePath: path.Join(backupDir, "backup.tar.gz"), ServiceIds: []string{"service2"},
+	}); err != nil {
+		t.Fatalf("Can't restore backup: %s", err)
+	}
+
+	if len(result.ServiceIds) != 1 || result.ServiceIds[0] != "service2" {
+		t.Errorf("Wrong restored services: %v", result.ServiceIds)
+	}
+
+	for _, archivePath := range []string{
+		"/tmp/backup.tar.gz", "../backup.tar.gz", "dir/../../backup.tar.gz", "link/backup.tar.gz", "",
+	} {
+		if _, err = client.extclient.BackupServices(ctx,
+			&extpb.BackupRequest{ArchivePath: archivePath}); err == nil {
+			t.Errorf("Error expected for archive path: %s", archivePath)
+		}
+
+		if _, err = client.extclient.RestoreBackup(ctx,
+			&extpb.BackupRequest{ArchivePath: archivePath}); err == nil {
+			t.Errorf("Error expected for archive path: %s", archivePath)
+		}
+	}
+}
+
+func TestInstallBundle(t *testing.T) {
+	bundlesDir, err := ioutil.TempDir("", "bundle_")
+	if err != nil {
+		t.Fatalf("Can't create bundles dir: %s", err)
+	}
+	defer os.RemoveAll(bundlesDir)
+
+	bundleDir := path.Join(bundlesDir, "bundle1")
+
+	if err = os.MkdirAll(bundleDir, 0o755); err != nil {
+		t.Fatalf("Can't create bundle dir: %s", err)
+	}
+
+	if err = ioutil.WriteFile(path.Join(bundleDir, "service1.tar.gz"), []byte("service1"), 0o600); err != nil {
+		t.Fatalf("Can't write service image: %s", err)
+	}
+
+	if err = ioutil.WriteFile(path.Join(bundleDir, "board_config.json"),
+		[]byte(`{"vendorVersion": "3.0"}`), 0o600); err != nil {
+		t.Fatalf("Can't write board config: %s", err)
+	}
+
+	fileInfo, err := image.CreateFileInfo(context.Background(), path.Join(bundleDir, "service1.tar.gz"))
+	if err != nil {
+		t.Fatalf("Can't create file info: %s", err)
+	}
+
+	bundleManifest := bundle.Manifest{
+		Version: 1,
+		Services: []bundle.ServiceManifest{{
+			ServiceID: "service1", AosVersion: 3,
+			FileManifest: bundle.FileManifest{
+				Path: "service1.tar.gz", Sha256: fmt.Sprintf("%x", fileInfo.Sha256),
+				Sha512: fmt.Sprintf("%x", fileInfo.Sha512), Size: fileInfo.Size,
+			},
+		}},
+		BoardConfig: "board_config.json",
+		Users:       []string{"subject1"},
+	}
+
+	writeBundleManifest(t, bundleDir, bundleManifest)
+
+	smConfig := config.Config{
+		SMServerURL: serverURL,
+		BundleDir:   bundlesDir,
+	}
+
+	bundleLauncher := &testLauncher{users: []string{"subject0"}}
+	resourceManager := &testResourceManager{version: "2.0"}
+
+	smServer, err := smserver.New(&smConfig, bundleLauncher, nil, nil, nil, resourceManager,
+		nil, nil, nil, nil, nil, &testBundleVerifier{}, true)
+	if err != nil {
+		t.Fatalf("Can't create: SM Server %s", err)
+	}
+
+	go func() {
+		if err := smServer.Start(); err != nil {
+			t.Errorf("Can't start sm server")
+		}
+	}()
+	defer smServer.Stop()
+
+	client, err := newTestClient(serverURL)
+	if err != nil {
+		t.Fatalf("Can't create test client: %s", err)
+	}
+	defer client.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := client.extclient.InstallBundle(ctx, &extpb.InstallBundleRequest{BundlePath: "bundle1"})
+	if err != nil {
+		t.Fatalf("Can't install bundle: %s", err)
+	}
+
+	if result.BoardConfigVersion != "3.0" || len(result.Services) != 1 ||
+		result.Services[0].ServiceId != "service1" || result.Services[0].AosVersion != 3 {
+		t.Errorf("Wrong install bundle result: %+v", result)
+	}
+
+	if bundleLauncher.replaced {
+		t.Error("Installed services should not be replaced")
+	}
+
+	if len(bundleLauncher.users) != 1 || bundleLauncher.users[0] != "subject1" {
+		t.Errorf("Wrong users: %v", bundleLauncher.users)
+	}
+
+	if resourceManager.boardConfig != `{"vendorVersion": "3.0"}` {
+		t.Errorf("Wrong board config: %s", resourceManager.boardConfig)
+	}
+
+	if _, err = client.extclient.InstallBundle(ctx,
+		&extpb.InstallBundleRequest{BundlePath: bundleDir, Replace: true}); err != nil {
+		t.Fatalf("Can't install bundle: %s", err)
+	}
+
+	if !bundleLauncher.replaced {
+		t.Error("Installed services should be replaced")
+	}
+
+	// failed install doesn't change users and board config
+
+	bundleLauncher.users = []string{"subject0"}
+	resourceManager.boardConfig = ""
+
+	bundleManifest.Layers = []bundle.LayerManifest{{
+		LayerID: "layer1", Digest: "sha256:1", FileManifest: bundleManifest.Services[0].FileManifest,
+	}}
+
+	writeBundleManifest(t, bundleDir, bundleManifest)
+
+	if _, err = client.extclient.InstallBundle(ctx, &extpb.InstallBundleRequest{BundlePath: "bundle1"}); err == nil {
+		t.Error("Error expected for failed layer install")
+	}
+
+	if len(bundleLauncher.users) != 1 || bundleLauncher.users[0] != "subject0" {
+		t.Errorf("Users should be restored: %v", bundleLauncher.users)
+	}
+
+	if resourceManager.boardConfig != "" {
+		t.Errorf("Board config should not be updated: %s", resourceManager.boardConfig)
+	}
+
+	if err = os.Symlink(os.TempDir(), path.Join(bundlesDir, "link")); err != nil {
+		t.Fatalf("Can't create symlink: %s", err)
+	}
+
+	for _, bundlePath := range []string{
+		"unknown", "../bundle1", bundlesDir + "/../bundle1", os.TempDir(), "link", "link/bundle1",
+	} {
+		if _, err = client.extclient.InstallBundle(ctx,
+			&extpb.InstallBundleRequest{BundlePath: bundlePath}); err == nil {
+			t.Errorf("Error expected for bundle path: %s", bundlePath)
+		}
+	}
+}
+
+func TestApplyDesiredState(t *testing.T) {
+	smConfig := config.Config{
+		SMServerURL: serverURL,
+	}
+
+	smServer, err := smserver.New(&smConfig, &testLauncher{}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, true)
+	if err != nil {
+		t.Fatalf("Can't create: SM Server %s", err)
+	}
+
+	go func() {
+		if err := smServer.Start(); err != nil {
+			t.Errorf("Can't start sm server")
+		}
+	}()
+	defer smServer.Stop()
+
+	client, err := newTestClient(serverURL)
+	if err != nil {
+		t.Fatalf("Can't create test client: %s", err)
+	}
+	defer client.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	status, err := client.extclient.ApplyDesiredState(ctx, &extpb.DesiredState{
+		Services: []*pb.InstallServiceRequest{
+			{ServiceId: "service1", AosVersion: 1, Users: &pb.Users{Users: []string{"user1"}}},
+			{ServiceId: "service2", AosVersion: 2, Users: &pb.Users{Users: []string{"user1"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Can't apply desired state: %s", err)
+	}
+
+	if len(status.Services) != 2 || status.Services[0].ServiceId != "service1" ||
+		status.Services[1].AosVersion != 2 {
+		t.Errorf("Wrong desired state status: %v", status.Services)
+	}
+
+	if _, err = client.extclient.ApplyDesiredState(ctx, &extpb.DesiredState{
+		Layers: []*pb.InstallLayerRequest{{Digest: "sha256:1"}},
+	}); err == nil {
+		t.Error("Error expected")
+	}
+}
+
+func TestInstallProgress(t *testing.T) {
+	smConfig := config.Config{
+		SMServerURL: serverURL,
+	}
+
+	tracker := progress.New()
+
+	smServer, err := smserver.New(&smConfig, nil, nil, nil, nil, nil, nil, nil, tracker, nil, nil, nil, true)
+	if err != nil {
+		t.Fatalf("Can't create: SM Server %s", err)
+	}
+
+	go func() {
+		if err := smServer.Start(); err != nil {
+			t.Errorf("Can't start sm server")
+		}
+	}()
+	defer smServer.Stop()
+
+	client, err := newTestClient(serverURL)
+	if err != nil {
+		t.Fatalf("Can't create test client: %s", err)
+	}
+	defer client.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	reporter := tracker.StartOperation(progress.OperationTypeService, "service1", 2)
+	reporter.SetPhase(progress.PhaseDownload)
+	reporter.SetDownloaded(512, 1024)
+
+	operations, err := client.extclient.GetInstallOperations(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("Can't get install operations: %s", err)
+	}
+
+	if len(operations.Operations) != 1 || operations.Operations[0].Id != "service1" ||
+		operations.Operations[0].Phase != progress.PhaseDownload || operations.Operations[0].Downloaded != 512 ||
+		operations.Operations[0].Total != 1024 {
+		t.Errorf("Wrong install operations: %+v", operations.Operations)
+	}
+
+	notifications, err := client.pbclient.SubscribeSMNotifications(
+		metadata.AppendToOutgoingContext(ctx, smserver.NotificationFilterKey, smserver.NotificationTypeProgress),
+		&emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("Can't subscribe: %s", err)
+	}
+
+	reporter.Finish(nil)
+
+	for _, phase := range []string{progress.PhaseDownload, progress.PhaseDone} {
+		notification, err := notifications.Recv()
+		if err != nil {
+			t.Fatalf("Can't receive notification: %s", err)
+		}
+
+		alert := notification.GetAlert()
+		if alert == nil || alert.GetTag() != progress.AlertTagInstallProgress || alert.GetSource() != "service1" {
+			t.Fatalf("Wrong progress notification: %v", notification)
+		}
+
+		var operation progress.Operation
+
+		if err = json.Unmarshal([]byte(alert.GetSystemAlert().GetMessage()), &operation); err != nil {
+			t.Fatalf("Can't unmarshal progress: %s", err)
+		}
+
+		if operation.Phase != phase {
+			t.Errorf("Wrong progress phase: %s", operation.Phase)
+		}
+	}
+
+	if operations, err = client.extclient.GetInstallOperations(ctx,
+		&emptypb.Empty{}); err != nil {
+		t.Fatalf("Can't get install operations: %s", err)
+	}
+
+	if len(operations.Operations) != 0 {
+		t.Errorf("Finished operation is not removed: %+v", operations.Operations)
+	}
+}
+
+func TestServiceStateProcessing(t *testing.T) {
+	smConfig := config.Config{
+		SMServerURL: serverURL,
+	}
+
+	launcher := &testLauncher{stateChannel: make(chan *pb.SMNotifications, 10)}
+
+	smServer, err := smserver.New(&smConfig, launcher, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, true)
+	if err != nil {
+		t.Fatalf("Can't create: SM Server %s", err)
+	}
+
+	go func() {
+		if err := smServer.Start(); err != nil {
+			t.Errorf("Can't start sm server")
+		}
+	}()
+	defer smServer.Stop()
+
+	client, err := newTestClient(serverURL)
+	if err != nil {
+		t.Fatalf("Can't create test client: %s", err)
+	}
+	defer client.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	notifications, err := client.pbclient.SubscribeSMNotifications(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("Can't subscribe: %s", err)
+	}
+
+	etalonNewStateMsg := &pb.NewServiceState{
+		CorrelationId: "corelationID",
+		ServiceState:  &pb.ServiceState{ServiceId: "serviecId1", StateChecksum: "someCheckSum", State: []byte("state1")},
+	}
+
+	launcher.stateChannel <- &pb.SMNotifications{
+		SMNotification: &pb.SMNotifications_NewServiceState{NewServiceState: etalonNewStateMsg},
+	}
+
+	receiveNewSate, err := notifications.Recv()
+	if err != nil {
+		t.Errorf("Can't receive monitoring data: %s", err)
+	}
+
+	if !proto.Equal(receiveNewSate.GetNewServiceState(), etalonNewStateMsg) {
+		log.Error("received newSate data != sent data")
+	}
+
+	etalonStateRequest := &pb.ServiceStateRequest{ServiceId: "serviceId2", Default: false}
+
+	launcher.stateChannel <- &pb.SMNotifications{
+		SMNotification: &pb.SMNotifications_ServiceStateRequest{
+			ServiceStateRequest: etalonStateRequest,
+		},
+	}
+
+	receivedSateRequest, err := notifications.Recv()
+	if err != nil {
+		t.Errorf("Can't receive monitoring data: %s", err)
+	}
+
+	if !proto.Equal(receivedSateRequest.GetServiceStateRequest(), etalonStateRequest) {
+		log.Error("received state request data != sent data")
+	}
+}
+
+/*******************************************************************************
+ * Interfaces
+ ******************************************************************************/
+
+func (launcher *testLauncher) SetUsers(users []string) (err error) {
+	launcher.users = users
+
+	return nil
+}
+
+func (launcher *testLauncher) GetUsers() (users []string) {
+	return launcher.users
+}
+
+func (launcher *testLauncher) GetServicesInfo() (currentServices []*pb.ServiceStatus, err error) {
+	currentServices = append(currentServices, &pb.ServiceStatus{ServiceId: "123"})
+
+	return currentServices, nil
+}
+
+func (launcher *testLauncher) InstallService(serviceInfo *pb.InstallServiceRequest) (status *pb.ServiceStatus, err error) {
+	return &pb.ServiceStatus{ServiceId: serviceInfo.ServiceId, StateChecksum: "some state check sum"}, nil
+}
+
+func (launcher *testLauncher) UninstallService(removeReq *pb.RemoveServiceRequest) (err error) {
+	return nil
+}
+
+func (launcher *testLauncher) StateAcceptance(acceptance *pb.StateAcceptance) (err error) {
+	return nil
+}
+
+func (launcher *testLauncher) SetServiceState(state *pb.ServiceState) (err error) {
+	return nil
+}
+
+func (launcher *testLauncher) GetStateMessageChannel() (channel <-chan *pb.SMNotifications) {
+	return launcher.stateChannel
+}
+
+func (launcher *testLauncher) RestartServices() {}
+
+func (launcher *testLauncher) ProcessDesiredEnvVarsList(envVars []*pb.OverrideEnvVar) (status []*pb.EnvVarStatus, err error) {
+	return status, nil
+}
+
+func (launcher *testLauncher) ApplyDesiredState(services []*pb.InstallServiceRequest,
+	layers []*pb.InstallLayerRequest) (status []*pb.ServiceStatus, err error) {
+	if status, err = launcher.InstallServices(services, layers); err != nil {
+		return nil, err
+	}
+
+	launcher.replaced = true
+
+	return status, nil
+}
+
+func (launcher *testLauncher) InstallServices(services []*pb.InstallServiceRequest,
+	layers []*pb.InstallLayerRequest) (status []*pb.ServiceStatus, err error) {
+	if len(layers) != 0 {
+		return nil, aoserrors.New("layer install failed")
+	}
+
+	for _, service := range services {
+		status = append(status, &pb.ServiceStatus{ServiceId: service.ServiceId, AosVersion: service.AosVersion})
+	}
+
+	return status, nil
+}
+
+func (*testLauncher) GetBlockedServices() (blockedServices []launcher.BlockedService) {
+	return []launcher.BlockedService{{ServiceID: "service1", SubjectID: "subject1", BlockedBy: []string{"broker"}}}
+}
+
+func (*testLauncher) GetServiceStateHistory(serviceID, subjectID string) (snapshots []launcher.StateSnapshot,
+	err error) {
+	return []launcher.StateSnapshot{{ID: "2", Size: 20}, {ID: "1", Size: 10}}, nil
+}
+
+func (*testLauncher) RestoreServiceState(serviceID, subjectID, snapshotID string) (err error) {
+	if snapshotID != "1" && snapshotID != "2" {
+		return aoserrors.Errorf("state snapshot %s not found", snapshotID)
+	}
+
+	return nil
+}
+
+func (*testLauncher) BackupServices(archivePath string, serviceIDs []string) (backedUp []string, err error) {
+	if len(serviceIDs) == 0 {
+		return []string{"service1", "service2"}, nil
+	}
+
+	return serviceIDs, nil
+}
+
+func (*testLauncher) RestoreServices(archivePath string, serviceIDs []string) (restored []string, err error) {
+	if len(serviceIDs) == 0 {
+		return []string{"service1", "service2"}, nil
+	}
+
+	return serviceIDs, nil
+}
+
+func (launcher *testLauncher) GetServicesLayersInfoByUsers(users []string) (servicesInfo []*pb.ServiceStatus,
+	layersInfo []*pb.LayerStatus, err error) {
+	return servicesInfo, layersInfo, nil
+}
+
+func (layerMgr *testLayerManager) GetLayersInfo() (layersList []*pb.LayerStatus, err error) {
+	return layersList, nil
+}
+
+func (layerMgr *testLayerManager) InstallLayer(installInfo *pb.InstallLayerRequest) (err error) {
+	return nil
+}
+
+func (layerMgr *testLayerManager) CollectGarbage(dryRun bool) (report layermanager.GarbageReport, err error) {
+	return layermanager.GarbageReport{
+		DryRun:    dryRun,
+		Layers:    []layermanager.GarbageLayer{{Digest: "sha256:1", Path: "/layers/1", Size: 1024}},
+		TotalSize: 1024,
+	}, nil
+}
+
+func (alerts *testAlertProvider) GetAlertsChannel() (channel <-chan *pb.Alert) {
+	return alerts.alertsChannel
+}
+
+func (monitoring *testMonitoringProvider) GetMonitoringDataChannel() (channel <-chan *pb.Monitoring) {
+	return monitoring.monitoringChannel
+}
+
+func (monitoring *testMonitoringProvider) GetMonitoringHistory(
+	serviceID string, from, till time.Time) (history []*pb.Monitoring, err error) {
+	for _, sample := range monitoring.history {
+		if sample.GetTimestamp().AsTime().Before(from) || sample.GetTimestamp().AsTime().After(till) {
+			continue
+		}
+
+		filtered := &pb.Monitoring{Timestamp: sample.GetTimestamp(), SystemMonitoring: sample.GetSystemMonitoring()}
+
+		for _, service := range sample.GetServiceMonitoring() {
+			if serviceID == "" || service.GetServiceId() == serviceID {
+				filtered.ServiceMonitoring = append(filtered.ServiceMonitoring, service)
+			}
+		}
+
+		history = append(history, filtered)
+	}
+
+	return history, nil
+}
+
+func (monitoring *testMonitoringProvider) GetCurrentMonitoringData() (
+	system *pb.SystemMonitoring, instances []monitoring.InstanceMonitoringData) {
+	return &pb.SystemMonitoring{Ram: 1024}, monitoring.instances
+}
+
+func (storage *testNotificationStorage) AddNotification(data []byte, maxCount uint64) (seq uint64, err error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	storage.lastSeq++
+
+	storage.notifications = append(storage.notifications, smserver.DurableNotification{
+		Seq: storage.lastSeq, Data: data,
+	})
+
+	if uint64(len(storage.notifications)) > maxCount {
+		storage.notifications = storage.notifications[uint64(len(storage.notifications))-maxCount:]
+	}
+
+	return storage.lastSeq, nil
+}
+
+func (storage *testNotificationStorage) GetNotifications(
+	fromSeq uint64, limit uint64) (notifications []smserver.DurableNotification, err error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	for _, notification := range storage.notifications {
+		if notification.Seq > fromSeq && uint64(len(notifications)) < limit {
+			notifications = append(notifications, notification)
+		}
+	}
+
+	return notifications, nil
+}
+
+func (storage *testNotificationStorage) RemoveNotifications(tillSeq uint64) (err error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	for len(storage.notifications) > 0 && storage.notifications[0].Seq <= tillSeq {
+		storage.notifications = storage.notifications[1:]
+	}
+
+	return nil
+}
+
+func (verifier *testBundleVerifier) VerifySignature(fileName string) (err error) {
+	return nil
+}
+
+func (resMgr *testResourceManager) GetBoardConfigInfo() (version string) {
+	return resMgr.version
+}
+
+func (resMgr *testResourceManager) CheckBoardConfig(configJSON string) (vendorVersion string, err error) {
+	var boardConfig struct {
+		VendorVersion string `json:"vendorVersion"`
+	}
+
+	if err = json.Unmarshal([]byte(configJSON), &boardConfig); err == nil && boardConfig.VendorVersion != "" {
+		return boardConfig.VendorVersion, nil
+	}
+
+	return resMgr.version, nil
+}
+
+func (resMgr *testResourceManager) UpdateBoardConfig(configJSON string) (err error) {
+	resMgr.boardConfig = configJSON
+
+	return nil
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func writeBundleManifest(t *testing.T, bundleDir string, bundleManifest bundle.Manifest) {
+	t.Helper()
+
+	manifest, err := json.Marshal(&bundleManifest)
+	if err != nil {
+		t.Fatalf("Can't marshal bundle manifest: %s", err)
+	}
+
+	if err = ioutil.WriteFile(path.Join(bundleDir, bundle.ManifestFileName), manifest, 0o600); err != nil {
+		t.Fatalf("Can't write bundle manifest: %s", err)
+	}
+}
+
+func newTestClient(url string) (client *testClient, err error) {
+	client = &testClient{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if client.connection, err = grpc.DialContext(ctx, url, grpc.WithInsecure(), grpc.WithBlock()); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	client.pbclient = pb.NewSMServiceClient(client.connection)
+	client.extclient = extpb.NewSMExtServiceClient(client.connection)
+
+	return client, nil
+}
+
+func (client *testClient) close() {
+	if client.connection != nil {
+		client.connection.Close()
+	}
+}
+
+func receiveDurableNotifications(ctx context.Context, client *testClient, tags []string) (err error) {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.extclient.SubscribeNotifications(streamCtx, &emptypb.Empty{})
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	for _, tag := range tags {
+		durableNotification, err := stream.Recv()
+		if err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+		notification := durableNotification.GetNotification()
+
+		if notification.GetAlert().GetTag() != tag {
+			return aoserrors.Errorf("wrong alert tag: %s", notification.GetAlert().GetTag())
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,241 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package signature creates and verifies detached signatures of image manifests, layer descriptors and backups
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/cryptutils"
+	log "github.com/sirupsen/logrus"
+)
+
+/*******************************************************************************
+ * Consts
+ ******************************************************************************/
+
+// FileSuffix suffix of detached signature file: signature of manifest.json is stored in manifest.json.sig.
+const FileSuffix = ".sig"
+
+// Signature verification policies.
+const (
+	// PolicyEnforce images without valid signature are rejected, default policy
+	PolicyEnforce = "enforce"
+	// PolicyWarn signature verification failures are logged only
+	PolicyWarn = "warn"
+	// PolicyOff signatures are not verified
+	PolicyOff = "off"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// Verifier verifies detached signatures against trust roots.
+type Verifier struct {
+	policy string
+	roots  *x509.CertPool
+}
+
+// signatureInfo detached signature file content
+type signatureInfo struct {
+	// PEM encoded signer certificate chain, signer certificate goes first
+	Certificates string `json:"certificates"`
+	// signature of SHA-256 digest of signed file: PKCS #1 v1.5 for RSA keys, ASN.1 DER for ECDSA keys
+	Signature []byte `json:"signature"`
+}
+
+// ecdsaSignature ASN.1 structure of ECDSA signature
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// New creates new signature verifier, enforce policy is used if policy is not set.
+func New(policy string, roots *x509.CertPool) (verifier *Verifier, err error) {
+	log.WithField("policy", policy).Debug("New signature verifier")
+
+	switch policy {
+	case "":
+		policy = PolicyEnforce
+
+	case PolicyEnforce, PolicyWarn, PolicyOff:
+
+	default:
+		return nil, aoserrors.Errorf("unsupported signature policy: %s", policy)
+	}
+
+	return &Verifier{policy: policy, roots: roots}, nil
+}
+
+// VerifySignature verifies detached signature of the file according to the verifier policy.
+func (verifier *Verifier) VerifySignature(fileName string) (err error) {
+	if verifier.policy == PolicyOff {
+		return nil
+	}
+
+	if err = verifyFile(fileName, verifier.roots, x509.ExtKeyUsageCodeSigning, nil); err != nil {
+		if verifier.policy == PolicyWarn {
+			log.WithField("file", fileName).Warnf("Signature verification failed: %s", err)
+
+			return nil
+		}
+
+		return aoserrors.Wrap(err)
+	}
+
+	log.WithField("file", fileName).Debug("Signature verified")
+
+	return nil
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+// verifyFile verifies signature of the file, signer certificate should have keyUsage and also requiredUsage
+// extended key usage which is not known by x509 package if it is set
+func verifyFile(fileName string, roots *x509.CertPool, keyUsage x509.ExtKeyUsage,
+	requiredUsage asn1.ObjectIdentifier) (err error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	return verifyReader(file, fileName+FileSuffix, roots, keyUsage, requiredUsage)
+}
+
+// verifyReader verifies content of the reader against detached signature file
+func verifyReader(reader io.Reader, signatureFile string, roots *x509.CertPool, keyUsage x509.ExtKeyUsage,
+	requiredUsage asn1.ObjectIdentifier) (err error) {
+	if roots == nil {
+		return aoserrors.New("trust roots are not configured")
+	}
+
+	signatureData, err := ioutil.ReadFile(signatureFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return aoserrors.New("signature not found")
+		}
+
+		return aoserrors.Wrap(err)
+	}
+
+	var signature signatureInfo
+
+	if err = json.Unmarshal(signatureData, &signature); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	certs, err := cryptutils.PEMToX509Cert([]byte(signature.Certificates))
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if requiredUsage != nil && !hasExtKeyUsage(certs[0], requiredUsage) {
+		return aoserrors.Errorf("signer certificate doesn't have %s extended key usage", requiredUsage)
+	}
+
+	intermediates := x509.NewCertPool()
+
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	if _, err = certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{keyUsage},
+	}); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	digest, err := getDigest(reader)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = verifyDigest(certs[0].PublicKey, digest, signature.Signature); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// getFileDigest calculates SHA-256 digest of the file without loading it into memory
+func getFileDigest(fileName string) (digest []byte, err error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	return getDigest(file)
+}
+
+// getDigest calculates SHA-256 digest of the reader content
+func getDigest(reader io.Reader) (digest []byte, err error) {
+	hash := sha256.New()
+
+	if _, err = io.Copy(hash, reader); err != nil {
+		return nil, aoserrors.Wrap(err)
+	}
+
+	return hash.Sum(nil), nil
+}
+
+func verifyDigest(publicKey crypto.PublicKey, digest, signatureData []byte) (err error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signatureData); err != nil {
+			return aoserrors.Wrap(err)
+		}
+
+	case *ecdsa.PublicKey:
+		var signature ecdsaSignature
+
+		if rest, err := asn1.Unmarshal(signatureData, &signature); err != nil || len(rest) != 0 ||
+			signature.R == nil || signature.S == nil {
+			return aoserrors.New("wrong ECDSA signature format")
+		}
+
+		if !ecdsa.Verify(key, digest, signature.R, signature.S) {
+			return aoserrors.New("ECDSA verification failure")
+		}
+
+	default:
+		return aoserrors.Errorf("public key type %T is not supported", publicKey)
+	}
+
+	return nil
+}
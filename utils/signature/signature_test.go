@@ -0,0 +1,392 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signature_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aoscloud/aos_common/utils/cryptutils"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aoscloud/aos_servicemanager/config"
+	"github.com/aoscloud/aos_servicemanager/utils/signature"
+)
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+type testSigner struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+type testCertProvider struct {
+	certURL string
+	keyURL  string
+}
+
+/*******************************************************************************
+ * Vars
+ ******************************************************************************/
+
+var tmpDir string
+
+/*******************************************************************************
+ * Main
+ ******************************************************************************/
+
+func TestMain(m *testing.M) {
+	var err error
+
+	if tmpDir, err = ioutil.TempDir("", "signature_"); err != nil {
+		log.Fatalf("Can't create tmp dir: %s", err)
+	}
+
+	ret := m.Run()
+
+	os.RemoveAll(tmpDir)
+
+	os.Exit(ret)
+}
+
+/*******************************************************************************
+ * Tests
+ ******************************************************************************/
+
+func TestVerifySignature(t *testing.T) {
+	ca := newTestSigner(t, nil, true, nil)
+	signer := newTestSigner(t, ca, false, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning})
+	tlsSigner := newTestSigner(t, ca, false, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+	untrusted := newTestSigner(t, newTestSigner(t, nil, true, nil), false,
+		[]x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	enforce, err := signature.New(signature.PolicyEnforce, roots)
+	if err != nil {
+		t.Fatalf("Can't create verifier: %s", err)
+	}
+
+	manifest := path.Join(tmpDir, "manifest.json")
+
+	writeFile(t, manifest, `{"schemaVersion": 2}`)
+
+	if err = enforce.VerifySignature(manifest); err == nil {
+		t.Error("Error expected for not signed file")
+	}
+
+	signer.sign(t, manifest)
+
+	if err = enforce.VerifySignature(manifest); err != nil {
+		t.Errorf("Can't verify signature: %s", err)
+	}
+
+	writeFile(t, manifest, `{"schemaVersion": 3}`)
+
+	if err = enforce.VerifySignature(manifest); err == nil {
+		t.Error("Error expected for modified file")
+	}
+
+	for _, wrongSigner := range []*testSigner{tlsSigner, untrusted} {
+		wrongSigner.sign(t, manifest)
+
+		if err = enforce.VerifySignature(manifest); err == nil {
+			t.Error("Error expected for wrong signer")
+		}
+	}
+
+	for _, policy := range []string{signature.PolicyWarn, signature.PolicyOff} {
+		verifier, err := signature.New(policy, roots)
+		if err != nil {
+			t.Fatalf("Can't create verifier: %s", err)
+		}
+
+		if err = verifier.VerifySignature(manifest); err != nil {
+			t.Errorf("Unexpected error for %s policy: %s", policy, err)
+		}
+	}
+
+	if _, err = signature.New("unknown", roots); err == nil {
+		t.Error("Error expected for unknown policy")
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	ca := newTestSigner(t, nil, true, nil)
+	signer := newTestSigner(t, ca, false, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	configFile := path.Join(tmpDir, "aos_servicemanager.cfg")
+
+	writeFile(t, configFile, `{"workingDir": "`+tmpDir+`"}`)
+
+	cfg, err := config.New(configFile)
+	if err != nil {
+		t.Fatalf("Can't create config: %s", err)
+	}
+
+	verifier, err := signature.New(cfg.ImageSignaturePolicy, roots)
+	if err != nil {
+		t.Fatalf("Can't create verifier: %s", err)
+	}
+
+	manifest := path.Join(tmpDir, "unsigned", "manifest.json")
+
+	if err = os.MkdirAll(path.Dir(manifest), 0o755); err != nil {
+		t.Fatalf("Can't create dir: %s", err)
+	}
+
+	writeFile(t, manifest, `{"schemaVersion": 2}`)
+
+	if err = verifier.VerifySignature(manifest); err == nil {
+		t.Error("Not signed manifest should be rejected by default")
+	}
+
+	signer.sign(t, manifest)
+
+	if err = verifier.VerifySignature(manifest); err != nil {
+		t.Errorf("Can't verify signature: %s", err)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	ca := newTestSigner(t, nil, true, nil)
+	unit := newTestSigner(t, ca, false, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		signature.DocumentSigningOID)
+	otherUnit := newTestSigner(t, ca, false, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth})
+
+	caFile := path.Join(tmpDir, "ca.pem")
+	certFile := path.Join(tmpDir, "unit.pem")
+	keyFile := path.Join(tmpDir, "unit.key")
+
+	writeFile(t, caFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})))
+	writeFile(t, certFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: unit.cert.Raw})))
+
+	keyData, err := x509.MarshalECPrivateKey(unit.key)
+	if err != nil {
+		t.Fatalf("Can't marshal key: %s", err)
+	}
+
+	writeFile(t, keyFile, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyData})))
+
+	cryptoContext, err := cryptutils.NewCryptoContext(caFile)
+	if err != nil {
+		t.Fatalf("Can't create crypto context: %s", err)
+	}
+	defer cryptoContext.Close()
+
+	signer, err := signature.NewSigner(&testCertProvider{certURL: "file://" + certFile, keyURL: "file://" + keyFile},
+		cryptoContext, "sm")
+	if err != nil {
+		t.Fatalf("Can't create signer: %s", err)
+	}
+
+	archive := path.Join(tmpDir, "backup.tar.gz")
+	linkTarget := path.Join(tmpDir, "link_target")
+
+	writeFile(t, archive, "backup data")
+	writeFile(t, linkTarget, "target data")
+
+	if err = signer.VerifyFile(archive); err == nil {
+		t.Error("Error expected for not signed file")
+	}
+
+	// certificate without document signing usage is not accepted
+	otherUnit.sign(t, archive)
+
+	if err = signer.VerifyFile(archive); err == nil {
+		t.Error("Error expected for certificate without document signing usage")
+	}
+
+	if err = os.Remove(archive + signature.FileSuffix); err != nil {
+		t.Fatalf("Can't remove signature: %s", err)
+	}
+
+	if err = os.Symlink(linkTarget, archive+signature.FileSuffix); err != nil {
+		t.Fatalf("Can't create symlink: %s", err)
+	}
+
+	if err = signer.SignFile(archive); err != nil {
+		t.Fatalf("Can't sign file: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(linkTarget)
+	if err != nil || string(data) != "target data" {
+		t.Errorf("Signature is written through symlink: %s, %v", data, err)
+	}
+
+	if err = signer.VerifyFile(archive); err != nil {
+		t.Errorf("Can't verify signature: %s", err)
+	}
+
+	// unit certificate is not allowed to sign images
+	enforce, err := signature.New(signature.PolicyEnforce, cryptoContext.GetCACertPool())
+	if err != nil {
+		t.Fatalf("Can't create verifier: %s", err)
+	}
+
+	if err = enforce.VerifySignature(archive); err == nil {
+		t.Error("Error expected for not code signing certificate")
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		t.Fatalf("Can't open file: %s", err)
+	}
+	defer file.Close()
+
+	if err = signer.Verify(archive, file); err != nil {
+		t.Errorf("Can't verify opened file: %s", err)
+	}
+
+	writeFile(t, archive, "modified backup data")
+
+	if err = signer.VerifyFile(archive); err == nil {
+		t.Error("Error expected for modified file")
+	}
+
+	if err = signer.Verify(archive, strings.NewReader("modified backup data")); err == nil {
+		t.Error("Error expected for modified content")
+	}
+
+	otherKeyData, err := x509.MarshalECPrivateKey(otherUnit.key)
+	if err != nil {
+		t.Fatalf("Can't marshal key: %s", err)
+	}
+
+	writeFile(t, certFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherUnit.cert.Raw})))
+	writeFile(t, keyFile, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: otherKeyData})))
+
+	if err = signer.SignFile(archive); err == nil {
+		t.Error("Error expected for certificate without document signing usage")
+	}
+}
+
+/*******************************************************************************
+ * Interfaces
+ ******************************************************************************/
+
+func (provider *testCertProvider) GetCertKeyURL(keyType string) (certURL, keyURL string, err error) {
+	return provider.certURL, provider.keyURL, nil
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+func newTestSigner(t *testing.T, issuer *testSigner, isCA bool, extKeyUsage []x509.ExtKeyUsage,
+	unknownExtKeyUsage ...asn1.ObjectIdentifier) (signer *testSigner) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Can't generate key: %s", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("Can't generate serial: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Aos test " + serial.String()},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           extKeyUsage,
+		UnknownExtKeyUsage:    unknownExtKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+
+	parent, parentKey := template, key
+
+	if issuer != nil {
+		parent, parentKey = issuer.cert, issuer.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Can't create certificate: %s", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Can't parse certificate: %s", err)
+	}
+
+	return &testSigner{cert: cert, key: key}
+}
+
+func (signer *testSigner) sign(t *testing.T, fileName string) {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("Can't read file: %s", err)
+	}
+
+	digest := sha256.Sum256(data)
+
+	signatureData, err := signer.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Can't sign file: %s", err)
+	}
+
+	content, err := json.Marshal(struct {
+		Certificates string `json:"certificates"`
+		Signature    []byte `json:"signature"`
+	}{
+		Certificates: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signer.cert.Raw})),
+		Signature:    signatureData,
+	})
+	if err != nil {
+		t.Fatalf("Can't marshal signature: %s", err)
+	}
+
+	writeFile(t, fileName+signature.FileSuffix, string(content))
+}
+
+func writeFile(t *testing.T, fileName, content string) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(fileName, []byte(content), 0o600); err != nil {
+		t.Fatalf("Can't write file: %s", err)
+	}
+}
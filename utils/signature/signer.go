@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Copyright (C) 2021 Renesas Electronics Corporation.
+// Copyright (C) 2021 EPAM Systems, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/aoscloud/aos_common/aoserrors"
+	"github.com/aoscloud/aos_common/utils/cryptutils"
+	log "github.com/sirupsen/logrus"
+)
+
+/*******************************************************************************
+ * Vars
+ ******************************************************************************/
+
+// DocumentSigningOID document signing extended key usage (RFC 9336), signer certificate of backups should have it.
+var DocumentSigningOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 36}
+
+/*******************************************************************************
+ * Types
+ ******************************************************************************/
+
+// CertProvider provides certificate and key URLs by certificate type.
+type CertProvider interface {
+	GetCertKeyURL(keyType string) (certURL, keyURL string, err error)
+}
+
+// Signer signs files with the unit key and verifies files signed by any unit of the same trust roots. Signer
+// certificate should have document signing extended key usage.
+type Signer struct {
+	certProvider  CertProvider
+	cryptoContext *cryptutils.CryptoContext
+	certType      string
+}
+
+/*******************************************************************************
+ * Public
+ ******************************************************************************/
+
+// NewSigner creates new signer which uses key of certType certificate.
+func NewSigner(certProvider CertProvider, cryptoContext *cryptutils.CryptoContext,
+	certType string) (signer *Signer, err error) {
+	log.WithField("certType", certType).Debug("New signer")
+
+	if certProvider == nil || cryptoContext == nil {
+		return nil, aoserrors.New("certificate provider and crypto context should be set")
+	}
+
+	return &Signer{certProvider: certProvider, cryptoContext: cryptoContext, certType: certType}, nil
+}
+
+// SignFile creates detached signature of the file.
+func (signer *Signer) SignFile(fileName string) (err error) {
+	// certificate and key are loaded on each call as they may be renewed by IAM
+	certURL, keyURL, err := signer.certProvider.GetCertKeyURL(signer.certType)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	certs, err := signer.cryptoContext.LoadCertificateByURL(certURL)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if len(certs) == 0 {
+		return aoserrors.New("signer certificate not found")
+	}
+
+	if !hasExtKeyUsage(certs[0], DocumentSigningOID) {
+		return aoserrors.New("signer certificate doesn't have document signing extended key usage")
+	}
+
+	privKey, _, err := signer.cryptoContext.LoadPrivateKeyByURL(keyURL)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	key, ok := privKey.(crypto.Signer)
+	if !ok {
+		return aoserrors.New("key doesn't support signing")
+	}
+
+	switch key.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+
+	default:
+		return aoserrors.Errorf("key type %T is not supported", key.Public())
+	}
+
+	digest, err := getFileDigest(fileName)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	signatureData, err := key.Sign(rand.Reader, digest, crypto.SHA256)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	info := signatureInfo{Signature: signatureData}
+
+	for _, cert := range certs {
+		info.Certificates += string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	}
+
+	content, err := json.Marshal(&info)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	if err = writeSignatureFile(fileName+FileSuffix, content); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	log.WithField("file", fileName).Debug("File signed")
+
+	return nil
+}
+
+// VerifyFile verifies detached signature of the file. The signer certificate should be issued by the trust roots
+// and have document signing extended key usage.
+func (signer *Signer) VerifyFile(fileName string) (err error) {
+	if err = verifyFile(fileName, signer.cryptoContext.GetCACertPool(), x509.ExtKeyUsageAny,
+		DocumentSigningOID); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	log.WithField("file", fileName).Debug("Signature verified")
+
+	return nil
+}
+
+// Verify verifies content of the reader against detached signature of fileName. It allows to verify a file which
+// is already opened, so the verified content is exactly what is read afterwards from the same descriptor.
+func (signer *Signer) Verify(fileName string, reader io.Reader) (err error) {
+	if err = verifyReader(reader, fileName+FileSuffix, signer.cryptoContext.GetCACertPool(), x509.ExtKeyUsageAny,
+		DocumentSigningOID); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	log.WithField("file", fileName).Debug("Signature verified")
+
+	return nil
+}
+
+/*******************************************************************************
+ * Private
+ ******************************************************************************/
+
+// writeSignatureFile replaces existing signature file, new file is never written through symlink
+func writeSignatureFile(fileName string, content []byte) (err error) {
+	if err = os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+		return aoserrors.Wrap(err)
+	}
+
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY|syscall.O_NOFOLLOW, 0o600)
+	if err != nil {
+		return aoserrors.Wrap(err)
+	}
+	defer file.Close()
+
+	if _, err = file.Write(content); err != nil {
+		return aoserrors.Wrap(err)
+	}
+
+	return aoserrors.Wrap(file.Close())
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, oid asn1.ObjectIdentifier) (result bool) {
+	for _, usage := range cert.UnknownExtKeyUsage {
+		if usage.Equal(oid) {
+			return true
+		}
+	}
+
+	return false
+}